@@ -0,0 +1,62 @@
+package gozstd
+
+/*
+#cgo CFLAGS: -O3
+
+#define ZSTD_STATIC_LINKING_ONLY
+#include "zstd.h"
+*/
+import "C"
+
+// Batch compresses independent blocks reusing the compression context
+// and the output buffer between Compress calls.
+//
+// This allows compressing blocks without memory allocations in hot paths
+// at the cost of managing the lifetime of the returned compressed data.
+//
+// Batch cannot be used from concurrently running goroutines.
+type Batch struct {
+	cctx             *cctxWrapper
+	compressionLevel int
+	buf              []byte
+}
+
+// NewBatch returns new Batch compressing blocks with the given compressionLevel.
+//
+// Call Release when the Batch is no longer needed.
+func NewBatch(compressionLevel int) *Batch {
+	return &Batch{
+		cctx:             cctxPool.Get().(*cctxWrapper),
+		compressionLevel: compressionLevel,
+	}
+}
+
+// Compress returns compressed src.
+//
+// The returned slice points to the output buffer owned by b, so it is valid
+// only until the next Compress or Release call. Copy the returned slice
+// if it must be retained after that.
+func (b *Batch) Compress(src []byte) []byte {
+	if len(src) == 0 {
+		return b.buf[:0]
+	}
+	compressBound := int(C.ZSTD_compressBound(C.size_t(len(src))))
+	if cap(b.buf) < compressBound {
+		b.buf = make([]byte, compressBound)
+	}
+	result := compressInternal(b.cctx, nil, b.buf[:compressBound], src, nil, b.compressionLevel, true)
+	return b.buf[:result]
+}
+
+// Release returns the compression context to the pool and frees
+// the output buffer.
+//
+// b cannot be used after the release.
+func (b *Batch) Release() {
+	if b.cctx == nil {
+		return
+	}
+	cctxPool.Put(b.cctx)
+	b.cctx = nil
+	b.buf = nil
+}
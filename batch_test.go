@@ -0,0 +1,44 @@
+package gozstd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	b := NewBatch(5)
+	defer b.Release()
+
+	if result := b.Compress(nil); len(result) != 0 {
+		t.Fatalf("unexpected non-empty result for empty src: %q", result)
+	}
+
+	var srcs [][]byte
+	for i := 0; i < 100; i++ {
+		srcs = append(srcs, []byte(fmt.Sprintf("block %d %s", i, newTestString(100*i, 3))))
+	}
+	for _, src := range srcs {
+		compressed := b.Compress(src)
+		compressedExpected := CompressLevel(nil, src, 5)
+		if string(compressed) != string(compressedExpected) {
+			t.Fatalf("unexpected compressed data for block of %d bytes", len(src))
+		}
+		plainData, err := Decompress(nil, compressed)
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		if string(plainData) != string(src) {
+			t.Fatalf("unexpected data decompressed")
+		}
+	}
+
+	// Verify zero allocations in steady state.
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, src := range srcs {
+			b.Compress(src)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("unexpected number of allocations; got %f; want 0", allocs)
+	}
+}
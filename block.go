@@ -0,0 +1,202 @@
+package gozstd
+
+/*
+#cgo CFLAGS: -O3
+
+#define ZSTD_STATIC_LINKING_ONLY
+#define ZSTD_DISABLE_DEPRECATE_WARNINGS
+#include "zstd.h"
+#include "zstd_errors.h"
+
+#include <stdint.h>  // for uintptr_t
+
+// ZSTD_compressRawBlock_wrapper compresses src into a single raw block
+// using window as the history.
+//
+// The window is referenced by the temporary CDict, so it must be freed
+// before returning to Go.
+static size_t ZSTD_compressRawBlock_wrapper(uintptr_t ctx, uintptr_t dst, size_t dstCapacity, uintptr_t src, size_t srcSize, uintptr_t window, size_t windowSize, int compressionLevel) {
+    ZSTD_CCtx* cctx = (ZSTD_CCtx*)ctx;
+    ZSTD_CDict* cdict = NULL;
+    size_t rv;
+    if (windowSize == 0) {
+        rv = ZSTD_compressBegin(cctx, compressionLevel);
+    } else {
+        ZSTD_compressionParameters cParams = ZSTD_getCParams(compressionLevel, srcSize, windowSize);
+        cdict = ZSTD_createCDict_advanced((const void*)window, windowSize, ZSTD_dlm_byRef, ZSTD_dct_rawContent, cParams, ZSTD_defaultCMem);
+        if (cdict == NULL) {
+            return (size_t)-(int)ZSTD_error_memory_allocation;
+        }
+        rv = ZSTD_compressBegin_usingCDict(cctx, cdict);
+    }
+    if (!ZSTD_isError(rv)) {
+        rv = ZSTD_compressBlock(cctx, (void*)dst, dstCapacity, (const void*)src, srcSize);
+    }
+    ZSTD_freeCDict(cdict);
+    return rv;
+}
+
+// ZSTD_decompressRawBlock_wrapper decompresses a single raw block from src
+// using window as the history.
+static size_t ZSTD_decompressRawBlock_wrapper(uintptr_t ctx, uintptr_t dst, size_t dstCapacity, uintptr_t src, size_t srcSize, uintptr_t window, size_t windowSize) {
+    ZSTD_DCtx* dctx = (ZSTD_DCtx*)ctx;
+    size_t rv = ZSTD_decompressBegin(dctx);
+    if (ZSTD_isError(rv)) {
+        return rv;
+    }
+    if (windowSize > 0) {
+        rv = ZSTD_insertBlock(dctx, (const void*)window, windowSize);
+        if (ZSTD_isError(rv)) {
+            return rv;
+        }
+    }
+    return ZSTD_decompressBlock(dctx, (void*)dst, dstCapacity, (const void*)src, srcSize);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// MaxRawBlockSize is the maximum size of the data, which may be compressed
+// into a single raw block with CompressRawBlock.
+const MaxRawBlockSize = C.ZSTD_BLOCKSIZE_MAX
+
+// ErrIncompressibleBlock is returned from CompressRawBlock when the data
+// cannot be compressed into a raw block.
+//
+// The caller must store such data uncompressed, since DecompressRawBlock
+// doesn't accept uncompressed data.
+var ErrIncompressibleBlock = errors.New("the data cannot be compressed into a raw block")
+
+var cctxBlockPool = &sync.Pool{
+	New: newCCtx,
+}
+
+var dctxBlockPool = &sync.Pool{
+	New: newDCtx,
+}
+
+// CompressRawBlock compresses src into a raw zstd block using windowContent
+// as the history, appends the block to dst and returns the result.
+//
+// Raw blocks contain no frame header, no content size and no checksum,
+// so they are smaller than frames for tiny inputs. This is useful for
+// interoperability with systems storing headerless blocks. The following
+// constraints apply:
+//
+//   - len(src) mustn't exceed MaxRawBlockSize.
+//   - ErrIncompressibleBlock is returned if src cannot be compressed.
+//     Store src uncompressed in this case.
+//   - The caller must store the compressed size and the information
+//     whether the block is compressed, since the block doesn't contain it.
+//   - The block may be decompressed only with DecompressRawBlock
+//     using the same windowContent.
+//
+// windowContent may be empty. Only the tail of windowContent fitting
+// the window for the given compressionLevel is referenced by the block.
+//
+// zstd marks the block API as deprecated, so prefer Compress for inputs
+// exceeding a few hundred bytes, where the frame overhead is negligible.
+func CompressRawBlock(dst, src, windowContent []byte, compressionLevel int) ([]byte, error) {
+	if len(src) == 0 {
+		return dst, nil
+	}
+	if len(src) > MaxRawBlockSize {
+		return dst, fmt.Errorf("too big src size for raw block; got %d bytes; mustn't exceed %d bytes", len(src), MaxRawBlockSize)
+	}
+
+	dstLen := len(dst)
+	compressBound := int(C.ZSTD_compressBound(C.size_t(len(src))))
+	if n := dstLen + compressBound - cap(dst); n > 0 {
+		dst = append(dst[:cap(dst)], make([]byte, n)...)
+	}
+	buf := dst[dstLen : dstLen+compressBound]
+
+	var windowPtr *byte
+	if len(windowContent) > 0 {
+		windowPtr = &windowContent[0]
+	}
+	cctx := cctxBlockPool.Get().(*cctxWrapper)
+	result := C.ZSTD_compressRawBlock_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(cctx.cctx))),
+		C.uintptr_t(uintptr(unsafe.Pointer(&buf[0]))),
+		C.size_t(len(buf)),
+		C.uintptr_t(uintptr(unsafe.Pointer(&src[0]))),
+		C.size_t(len(src)),
+		C.uintptr_t(uintptr(unsafe.Pointer(windowPtr))),
+		C.size_t(len(windowContent)),
+		C.int(compressionLevel))
+	// Prevent from GC'ing of buf, src and windowContent during CGO call above.
+	runtime.KeepAlive(buf)
+	runtime.KeepAlive(src)
+	runtime.KeepAlive(windowContent)
+	cctxBlockPool.Put(cctx)
+
+	if err := checkError("ZSTD_compressBlock", result); err != nil {
+		return dst[:dstLen], err
+	}
+	if result == 0 {
+		return dst[:dstLen], ErrIncompressibleBlock
+	}
+	return dst[:dstLen+int(result)], nil
+}
+
+// DecompressRawBlock decompresses the raw zstd block from src using
+// windowContent as the history, appends the result to dst and returns it.
+//
+// src must contain a single block compressed with CompressRawBlock using
+// the same windowContent. Invalid data may be returned without an error
+// if windowContent differs from the one used for the compression, since raw
+// blocks contain no checksum.
+//
+// dst is reused without allocations if it has at least MaxRawBlockSize bytes
+// of spare capacity.
+func DecompressRawBlock(dst, src, windowContent []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return dst, nil
+	}
+
+	dstLen := len(dst)
+	grown := false
+	if n := dstLen + MaxRawBlockSize - cap(dst); n > 0 {
+		dst = append(dst[:cap(dst)], make([]byte, n)...)
+		grown = true
+	}
+	buf := dst[dstLen : dstLen+MaxRawBlockSize]
+
+	var windowPtr *byte
+	if len(windowContent) > 0 {
+		windowPtr = &windowContent[0]
+	}
+	dctx := dctxBlockPool.Get().(*dctxWrapper)
+	result := C.ZSTD_decompressRawBlock_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(dctx.dctx))),
+		C.uintptr_t(uintptr(unsafe.Pointer(&buf[0]))),
+		C.size_t(len(buf)),
+		C.uintptr_t(uintptr(unsafe.Pointer(&src[0]))),
+		C.size_t(len(src)),
+		C.uintptr_t(uintptr(unsafe.Pointer(windowPtr))),
+		C.size_t(len(windowContent)))
+	// Prevent from GC'ing of buf, src and windowContent during CGO call above.
+	runtime.KeepAlive(buf)
+	runtime.KeepAlive(src)
+	runtime.KeepAlive(windowContent)
+	dctxBlockPool.Put(dctx)
+
+	if C.ZSTD_getErrorCode(result) != 0 {
+		return dst[:dstLen], fmt.Errorf("decompression error: %s", errStr(result))
+	}
+	dst = dst[:dstLen+int(result)]
+	if grown && cap(dst)-len(dst) > 4096 {
+		// Re-allocate dst in order to remove superflouos capacity and reduce memory usage.
+		// Do not touch the capacity provided by the caller, so dst may be reused.
+		dst = append([]byte{}, dst...)
+	}
+	return dst, nil
+}
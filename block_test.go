@@ -0,0 +1,134 @@
+package gozstd
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestCompressDecompressRawBlock(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	window := make([]byte, 64*1024)
+	r.Read(window)
+
+	f := func(src, windowContent []byte, compressionLevel int) []byte {
+		t.Helper()
+		compressed, err := CompressRawBlock(nil, src, windowContent, compressionLevel)
+		if err != nil {
+			t.Fatalf("cannot compress raw block of %d bytes at level %d: %s", len(src), compressionLevel, err)
+		}
+		prefix := []byte("prefix")
+		plainData, err := DecompressRawBlock(prefix, compressed, windowContent)
+		if err != nil {
+			t.Fatalf("cannot decompress raw block of %d bytes at level %d: %s", len(src), compressionLevel, err)
+		}
+		if string(plainData[:len(prefix)]) != string(prefix) {
+			t.Fatalf("unexpected prefix; got %q; want %q", plainData[:len(prefix)], prefix)
+		}
+		if !bytes.Equal(plainData[len(prefix):], src) {
+			t.Fatalf("unexpected data decompressed at level %d; got %d bytes; want %d bytes", compressionLevel, len(plainData)-len(prefix), len(src))
+		}
+		return compressed
+	}
+
+	// Random data repeating the window must be compressible only with the window.
+	for _, level := range []int{1, DefaultCompressionLevel, 10, 19} {
+		for _, n := range []int{100, 1000, 16 * 1024, 40 * 1024} {
+			src := window[len(window)/3:][:n]
+			compressed := f(src, window, level)
+			if len(compressed) > len(src)/2 {
+				t.Fatalf("level=%d, n=%d: too big block compressed with the window; got %d bytes; want up to %d bytes",
+					level, n, len(compressed), len(src)/2)
+			}
+			if _, err := CompressRawBlock(nil, src, nil, level); err != ErrIncompressibleBlock {
+				t.Fatalf("level=%d, n=%d: unexpected error for the block compressed without the window; got %v; want %v",
+					level, n, err, ErrIncompressibleBlock)
+			}
+		}
+
+		// The block of the maximum size.
+		src := append([]byte{}, window...)
+		src = append(src, window...)
+		f(src[:MaxRawBlockSize], window, level)
+	}
+
+	// Successive blocks sharing the history.
+	var history []byte
+	for i := 0; i < 10; i++ {
+		src := []byte(newTestString(10*1024, 3))
+		if len(history) > 0 {
+			src = append(src, history[:1024]...)
+		}
+		compressed := f(src, history, DefaultCompressionLevel)
+		plainData, err := DecompressRawBlock(nil, compressed, history)
+		if err != nil {
+			t.Fatalf("cannot decompress block #%d: %s", i, err)
+		}
+		history = append(history, plainData...)
+	}
+
+	// dst with enough capacity must be reused.
+	src := window[:1000]
+	compressed, err := CompressRawBlock(nil, src, window, DefaultCompressionLevel)
+	if err != nil {
+		t.Fatalf("cannot compress raw block: %s", err)
+	}
+	buf := make([]byte, 0, 2*MaxRawBlockSize)
+	for i := 0; i < 3; i++ {
+		plainData, err := DecompressRawBlock(buf[:0], compressed, window)
+		if err != nil {
+			t.Fatalf("cannot decompress raw block: %s", err)
+		}
+		if !bytes.Equal(plainData, src) {
+			t.Fatalf("unexpected data decompressed; got %d bytes; want %d bytes", len(plainData), len(src))
+		}
+		if &plainData[0] != &buf[:1][0] || cap(plainData) != cap(buf) {
+			t.Fatalf("dst with enough capacity must be reused")
+		}
+	}
+
+	// Empty src.
+	compressed, err = CompressRawBlock([]byte("foo"), nil, window, DefaultCompressionLevel)
+	if err != nil {
+		t.Fatalf("unexpected error for empty src: %s", err)
+	}
+	if string(compressed) != "foo" {
+		t.Fatalf("unexpected result for empty src; got %q; want %q", compressed, "foo")
+	}
+}
+
+func TestCompressRawBlockInvalid(t *testing.T) {
+	// Too big src.
+	src := []byte(newTestString(MaxRawBlockSize+1, 3))
+	if _, err := CompressRawBlock(nil, src, nil, DefaultCompressionLevel); err == nil {
+		t.Fatalf("expecting non-nil error for too big src")
+	}
+
+	// Incompressible src.
+	r := rand.New(rand.NewSource(1))
+	src = make([]byte, 1000)
+	r.Read(src)
+	dst, err := CompressRawBlock([]byte("foo"), src, nil, DefaultCompressionLevel)
+	if err != ErrIncompressibleBlock {
+		t.Fatalf("unexpected error for incompressible src; got %v; want %v", err, ErrIncompressibleBlock)
+	}
+	if string(dst) != "foo" {
+		t.Fatalf("unexpected dst for incompressible src; got %q; want %q", dst, "foo")
+	}
+
+	// Garbage block.
+	if _, err := DecompressRawBlock(nil, []byte("foobarbaz"), nil); err == nil {
+		t.Fatalf("expecting non-nil error for invalid block")
+	}
+
+	// The block referring the window cannot be decompressed without the window.
+	window := []byte(newTestString(64*1024, 3))
+	compressed, err := CompressRawBlock(nil, window[:32*1024], window, DefaultCompressionLevel)
+	if err != nil {
+		t.Fatalf("cannot compress block: %s", err)
+	}
+	plainData, err := DecompressRawBlock(nil, compressed, nil)
+	if err == nil && bytes.Equal(plainData, window[:32*1024]) {
+		t.Fatalf("the block referring the window mustn't be decompressed properly without the window")
+	}
+}
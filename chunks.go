@@ -0,0 +1,107 @@
+package gozstd
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// CompressChunksFromReaderAt compresses size bytes from r in parallel
+// and returns the result.
+//
+// The data is split into chunks of chunkSize bytes. Every chunk is read
+// from r and compressed into a separate frame at the given compressionLevel
+// by one of the workers goroutines. The frames are concatenated in the order
+// of the chunks, so the result may be decompressed as a single stream
+// with Decompress or Reader. This parallelizes the compression of big
+// on-disk objects.
+//
+// Zero or negative workers means runtime.GOMAXPROCS(0) workers.
+// Every worker holds a chunk buffer, while all the compressed frames are
+// held in memory until they are concatenated.
+func CompressChunksFromReaderAt(r io.ReaderAt, size int64, chunkSize int, compressionLevel int, workers int) ([]byte, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("chunkSize must be positive; got %d", chunkSize)
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("size cannot be negative; got %d", size)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	chunks := int((size + int64(chunkSize) - 1) / int64(chunkSize))
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > chunks {
+		workers = chunks
+	}
+
+	frames := make([][]byte, chunks)
+	workCh := make(chan int, chunks)
+	for i := 0; i < chunks; i++ {
+		workCh <- i
+	}
+	close(workCh)
+
+	var errLock sync.Mutex
+	var firstErr error
+	hasErr := func() bool {
+		errLock.Lock()
+		ok := firstErr != nil
+		errLock.Unlock()
+		return ok
+	}
+	setErr := func(err error) {
+		errLock.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		errLock.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cctx := cctxPool.Get().(*cctxWrapper)
+			defer cctxPool.Put(cctx)
+			buf := make([]byte, chunkSize)
+			for idx := range workCh {
+				if hasErr() {
+					return
+				}
+				offset := int64(idx) * int64(chunkSize)
+				chunk := buf
+				if n := size - offset; n < int64(len(chunk)) {
+					chunk = chunk[:n]
+				}
+				n, err := r.ReadAt(chunk, offset)
+				if n < len(chunk) {
+					if err == nil || err == io.EOF {
+						err = io.ErrUnexpectedEOF
+					}
+					setErr(fmt.Errorf("cannot read chunk #%d of %d bytes at offset %d: %s", idx, len(chunk), offset, err))
+					return
+				}
+				frames[idx] = compress(cctx, nil, nil, chunk, nil, compressionLevel)
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	n := 0
+	for _, frame := range frames {
+		n += len(frame)
+	}
+	dst := make([]byte, 0, n)
+	for _, frame := range frames {
+		dst = append(dst, frame...)
+	}
+	return dst, nil
+}
@@ -0,0 +1,89 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCompressChunksFromReaderAt(t *testing.T) {
+	data := []byte(newTestString(3*1024*1024+123, 10))
+
+	f := func(size int64, chunkSize, workers int) {
+		t.Helper()
+		compressed, err := CompressChunksFromReaderAt(bytes.NewReader(data), size, chunkSize, DefaultCompressionLevel, workers)
+		if err != nil {
+			t.Fatalf("size=%d, chunkSize=%d, workers=%d: unexpected error: %s", size, chunkSize, workers, err)
+		}
+		plainData, err := Decompress(nil, compressed)
+		if err != nil {
+			t.Fatalf("size=%d, chunkSize=%d, workers=%d: cannot decompress data: %s", size, chunkSize, workers, err)
+		}
+		if !bytes.Equal(plainData, data[:size]) {
+			t.Fatalf("size=%d, chunkSize=%d, workers=%d: unexpected data decompressed; got %d bytes; want %d bytes",
+				size, chunkSize, workers, len(plainData), size)
+		}
+
+		// The result must be readable as a single stream.
+		zr := NewReader(bytes.NewReader(compressed))
+		plainData, err = ioutil.ReadAll(zr)
+		zr.Release()
+		if err != nil {
+			t.Fatalf("size=%d, chunkSize=%d, workers=%d: cannot read data: %s", size, chunkSize, workers, err)
+		}
+		if !bytes.Equal(plainData, data[:size]) {
+			t.Fatalf("size=%d, chunkSize=%d, workers=%d: unexpected data read; got %d bytes; want %d bytes",
+				size, chunkSize, workers, len(plainData), size)
+		}
+
+		expectedFrames := int((size + int64(chunkSize) - 1) / int64(chunkSize))
+		frames, err := CountFrames(compressed, false)
+		if err != nil {
+			t.Fatalf("cannot count frames: %s", err)
+		}
+		if frames != expectedFrames {
+			t.Fatalf("size=%d, chunkSize=%d, workers=%d: unexpected number of frames; got %d; want %d",
+				size, chunkSize, workers, frames, expectedFrames)
+		}
+	}
+	for _, workers := range []int{0, 1, 3, 100} {
+		f(0, 1024, workers)
+		f(1, 1024, workers)
+		f(1024, 1024, workers)
+		f(int64(len(data)), 1024*1024, workers)
+		f(int64(len(data)), 100*1024, workers)
+		f(int64(len(data)-1000), 333*1024, workers)
+	}
+}
+
+func TestCompressChunksFromReaderAtError(t *testing.T) {
+	data := []byte(newTestString(10*1024, 10))
+
+	// Invalid chunkSize.
+	if _, err := CompressChunksFromReaderAt(bytes.NewReader(data), int64(len(data)), 0, DefaultCompressionLevel, 1); err == nil {
+		t.Fatalf("expecting non-nil error for zero chunkSize")
+	}
+
+	// Negative size.
+	if _, err := CompressChunksFromReaderAt(bytes.NewReader(data), -1, 1024, DefaultCompressionLevel, 1); err == nil {
+		t.Fatalf("expecting non-nil error for negative size")
+	}
+
+	// size exceeding the data size.
+	if _, err := CompressChunksFromReaderAt(bytes.NewReader(data), int64(len(data))+1, 1024, DefaultCompressionLevel, 4); err == nil {
+		t.Fatalf("expecting non-nil error for size exceeding the data size")
+	}
+
+	// Read error.
+	_, err := CompressChunksFromReaderAt(errorReaderAt{}, int64(len(data)), 1024, DefaultCompressionLevel, 4)
+	if err == nil {
+		t.Fatalf("expecting non-nil error for failing reader")
+	}
+}
+
+type errorReaderAt struct{}
+
+func (errorReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return 0, fmt.Errorf("cannot read at offset %d", off)
+}
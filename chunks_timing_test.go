@@ -0,0 +1,23 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func BenchmarkCompressChunksFromReaderAt(b *testing.B) {
+	data := newBenchString(16 * 1024 * 1024)
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers_%d", workers), func(b *testing.B) {
+			r := bytes.NewReader(data)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := CompressChunksFromReaderAt(r, int64(len(data)), 1024*1024, DefaultCompressionLevel, workers); err != nil {
+					panic(fmt.Errorf("unexpected error: %s", err))
+				}
+			}
+		})
+	}
+}
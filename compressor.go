@@ -0,0 +1,149 @@
+package gozstd
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Compressor compresses data.
+//
+// Application code may accept Compressor instead of calling Compress*
+// functions directly, so distinct compressors may be injected,
+// e.g. a fake compressor in tests.
+//
+// CCtx, DictCompressor and WriterCompressor implement Compressor.
+type Compressor interface {
+	// Compress appends compressed src to dst and returns the result.
+	Compress(dst, src []byte) []byte
+}
+
+// CCtx is a reusable compression context.
+//
+// CCtx avoids obtaining the compression context from the shared pool
+// on every Compress call. CCtx cannot be used from concurrently running
+// goroutines.
+type CCtx struct {
+	cctx             *cctxWrapper
+	compressionLevel int
+}
+
+// NewCCtx returns new compression context compressing data
+// at the given compressionLevel.
+//
+// Call Release when the CCtx is no longer needed.
+//
+// NewCCtx blocks if the limit set via SetMaxConcurrentContexts is reached.
+func NewCCtx(compressionLevel int) *CCtx {
+	acquireContext()
+	cc := &CCtx{
+		cctx:             newCCtx().(*cctxWrapper),
+		compressionLevel: compressionLevel,
+	}
+	runtime.SetFinalizer(cc, (*CCtx).Release)
+	return cc
+}
+
+// Compress appends compressed src to dst and returns the result.
+func (cc *CCtx) Compress(dst, src []byte) []byte {
+	return compress(cc.cctx, nil, dst, src, nil, cc.compressionLevel)
+}
+
+// Release releases resources occupied by cc.
+//
+// cc cannot be used after the release.
+func (cc *CCtx) Release() {
+	if cc.cctx == nil {
+		return
+	}
+	runtime.SetFinalizer(cc, nil)
+	runtime.SetFinalizer(cc.cctx, nil)
+	freeCCtx(cc.cctx)
+	cc.cctx = nil
+	releaseContext()
+}
+
+// DictCompressor compresses data with the given dictionary.
+//
+// DictCompressor may be used from concurrently running goroutines.
+type DictCompressor struct {
+	cd *CDict
+}
+
+// NewDictCompressor returns new compressor compressing data with cd.
+//
+// cd mustn't be released while the returned compressor is in use.
+func NewDictCompressor(cd *CDict) *DictCompressor {
+	return &DictCompressor{
+		cd: cd,
+	}
+}
+
+// Compress appends compressed src to dst and returns the result.
+//
+// It is equivalent to CompressDict(dst, src, cd).
+func (dc *DictCompressor) Compress(dst, src []byte) []byte {
+	return CompressDict(dst, src, dc.cd)
+}
+
+// WriterCompressor compresses data with the streaming Writer.
+//
+// This allows using all the WriterParams for one-shot compression.
+// Every Compress call produces a single frame. WriterCompressor cannot be
+// used from concurrently running goroutines.
+type WriterCompressor struct {
+	zw     *Writer
+	params WriterParams
+	aw     appendWriter
+}
+
+// NewWriterCompressor returns new compressor compressing data
+// with the given params.
+//
+// Nil params means default parameters.
+//
+// Call Release when the WriterCompressor is no longer needed.
+func NewWriterCompressor(params *WriterParams) *WriterCompressor {
+	if params == nil {
+		params = &WriterParams{}
+	}
+	return &WriterCompressor{
+		zw:     NewWriterParams(nil, params),
+		params: *params,
+	}
+}
+
+// Compress appends compressed src to dst and returns the result.
+func (wc *WriterCompressor) Compress(dst, src []byte) []byte {
+	if len(src) == 0 {
+		return dst
+	}
+	wc.aw.b = dst
+	wc.zw.ResetWriterParams(&wc.aw, &wc.params)
+	if _, err := wc.zw.Write(src); err != nil {
+		panic(fmt.Errorf("BUG: unexpected error when writing data to the compressor: %s", err))
+	}
+	if err := wc.zw.Close(); err != nil {
+		panic(fmt.Errorf("BUG: unexpected error when closing the compressor: %s", err))
+	}
+	dst = wc.aw.b
+	wc.aw.b = nil
+	wc.zw.ResetWriterParams(nil, &wc.params)
+	return dst
+}
+
+// Release releases resources occupied by wc.
+//
+// wc cannot be used after the release.
+func (wc *WriterCompressor) Release() {
+	wc.zw.Release()
+}
+
+// appendWriter appends the written data to b.
+type appendWriter struct {
+	b []byte
+}
+
+func (aw *appendWriter) Write(p []byte) (int, error) {
+	aw.b = append(aw.b, p...)
+	return len(p), nil
+}
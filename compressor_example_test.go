@@ -0,0 +1,41 @@
+package gozstd
+
+import (
+	"fmt"
+	"log"
+)
+
+// noopCompressor is a fake Compressor, which stores data uncompressed.
+type noopCompressor struct{}
+
+func (noopCompressor) Compress(dst, src []byte) []byte {
+	return append(dst, src...)
+}
+
+// storeBlock accepts any Compressor, so the compressor may be injected
+// by the caller.
+func storeBlock(c Compressor, block []byte) []byte {
+	return c.Compress(nil, block)
+}
+
+func ExampleCompressor() {
+	block := []byte("foo bar baz foo bar baz")
+
+	// Inject the fake compressor, e.g. in tests.
+	stored := storeBlock(noopCompressor{}, block)
+	fmt.Printf("noop: %q\n", stored)
+
+	// Inject the real compressor.
+	cc := NewCCtx(DefaultCompressionLevel)
+	defer cc.Release()
+	stored = storeBlock(cc, block)
+	plainData, err := Decompress(nil, stored)
+	if err != nil {
+		log.Fatalf("cannot decompress block: %s", err)
+	}
+	fmt.Printf("zstd: %q\n", plainData)
+
+	// Output:
+	// noop: "foo bar baz foo bar baz"
+	// zstd: "foo bar baz foo bar baz"
+}
@@ -0,0 +1,74 @@
+package gozstd
+
+import (
+	"bytes"
+	"testing"
+)
+
+var (
+	_ Compressor = &CCtx{}
+	_ Compressor = &DictCompressor{}
+	_ Compressor = &WriterCompressor{}
+)
+
+func TestCompressor(t *testing.T) {
+	cd, dd := newTestShardDicts(t, "foo")
+	defer cd.Release()
+	defer dd.Release()
+
+	cc := NewCCtx(5)
+	defer cc.Release()
+	wc := NewWriterCompressor(&WriterParams{
+		CompressionLevel: 7,
+		WindowLog:        18,
+		Checksum:         true,
+	})
+	defer wc.Release()
+	wcDict := NewWriterCompressor(&WriterParams{
+		Dict: cd,
+	})
+	defer wcDict.Release()
+
+	f := func(c Compressor, dd *DDict) {
+		t.Helper()
+		for _, src := range [][]byte{
+			nil,
+			[]byte("foo sample number 1 for shard foo"),
+			[]byte(newTestString(1000, 3)),
+			[]byte(newTestString(1024*1024, 10)),
+		} {
+			prefix := []byte("prefix")
+			compressed := c.Compress(prefix, src)
+			if string(compressed[:len(prefix)]) != string(prefix) {
+				t.Fatalf("unexpected prefix for %T; got %q; want %q", c, compressed[:len(prefix)], prefix)
+			}
+			if len(src) == 0 && len(compressed) != len(prefix) {
+				t.Fatalf("unexpected data compressed by %T from empty src; got %d bytes; want 0 bytes", c, len(compressed)-len(prefix))
+			}
+			plainData, err := DecompressDict(nil, compressed[len(prefix):], dd)
+			if err != nil {
+				t.Fatalf("cannot decompress data compressed by %T: %s", c, err)
+			}
+			if !bytes.Equal(plainData, src) {
+				t.Fatalf("unexpected data decompressed for %T; got %d bytes; want %d bytes", c, len(plainData), len(src))
+			}
+		}
+	}
+	f(cc, nil)
+	f(NewDictCompressor(cd), dd)
+	f(wc, nil)
+	f(wcDict, dd)
+
+	// WriterCompressor must apply WriterParams.
+	compressed := wc.Compress(nil, []byte("foobar"))
+	present, _, err := ExtractFrameChecksum(compressed)
+	if err != nil {
+		t.Fatalf("cannot extract frame checksum: %s", err)
+	}
+	if !present {
+		t.Fatalf("missing frame checksum")
+	}
+
+	// Released CCtx may be released again.
+	cc.Release()
+}
@@ -0,0 +1,41 @@
+package gozstd
+
+import (
+	"net"
+	"time"
+)
+
+// NewConnWriter returns new zstd writer writing compressed data to conn
+// at the given compression level.
+//
+// The write deadline for conn is set to flushDeadline from now before
+// every write of compressed data to conn, so Write, Flush and Close
+// calls don't stall for longer than flushDeadline on slow peers.
+// Zero or negative flushDeadline disables setting the write deadline.
+//
+// The timeout error from conn is returned from the corresponding Writer call.
+// The compressed data, which wasn't written to conn, remains buffered
+// in the Writer, so Flush or Close may be retried after the timeout.
+//
+// Call Release when the Writer is no longer needed. Release doesn't close conn.
+func NewConnWriter(conn net.Conn, compressionLevel int, flushDeadline time.Duration) *Writer {
+	dw := &deadlineWriter{
+		conn:          conn,
+		flushDeadline: flushDeadline,
+	}
+	return NewWriterLevel(dw, compressionLevel)
+}
+
+type deadlineWriter struct {
+	conn          net.Conn
+	flushDeadline time.Duration
+}
+
+func (dw *deadlineWriter) Write(p []byte) (int, error) {
+	if dw.flushDeadline > 0 {
+		if err := dw.conn.SetWriteDeadline(time.Now().Add(dw.flushDeadline)); err != nil {
+			return 0, err
+		}
+	}
+	return dw.conn.Write(p)
+}
@@ -0,0 +1,108 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// fakeConn writes data to bb. It writes only a part of the data
+// and returns timeoutError on the write with the index timeoutWrite.
+type fakeConn struct {
+	net.Conn
+
+	bb           bytes.Buffer
+	writes       int
+	timeoutWrite int
+	deadlines    int
+}
+
+func (fc *fakeConn) Write(p []byte) (int, error) {
+	fc.writes++
+	if fc.writes == fc.timeoutWrite {
+		n := len(p) / 2
+		fc.bb.Write(p[:n])
+		return n, timeoutError{}
+	}
+	return fc.bb.Write(p)
+}
+
+func (fc *fakeConn) SetWriteDeadline(t time.Time) error {
+	fc.deadlines++
+	return nil
+}
+
+func TestNewConnWriter(t *testing.T) {
+	fc := &fakeConn{
+		timeoutWrite: 2,
+	}
+	zw := NewConnWriter(fc, DefaultCompressionLevel, time.Second)
+	defer zw.Release()
+
+	var expected []byte
+	timeouts := 0
+	for i := 0; i < 20; i++ {
+		line := fmt.Sprintf("line %d %s\n", i, newTestString(1000, 10))
+		if _, err := zw.Write([]byte(line)); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		expected = append(expected, line...)
+		for {
+			err := zw.Flush()
+			if err == nil {
+				break
+			}
+			timeouts++
+			if timeouts > 1 {
+				t.Fatalf("unexpected error on Flush retry: %s", err)
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	if timeouts != 1 {
+		t.Fatalf("unexpected number of timeouts; got %d; want 1", timeouts)
+	}
+	if fc.deadlines != fc.writes {
+		t.Fatalf("unexpected number of write deadlines set; got %d; want %d", fc.deadlines, fc.writes)
+	}
+
+	plainData, err := Decompress(nil, fc.bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data after retried Flush: %s", err)
+	}
+	if !bytes.Equal(plainData, expected) {
+		t.Fatalf("unexpected data decompressed after retried Flush")
+	}
+
+	// Verify Close retry.
+	fc = &fakeConn{
+		timeoutWrite: 1,
+	}
+	zw.Reset(&deadlineWriter{conn: fc, flushDeadline: time.Second}, nil, DefaultCompressionLevel)
+	if _, err := zw.Write(expected); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err == nil {
+		t.Fatalf("expecting non-nil error on Close")
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("unexpected error on Close retry: %s", err)
+	}
+	plainData, err = Decompress(nil, fc.bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data after retried Close: %s", err)
+	}
+	if !bytes.Equal(plainData, expected) {
+		t.Fatalf("unexpected data decompressed after retried Close")
+	}
+}
@@ -0,0 +1,88 @@
+package gozstd
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrTooManyContexts is returned from TryNewWriterParams when the limit
+// set via SetMaxConcurrentContexts is reached.
+var ErrTooManyContexts = errors.New("the limit on concurrent compression contexts is reached")
+
+var contextLimiter = newContextLimiter()
+
+type contextLimiterState struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	max    int
+	active int
+}
+
+func newContextLimiter() *contextLimiterState {
+	cl := &contextLimiterState{}
+	cl.cond = sync.NewCond(&cl.mu)
+	return cl
+}
+
+// SetMaxConcurrentContexts limits the number of simultaneously active
+// compression contexts to n.
+//
+// The limit applies to contexts held by Writers and CCtxs. New* functions
+// for Writer and NewCCtx block until the number of active contexts drops
+// below n, while TryNewWriterParams returns ErrTooManyContexts instead
+// of blocking. A context is released by the Release call. This prevents
+// native memory exhaustion on servers running many compressions in parallel.
+//
+// The contexts used internally by Compress* functions are pooled and they
+// aren't limited.
+//
+// Zero or negative n disables the limit. The limit is disabled by default.
+func SetMaxConcurrentContexts(n int) {
+	cl := contextLimiter
+	cl.mu.Lock()
+	cl.max = n
+	cl.mu.Unlock()
+	// Wake up all the waiters, since the limit may be increased.
+	cl.cond.Broadcast()
+}
+
+func acquireContext() {
+	cl := contextLimiter
+	cl.mu.Lock()
+	for cl.max > 0 && cl.active >= cl.max {
+		cl.cond.Wait()
+	}
+	cl.active++
+	cl.mu.Unlock()
+}
+
+func tryAcquireContext() bool {
+	cl := contextLimiter
+	cl.mu.Lock()
+	ok := cl.max <= 0 || cl.active < cl.max
+	if ok {
+		cl.active++
+	}
+	cl.mu.Unlock()
+	return ok
+}
+
+func releaseContext() {
+	cl := contextLimiter
+	cl.mu.Lock()
+	cl.active--
+	if cl.active < 0 {
+		cl.mu.Unlock()
+		panic("BUG: the number of active contexts cannot be negative")
+	}
+	cl.mu.Unlock()
+	cl.cond.Signal()
+}
+
+func activeContexts() int {
+	cl := contextLimiter
+	cl.mu.Lock()
+	n := cl.active
+	cl.mu.Unlock()
+	return n
+}
@@ -0,0 +1,109 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSetMaxConcurrentContexts(t *testing.T) {
+	// Free the contexts leaked by other tests, so they don't affect the limit.
+	runtime.GC()
+	runtime.GC()
+	time.Sleep(10 * time.Millisecond)
+
+	const maxContexts = 3
+	base := activeContexts()
+	SetMaxConcurrentContexts(base + maxContexts)
+	defer SetMaxConcurrentContexts(0)
+
+	// Occupy all the contexts.
+	zw1 := NewWriter(nil)
+	zw2 := NewWriterLevel(nil, 5)
+	cc := NewCCtx(DefaultCompressionLevel)
+	if _, err := TryNewWriterParams(nil, nil); err != ErrTooManyContexts {
+		t.Fatalf("unexpected error; got %v; want %v", err, ErrTooManyContexts)
+	}
+
+	// Releasing a writer must admit a waiting one.
+	ch := make(chan *Writer, 1)
+	go func() {
+		ch <- NewWriter(nil)
+	}()
+	select {
+	case <-ch:
+		t.Fatalf("NewWriter must block when the limit is reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+	zw1.Release()
+	var zw3 *Writer
+	select {
+	case zw3 = <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout when waiting for NewWriter after releasing a writer")
+	}
+	if _, err := TryNewWriterParams(nil, nil); err != ErrTooManyContexts {
+		t.Fatalf("unexpected error; got %v; want %v", err, ErrTooManyContexts)
+	}
+	zw2.Release()
+	zw3.Release()
+	cc.Release()
+
+	// The limit must be enforced for many concurrent writers.
+	var active, maxActive int32
+	var wg sync.WaitGroup
+	errCh := make(chan error, 50)
+	for i := 0; i < cap(errCh); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var bb bytes.Buffer
+			zw := NewWriter(&bb)
+			n := atomic.AddInt32(&active, 1)
+			for {
+				m := atomic.LoadInt32(&maxActive)
+				if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+					break
+				}
+			}
+			s := fmt.Sprintf("data number %d", i)
+			if _, err := zw.Write([]byte(s)); err != nil {
+				errCh <- err
+			}
+			if err := zw.Close(); err != nil {
+				errCh <- err
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			zw.Release()
+			plainData, err := Decompress(nil, bb.Bytes())
+			if err != nil {
+				errCh <- err
+			} else if string(plainData) != s {
+				errCh <- fmt.Errorf("unexpected data decompressed; got %q; want %q", plainData, s)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if maxActive > maxContexts {
+		t.Fatalf("too many concurrent writers; got %d; want up to %d", maxActive, maxContexts)
+	}
+	if n := activeContexts(); n > base {
+		t.Fatalf("unexpected number of active contexts after releasing all the writers; got %d; want up to %d", n, base)
+	}
+
+	// TryNewWriterParams must succeed when the limit isn't reached.
+	zw, err := TryNewWriterParams(nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	zw.Release()
+}
@@ -0,0 +1,60 @@
+package gozstd
+
+import (
+	"hash/crc32"
+)
+
+// CRCWriter wraps Writer and calculates CRC32 (IEEE) and the size
+// of the uncompressed data written to it.
+//
+// This allows storing the uncompressed size and CRC32 alongside
+// the compressed data without the second pass over the data.
+type CRCWriter struct {
+	zw   *Writer
+	crc  uint32
+	size int64
+}
+
+// NewCRCWriter returns new CRCWriter writing the data to zw.
+//
+// zw may be created with any set of parameters including dictionaries
+// and compression levels.
+func NewCRCWriter(zw *Writer) *CRCWriter {
+	return &CRCWriter{
+		zw: zw,
+	}
+}
+
+// Write writes p to the underlying Writer and updates CRC32 and size for p.
+func (cw *CRCWriter) Write(p []byte) (int, error) {
+	n, err := cw.zw.Write(p)
+	cw.crc = crc32.Update(cw.crc, crc32.IEEETable, p[:n])
+	cw.size += int64(n)
+	return n, err
+}
+
+// Flush flushes the underlying Writer.
+func (cw *CRCWriter) Flush() error {
+	return cw.zw.Flush()
+}
+
+// Close closes the underlying Writer.
+//
+// Sum returns the final CRC32 and size after Close.
+func (cw *CRCWriter) Close() error {
+	return cw.zw.Close()
+}
+
+// Sum returns CRC32 (IEEE) and the size of the uncompressed data
+// written to cw.
+func (cw *CRCWriter) Sum() (uint32, int64) {
+	return cw.crc, cw.size
+}
+
+// Reset resets CRC32 and size calculated by cw.
+//
+// It doesn't reset the underlying Writer.
+func (cw *CRCWriter) Reset() {
+	cw.crc = 0
+	cw.size = 0
+}
@@ -0,0 +1,63 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"testing"
+)
+
+func TestCRCWriter(t *testing.T) {
+	testCRCWriter(t, NewWriter)
+	testCRCWriter(t, func(w io.Writer) *Writer {
+		return NewWriterLevel(w, 19)
+	})
+
+	var samples [][]byte
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, []byte(fmt.Sprintf("crc sample %d", i)))
+	}
+	dict := BuildDict(samples, 8*1024)
+	cd, err := NewCDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create CDict: %s", err)
+	}
+	defer cd.Release()
+	testCRCWriter(t, func(w io.Writer) *Writer {
+		return NewWriterDict(w, cd)
+	})
+}
+
+func testCRCWriter(t *testing.T, newWriter func(w io.Writer) *Writer) {
+	t.Helper()
+
+	var bb, bbOrig bytes.Buffer
+	zw := newWriter(&bb)
+	defer zw.Release()
+	cw := NewCRCWriter(zw)
+
+	w := io.MultiWriter(cw, &bbOrig)
+	for bbOrig.Len() < 300*1024 {
+		if _, err := fmt.Fprintf(w, "crc writer data %d, ", bbOrig.Len()); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatalf("cannot close cw: %s", err)
+	}
+
+	crc, size := cw.Sum()
+	if size != int64(bbOrig.Len()) {
+		t.Fatalf("unexpected size; got %d; want %d", size, bbOrig.Len())
+	}
+	crcExpected := crc32.ChecksumIEEE(bbOrig.Bytes())
+	if crc != crcExpected {
+		t.Fatalf("unexpected crc; got %08X; want %08X", crc, crcExpected)
+	}
+
+	cw.Reset()
+	if crc, size := cw.Sum(); crc != 0 || size != 0 {
+		t.Fatalf("unexpected crc and size after Reset; got %08X, %d; want 0, 0", crc, size)
+	}
+}
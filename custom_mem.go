@@ -0,0 +1,75 @@
+package gozstd
+
+// #include <stdint.h>
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// Allocator is a custom memory allocator for zstd contexts.
+//
+// See NewWriterCustomMem.
+type Allocator interface {
+	// Alloc must return a pointer to at least size bytes of memory,
+	// which isn't managed by Go, i.e. it is obtained from C.malloc, mmap,
+	// a NUMA-local arena, etc. Go memory cannot be returned, since it may be
+	// moved or freed by Go GC while used by zstd.
+	//
+	// Alloc must return nil if the memory cannot be allocated.
+	Alloc(size int) unsafe.Pointer
+
+	// Free must free the memory obtained from Alloc.
+	Free(p unsafe.Pointer)
+}
+
+var (
+	allocatorsLock   sync.Mutex
+	allocators       = make(map[uintptr]Allocator)
+	allocatorsNextID uintptr
+)
+
+// registerAllocator registers a and returns the id, which may be passed
+// to zstd as an opaque pointer for goZstdAlloc and goZstdFree.
+//
+// Go pointers cannot be stored in C memory, so the allocator is referred by id.
+func registerAllocator(a Allocator) uintptr {
+	allocatorsLock.Lock()
+	allocatorsNextID++
+	id := allocatorsNextID
+	allocators[id] = a
+	allocatorsLock.Unlock()
+	return id
+}
+
+func unregisterAllocator(id uintptr) {
+	allocatorsLock.Lock()
+	delete(allocators, id)
+	allocatorsLock.Unlock()
+}
+
+func getAllocator(id uintptr) Allocator {
+	allocatorsLock.Lock()
+	a := allocators[id]
+	allocatorsLock.Unlock()
+	if a == nil {
+		panic("BUG: unknown allocator")
+	}
+	return a
+}
+
+//export goZstdAlloc
+func goZstdAlloc(opaque C.uintptr_t, size C.size_t) unsafe.Pointer {
+	a := getAllocator(uintptr(opaque))
+	return a.Alloc(int(size))
+}
+
+//export goZstdFree
+func goZstdFree(opaque C.uintptr_t, address unsafe.Pointer) {
+	if address == nil {
+		return
+	}
+	a := getAllocator(uintptr(opaque))
+	a.Free(address)
+}
@@ -0,0 +1,103 @@
+//go:build linux
+// +build linux
+
+package gozstd
+
+import (
+	"bytes"
+	"sync"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// trackingAllocator allocates memory via anonymous mmap, since Alloc
+// cannot return Go memory.
+type trackingAllocator struct {
+	lock   sync.Mutex
+	allocs int
+	frees  int
+	live   map[unsafe.Pointer][]byte
+}
+
+func (a *trackingAllocator) Alloc(size int) unsafe.Pointer {
+	if size <= 0 {
+		size = 1
+	}
+	b, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil
+	}
+	p := unsafe.Pointer(&b[0])
+	a.lock.Lock()
+	a.allocs++
+	if a.live == nil {
+		a.live = make(map[unsafe.Pointer][]byte)
+	}
+	a.live[p] = b
+	a.lock.Unlock()
+	return p
+}
+
+func (a *trackingAllocator) Free(p unsafe.Pointer) {
+	a.lock.Lock()
+	a.frees++
+	b, ok := a.live[p]
+	if !ok {
+		a.lock.Unlock()
+		panic("BUG: freeing unknown pointer")
+	}
+	delete(a.live, p)
+	a.lock.Unlock()
+	if err := syscall.Munmap(b); err != nil {
+		panic(err)
+	}
+}
+
+func TestWriterCustomMem(t *testing.T) {
+	var a trackingAllocator
+	var bb bytes.Buffer
+	zw := NewWriterCustomMem(&bb, 5, &a)
+
+	src := []byte(newTestString(512*1024, 3))
+	for i := 0; i < 3; i++ {
+		bb.Reset()
+		if _, err := zw.Write(src); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw: %s", err)
+		}
+		plainData, err := Decompress(nil, bb.Bytes())
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		if !bytes.Equal(plainData, src) {
+			t.Fatalf("unexpected data decompressed")
+		}
+		zw.Reset(&bb, nil, 5+i)
+	}
+
+	a.lock.Lock()
+	allocs := a.allocs
+	a.lock.Unlock()
+	if allocs == 0 {
+		t.Fatalf("expecting non-zero allocations via custom allocator")
+	}
+
+	zw.Release()
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.allocs != a.frees {
+		t.Fatalf("unbalanced allocations; allocs=%d, frees=%d", a.allocs, a.frees)
+	}
+	if len(a.live) != 0 {
+		t.Fatalf("unexpected number of live allocations after Release; got %d; want 0", len(a.live))
+	}
+	allocatorsLock.Lock()
+	n := len(allocators)
+	allocatorsLock.Unlock()
+	if n != 0 {
+		t.Fatalf("the allocator must be unregistered after Release")
+	}
+}
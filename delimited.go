@@ -0,0 +1,118 @@
+package gozstd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// DelimitedWriter writes messages as independent zstd frames, which are
+// preceded by the varint-encoded frame length.
+//
+// This format is similar to length-delimited protobuf streams.
+// Use DelimitedReader for reading the messages.
+type DelimitedWriter struct {
+	w     io.Writer
+	level int
+
+	buf []byte
+}
+
+// NewDelimitedWriter returns new DelimitedWriter writing messages
+// compressed at the given compression level to w.
+func NewDelimitedWriter(w io.Writer, compressionLevel int) *DelimitedWriter {
+	return &DelimitedWriter{
+		w:     w,
+		level: compressionLevel,
+	}
+}
+
+// WriteMsg compresses msg and writes it to the underlying writer.
+//
+// Every message is written with a single Write call to the underlying writer.
+func (dw *DelimitedWriter) WriteMsg(msg []byte) error {
+	// Reserve space for the length prefix in front of the compressed frame.
+	var lenBuf [binary.MaxVarintLen64]byte
+	buf := append(dw.buf[:0], lenBuf[:]...)
+	buf = CompressLevel(buf, msg, dw.level)
+	frameLen := len(buf) - len(lenBuf)
+	n := binary.PutUvarint(lenBuf[:], uint64(frameLen))
+	start := len(lenBuf) - n
+	copy(buf[start:], lenBuf[:n])
+	dw.buf = buf
+
+	if _, err := dw.w.Write(buf[start:]); err != nil {
+		return fmt.Errorf("cannot write message: %s", err)
+	}
+	return nil
+}
+
+// DelimitedReader reads messages written by DelimitedWriter.
+type DelimitedReader struct {
+	br *bufio.Reader
+
+	frame []byte
+	msg   []byte
+}
+
+// NewDelimitedReader returns new DelimitedReader reading messages from r.
+//
+// DelimitedReader may read more data from r than needed for the returned
+// messages due to buffering.
+func NewDelimitedReader(r io.Reader) *DelimitedReader {
+	return &DelimitedReader{
+		br: bufio.NewReader(r),
+	}
+}
+
+// maxDelimitedChunkSize is the maximum size of the chunk the frame is read by.
+//
+// The frame is read by chunks, so a corrupted frame length doesn't result
+// in a huge memory allocation.
+const maxDelimitedChunkSize = 64 * 1024
+
+// ReadMsg reads and decompresses the next message.
+//
+// io.EOF is returned if the underlying reader has no more messages.
+// io.ErrUnexpectedEOF is returned if the underlying reader ends
+// in the middle of a message.
+//
+// The returned message is valid until the next ReadMsg call.
+func (dr *DelimitedReader) ReadMsg() ([]byte, error) {
+	frameLen, err := binary.ReadUvarint(dr.br)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("cannot read message length: %s", err)
+	}
+
+	frame := dr.frame[:0]
+	for uint64(len(frame)) < frameLen {
+		chunkSize := frameLen - uint64(len(frame))
+		if chunkSize > maxDelimitedChunkSize {
+			chunkSize = maxDelimitedChunkSize
+		}
+		n := len(frame)
+		frame = append(frame, make([]byte, chunkSize)...)
+		if _, err := io.ReadFull(dr.br, frame[n:]); err != nil {
+			dr.frame = frame[:0]
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err == io.ErrUnexpectedEOF {
+				return nil, err
+			}
+			return nil, fmt.Errorf("cannot read message: %s", err)
+		}
+	}
+	dr.frame = frame
+
+	msg, err := Decompress(dr.msg[:0], frame)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress message: %s", err)
+	}
+	dr.msg = msg
+	return msg, nil
+}
@@ -0,0 +1,86 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDelimitedWriterReader(t *testing.T) {
+	var msgs []string
+	for i := 0; i < 200; i++ {
+		msgs = append(msgs, newTestString(i*i, i%10+1))
+	}
+	msgs = append(msgs, "", newTestString(300*1000, 10), "foobar")
+
+	var bb bytes.Buffer
+	dw := NewDelimitedWriter(&bb, 5)
+	for _, msg := range msgs {
+		if err := dw.WriteMsg([]byte(msg)); err != nil {
+			t.Fatalf("cannot write message: %s", err)
+		}
+	}
+	data := bb.Bytes()
+
+	for _, r := range []io.Reader{
+		bytes.NewReader(data),
+		iotest.OneByteReader(bytes.NewReader(data)),
+		iotest.HalfReader(bytes.NewReader(data)),
+	} {
+		dr := NewDelimitedReader(r)
+		for i, msgExpected := range msgs {
+			msg, err := dr.ReadMsg()
+			if err != nil {
+				t.Fatalf("cannot read message #%d: %s", i, err)
+			}
+			if string(msg) != msgExpected {
+				t.Fatalf("unexpected message #%d; got %d bytes; want %d bytes", i, len(msg), len(msgExpected))
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if _, err := dr.ReadMsg(); err != io.EOF {
+				t.Fatalf("unexpected error at the end of stream; got %v; want %v", err, io.EOF)
+			}
+		}
+	}
+}
+
+func TestDelimitedReaderTruncated(t *testing.T) {
+	var bb bytes.Buffer
+	dw := NewDelimitedWriter(&bb, 3)
+	lastMsgOffset := 0
+	for i := 0; i < 3; i++ {
+		lastMsgOffset = bb.Len()
+		if err := dw.WriteMsg([]byte(fmt.Sprintf("message %d %s", i, newTestString(1000, 3)))); err != nil {
+			t.Fatalf("cannot write message: %s", err)
+		}
+	}
+	data := bb.Bytes()
+
+	// Truncate the stream at every position inside the last message.
+	for n := lastMsgOffset + 1; n < len(data); n++ {
+		dr := NewDelimitedReader(bytes.NewReader(data[:n]))
+		for i := 0; i < 2; i++ {
+			if _, err := dr.ReadMsg(); err != nil {
+				t.Fatalf("cannot read message #%d: %s", i, err)
+			}
+		}
+		if _, err := dr.ReadMsg(); err != io.ErrUnexpectedEOF {
+			t.Fatalf("unexpected error for stream truncated to %d bytes; got %v; want %v", n, err, io.ErrUnexpectedEOF)
+		}
+	}
+
+	// Huge corrupted length.
+	dr := NewDelimitedReader(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f, 1, 2, 3}))
+	if _, err := dr.ReadMsg(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("unexpected error for corrupted length; got %v; want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	// Corrupted frame.
+	dr = NewDelimitedReader(bytes.NewReader([]byte{3, 1, 2, 3}))
+	if _, err := dr.ReadMsg(); err == nil || err == io.ErrUnexpectedEOF {
+		t.Fatalf("expecting decompression error for corrupted frame; got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package gozstd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// The header written by DescribedWriter before the compressed stream.
+// See DescribedWriter for the header layout.
+const (
+	describedHeaderMagic   = "GZSD"
+	describedHeaderVersion = 1
+	describedHeaderSize    = 13
+)
+
+// DescribedWriter writes self-describing compressed stream.
+//
+// The compressed stream is prepended by a small header containing
+// the compression level and the dictionary ID, so the stream may be
+// decompressed with DescribedReader without knowing the dictionary
+// in advance.
+//
+// The header layout is the following (all the integers are little-endian):
+//
+//	offset  size  description
+//	0       4     magic bytes "GZSD"
+//	4       1     header version, currently 1
+//	5       4     compression level, signed 32-bit integer
+//	9       4     dictionary ID, unsigned 32-bit integer; 0 means no dictionary
+//
+// The compressed zstd stream follows the header.
+//
+// DescribedWriter must be created via NewDescribedWriter.
+type DescribedWriter struct {
+	zw *Writer
+	w  io.Writer
+
+	header        [describedHeaderSize]byte
+	headerWritten bool
+}
+
+// NewDescribedWriter returns new DescribedWriter writing compressed data
+// to w at the given compressionLevel using the given cd.
+//
+// cd may be nil. In this case the data is compressed without a dictionary.
+// The dictionary ID of cd is written into the header, so cd must have
+// the dictionary ID, i.e. it mustn't be a raw content dictionary.
+//
+// The header is written to w on the first Write, Flush or Close call.
+//
+// The returned writer must be closed with Close call in order
+// to finalize the compressed stream.
+//
+// Call Release when the DescribedWriter is no longer needed.
+func NewDescribedWriter(w io.Writer, compressionLevel int, cd *CDict) *DescribedWriter {
+	var zw *Writer
+	var dictID uint32
+	if cd != nil {
+		zw = NewWriterDictLevel(w, cd, compressionLevel)
+		dictID = cd.DictID()
+		if compressionLevel == 0 {
+			compressionLevel = cd.compressionLevel
+		}
+	} else {
+		zw = NewWriterLevel(w, compressionLevel)
+	}
+	if compressionLevel == 0 {
+		compressionLevel = DefaultCompressionLevel
+	}
+
+	dw := &DescribedWriter{
+		zw: zw,
+		w:  w,
+	}
+	h := dw.header[:]
+	copy(h, describedHeaderMagic)
+	h[4] = describedHeaderVersion
+	binary.LittleEndian.PutUint32(h[5:], uint32(int32(compressionLevel)))
+	binary.LittleEndian.PutUint32(h[9:], dictID)
+	return dw
+}
+
+func (dw *DescribedWriter) writeHeader() error {
+	if dw.headerWritten {
+		return nil
+	}
+	if _, err := dw.w.Write(dw.header[:]); err != nil {
+		return fmt.Errorf("cannot write header: %s", err)
+	}
+	dw.headerWritten = true
+	return nil
+}
+
+// Write writes p to dw.
+func (dw *DescribedWriter) Write(p []byte) (int, error) {
+	if err := dw.writeHeader(); err != nil {
+		return 0, err
+	}
+	return dw.zw.Write(p)
+}
+
+// Flush flushes the buffered data to the underlying writer.
+func (dw *DescribedWriter) Flush() error {
+	if err := dw.writeHeader(); err != nil {
+		return err
+	}
+	return dw.zw.Flush()
+}
+
+// Close finalizes the compressed stream.
+//
+// It doesn't close the underlying writer.
+func (dw *DescribedWriter) Close() error {
+	if err := dw.writeHeader(); err != nil {
+		return err
+	}
+	return dw.zw.Close()
+}
+
+// Release releases all the resources occupied by dw.
+//
+// dw cannot be used after the release.
+func (dw *DescribedWriter) Release() {
+	dw.zw.Release()
+	dw.zw = nil
+}
+
+// DescribedReader reads the stream written by DescribedWriter.
+//
+// DescribedReader must be created via NewDescribedReader.
+type DescribedReader struct {
+	r   io.Reader
+	reg *DictRegistry
+	zr  *Reader
+
+	compressionLevel int
+	dictID           uint32
+	headerErr        error
+}
+
+// NewDescribedReader returns new DescribedReader reading the stream
+// written by DescribedWriter from r.
+//
+// The dictionary for the stream is selected from reg by the dictionary ID
+// stored in the header. reg may be nil if the stream has been compressed
+// without a dictionary.
+//
+// Call Release when the DescribedReader is no longer needed.
+func NewDescribedReader(r io.Reader, reg *DictRegistry) *DescribedReader {
+	return &DescribedReader{
+		r:   r,
+		reg: reg,
+	}
+}
+
+// ReadHeader reads the header from the underlying reader.
+//
+// It is called automatically on the first Read call. ReadHeader may be
+// called before Read in order to obtain CompressionLevel and DictID.
+// Subsequent calls return the result of the first call.
+func (dr *DescribedReader) ReadHeader() error {
+	if dr.zr != nil || dr.headerErr != nil {
+		return dr.headerErr
+	}
+	dr.headerErr = dr.readHeader()
+	return dr.headerErr
+}
+
+func (dr *DescribedReader) readHeader() error {
+	var h [describedHeaderSize]byte
+	if _, err := io.ReadFull(dr.r, h[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("cannot read header: %s", err)
+	}
+	if string(h[:4]) != describedHeaderMagic {
+		return fmt.Errorf("invalid header magic %q; want %q", h[:4], describedHeaderMagic)
+	}
+	if h[4] != describedHeaderVersion {
+		return fmt.Errorf("unsupported header version %d; want %d", h[4], describedHeaderVersion)
+	}
+	compressionLevel := int(int32(binary.LittleEndian.Uint32(h[5:])))
+	dictID := binary.LittleEndian.Uint32(h[9:])
+
+	var dd *DDict
+	if dictID != 0 {
+		if dr.reg != nil {
+			dd = dr.reg.Get(dictID)
+		}
+		if dd == nil {
+			return fmt.Errorf("cannot find dictionary with ID %d in the registry", dictID)
+		}
+	}
+	dr.compressionLevel = compressionLevel
+	dr.dictID = dictID
+	dr.zr = NewReaderDict(dr.r, dd)
+	return nil
+}
+
+// CompressionLevel returns the compression level stored in the header.
+//
+// ReadHeader or Read must be called before CompressionLevel.
+func (dr *DescribedReader) CompressionLevel() int {
+	return dr.compressionLevel
+}
+
+// DictID returns the dictionary ID stored in the header.
+//
+// Zero is returned if the stream has been compressed without a dictionary.
+// ReadHeader or Read must be called before DictID.
+func (dr *DescribedReader) DictID() uint32 {
+	return dr.dictID
+}
+
+// Read reads up to len(p) decompressed bytes into p.
+func (dr *DescribedReader) Read(p []byte) (int, error) {
+	if err := dr.ReadHeader(); err != nil {
+		return 0, err
+	}
+	return dr.zr.Read(p)
+}
+
+// Release releases all the resources occupied by dr.
+//
+// dr cannot be used after the release.
+func (dr *DescribedReader) Release() {
+	if dr.zr != nil {
+		dr.zr.Release()
+		dr.zr = nil
+	}
+}
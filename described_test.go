@@ -0,0 +1,112 @@
+package gozstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDescribedWriterReader(t *testing.T) {
+	cdFoo, ddFoo := newTestShardDicts(t, "foo")
+	defer cdFoo.Release()
+	defer ddFoo.Release()
+	cdBar, ddBar := newTestShardDicts(t, "bar")
+	defer cdBar.Release()
+	defer ddBar.Release()
+
+	reg := NewDictRegistry()
+	if err := reg.Add(ddFoo); err != nil {
+		t.Fatalf("cannot add dictionary: %s", err)
+	}
+	if err := reg.Add(ddBar); err != nil {
+		t.Fatalf("cannot add dictionary: %s", err)
+	}
+
+	f := func(level int, cd *CDict, expectedLevel int, expectedDictID uint32) {
+		t.Helper()
+		src := []byte(newTestString(1000, 10))
+		var bb bytes.Buffer
+		dw := NewDescribedWriter(&bb, level, cd)
+		if _, err := dw.Write(src); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := dw.Close(); err != nil {
+			t.Fatalf("cannot close writer: %s", err)
+		}
+		dw.Release()
+
+		dr := NewDescribedReader(&bb, reg)
+		defer dr.Release()
+		if err := dr.ReadHeader(); err != nil {
+			t.Fatalf("cannot read header: %s", err)
+		}
+		if dr.CompressionLevel() != expectedLevel {
+			t.Fatalf("unexpected compression level; got %d; want %d", dr.CompressionLevel(), expectedLevel)
+		}
+		if dr.DictID() != expectedDictID {
+			t.Fatalf("unexpected dictionary ID; got %d; want %d", dr.DictID(), expectedDictID)
+		}
+		plainData, err := ioutil.ReadAll(dr)
+		if err != nil {
+			t.Fatalf("cannot read data: %s", err)
+		}
+		if !bytes.Equal(plainData, src) {
+			t.Fatalf("unexpected data read; got %d bytes; want %d bytes", len(plainData), len(src))
+		}
+	}
+
+	f(0, nil, DefaultCompressionLevel, 0)
+	f(5, nil, 5, 0)
+	f(-3, nil, -3, 0)
+	f(0, cdFoo, cdFoo.compressionLevel, ddFoo.DictID())
+	f(7, cdFoo, 7, ddFoo.DictID())
+	f(1, cdBar, 1, ddBar.DictID())
+}
+
+func TestDescribedReaderInvalidHeader(t *testing.T) {
+	cd, dd := newTestShardDicts(t, "foo")
+	defer cd.Release()
+	defer dd.Release()
+
+	var bb bytes.Buffer
+	dw := NewDescribedWriter(&bb, 3, cd)
+	if _, err := dw.Write([]byte("foo sample")); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := dw.Close(); err != nil {
+		t.Fatalf("cannot close writer: %s", err)
+	}
+	dw.Release()
+	data := bb.Bytes()
+
+	f := func(data []byte, reg *DictRegistry) {
+		t.Helper()
+		dr := NewDescribedReader(bytes.NewReader(data), reg)
+		defer dr.Release()
+		if _, err := ioutil.ReadAll(dr); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		// The error must be sticky.
+		if err := dr.ReadHeader(); err == nil {
+			t.Fatalf("expecting non-nil error on the second ReadHeader call")
+		}
+	}
+
+	// Missing dictionary.
+	f(data, nil)
+	f(data, NewDictRegistry())
+
+	// Truncated header.
+	f(data[:describedHeaderSize-1], nil)
+	f(nil, nil)
+
+	// Invalid magic.
+	bad := append([]byte{}, data...)
+	bad[0] = 'X'
+	f(bad, nil)
+
+	// Unsupported version.
+	bad = append([]byte{}, data...)
+	bad[4] = describedHeaderVersion + 1
+	f(bad, nil)
+}
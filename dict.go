@@ -5,29 +5,81 @@ package gozstd
 
 #define ZSTD_STATIC_LINKING_ONLY
 #include "zstd.h"
+#include "zstd_errors.h"
 
 #define ZDICT_STATIC_LINKING_ONLY
 #include "zdict.h"
 
+#include <stdlib.h>  // for malloc/free
 #include <stdint.h>  // for uintptr_t
 
 // The following *_wrapper functions allow avoiding memory allocations
 // durting calls from Go.
 // See https://github.com/golang/go/issues/24450 .
 
-static ZSTD_CDict* ZSTD_createCDict_wrapper(uintptr_t dictBuffer, size_t dictSize, int compressionLevel) {
-	return ZSTD_createCDict((const void *)dictBuffer, dictSize, compressionLevel);
+static ZSTD_CDict* ZSTD_createCDict_byReference_wrapper(uintptr_t dictBuffer, size_t dictSize, int compressionLevel) {
+	return ZSTD_createCDict_byReference((const void *)dictBuffer, dictSize, compressionLevel);
+}
+
+// ZSTD_createCDict_params_wrapper creates CDict, which references the given dict.
+//
+// If fastLoad is set, then dictionary tables are built with hash chains
+// instead of binary trees for compression levels using binary tree strategies,
+// since binary trees are slow to build for large dictionaries.
+static ZSTD_CDict* ZSTD_createCDict_params_wrapper(uintptr_t dictBuffer, size_t dictSize, int compressionLevel, int fastLoad, int dedicatedDictSearch) {
+	ZSTD_CCtx_params* params = ZSTD_createCCtxParams();
+	if (params == NULL) {
+		return NULL;
+	}
+	ZSTD_CCtxParams_init(params, compressionLevel);
+	if (fastLoad) {
+		ZSTD_compressionParameters cParams = ZSTD_getCParams(compressionLevel, 0, dictSize);
+		if (cParams.strategy > ZSTD_lazy2) {
+			ZSTD_CCtxParams_setParameter(params, ZSTD_c_strategy, ZSTD_lazy2);
+		}
+	}
+	if (dedicatedDictSearch) {
+		ZSTD_CCtxParams_setParameter(params, ZSTD_c_enableDedicatedDictSearch, 1);
+	}
+	ZSTD_CDict* cdict = ZSTD_createCDict_advanced2((const void *)dictBuffer, dictSize, ZSTD_dlm_byRef, ZSTD_dct_auto, params, ZSTD_defaultCMem);
+	ZSTD_freeCCtxParams(params);
+	return cdict;
 }
 
 static ZSTD_DDict* ZSTD_createDDict_wrapper(uintptr_t dictBuffer, size_t dictSize) {
 	return ZSTD_createDDict((const void *)dictBuffer, dictSize);
 }
 
+// The following functions return the reason why ZSTD_create*Dict
+// couldn't load the given dictionary.
+
+static size_t ZSTD_checkCDict_wrapper(uintptr_t dictBuffer, size_t dictSize, int compressionLevel) {
+	ZSTD_CCtx* cctx = ZSTD_createCCtx();
+	if (cctx == NULL) {
+		return (size_t)-ZSTD_error_memory_allocation;
+	}
+	char dst[64];
+	size_t rv = ZSTD_compress_usingDict(cctx, dst, sizeof(dst), NULL, 0, (const void *)dictBuffer, dictSize, compressionLevel);
+	ZSTD_freeCCtx(cctx);
+	return rv;
+}
+
+static size_t ZSTD_checkDDict_wrapper(uintptr_t dictBuffer, size_t dictSize) {
+	ZSTD_DCtx* dctx = ZSTD_createDCtx();
+	if (dctx == NULL) {
+		return (size_t)-ZSTD_error_memory_allocation;
+	}
+	size_t rv = ZSTD_decompressBegin_usingDict(dctx, (const void *)dictBuffer, dictSize);
+	ZSTD_freeDCtx(dctx);
+	return rv;
+}
+
 */
 import "C"
 
 import (
 	"fmt"
+	"io/ioutil"
 	"runtime"
 	"sync"
 	"unsafe"
@@ -41,28 +93,131 @@ const minDictLen = C.ZDICT_DICTSIZE_MIN
 //
 // The returned dictionary may be passed to NewCDict* and NewDDict.
 func BuildDict(samples [][]byte, desiredDictLen int) []byte {
-	if desiredDictLen < minDictLen {
-		desiredDictLen = minDictLen
+	dict, err := buildDict(samples, desiredDictLen)
+	if err != nil {
+		// Return empty dictionary, since the original samples are too small.
+		return nil
 	}
-	dict := make([]byte, desiredDictLen)
+	return dict
+}
 
-	// Calculate the total samples size.
-	samplesBufLen := 0
+const (
+	// minSuggestedDictLen is the minimum dictionary size returned from SuggestDictSize.
+	minSuggestedDictLen = 1024
+
+	// maxSuggestedDictLen is the maximum dictionary size returned from SuggestDictSize.
+	//
+	// This is the default dictionary size for the zstd command-line tool.
+	maxSuggestedDictLen = 110 * 1024
+)
+
+// SuggestDictSize returns the recommended desiredDictLen for BuildDict
+// for the given samples.
+//
+// zstd recommends training the dictionary on samples, which are about
+// 100x bigger than the dictionary. So the suggested size is 1% of the total
+// samples size. The result is in the range [1KB ... 110KB].
+func SuggestDictSize(samples [][]byte) int {
+	samplesLen := 0
 	for _, sample := range samples {
-		if len(sample) == 0 {
-			// Skip empty samples.
-			continue
-		}
-		samplesBufLen += len(sample)
+		samplesLen += len(sample)
 	}
 
-	// Construct flat samplesBuf and samplesSizes.
-	samplesBuf := make([]byte, 0, samplesBufLen)
-	samplesSizes := make([]C.size_t, 0, len(samples))
+	n := samplesLen / 100
+	if n < minSuggestedDictLen {
+		n = minSuggestedDictLen
+	}
+	if n > maxSuggestedDictLen {
+		n = maxSuggestedDictLen
+	}
+	return n
+}
+
+// BuildDictAuto returns dictionary built from the given samples
+// with the size returned from SuggestDictSize.
+//
+// An error is returned if samples are empty or if the dictionary
+// cannot be built from samples.
+//
+// The returned dictionary may be passed to NewCDict* and NewDDict.
+func BuildDictAuto(samples [][]byte) ([]byte, error) {
+	hasSamples := false
 	for _, sample := range samples {
-		samplesBuf = append(samplesBuf, sample...)
-		samplesSizes = append(samplesSizes, C.size_t(len(sample)))
+		if len(sample) > 0 {
+			hasSamples = true
+			break
+		}
+	}
+	if !hasSamples {
+		return nil, fmt.Errorf("cannot build dictionary without samples")
 	}
+	return buildDict(samples, SuggestDictSize(samples))
+}
+
+// FinalizeDict returns dictionary built from the given rawContent
+// by adding the dictionary header with entropy tables obtained from samples.
+//
+// Unlike BuildDict, which selects the dictionary content from samples,
+// FinalizeDict uses rawContent as is. This is useful when the content
+// is hand-picked, e.g. it contains commonly used strings or the prefix
+// shared by the compressed data. The entropy tables are optimized
+// for the given compressionLevel, which is usually better than using
+// rawContent directly as a raw content dictionary.
+//
+// The size of the returned dictionary doesn't exceed maxDictSize.
+// The beginning of rawContent is dropped if the header and rawContent
+// don't fit maxDictSize, so the most valuable content must be put
+// at the end of rawContent. rawContent must contain at least 128 bytes,
+// while maxDictSize cannot be smaller than len(rawContent) and 256 bytes.
+//
+// The returned dictionary may be passed to NewCDict* and NewDDict.
+func FinalizeDict(rawContent []byte, samples [][]byte, maxDictSize int, compressionLevel int) ([]byte, error) {
+	if len(rawContent) < int(C.ZDICT_CONTENTSIZE_MIN) {
+		return nil, fmt.Errorf("too small rawContent; got %d bytes; want at least %d bytes", len(rawContent), C.ZDICT_CONTENTSIZE_MIN)
+	}
+	minDictSize := len(rawContent)
+	if minDictSize < minDictLen {
+		minDictSize = minDictLen
+	}
+	if maxDictSize < minDictSize {
+		return nil, fmt.Errorf("too small maxDictSize=%d; it must be at least %d bytes", maxDictSize, minDictSize)
+	}
+	samplesBuf, samplesSizes := flattenSamples(samples)
+	if len(samplesBuf) == 0 {
+		return nil, fmt.Errorf("cannot finalize dictionary without samples")
+	}
+	dict := make([]byte, maxDictSize)
+	params := C.ZDICT_params_t{
+		compressionLevel: C.int(compressionLevel),
+	}
+
+	// Run ZDICT_finalizeDictionary under lock for the same reason as in BuildDict.
+	buildDictLock.Lock()
+	result := C.ZDICT_finalizeDictionary(
+		unsafe.Pointer(&dict[0]),
+		C.size_t(len(dict)),
+		unsafe.Pointer(&rawContent[0]),
+		C.size_t(len(rawContent)),
+		unsafe.Pointer(&samplesBuf[0]),
+		&samplesSizes[0],
+		C.unsigned(len(samplesSizes)),
+		params)
+	buildDictLock.Unlock()
+	if C.ZDICT_isError(result) != 0 {
+		return nil, fmt.Errorf("cannot finalize dictionary from %d samples: %s", len(samplesSizes), C.GoString(C.ZDICT_getErrorName(result)))
+	}
+
+	dictLen := int(result)
+	return dict[:dictLen], nil
+}
+
+func buildDict(samples [][]byte, desiredDictLen int) ([]byte, error) {
+	if desiredDictLen < minDictLen {
+		desiredDictLen = minDictLen
+	}
+	dict := make([]byte, desiredDictLen)
+	samplesBuf, samplesSizes := flattenSamples(samples)
+	samplesBufLen := len(samplesBuf)
 
 	// Add fake samples if the original samples are too small.
 	minSamplesBufLen := int(C.ZDICT_CONTENTSIZE_MIN)
@@ -89,22 +244,93 @@ func BuildDict(samples [][]byte, desiredDictLen int) []byte {
 		C.unsigned(len(samplesSizes)))
 	buildDictLock.Unlock()
 	if C.ZDICT_isError(result) != 0 {
-		// Return empty dictionary, since the original samples are too small.
-		return nil
+		return nil, fmt.Errorf("cannot build dictionary from %d samples: %s", len(samplesSizes), C.GoString(C.ZDICT_getErrorName(result)))
 	}
 
 	dictLen := int(result)
-	return dict[:dictLen]
+	return dict[:dictLen], nil
 }
 
 var buildDictLock sync.Mutex
 
+// flattenSamples returns samples concatenated into a flat buffer
+// and the sizes of samples in the buffer.
+func flattenSamples(samples [][]byte) ([]byte, []C.size_t) {
+	// Calculate the total samples size.
+	samplesBufLen := 0
+	for _, sample := range samples {
+		if len(sample) == 0 {
+			// Skip empty samples.
+			continue
+		}
+		samplesBufLen += len(sample)
+	}
+
+	// Construct flat samplesBuf and samplesSizes.
+	samplesBuf := make([]byte, 0, samplesBufLen)
+	samplesSizes := make([]C.size_t, 0, len(samples))
+	for _, sample := range samples {
+		samplesBuf = append(samplesBuf, sample...)
+		samplesSizes = append(samplesSizes, C.size_t(len(sample)))
+	}
+	return samplesBuf, samplesSizes
+}
+
+// DictError is returned from NewCDict* and NewDDict when the dictionary
+// cannot be loaded.
+type DictError struct {
+	// Corrupted is set to true if the dictionary is malformed.
+	//
+	// Otherwise the dictionary couldn't be loaded due to memory
+	// allocation failure.
+	Corrupted bool
+
+	msg string
+}
+
+// Error implements error interface.
+func (e *DictError) Error() string {
+	return e.msg
+}
+
+func newDictError(funcName string, result C.size_t) error {
+	switch C.ZSTD_getErrorCode(result) {
+	case C.ZSTD_error_dictionary_corrupted, C.ZSTD_error_dictionary_wrong:
+		return &DictError{
+			Corrupted: true,
+			msg:       fmt.Sprintf("corrupted dictionary passed to %s: %s", funcName, errStr(result)),
+		}
+	case C.ZSTD_error_no_error:
+		// The dictionary looks valid, so the only possible reason
+		// for the failure is lack of memory.
+		return &DictError{
+			msg: fmt.Sprintf("cannot allocate memory in %s", funcName),
+		}
+	default:
+		return &DictError{
+			msg: fmt.Sprintf("cannot load dictionary in %s: %s", funcName, errStr(result)),
+		}
+	}
+}
+
 // CDict is a dictionary used for compression.
 //
 // A single CDict may be re-used in concurrently running goroutines.
 type CDict struct {
 	p                *C.ZSTD_CDict
 	compressionLevel int
+
+	// params contains the parameters CDicts are created with.
+	params CDictParams
+
+	// dict contains the dictionary contents referenced by p and levelCDicts.
+	dict    unsafe.Pointer
+	dictLen int
+
+	// levelCDicts contains CDicts for compression levels other than
+	// compressionLevel. They are created on demand by levelCDict.
+	levelCDictsLock sync.Mutex
+	levelCDicts     map[int]*C.ZSTD_CDict
 }
 
 // NewCDict creates new CDict from the given dict.
@@ -117,35 +343,242 @@ func NewCDict(dict []byte) (*CDict, error) {
 // NewCDictLevel creates new CDict from the given dict
 // using the given compressionLevel.
 //
+// *DictError is returned if dict cannot be loaded.
+//
 // Call Release when the returned dict is no longer used.
 func NewCDictLevel(dict []byte, compressionLevel int) (*CDict, error) {
-	if len(dict) == 0 {
-		return nil, fmt.Errorf("dict cannot be empty")
-	}
+	return NewCDictParams(dict, &CDictParams{
+		CompressionLevel: compressionLevel,
+	})
+}
 
+// NewCDictFast creates new CDict from the given dict using the given
+// compressionLevel with the faster dictionary loading.
+//
+// Dictionary loading is slow for large dictionaries at high compression
+// levels, since the dictionary contents are indexed with binary trees.
+// NewCDictFast indexes the dictionary contents with hash chains instead,
+// which speeds up the CDict creation at the cost of slightly lower
+// compression ratio for the data compressed with the dictionary.
+// It is equivalent to NewCDictLevel for compression levels,
+// which don't use binary trees.
+//
+// *DictError is returned if dict cannot be loaded.
+//
+// Call Release when the returned dict is no longer used.
+func NewCDictFast(dict []byte, compressionLevel int) (*CDict, error) {
+	return NewCDictParams(dict, &CDictParams{
+		CompressionLevel: compressionLevel,
+		FastLoad:         true,
+	})
+}
+
+// CDictParams contains parameters for NewCDictParams.
+type CDictParams struct {
+	// CompressionLevel is the compression level for the CDict.
+	//
+	// Zero means the default compression level.
+	CompressionLevel int
+
+	// FastLoad enables the faster dictionary loading.
+	//
+	// See NewCDictFast for details.
+	FastLoad bool
+
+	// DedicatedDictSearch enables the search structure optimized
+	// for reading from the dictionary.
+	//
+	// This makes the compression with the dictionary faster, especially
+	// for small messages, at the cost of slightly slower CDict creation.
+	// It has effect only for compression levels using greedy, lazy
+	// and lazy2 strategies. FastLoad makes the dedicated search available
+	// for higher compression levels, since it switches binary tree strategies
+	// to lazy2 for the dictionary.
+	//
+	// The dictionary built with the dedicated search is always attached
+	// to the compression context, so WriterParams.ForceAttachDict set
+	// to DictForceCopy has no effect for such a dictionary.
+	//
+	// See ZSTD_c_enableDedicatedDictSearch in zstd.h for details.
+	DedicatedDictSearch bool
+}
+
+// NewCDictParams creates new CDict from the given dict using the given params.
+//
+// Nil params means default parameters.
+//
+// *DictError is returned if dict cannot be loaded.
+//
+// Call Release when the returned dict is no longer used.
+func NewCDictParams(dict []byte, params *CDictParams) (*CDict, error) {
+	if params == nil {
+		params = &CDictParams{}
+	}
+	cdParams := *params
+	p, dictC, err := createCDict(dict, &cdParams)
+	if err != nil {
+		return nil, err
+	}
 	cd := &CDict{
-		p: C.ZSTD_createCDict_wrapper(
-			C.uintptr_t(uintptr(unsafe.Pointer(&dict[0]))),
-			C.size_t(len(dict)),
-			C.int(compressionLevel)),
-		compressionLevel: compressionLevel,
+		p:                p,
+		compressionLevel: cdParams.CompressionLevel,
+		params:           cdParams,
+		dict:             dictC,
+		dictLen:          len(dict),
 	}
-	// Prevent from GC'ing of dict during CGO call above.
-	runtime.KeepAlive(dict)
 	runtime.SetFinalizer(cd, freeCDict)
 	return cd, nil
 }
 
+// Reload replaces the contents of cd with the given dict and compressionLevel.
+//
+// This allows rotating dictionaries without replacing references to cd
+// in pooled Writers. cd mustn't be used by concurrently running goroutines
+// during the Reload call. Writers referring to cd must be reset via Reset
+// or ResetWriterParams after the Reload call, so they start using the new dict.
+//
+// cd remains unchanged on error.
+func (cd *CDict) Reload(dict []byte, compressionLevel int) error {
+	params := cd.params
+	params.CompressionLevel = compressionLevel
+	p, dictC, err := createCDict(dict, &params)
+	if err != nil {
+		return err
+	}
+	cd.free()
+	cd.p = p
+	cd.compressionLevel = compressionLevel
+	cd.params = params
+	cd.dict = dictC
+	cd.dictLen = len(dict)
+	return nil
+}
+
+func createCDict(dict []byte, params *CDictParams) (*C.ZSTD_CDict, unsafe.Pointer, error) {
+	if len(dict) == 0 {
+		return nil, nil, fmt.Errorf("dict cannot be empty")
+	}
+
+	// Copy dict to C memory, so it may be referenced by CDicts for distinct
+	// compression levels without additional copies. See levelCDict.
+	dictC := C.malloc(C.size_t(len(dict)))
+	if dictC == nil {
+		return nil, nil, &DictError{
+			msg: "cannot allocate memory for dict",
+		}
+	}
+	copy((*[1 << 30]byte)(dictC)[:len(dict):len(dict)], dict)
+
+	p := createCDictByReference(dictC, len(dict), params.CompressionLevel, params)
+	if p == nil {
+		result := C.ZSTD_checkCDict_wrapper(
+			C.uintptr_t(uintptr(dictC)),
+			C.size_t(len(dict)),
+			C.int(params.CompressionLevel))
+		C.free(dictC)
+		return nil, nil, newDictError("ZSTD_createCDict", result)
+	}
+	return p, dictC, nil
+}
+
+// levelCDict returns CDict for the given compressionLevel.
+//
+// CDict for compressionLevel other than cd.compressionLevel is created
+// on the first call and is cached until cd.Release.
+func (cd *CDict) levelCDict(compressionLevel int) *C.ZSTD_CDict {
+	if compressionLevel == 0 || compressionLevel == cd.compressionLevel {
+		return cd.p
+	}
+
+	cd.levelCDictsLock.Lock()
+	defer cd.levelCDictsLock.Unlock()
+
+	if p := cd.levelCDicts[compressionLevel]; p != nil {
+		return p
+	}
+	p := createCDictByReference(cd.dict, cd.dictLen, compressionLevel, &cd.params)
+	if p == nil {
+		panic(fmt.Errorf("BUG: cannot create CDict for compression level %d", compressionLevel))
+	}
+	if cd.levelCDicts == nil {
+		cd.levelCDicts = make(map[int]*C.ZSTD_CDict)
+	}
+	cd.levelCDicts[compressionLevel] = p
+	return p
+}
+
+// createCDictByReference creates CDict for the given compressionLevel,
+// which references dict. The rest of parameters are obtained from params.
+func createCDictByReference(dict unsafe.Pointer, dictLen, compressionLevel int, params *CDictParams) *C.ZSTD_CDict {
+	if params.FastLoad || params.DedicatedDictSearch {
+		var fastLoad, dedicatedDictSearch C.int
+		if params.FastLoad {
+			fastLoad = 1
+		}
+		if params.DedicatedDictSearch {
+			dedicatedDictSearch = 1
+		}
+		return C.ZSTD_createCDict_params_wrapper(
+			C.uintptr_t(uintptr(dict)),
+			C.size_t(dictLen),
+			C.int(compressionLevel),
+			fastLoad,
+			dedicatedDictSearch)
+	}
+	return C.ZSTD_createCDict_byReference_wrapper(
+		C.uintptr_t(uintptr(dict)),
+		C.size_t(dictLen),
+		C.int(compressionLevel))
+}
+
+// LoadCDictFile creates new CDict from the dictionary stored in the file
+// at the given path using the given compressionLevel.
+//
+// The error returned from ioutil.ReadFile is returned as is if the file
+// cannot be read, so it may be checked with os.IsNotExist and friends.
+// *DictError is returned if the file contents cannot be loaded as a dictionary.
+//
+// Call Release when the returned dict is no longer used.
+func LoadCDictFile(path string, compressionLevel int) (*CDict, error) {
+	dict, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewCDictLevel(dict, compressionLevel)
+}
+
+// DictID returns the dictionary ID for cd.
+//
+// Zero is returned for raw content dictionaries, which have no ID.
+func (cd *CDict) DictID() uint32 {
+	return uint32(C.ZSTD_getDictID_fromCDict(cd.p))
+}
+
 // Release releases resources occupied by cd.
 //
 // cd cannot be used after the release.
 func (cd *CDict) Release() {
+	cd.free()
+}
+
+func (cd *CDict) free() {
 	if cd.p == nil {
 		return
 	}
 	result := C.ZSTD_freeCDict(cd.p)
 	ensureNoError("ZSTD_freeCDict", result)
 	cd.p = nil
+
+	cd.levelCDictsLock.Lock()
+	for _, p := range cd.levelCDicts {
+		result := C.ZSTD_freeCDict(p)
+		ensureNoError("ZSTD_freeCDict", result)
+	}
+	cd.levelCDicts = nil
+	cd.levelCDictsLock.Unlock()
+
+	C.free(cd.dict)
+	cd.dict = nil
 }
 
 func freeCDict(v interface{}) {
@@ -161,21 +594,81 @@ type DDict struct {
 
 // NewDDict creates new DDict from the given dict.
 //
+// *DictError is returned if dict cannot be loaded.
+//
 // Call Release when the returned dict is no longer needed.
 func NewDDict(dict []byte) (*DDict, error) {
+	p, err := createDDict(dict)
+	if err != nil {
+		return nil, err
+	}
+	dd := &DDict{
+		p: p,
+	}
+	runtime.SetFinalizer(dd, freeDDict)
+	return dd, nil
+}
+
+// Reload replaces the contents of dd with the given dict.
+//
+// This allows rotating dictionaries without replacing references to dd
+// in pooled Readers. dd mustn't be used by concurrently running goroutines
+// during the Reload call. Readers referring to dd must be reset via Reset
+// after the Reload call, so they start using the new dict.
+//
+// dd remains unchanged on error.
+func (dd *DDict) Reload(dict []byte) error {
+	p, err := createDDict(dict)
+	if err != nil {
+		return err
+	}
+	dd.Release()
+	dd.p = p
+	return nil
+}
+
+// DictID returns the dictionary ID for dd.
+//
+// Zero is returned for raw content dictionaries, which have no ID.
+func (dd *DDict) DictID() uint32 {
+	return uint32(C.ZSTD_getDictID_fromDDict(dd.p))
+}
+
+func createDDict(dict []byte) (*C.ZSTD_DDict, error) {
 	if len(dict) == 0 {
 		return nil, fmt.Errorf("dict cannot be empty")
 	}
 
-	dd := &DDict{
-		p: C.ZSTD_createDDict_wrapper(
+	p := C.ZSTD_createDDict_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(&dict[0]))),
+		C.size_t(len(dict)))
+	if p == nil {
+		result := C.ZSTD_checkDDict_wrapper(
 			C.uintptr_t(uintptr(unsafe.Pointer(&dict[0]))),
-			C.size_t(len(dict))),
+			C.size_t(len(dict)))
+		// Prevent from GC'ing of dict during CGO calls above.
+		runtime.KeepAlive(dict)
+		return nil, newDictError("ZSTD_createDDict", result)
 	}
 	// Prevent from GC'ing of dict during CGO call above.
 	runtime.KeepAlive(dict)
-	runtime.SetFinalizer(dd, freeDDict)
-	return dd, nil
+	return p, nil
+}
+
+// LoadDDictFile creates new DDict from the dictionary stored in the file
+// at the given path.
+//
+// The error returned from ioutil.ReadFile is returned as is if the file
+// cannot be read, so it may be checked with os.IsNotExist and friends.
+// *DictError is returned if the file contents cannot be loaded as a dictionary.
+//
+// Call Release when the returned dict is no longer needed.
+func LoadDDictFile(path string) (*DDict, error) {
+	dict, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewDDict(dict)
 }
 
 // Release releases resources occupied by dd.
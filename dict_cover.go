@@ -0,0 +1,130 @@
+package gozstd
+
+/*
+#cgo CFLAGS: -O3
+
+#define ZDICT_STATIC_LINKING_ONLY
+#include "zdict.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// CoverParams contains parameters for BuildDictCover.
+//
+// Zero values mean 'select the best value via training'. The best values
+// are selected by building dictionaries with various parameters
+// and picking the dictionary giving the best compression ratio
+// for the samples.
+type CoverParams struct {
+	// K is the segment size. The reasonable range is [16 ... 2048].
+	K int
+
+	// D is the dmer size. It must be 6 or 8 for FastCover and in the range
+	// [6 ... 16] otherwise. It mustn't exceed K.
+	D int
+
+	// Steps is the number of parameter combinations to try when K is zero.
+	// Higher values improve the dictionary quality at the cost of
+	// training speed.
+	//
+	// Special value 0 means 'use the default number of steps' (40).
+	Steps int
+
+	// CompressionLevel is the compression level the dictionary is
+	// optimized for.
+	//
+	// Special value 0 means 'use default compression level'.
+	CompressionLevel int
+
+	// DictSize is the maximum size of the dictionary.
+	//
+	// Special value 0 means 'use the size returned from SuggestDictSize'.
+	DictSize int
+
+	// FastCover enables the FASTCOVER trainer instead of the COVER trainer.
+	// It is much faster at the cost of slightly lower dictionary quality.
+	FastCover bool
+}
+
+// BuildDictCover returns dictionary built from the given samples
+// with the COVER or FASTCOVER trainer depending on params.FastCover.
+//
+// These trainers usually build better dictionaries than BuildDict
+// at the cost of much slower training.
+//
+// An error is returned if params are invalid, if samples are empty or
+// if the dictionary cannot be built from samples.
+//
+// The returned dictionary may be passed to NewCDict* and NewDDict.
+func BuildDictCover(samples [][]byte, params CoverParams) ([]byte, error) {
+	if params.K < 0 || params.D < 0 || params.Steps < 0 || params.DictSize < 0 {
+		return nil, fmt.Errorf("invalid CoverParams %+v: negative values aren't allowed", params)
+	}
+	if params.D > 0 && params.K > 0 && params.D > params.K {
+		return nil, fmt.Errorf("invalid CoverParams %+v: D cannot exceed K", params)
+	}
+
+	samplesBuf, samplesSizes := flattenSamples(samples)
+	if len(samplesBuf) == 0 {
+		return nil, fmt.Errorf("cannot build dictionary without samples")
+	}
+
+	dictSize := params.DictSize
+	if dictSize == 0 {
+		dictSize = SuggestDictSize(samples)
+	}
+	if dictSize < minDictLen {
+		dictSize = minDictLen
+	}
+	dict := make([]byte, dictSize)
+
+	zParams := C.ZDICT_params_t{
+		compressionLevel: C.int(params.CompressionLevel),
+	}
+
+	// Run the training under lock for the same reason as in BuildDict.
+	buildDictLock.Lock()
+	var result C.size_t
+	if params.FastCover {
+		cp := C.ZDICT_fastCover_params_t{
+			k:         C.unsigned(params.K),
+			d:         C.unsigned(params.D),
+			steps:     C.unsigned(params.Steps),
+			nbThreads: 1,
+			zParams:   zParams,
+		}
+		result = C.ZDICT_optimizeTrainFromBuffer_fastCover(
+			unsafe.Pointer(&dict[0]),
+			C.size_t(len(dict)),
+			unsafe.Pointer(&samplesBuf[0]),
+			&samplesSizes[0],
+			C.unsigned(len(samplesSizes)),
+			&cp)
+	} else {
+		cp := C.ZDICT_cover_params_t{
+			k:         C.unsigned(params.K),
+			d:         C.unsigned(params.D),
+			steps:     C.unsigned(params.Steps),
+			nbThreads: 1,
+			zParams:   zParams,
+		}
+		result = C.ZDICT_optimizeTrainFromBuffer_cover(
+			unsafe.Pointer(&dict[0]),
+			C.size_t(len(dict)),
+			unsafe.Pointer(&samplesBuf[0]),
+			&samplesSizes[0],
+			C.unsigned(len(samplesSizes)),
+			&cp)
+	}
+	buildDictLock.Unlock()
+	if C.ZDICT_isError(result) != 0 {
+		return nil, fmt.Errorf("cannot build dictionary from %d samples: %s", len(samplesSizes), C.GoString(C.ZDICT_getErrorName(result)))
+	}
+
+	dictLen := int(result)
+	return dict[:dictLen], nil
+}
@@ -0,0 +1,103 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func newTestCoverSamples(n int) [][]byte {
+	rnd := rand.New(rand.NewSource(1))
+	statuses := []string{"active", "disabled", "pending", "deleted"}
+	var samples [][]byte
+	for i := 0; i < n; i++ {
+		sample := fmt.Sprintf(`{"id":%d,"name":"user_%d","email":"user_%d@example.com","status":%q,"score":%d,"tags":["tag%d","tag%d"]}`,
+			i, rnd.Intn(100000), rnd.Intn(100000), statuses[rnd.Intn(len(statuses))], rnd.Intn(1000), rnd.Intn(20), rnd.Intn(20))
+		samples = append(samples, []byte(sample))
+	}
+	return samples
+}
+
+func testDictCompressedSize(t *testing.T, dict []byte, samples [][]byte) int {
+	t.Helper()
+	cd, err := NewCDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create CDict: %s", err)
+	}
+	defer cd.Release()
+	dd, err := NewDDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create DDict: %s", err)
+	}
+	defer dd.Release()
+
+	n := 0
+	var compressed, plainData []byte
+	for _, sample := range samples {
+		compressed = CompressDict(compressed[:0], sample, cd)
+		plainData, err = DecompressDict(plainData[:0], compressed, dd)
+		if err != nil {
+			t.Fatalf("cannot decompress sample: %s", err)
+		}
+		if !bytes.Equal(plainData, sample) {
+			t.Fatalf("unexpected sample decompressed; got %q; want %q", plainData, sample)
+		}
+		n += len(compressed)
+	}
+	return n
+}
+
+func TestBuildDictCover(t *testing.T) {
+	samples := newTestCoverSamples(3000)
+	testSamples := newTestCoverSamples(3100)[3000:]
+	dictSize := 4 * 1024
+
+	defaultDict := BuildDict(samples, dictSize)
+	if len(defaultDict) == 0 {
+		t.Fatalf("cannot build the default dict")
+	}
+	defaultSize := testDictCompressedSize(t, defaultDict, testSamples)
+
+	f := func(params CoverParams) {
+		t.Helper()
+		params.DictSize = dictSize
+		dict, err := BuildDictCover(samples, params)
+		if err != nil {
+			t.Fatalf("cannot build dict with %+v: %s", params, err)
+		}
+		if len(dict) == 0 || len(dict) > dictSize {
+			t.Fatalf("unexpected dict size for %+v; got %d; want up to %d", params, len(dict), dictSize)
+		}
+		size := testDictCompressedSize(t, dict, testSamples)
+
+		// The trainer must build a dictionary of comparable quality.
+		if size > defaultSize*105/100 {
+			t.Fatalf("too big compressed size with the dict built with %+v; got %d bytes; the default dict gives %d bytes", params, size, defaultSize)
+		}
+	}
+	f(CoverParams{Steps: 4})
+	f(CoverParams{K: 200, D: 8})
+	f(CoverParams{FastCover: true})
+	f(CoverParams{K: 200, D: 6, CompressionLevel: 5, FastCover: true})
+}
+
+func TestBuildDictCoverError(t *testing.T) {
+	samples := newTestCoverSamples(100)
+	f := func(samples [][]byte, params CoverParams) {
+		t.Helper()
+		dict, err := BuildDictCover(samples, params)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %+v", params)
+		}
+		if dict != nil {
+			t.Fatalf("expecting nil dict on error; got %d bytes", len(dict))
+		}
+	}
+	f(nil, CoverParams{})
+	f([][]byte{nil, {}}, CoverParams{})
+	f(samples, CoverParams{K: -1})
+	f(samples, CoverParams{Steps: -1})
+	f(samples, CoverParams{K: 8, D: 16})
+	f(samples, CoverParams{K: 200, D: 7, FastCover: true})
+}
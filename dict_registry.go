@@ -0,0 +1,63 @@
+package gozstd
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DictRegistry maps dictionary IDs to DDicts.
+//
+// It is used by Readers created via NewReaderRegistry for selecting
+// the dictionary for every frame by the dictionary ID stored in the frame
+// header. This is useful when the stream contains frames compressed
+// with distinct dictionaries, e.g. per-tenant dictionaries.
+//
+// A single DictRegistry may be used by concurrently running goroutines.
+type DictRegistry struct {
+	mu    sync.RWMutex
+	dicts map[uint32]*DDict
+}
+
+// NewDictRegistry returns new empty DictRegistry.
+func NewDictRegistry() *DictRegistry {
+	return &DictRegistry{
+		dicts: make(map[uint32]*DDict),
+	}
+}
+
+// Add adds dd to reg under the dictionary ID of dd.
+//
+// An error is returned if dd has no dictionary ID or if reg already
+// contains a dictionary with the same ID.
+func (reg *DictRegistry) Add(dd *DDict) error {
+	id := dd.DictID()
+	if id == 0 {
+		return fmt.Errorf("cannot add dictionary without ID to the registry")
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if _, ok := reg.dicts[id]; ok {
+		return fmt.Errorf("the registry already contains dictionary with ID %d", id)
+	}
+	reg.dicts[id] = dd
+	return nil
+}
+
+// Remove removes the dictionary with the given id from reg.
+//
+// The removed dictionary isn't released.
+func (reg *DictRegistry) Remove(id uint32) {
+	reg.mu.Lock()
+	delete(reg.dicts, id)
+	reg.mu.Unlock()
+}
+
+// Get returns the dictionary with the given id from reg.
+//
+// Nil is returned if reg doesn't contain the dictionary with the given id.
+func (reg *DictRegistry) Get(id uint32) *DDict {
+	reg.mu.RLock()
+	dd := reg.dicts[id]
+	reg.mu.RUnlock()
+	return dd
+}
@@ -0,0 +1,115 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDictRegistry(t *testing.T) {
+	newDicts := func(prefix string) (*CDict, *DDict) {
+		t.Helper()
+		var samples [][]byte
+		for i := 0; i < 1e4; i++ {
+			sample := []byte(fmt.Sprintf("%s sample number %d", prefix, i))
+			samples = append(samples, sample)
+		}
+		dict := BuildDict(samples, 8*1024)
+		cd, err := NewCDict(dict)
+		if err != nil {
+			t.Fatalf("cannot create CDict: %s", err)
+		}
+		dd, err := NewDDict(dict)
+		if err != nil {
+			t.Fatalf("cannot create DDict: %s", err)
+		}
+		return cd, dd
+	}
+	cd1, dd1 := newDicts("foo")
+	defer cd1.Release()
+	defer dd1.Release()
+	cd2, dd2 := newDicts("bar")
+	defer cd2.Release()
+	defer dd2.Release()
+
+	reg := NewDictRegistry()
+	if err := reg.Add(dd1); err != nil {
+		t.Fatalf("cannot add dd1: %s", err)
+	}
+	if err := reg.Add(dd1); err == nil {
+		t.Fatalf("expecting non-nil error when adding duplicate dictionary")
+	}
+	if err := reg.Add(dd2); err != nil {
+		t.Fatalf("cannot add dd2: %s", err)
+	}
+	if dd := reg.Get(dd1.DictID()); dd != dd1 {
+		t.Fatalf("unexpected dictionary for ID %d", dd1.DictID())
+	}
+
+	// Mix frames compressed with both dictionaries and without a dictionary.
+	var compressed, expected []byte
+	for i := 0; i < 100; i++ {
+		var src []byte
+		switch i % 3 {
+		case 0:
+			src = []byte(fmt.Sprintf("foo sample number %d", i))
+			compressed = CompressDict(compressed, src, cd1)
+		case 1:
+			src = []byte(fmt.Sprintf("bar sample number %d", i))
+			compressed = CompressDict(compressed, src, cd2)
+		default:
+			src = []byte(fmt.Sprintf("no dict sample number %d", i))
+			compressed = Compress(compressed, src)
+		}
+		expected = append(expected, src...)
+	}
+
+	for _, multistream := range []bool{true, false} {
+		zr := NewReaderRegistry(bytes.NewReader(compressed), reg)
+		zr.Multistream(multistream)
+		var result []byte
+		for {
+			data, err := ioutil.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("cannot read data; multistream=%v: %s", multistream, err)
+			}
+			result = append(result, data...)
+			if multistream {
+				break
+			}
+			if err := zr.NextFrame(); err != nil {
+				if err == io.EOF {
+					break
+				}
+				t.Fatalf("cannot read the next frame: %s", err)
+			}
+		}
+		if !bytes.Equal(result, expected) {
+			t.Fatalf("unexpected data decompressed; multistream=%v\ngot\n%q\nwant\n%q", multistream, result, expected)
+		}
+		zr.Release()
+	}
+
+	// Verify that missing dictionary results in error.
+	reg.Remove(dd2.DictID())
+	zr := NewReaderRegistry(bytes.NewReader(compressed), reg)
+	defer zr.Release()
+	if _, err := ioutil.ReadAll(zr); err == nil {
+		t.Fatalf("expecting non-nil error for missing dictionary")
+	}
+
+	// Verify ResetRegistry.
+	if err := reg.Add(dd2); err != nil {
+		t.Fatalf("cannot add dd2: %s", err)
+	}
+	zr.ResetRegistry(bytes.NewReader(compressed), reg)
+	result, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("cannot read data after ResetRegistry: %s", err)
+	}
+	if !bytes.Equal(result, expected) {
+		t.Fatalf("unexpected data decompressed after ResetRegistry")
+	}
+}
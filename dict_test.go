@@ -1,8 +1,12 @@
 package gozstd
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -105,3 +109,445 @@ func testBuildDict(t *testing.T, samples [][]byte, desiredDictLen int) {
 		}
 	}
 }
+
+func TestDictCorrupted(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, []byte(fmt.Sprintf("sample %d", i)))
+	}
+	dict := BuildDict(samples, 8*1024)
+
+	// Corrupt entropy tables, which follow the dictionary magic and ID.
+	corruptedDict := append([]byte{}, dict...)
+	for i := 8; i < 64; i++ {
+		corruptedDict[i] = 0xff
+	}
+
+	cd, err := NewCDict(corruptedDict)
+	if err == nil {
+		t.Fatalf("expecting non-nil error for corrupted CDict")
+	}
+	if cd != nil {
+		t.Fatalf("expecting nil cd")
+	}
+	de, ok := err.(*DictError)
+	if !ok {
+		t.Fatalf("unexpected error type; got %T; want *DictError", err)
+	}
+	if !de.Corrupted {
+		t.Fatalf("expecting corrupted dictionary error; got %q", err)
+	}
+
+	dd, err := NewDDict(corruptedDict)
+	if err == nil {
+		t.Fatalf("expecting non-nil error for corrupted DDict")
+	}
+	if dd != nil {
+		t.Fatalf("expecting nil dd")
+	}
+	de, ok = err.(*DictError)
+	if !ok {
+		t.Fatalf("unexpected error type; got %T; want *DictError", err)
+	}
+	if !de.Corrupted {
+		t.Fatalf("expecting corrupted dictionary error; got %q", err)
+	}
+}
+
+func TestLoadDictFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gozstd-dict")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var samples [][]byte
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, []byte(fmt.Sprintf("load dict sample %d", i)))
+	}
+	dict := BuildDict(samples, 8*1024)
+
+	// Valid dictionary file
+	validPath := filepath.Join(dir, "valid.dict")
+	if err := ioutil.WriteFile(validPath, dict, 0600); err != nil {
+		t.Fatalf("cannot write dict file: %s", err)
+	}
+	cd, err := LoadCDictFile(validPath, 5)
+	if err != nil {
+		t.Fatalf("cannot load CDict from file: %s", err)
+	}
+	defer cd.Release()
+	dd, err := LoadDDictFile(validPath)
+	if err != nil {
+		t.Fatalf("cannot load DDict from file: %s", err)
+	}
+	defer dd.Release()
+	src := []byte("load dict sample 123")
+	compressedData := CompressDict(nil, src, cd)
+	plainData, err := DecompressDict(nil, compressedData, dd)
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data decompressed; got %q; want %q", plainData, src)
+	}
+
+	// Missing file
+	missingPath := filepath.Join(dir, "missing.dict")
+	if _, err := LoadCDictFile(missingPath, 5); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error for missing CDict file; got %v; want not exist error", err)
+	}
+	if _, err := LoadDDictFile(missingPath); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error for missing DDict file; got %v; want not exist error", err)
+	}
+
+	// Garbage after the dictionary magic
+	garbage := append([]byte{}, dict[:8]...)
+	for i := 0; i < 1024; i++ {
+		garbage = append(garbage, 0xff)
+	}
+	garbagePath := filepath.Join(dir, "garbage.dict")
+	if err := ioutil.WriteFile(garbagePath, garbage, 0600); err != nil {
+		t.Fatalf("cannot write dict file: %s", err)
+	}
+	if _, err := LoadCDictFile(garbagePath, 5); err == nil {
+		t.Fatalf("expecting non-nil error for garbage CDict file")
+	} else if de, ok := err.(*DictError); !ok || !de.Corrupted {
+		t.Fatalf("unexpected error for garbage CDict file; got %T %q; want corrupted *DictError", err, err)
+	}
+	if _, err := LoadDDictFile(garbagePath); err == nil {
+		t.Fatalf("expecting non-nil error for garbage DDict file")
+	} else if de, ok := err.(*DictError); !ok || !de.Corrupted {
+		t.Fatalf("unexpected error for garbage DDict file; got %T %q; want corrupted *DictError", err, err)
+	}
+}
+
+func TestDictReload(t *testing.T) {
+	newDict := func(prefix string) []byte {
+		var samples [][]byte
+		for i := 0; i < 1000; i++ {
+			samples = append(samples, []byte(fmt.Sprintf("%s sample %d", prefix, i)))
+		}
+		return BuildDict(samples, 8*1024)
+	}
+	dict1 := newDict("foo")
+	dict2 := newDict("bar")
+
+	cd, err := NewCDict(dict1)
+	if err != nil {
+		t.Fatalf("cannot create CDict: %s", err)
+	}
+	defer cd.Release()
+	dd, err := NewDDict(dict1)
+	if err != nil {
+		t.Fatalf("cannot create DDict: %s", err)
+	}
+	defer dd.Release()
+
+	var bb bytes.Buffer
+	zw := NewWriterDict(&bb, cd)
+	defer zw.Release()
+	zr := NewReaderDict(nil, dd)
+	defer zr.Release()
+
+	compressDecompress := func(src []byte) uint32 {
+		t.Helper()
+		bb.Reset()
+		zw.Reset(&bb, cd, 0)
+		if _, err := zw.Write(src); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw: %s", err)
+		}
+		dictID, err := GetFrameDictID(bb.Bytes())
+		if err != nil {
+			t.Fatalf("cannot get dict ID: %s", err)
+		}
+		zr.Reset(&bb, dd)
+		plainData, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("cannot read data: %s", err)
+		}
+		if !bytes.Equal(plainData, src) {
+			t.Fatalf("unexpected data read; got %q; want %q", plainData, src)
+		}
+		return dictID
+	}
+
+	dictID1 := compressDecompress([]byte("foo sample 42"))
+	if dictID1 == 0 {
+		t.Fatalf("expecting non-zero dict ID")
+	}
+
+	if err := cd.Reload(dict2, 5); err != nil {
+		t.Fatalf("cannot reload CDict: %s", err)
+	}
+	if err := dd.Reload(dict2); err != nil {
+		t.Fatalf("cannot reload DDict: %s", err)
+	}
+	dictID2 := compressDecompress([]byte("bar sample 42"))
+	if dictID2 == 0 || dictID2 == dictID1 {
+		t.Fatalf("unexpected dict ID after reload; got %d; old dict ID %d", dictID2, dictID1)
+	}
+
+	// Failed reload must leave the dicts unchanged.
+	if err := cd.Reload(nil, 5); err == nil {
+		t.Fatalf("expecting error when reloading CDict with empty dict")
+	}
+	if err := dd.Reload(nil); err == nil {
+		t.Fatalf("expecting error when reloading DDict with empty dict")
+	}
+	if dictID := compressDecompress([]byte("bar sample 43")); dictID != dictID2 {
+		t.Fatalf("unexpected dict ID after failed reload; got %d; want %d", dictID, dictID2)
+	}
+}
+
+func TestNewCDictFast(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, []byte(fmt.Sprintf("fast sample %d", i)))
+	}
+	dict := BuildDict(samples, 8*1024)
+	dd, err := NewDDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create DDict: %s", err)
+	}
+	defer dd.Release()
+
+	src := []byte(fmt.Sprintf("fast sample 42 %s", newTestString(1000, 3)))
+	for _, level := range []int{1, 3, 12, 19, 22} {
+		cd, err := NewCDictFast(dict, level)
+		if err != nil {
+			t.Fatalf("cannot create CDict for level %d: %s", level, err)
+		}
+		for _, compressionLevel := range []int{0, 5} {
+			var bb bytes.Buffer
+			zw := NewWriterDictLevel(&bb, cd, compressionLevel)
+			if _, err := zw.Write(src); err != nil {
+				t.Fatalf("cannot write data: %s", err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatalf("cannot close zw: %s", err)
+			}
+			zw.Release()
+			for _, compressed := range [][]byte{bb.Bytes(), CompressDict(nil, src, cd)} {
+				plainData, err := DecompressDict(nil, compressed, dd)
+				if err != nil {
+					t.Fatalf("cannot decompress data for level %d: %s", level, err)
+				}
+				if !bytes.Equal(plainData, src) {
+					t.Fatalf("unexpected data decompressed for level %d", level)
+				}
+			}
+		}
+		cd.Release()
+	}
+
+	if _, err := NewCDictFast(nil, 19); err == nil {
+		t.Fatalf("expecting non-nil error for empty dict")
+	}
+}
+
+func TestNewCDictParams(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, []byte(fmt.Sprintf("params sample %d", i)))
+	}
+	dict := BuildDict(samples, 8*1024)
+	dd, err := NewDDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create DDict: %s", err)
+	}
+	defer dd.Release()
+
+	src := []byte("params sample 42 params sample 43")
+	for _, level := range []int{0, 1, 5, 9, 12, 19} {
+		for _, params := range []CDictParams{
+			{CompressionLevel: level},
+			{CompressionLevel: level, DedicatedDictSearch: true},
+			{CompressionLevel: level, DedicatedDictSearch: true, FastLoad: true},
+		} {
+			cd, err := NewCDictParams(dict, &params)
+			if err != nil {
+				t.Fatalf("cannot create CDict with params %+v: %s", params, err)
+			}
+			for _, attachMode := range []DictAttachMode{0, DictForceCopy} {
+				var bb bytes.Buffer
+				zw := NewWriterParams(&bb, &WriterParams{
+					Dict:            cd,
+					ForceAttachDict: attachMode,
+				})
+				if _, err := zw.Write(src); err != nil {
+					t.Fatalf("cannot write data: %s", err)
+				}
+				if err := zw.Close(); err != nil {
+					t.Fatalf("cannot close zw: %s", err)
+				}
+				zw.Release()
+				for _, compressed := range [][]byte{bb.Bytes(), CompressDict(nil, src, cd)} {
+					plainData, err := DecompressDict(nil, compressed, dd)
+					if err != nil {
+						t.Fatalf("cannot decompress data for params %+v: %s", params, err)
+					}
+					if !bytes.Equal(plainData, src) {
+						t.Fatalf("unexpected data decompressed for params %+v", params)
+					}
+				}
+			}
+			cd.Release()
+		}
+	}
+
+	// Nil params.
+	cd, err := NewCDictParams(dict, nil)
+	if err != nil {
+		t.Fatalf("cannot create CDict with nil params: %s", err)
+	}
+	cd.Release()
+}
+
+func TestSuggestDictSize(t *testing.T) {
+	f := func(samplesCount, sampleLen, sizeExpected int) {
+		t.Helper()
+		samples := make([][]byte, samplesCount)
+		for i := range samples {
+			samples[i] = make([]byte, sampleLen)
+		}
+		size := SuggestDictSize(samples)
+		if size != sizeExpected {
+			t.Fatalf("unexpected dict size for %d samples of %d bytes; got %d; want %d", samplesCount, sampleLen, size, sizeExpected)
+		}
+		if size < minSuggestedDictLen || size > maxSuggestedDictLen {
+			t.Fatalf("dict size %d is out of range [%d ... %d]", size, minSuggestedDictLen, maxSuggestedDictLen)
+		}
+	}
+	f(0, 0, minSuggestedDictLen)
+	f(100, 0, minSuggestedDictLen)
+	f(10, 100, minSuggestedDictLen)
+	f(1000, 1000, 10000)
+	f(2000, 2000, 40000)
+	f(1000, 100*1000, maxSuggestedDictLen)
+}
+
+func TestBuildDictAuto(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 3000; i++ {
+		sample := fmt.Sprintf(`{"id":%d,"name":"user_%d","email":"user_%d@example.com","status":"active","score":%d}`, i, i, i, rand.Intn(1000))
+		samples = append(samples, []byte(sample))
+	}
+	dict, err := BuildDictAuto(samples)
+	if err != nil {
+		t.Fatalf("cannot build dict: %s", err)
+	}
+	if len(dict) == 0 || len(dict) > SuggestDictSize(samples) {
+		t.Fatalf("unexpected dict size; got %d; want up to %d", len(dict), SuggestDictSize(samples))
+	}
+
+	cd, err := NewCDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create CDict: %s", err)
+	}
+	defer cd.Release()
+	dd, err := NewDDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create DDict: %s", err)
+	}
+	defer dd.Release()
+
+	data := []byte(`{"id":12345,"name":"user_12345","email":"user_12345@example.com","status":"active","score":42}`)
+	compressed := Compress(nil, data)
+	compressedDict := CompressDict(nil, data, cd)
+	if len(compressedDict) >= len(compressed) {
+		t.Fatalf("the dictionary doesn't improve compression; got %d bytes with dict; %d bytes without dict", len(compressedDict), len(compressed))
+	}
+	plainData, err := DecompressDict(nil, compressedDict, dd)
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if !bytes.Equal(plainData, data) {
+		t.Fatalf("unexpected data decompressed; got %q; want %q", plainData, data)
+	}
+}
+
+func TestBuildDictAutoError(t *testing.T) {
+	if _, err := BuildDictAuto(nil); err == nil {
+		t.Fatalf("expecting non-nil error when building dict without samples")
+	}
+	if _, err := BuildDictAuto([][]byte{nil, {}}); err == nil {
+		t.Fatalf("expecting non-nil error when building dict from empty samples")
+	}
+}
+
+func TestFinalizeDict(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 3000; i++ {
+		sample := fmt.Sprintf(`{"id":%d,"name":"user_%d","email":"user_%d@example.com","status":"active","score":%d}`, i, rand.Intn(100000), rand.Intn(100000), rand.Intn(1000))
+		samples = append(samples, []byte(sample))
+	}
+	rawContent := bytes.Join(samples[:4], nil)
+	dict, err := FinalizeDict(rawContent, samples, 4*1024, 3)
+	if err != nil {
+		t.Fatalf("cannot finalize dict: %s", err)
+	}
+	if len(dict) <= len(rawContent) || len(dict) > 4*1024 {
+		t.Fatalf("unexpected dict size; got %d bytes; want (%d ... %d] bytes", len(dict), len(rawContent), 4*1024)
+	}
+	if !bytes.HasSuffix(dict, rawContent) {
+		t.Fatalf("the dict must end with rawContent")
+	}
+
+	compressedSize := func(dict []byte) int {
+		t.Helper()
+		cd, err := NewCDictLevel(dict, 3)
+		if err != nil {
+			t.Fatalf("cannot create CDict: %s", err)
+		}
+		defer cd.Release()
+		dd, err := NewDDict(dict)
+		if err != nil {
+			t.Fatalf("cannot create DDict: %s", err)
+		}
+		defer dd.Release()
+
+		n := 0
+		for i := 0; i < 100; i++ {
+			data := []byte(fmt.Sprintf(`{"id":%d,"name":"user_%d","email":"user_%d@example.com","status":"active","score":%d}`, 5000+i, rand.Intn(100000), rand.Intn(100000), rand.Intn(1000)))
+			compressed := CompressDict(nil, data, cd)
+			plainData, err := DecompressDict(nil, compressed, dd)
+			if err != nil {
+				t.Fatalf("cannot decompress data: %s", err)
+			}
+			if !bytes.Equal(plainData, data) {
+				t.Fatalf("unexpected data decompressed; got %q; want %q", plainData, data)
+			}
+			n += len(compressed)
+		}
+		return n
+	}
+	finalizedSize := compressedSize(dict)
+	rawSize := compressedSize(rawContent)
+	if finalizedSize >= rawSize {
+		t.Fatalf("the finalized dict must outperform the raw content; got %d bytes vs %d bytes", finalizedSize, rawSize)
+	}
+}
+
+func TestFinalizeDictError(t *testing.T) {
+	rawContent := bytes.Repeat([]byte("foobar"), 100)
+	samples := [][]byte{[]byte("foo"), []byte("bar")}
+	f := func(rawContent []byte, samples [][]byte, maxDictSize int) {
+		t.Helper()
+		dict, err := FinalizeDict(rawContent, samples, maxDictSize, 3)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if dict != nil {
+			t.Fatalf("expecting nil dict on error; got %d bytes", len(dict))
+		}
+	}
+	f(nil, samples, 1024)
+	f([]byte("foo"), samples, 1024)
+	f(rawContent, samples, 100)
+	f(rawContent, samples, len(rawContent)-1)
+	f(rawContent, nil, 1024)
+}
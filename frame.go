@@ -0,0 +1,322 @@
+package gozstd
+
+/*
+#cgo CFLAGS: -O3
+
+#define ZSTD_STATIC_LINKING_ONLY
+// ZSTD_getDecompressedSize is deprecated, but it is needed by LegacyDecompressedSize.
+#define ZSTD_DISABLE_DEPRECATE_WARNINGS
+#include "zstd.h"
+#include "zstd_errors.h"
+
+#include <stdint.h>  // for uintptr_t
+
+// The following *_wrapper functions allow avoiding memory allocations
+// durting calls from Go.
+// See https://github.com/golang/go/issues/24450 .
+
+static size_t ZSTD_findFrameCompressedSize_wrapper(uintptr_t src, size_t srcSize) {
+    return ZSTD_findFrameCompressedSize((const void*)src, srcSize);
+}
+
+static unsigned long long ZSTD_getDecompressedSize_wrapper(uintptr_t src, size_t srcSize) {
+    return ZSTD_getDecompressedSize((const void*)src, srcSize);
+}
+
+static size_t ZSTD_getFrameHeader_wrapper(uintptr_t zfh, uintptr_t src, size_t srcSize) {
+    return ZSTD_getFrameHeader((ZSTD_frameHeader*)zfh, (const void*)src, srcSize);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+const (
+	// FrameMagic is the magic number at the start of every zstd frame.
+	FrameMagic uint32 = C.ZSTD_MAGICNUMBER
+
+	// SkippableFrameMagicStart is the magic number for the first variant
+	// of skippable frames.
+	//
+	// Skippable frames have magic numbers in the range
+	// [SkippableFrameMagicStart ... SkippableFrameMagicStart+15].
+	// See IsSkippableMagic.
+	SkippableFrameMagicStart uint32 = C.ZSTD_MAGIC_SKIPPABLE_START
+)
+
+// IsSkippableMagic returns true if m is the magic number of a skippable frame.
+//
+// The magic number is stored in little-endian byte order at the start
+// of every frame.
+func IsSkippableMagic(m uint32) bool {
+	return m&C.ZSTD_MAGIC_SKIPPABLE_MASK == SkippableFrameMagicStart
+}
+
+// GetFrameWindowSize returns the window size required for decompressing
+// the frame at the start of src.
+//
+// The window size is obtained from the frame header, so it may be used
+// for deciding whether the frame may be decompressed with the given
+// memory limits before the decompression.
+//
+// Zero window size is returned for skippable frames.
+func GetFrameWindowSize(src []byte) (uint64, error) {
+	var fh C.ZSTD_frameHeader
+	if err := getFrameHeader(&fh, src); err != nil {
+		return 0, err
+	}
+	return uint64(fh.windowSize), nil
+}
+
+// GetFrameDictID returns the dictionary ID for the frame at the start of src.
+//
+// Zero is returned if the frame was created without a dictionary or if
+// the dictionary ID wasn't written into the frame header.
+func GetFrameDictID(src []byte) (uint32, error) {
+	var fh C.ZSTD_frameHeader
+	if err := getFrameHeader(&fh, src); err != nil {
+		return 0, err
+	}
+	return uint32(fh.dictID), nil
+}
+
+// LegacyDecompressedSize returns the decompressed size for the frame
+// at the start of src using the semantics of the deprecated
+// ZSTD_getDecompressedSize function.
+//
+// Unlike RequiredOutputSize, it blends errors with the unknown size:
+// zero is returned if the decompressed size isn't stored in the frame header,
+// if src doesn't start with a valid frame header or if the frame is empty.
+// This is useful for tools, which must stay compatible with the behavior
+// of older zstd versions.
+func LegacyDecompressedSize(src []byte) uint64 {
+	if len(src) == 0 {
+		return 0
+	}
+	result := C.ZSTD_getDecompressedSize_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(&src[0]))),
+		C.size_t(len(src)))
+	// Prevent from GC'ing of src during CGO call above.
+	runtime.KeepAlive(src)
+	return uint64(result)
+}
+
+func getFrameHeader(fh *C.ZSTD_frameHeader, src []byte) error {
+	if len(src) == 0 {
+		return fmt.Errorf("cannot read frame header from empty src")
+	}
+	n, err := parseFrameHeader(fh, src)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("cannot read frame header: src is too short; got %d bytes; need at least %d bytes", len(src), n)
+	}
+	return nil
+}
+
+// parseFrameHeader parses the frame header at the start of src into fh.
+//
+// It returns the minimum size of src required for parsing the header
+// if src is too short. Otherwise zero is returned.
+func parseFrameHeader(fh *C.ZSTD_frameHeader, src []byte) (int, error) {
+	if len(src) == 0 {
+		return int(frameHeaderSizePrefix), nil
+	}
+	result := C.ZSTD_getFrameHeader_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(fh))),
+		C.uintptr_t(uintptr(unsafe.Pointer(&src[0]))),
+		C.size_t(len(src)))
+	// Prevent from GC'ing of fh and src during CGO call above.
+	runtime.KeepAlive(fh)
+	runtime.KeepAlive(src)
+	if C.ZSTD_getErrorCode(result) != 0 {
+		return 0, fmt.Errorf("cannot read frame header: %s", errStr(result))
+	}
+	return int(result), nil
+}
+
+// ForEachFrame calls fn for every frame in src.
+//
+// src may contain concatenated frames. fn is called with the compressed frame
+// and its decompressed contents in the order the frames are stored in src.
+// Skippable frames are passed to fn with empty decompressed contents.
+//
+// fn mustn't hold references to frame and decompressed after returning,
+// since decompressed is re-used between fn calls.
+// ForEachFrame stops at the first error returned from fn and returns it.
+func ForEachFrame(src []byte, fn func(frame, decompressed []byte) error) error {
+	var buf []byte
+	for len(src) > 0 {
+		n, err := findFrameCompressedSize(src)
+		if err != nil {
+			return err
+		}
+		frame := src[:n]
+		buf, err = Decompress(buf[:0], frame)
+		if err != nil {
+			return fmt.Errorf("cannot decompress frame: %s", err)
+		}
+		if err := fn(frame, buf); err != nil {
+			return err
+		}
+		src = src[n:]
+	}
+	return nil
+}
+
+// DecompressFrameAt decompresses the frame with the given index in src.
+//
+// src may contain concatenated frames. The frames preceding the frame
+// with the given index are skipped without the decompression, so this
+// is useful for record stores addressing records by frame index.
+// Skippable frames are counted as regular frames.
+func DecompressFrameAt(src []byte, index int) ([]byte, error) {
+	if index < 0 {
+		return nil, fmt.Errorf("frame index cannot be negative; got %d", index)
+	}
+	for i := 0; len(src) > 0; i++ {
+		n, err := findFrameCompressedSize(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find frame #%d: %s", i, err)
+		}
+		if i == index {
+			return Decompress(nil, src[:n])
+		}
+		src = src[n:]
+	}
+	return nil, fmt.Errorf("frame index %d is out of range", index)
+}
+
+// ConcatFrames appends the given frames to dst and returns the result.
+//
+// Every frame must contain exactly one complete zstd frame. The result
+// may be decompressed as a single stream, which is equivalent
+// to the concatenation of the decompressed frames. This allows merging
+// pre-compressed chunks without the decompression and the recompression.
+//
+// dst remains unchanged on error.
+func ConcatFrames(dst []byte, frames ...[]byte) ([]byte, error) {
+	for i, frame := range frames {
+		n, err := findFrameCompressedSize(frame)
+		if err != nil {
+			return dst, fmt.Errorf("invalid frame #%d: %s", i, err)
+		}
+		if n != len(frame) {
+			return dst, fmt.Errorf("invalid frame #%d: it must contain exactly one frame; got %d trailing bytes after the first frame", i, len(frame)-n)
+		}
+	}
+	for _, frame := range frames {
+		dst = append(dst, frame...)
+	}
+	return dst, nil
+}
+
+// ExtractFrameChecksum returns the content checksum stored at the end
+// of the frame at the start of src.
+//
+// The checksum is obtained without the decompression, so it may be used
+// for validating the data decompressed by external tools. The checksum
+// contains the lower 32 bits of xxHash64 with zero seed for the decompressed
+// frame contents. present is false if the frame has no checksum.
+func ExtractFrameChecksum(src []byte) (present bool, checksum uint32, err error) {
+	var fh C.ZSTD_frameHeader
+	if err := getFrameHeader(&fh, src); err != nil {
+		return false, 0, err
+	}
+	if fh.frameType != C.ZSTD_frame || fh.checksumFlag == 0 {
+		return false, 0, nil
+	}
+	n, err := findFrameCompressedSize(src)
+	if err != nil {
+		return false, 0, err
+	}
+	// findFrameCompressedSize guarantees the frame contains the checksum.
+	b := src[n-4 : n]
+	checksum = uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+	return true, checksum, nil
+}
+
+// CountFrames returns the number of frames in src.
+//
+// src may contain concatenated frames. Skippable frames are counted
+// only if countSkippable is set. An error is returned if src contains
+// incomplete frames or trailing garbage.
+func CountFrames(src []byte, countSkippable bool) (int, error) {
+	n := 0
+	for len(src) > 0 {
+		var fh C.ZSTD_frameHeader
+		if err := getFrameHeader(&fh, src); err != nil {
+			return 0, fmt.Errorf("cannot read frame #%d: %s", n, err)
+		}
+		frameSize, err := findFrameCompressedSize(src)
+		if err != nil {
+			return 0, fmt.Errorf("cannot read frame #%d: %s", n, err)
+		}
+		if countSkippable || fh.frameType != C.ZSTD_skippableFrame {
+			n++
+		}
+		src = src[frameSize:]
+	}
+	return n, nil
+}
+
+// appendSkippableFrame appends skippable frame with the given magicVariant
+// and data to dst and returns the result.
+func appendSkippableFrame(dst []byte, magicVariant uint32, data []byte) []byte {
+	magic := SkippableFrameMagicStart + magicVariant
+	n := uint32(len(data))
+	dst = append(dst, byte(magic), byte(magic>>8), byte(magic>>16), byte(magic>>24))
+	dst = append(dst, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	return append(dst, data...)
+}
+
+// findFrameCompressedSize returns the size of the compressed frame
+// at the start of src.
+func findFrameCompressedSize(src []byte) (int, error) {
+	if len(src) == 0 {
+		return 0, fmt.Errorf("cannot find frame size in empty src")
+	}
+	result := C.ZSTD_findFrameCompressedSize_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(&src[0]))),
+		C.size_t(len(src)))
+	// Prevent from GC'ing of src during CGO call above.
+	runtime.KeepAlive(src)
+	if C.ZSTD_getErrorCode(result) != 0 {
+		return 0, fmt.Errorf("cannot find frame size: %s", errStr(result))
+	}
+	return int(result), nil
+}
+
+// checkFrameChecksums verifies whether all the frames in src
+// contain the content checksum.
+//
+// An error is returned if src contains no frames with the checksum.
+func checkFrameChecksums(src []byte) error {
+	checksums := 0
+	for len(src) > 0 {
+		var fh C.ZSTD_frameHeader
+		if err := getFrameHeader(&fh, src); err != nil {
+			return err
+		}
+		if fh.frameType == C.ZSTD_frame && fh.checksumFlag == 0 {
+			return fmt.Errorf("missing content checksum in the frame")
+		}
+		if fh.frameType == C.ZSTD_frame {
+			checksums++
+		}
+		n, err := findFrameCompressedSize(src)
+		if err != nil {
+			return err
+		}
+		src = src[n:]
+	}
+	if checksums == 0 {
+		return fmt.Errorf("missing frames with content checksum")
+	}
+	return nil
+}
@@ -0,0 +1,449 @@
+package gozstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestGetFrameWindowSize(t *testing.T) {
+	src := []byte(newTestString(64*1024, 20))
+	for _, wlog := range []int{WindowLogMin, 12, 17, 20, 24, 27} {
+		var bb bytes.Buffer
+		zw := NewWriterParams(&bb, &WriterParams{
+			WindowLog: wlog,
+		})
+		if _, err := zw.Write(src); err != nil {
+			t.Fatalf("cannot write data with wlog %d: %s", wlog, err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw with wlog %d: %s", wlog, err)
+		}
+		zw.Release()
+
+		windowSize, err := GetFrameWindowSize(bb.Bytes())
+		if err != nil {
+			t.Fatalf("unexpected error for wlog %d: %s", wlog, err)
+		}
+		if windowSize != 1<<uint(wlog) {
+			t.Fatalf("unexpected window size for wlog %d; got %d; want %d", wlog, windowSize, 1<<uint(wlog))
+		}
+	}
+}
+
+func TestGetFrameWindowSizeInvalidData(t *testing.T) {
+	if _, err := GetFrameWindowSize(nil); err == nil {
+		t.Fatalf("expecting error for empty src")
+	}
+	if _, err := GetFrameWindowSize([]byte("invalid frame header")); err == nil {
+		t.Fatalf("expecting error for invalid src")
+	}
+	cd := Compress(nil, []byte("foobar"))
+	if _, err := GetFrameWindowSize(cd[:3]); err == nil {
+		t.Fatalf("expecting error for truncated src")
+	}
+}
+
+func TestGetFrameDictID(t *testing.T) {
+	cd := Compress(nil, []byte("foobar"))
+	dictID, err := GetFrameDictID(cd)
+	if err != nil {
+		t.Fatalf("cannot get dict ID: %s", err)
+	}
+	if dictID != 0 {
+		t.Fatalf("unexpected dict ID for frame without dictionary; got %d; want 0", dictID)
+	}
+	if _, err := GetFrameDictID(nil); err == nil {
+		t.Fatalf("expecting error for empty src")
+	}
+}
+
+func TestForEachFrame(t *testing.T) {
+	var src []byte
+	var frames, blocks [][]byte
+	for i := 1; i <= 10; i++ {
+		block := []byte(newTestString(1000*i, 3))
+		frame := CompressLevel(nil, block, i)
+		src = append(src, frame...)
+		frames = append(frames, frame)
+		blocks = append(blocks, block)
+	}
+
+	i := 0
+	err := ForEachFrame(src, func(frame, decompressed []byte) error {
+		if i >= len(frames) {
+			t.Fatalf("too many frames; want %d frames", len(frames))
+		}
+		if !bytes.Equal(frame, frames[i]) {
+			t.Fatalf("unexpected frame #%d", i)
+		}
+		if !bytes.Equal(decompressed, blocks[i]) {
+			t.Fatalf("unexpected decompressed data for frame #%d", i)
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if i != len(frames) {
+		t.Fatalf("unexpected number of frames; got %d; want %d", i, len(frames))
+	}
+
+	// The error from fn must stop the iteration.
+	errStop := fmt.Errorf("stop")
+	i = 0
+	err = ForEachFrame(src, func(frame, decompressed []byte) error {
+		i++
+		if i == 3 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("unexpected error; got %v; want %v", err, errStop)
+	}
+	if i != 3 {
+		t.Fatalf("unexpected number of fn calls; got %d; want 3", i)
+	}
+
+	// Invalid trailing data
+	err = ForEachFrame(append(src, "foobar"...), func(frame, decompressed []byte) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("expecting error for invalid trailing data")
+	}
+}
+
+func TestDecompressFrameAt(t *testing.T) {
+	var src []byte
+	var records [][]byte
+	for i := 0; i < 3; i++ {
+		record := []byte(fmt.Sprintf("record #%d: %s", i, newTestString(1000, 3)))
+		src = Compress(src, record)
+		records = append(records, record)
+	}
+
+	data, err := DecompressFrameAt(src, 1)
+	if err != nil {
+		t.Fatalf("cannot decompress frame: %s", err)
+	}
+	if !bytes.Equal(data, records[1]) {
+		t.Fatalf("unexpected data decompressed; got\n%q; want\n%q", data, records[1])
+	}
+	for i, record := range records {
+		data, err := DecompressFrameAt(src, i)
+		if err != nil {
+			t.Fatalf("cannot decompress frame #%d: %s", i, err)
+		}
+		if !bytes.Equal(data, record) {
+			t.Fatalf("unexpected data decompressed for frame #%d", i)
+		}
+	}
+
+	for _, index := range []int{-1, 3, 100} {
+		if _, err := DecompressFrameAt(src, index); err == nil {
+			t.Fatalf("expecting error for out of range index %d", index)
+		}
+	}
+}
+
+func TestLegacyDecompressedSize(t *testing.T) {
+	src := []byte(newTestString(64*1024, 3))
+
+	// The frame with content size.
+	compressed := CompressLevel(nil, src, 1)
+	if n := LegacyDecompressedSize(compressed); n != uint64(len(src)) {
+		t.Fatalf("unexpected size for frame with content size; got %d; want %d", n, len(src))
+	}
+
+	// The frame without content size.
+	var bb bytes.Buffer
+	zw := NewWriterLevel(&bb, 1)
+	if _, err := zw.Write(src); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	zw.Release()
+	if _, err := RequiredOutputSize(bb.Bytes()); err != ErrUnknownContentSize {
+		t.Fatalf("unexpected error for frame without content size; got %v; want %v", err, ErrUnknownContentSize)
+	}
+	if n := LegacyDecompressedSize(bb.Bytes()); n != 0 {
+		t.Fatalf("unexpected size for frame without content size; got %d; want 0", n)
+	}
+
+	// Invalid frames.
+	for _, s := range []string{"", "x", "foobarbaz"} {
+		if n := LegacyDecompressedSize([]byte(s)); n != 0 {
+			t.Fatalf("unexpected size for invalid frame %q; got %d; want 0", s, n)
+		}
+	}
+}
+
+func TestConcatFrames(t *testing.T) {
+	const workersCount = 5
+	chunks := make([][]byte, workersCount)
+	frames := make([][]byte, workersCount)
+	var wg sync.WaitGroup
+	for i := 0; i < workersCount; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			chunks[n] = []byte(fmt.Sprintf("worker %d: %s", n, newTestString(10000*(n+1), 3)))
+			frames[n] = Compress(nil, chunks[n])
+		}(i)
+	}
+	wg.Wait()
+
+	prefix := []byte("prefix")
+	result, err := ConcatFrames(append([]byte{}, prefix...), frames...)
+	if err != nil {
+		t.Fatalf("cannot concatenate frames: %s", err)
+	}
+	if !bytes.HasPrefix(result, prefix) {
+		t.Fatalf("missing dst prefix in the result")
+	}
+	var expected []byte
+	for _, chunk := range chunks {
+		expected = append(expected, chunk...)
+	}
+	plainData, err := Decompress(nil, result[len(prefix):])
+	if err != nil {
+		t.Fatalf("cannot decompress concatenated frames: %s", err)
+	}
+	if !bytes.Equal(plainData, expected) {
+		t.Fatalf("unexpected data decompressed from concatenated frames")
+	}
+	var bb bytes.Buffer
+	if err := StreamDecompress(&bb, bytes.NewReader(result[len(prefix):])); err != nil {
+		t.Fatalf("cannot stream decompress concatenated frames: %s", err)
+	}
+	if !bytes.Equal(bb.Bytes(), expected) {
+		t.Fatalf("unexpected data stream decompressed from concatenated frames")
+	}
+
+	// Invalid frames.
+	twoFrames := append(append([]byte{}, frames[0]...), frames[1]...)
+	for _, frame := range [][]byte{nil, []byte("foobar"), frames[0][:len(frames[0])-1], twoFrames} {
+		dst, err := ConcatFrames(prefix, frames[0], frame)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for invalid frame %q", frame)
+		}
+		if string(dst) != string(prefix) {
+			t.Fatalf("unexpected dst on error; got %q; want %q", dst, prefix)
+		}
+	}
+}
+
+func newTestSkippableFrame(payload string) []byte {
+	frame := []byte{0x50, 0x2a, 0x4d, 0x18}
+	n := len(payload)
+	frame = append(frame, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	return append(frame, payload...)
+}
+
+func TestCountFrames(t *testing.T) {
+	f := func(src []byte, countSkippable bool, nExpected int) {
+		t.Helper()
+		n, err := CountFrames(src, countSkippable)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if n != nExpected {
+			t.Fatalf("unexpected number of frames for countSkippable=%v; got %d; want %d", countSkippable, n, nExpected)
+		}
+	}
+
+	// Empty src.
+	f(nil, false, 0)
+
+	// Single frame.
+	frame := Compress(nil, []byte("foobar"))
+	f(frame, false, 1)
+	f(frame, true, 1)
+
+	// Multiple frames.
+	var src []byte
+	for i := 0; i < 10; i++ {
+		src = Compress(src, []byte(fmt.Sprintf("frame %d %s", i, newTestString(1000*i, 3))))
+	}
+	f(src, false, 10)
+	f(src, true, 10)
+
+	// Multiple frames ending with a skippable frame.
+	src = append(src, newTestSkippableFrame("skippable payload")...)
+	f(src, false, 10)
+	f(src, true, 11)
+
+	// Trailing garbage.
+	for _, garbage := range []string{"x", "foobarbaz", string(frame[:len(frame)-1])} {
+		if _, err := CountFrames(append(append([]byte{}, src...), garbage...), true); err == nil {
+			t.Fatalf("expecting non-nil error for trailing garbage %q", garbage)
+		}
+	}
+}
+
+func TestExtractFrameChecksum(t *testing.T) {
+	for _, size := range []int{1, 3, 31, 32, 100, 64 * 1024, 1024 * 1024} {
+		src := []byte(newTestString(size, 3))
+
+		compressed := SafeCompress(nil, src, DefaultCompressionLevel)
+		present, checksum, err := ExtractFrameChecksum(compressed)
+		if err != nil {
+			t.Fatalf("cannot extract checksum for size=%d: %s", size, err)
+		}
+		if !present {
+			t.Fatalf("missing checksum for size=%d", size)
+		}
+		plainData, err := Decompress(nil, compressed)
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		checksumExpected := uint32(testXXHash64(plainData))
+		if checksum != checksumExpected {
+			t.Fatalf("unexpected checksum for size=%d; got %08X; want %08X", size, checksum, checksumExpected)
+		}
+	}
+
+	// The frame without checksum.
+	present, _, err := ExtractFrameChecksum(Compress(nil, []byte("foobar")))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if present {
+		t.Fatalf("unexpected checksum for the frame without checksum")
+	}
+
+	// Skippable frame.
+	present, _, err = ExtractFrameChecksum(newTestSkippableFrame("foobar"))
+	if err != nil {
+		t.Fatalf("unexpected error for skippable frame: %s", err)
+	}
+	if present {
+		t.Fatalf("unexpected checksum for skippable frame")
+	}
+
+	// Invalid frames.
+	compressed := SafeCompress(nil, []byte("foobar"), DefaultCompressionLevel)
+	for _, src := range [][]byte{nil, []byte("foobar"), compressed[:len(compressed)-1]} {
+		if _, _, err := ExtractFrameChecksum(src); err == nil {
+			t.Fatalf("expecting non-nil error for invalid frame %q", src)
+		}
+	}
+}
+
+// testXXHash64 returns xxHash64 with zero seed for b.
+func testXXHash64(b []byte) uint64 {
+	const (
+		p1 uint64 = 11400714785074694791
+		p2 uint64 = 14029467366897019727
+		p3 uint64 = 1609587929392839161
+		p4 uint64 = 9650029242287828579
+		p5 uint64 = 2870177450012600261
+	)
+	rotl := func(x uint64, r uint) uint64 {
+		return (x << r) | (x >> (64 - r))
+	}
+	round := func(acc, input uint64) uint64 {
+		acc += input * p2
+		acc = rotl(acc, 31)
+		return acc * p1
+	}
+	mergeRound := func(acc, v uint64) uint64 {
+		acc ^= round(0, v)
+		return acc*p1 + p4
+	}
+	u64 := func(b []byte) uint64 {
+		return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24 |
+			uint64(b[4])<<32 | uint64(b[5])<<40 | uint64(b[6])<<48 | uint64(b[7])<<56
+	}
+	u32 := func(b []byte) uint64 {
+		return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24
+	}
+
+	n := len(b)
+	var h uint64
+	if n >= 32 {
+		// Use variables for p1 and p2, since p1+p2 and -p1 overflow constants.
+		x1, x2 := p1, p2
+		v1 := x1 + x2
+		v2 := x2
+		v3 := uint64(0)
+		v4 := -x1
+		for len(b) >= 32 {
+			v1 = round(v1, u64(b[0:]))
+			v2 = round(v2, u64(b[8:]))
+			v3 = round(v3, u64(b[16:]))
+			v4 = round(v4, u64(b[24:]))
+			b = b[32:]
+		}
+		h = rotl(v1, 1) + rotl(v2, 7) + rotl(v3, 12) + rotl(v4, 18)
+		h = mergeRound(h, v1)
+		h = mergeRound(h, v2)
+		h = mergeRound(h, v3)
+		h = mergeRound(h, v4)
+	} else {
+		h = p5
+	}
+	h += uint64(n)
+	for len(b) >= 8 {
+		h ^= round(0, u64(b))
+		h = rotl(h, 27)*p1 + p4
+		b = b[8:]
+	}
+	if len(b) >= 4 {
+		h ^= u32(b) * p1
+		h = rotl(h, 23)*p2 + p3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * p5
+		h = rotl(h, 11) * p1
+	}
+	h ^= h >> 33
+	h *= p2
+	h ^= h >> 29
+	h *= p3
+	h ^= h >> 32
+	return h
+}
+
+func TestFrameMagic(t *testing.T) {
+	if FrameMagic != 0xFD2FB528 {
+		t.Fatalf("unexpected FrameMagic; got 0x%08X; want 0x%08X", FrameMagic, 0xFD2FB528)
+	}
+	compressed := Compress(nil, []byte("foobar"))
+	magic := binary.LittleEndian.Uint32(compressed)
+	if magic != FrameMagic {
+		t.Fatalf("unexpected magic for compressed frame; got 0x%08X; want 0x%08X", magic, FrameMagic)
+	}
+	if IsSkippableMagic(magic) {
+		t.Fatalf("FrameMagic mustn't be skippable")
+	}
+}
+
+func TestIsSkippableMagic(t *testing.T) {
+	for variant := uint32(0); variant < 16; variant++ {
+		m := SkippableFrameMagicStart + variant
+		if !IsSkippableMagic(m) {
+			t.Fatalf("expecting skippable magic for 0x%08X", m)
+		}
+		frame := appendSkippableFrame(nil, variant, []byte("foo"))
+		if magic := binary.LittleEndian.Uint32(frame); magic != m {
+			t.Fatalf("unexpected magic for skippable frame variant %d; got 0x%08X; want 0x%08X", variant, magic, m)
+		}
+	}
+	if SkippableFrameMagicStart != 0x184D2A50 {
+		t.Fatalf("unexpected SkippableFrameMagicStart; got 0x%08X; want 0x%08X", SkippableFrameMagicStart, 0x184D2A50)
+	}
+	for _, m := range []uint32{0, 0x184D2A4F, 0x184D2A60, 0x184D2B50, 0x284D2A50, FrameMagic, 0xFFFFFFFF} {
+		if IsSkippableMagic(m) {
+			t.Fatalf("unexpected skippable magic for 0x%08X", m)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+//go:build go1.18
+// +build go1.18
+
+package gozstd
+
+import (
+	"testing"
+)
+
+func FuzzRoundTrip(f *testing.F) {
+	for _, data := range fuzzSeedCorpus() {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzRoundTrip(data)
+	})
+}
+
+func FuzzDecompress(f *testing.F) {
+	for _, data := range fuzzSeedCorpus() {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzDecompress(data)
+	})
+}
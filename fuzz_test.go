@@ -0,0 +1,134 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// fuzzRoundTrip compresses data, decompresses the result and panics
+// if the decompressed data doesn't match data.
+func fuzzRoundTrip(data []byte) {
+	for _, level := range []int{1, DefaultCompressionLevel, 19} {
+		compressed := CompressLevel(nil, data, level)
+		plainData, err := Decompress(nil, compressed)
+		if err != nil {
+			panic(fmt.Errorf("cannot decompress data compressed at level %d: %s", level, err))
+		}
+		if !bytes.Equal(plainData, data) {
+			panic(fmt.Errorf("unexpected data decompressed at level %d; got %d bytes; want %d bytes", level, len(plainData), len(data)))
+		}
+	}
+
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	if _, err := zw.Write(data); err != nil {
+		panic(fmt.Errorf("cannot write data to the writer: %s", err))
+	}
+	if err := zw.Close(); err != nil {
+		panic(fmt.Errorf("cannot close the writer: %s", err))
+	}
+	zw.Release()
+
+	zr := NewReader(&bb)
+	plainData, err := ioutil.ReadAll(zr)
+	zr.Release()
+	if err != nil {
+		panic(fmt.Errorf("cannot read data from the reader: %s", err))
+	}
+	if !bytes.Equal(plainData, data) {
+		panic(fmt.Errorf("unexpected data read from the reader; got %d bytes; want %d bytes", len(plainData), len(data)))
+	}
+}
+
+// fuzzDecompress decompresses arbitrary data with Decompress, SafeDecompress
+// and Reader.
+//
+// Malformed data must result in *DecompressError, so fuzzDecompress panics
+// if the decompression returns an error of other type.
+func fuzzDecompress(data []byte) {
+	checkError := func(funcName string, err error) {
+		if err == nil {
+			return
+		}
+		if _, ok := err.(*DecompressError); !ok {
+			panic(fmt.Errorf("unexpected error type returned from %s; got %T; want *DecompressError; error: %s", funcName, err, err))
+		}
+	}
+
+	// Cap the decompressed size, since valid frames may expand
+	// into huge amounts of data.
+	const maxSize = 1 << 24
+	if _, err := SafeDecompressedSize(data, maxSize); err == nil {
+		_, err := Decompress(nil, data)
+		checkError("Decompress", err)
+		_, err = SafeDecompress(nil, data)
+		checkError("SafeDecompress", err)
+	}
+
+	zr := NewReader(bytes.NewReader(data))
+	_, err := io.Copy(ioutil.Discard, io.LimitReader(zr, maxSize))
+	zr.Release()
+	checkError("Reader", err)
+}
+
+func fuzzSeedCorpus() [][]byte {
+	src := []byte(newTestString(1000, 10))
+	compressed := Compress(nil, src)
+	corrupted := append([]byte{}, compressed...)
+	corrupted[len(corrupted)/2] ^= 0xff
+
+	return [][]byte{
+		nil,
+		[]byte("foobar"),
+		src,
+		compressed,
+		SafeCompress(nil, src, 3),
+		compressed[:len(compressed)/2],
+		corrupted,
+		newTestSkippableFrame("skippable"),
+		{0x28, 0xb5, 0x2f, 0xfd},
+		{0x28, 0xb5, 0x2f, 0xfd, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+}
+
+func TestFuzzSeedCorpus(t *testing.T) {
+	for _, data := range fuzzSeedCorpus() {
+		fuzzRoundTrip(data)
+		fuzzDecompress(data)
+	}
+}
+
+func TestDecompressErrorType(t *testing.T) {
+	src := []byte(newTestString(1000, 10))
+	compressed := Compress(nil, src)
+
+	// Corrupt the frame with the checksum, so the corruption is detected.
+	corrupted := SafeCompress(nil, src, 3)
+	corrupted[len(corrupted)/2] ^= 0xff
+
+	f := func(funcName string, err error) {
+		t.Helper()
+		if err == nil {
+			t.Fatalf("expecting non-nil error from %s", funcName)
+		}
+		if _, ok := err.(*DecompressError); !ok {
+			t.Fatalf("unexpected error type returned from %s; got %T; want *DecompressError", funcName, err)
+		}
+	}
+	_, err := Decompress(nil, corrupted)
+	f("Decompress", err)
+	_, err = Decompress(nil, []byte("foobar"))
+	f("Decompress", err)
+	_, err = SafeDecompress(nil, compressed)
+	f("SafeDecompress", err)
+	_, err = DecompressBestEffort(compressed[:len(compressed)/2])
+	f("DecompressBestEffort", err)
+
+	zr := NewReader(bytes.NewReader(corrupted))
+	defer zr.Release()
+	_, err = ioutil.ReadAll(zr)
+	f("Reader", err)
+}
@@ -29,6 +29,30 @@ static size_t ZSTD_decompress_usingDDict_wrapper(uintptr_t ctx, uintptr_t dst, s
     return ZSTD_decompress_usingDDict((ZSTD_DCtx*)ctx, (void*)dst, dstCapacity, (const void*)src, srcSize, (const ZSTD_DDict*)ddict);
 }
 
+static size_t ZSTD_CCtx_reset_wrapper(uintptr_t ctx, ZSTD_ResetDirective reset) {
+    return ZSTD_CCtx_reset((ZSTD_CCtx*)ctx, reset);
+}
+
+static size_t ZSTD_CCtx_setParameter_wrapper(uintptr_t ctx, ZSTD_cParameter param, int value) {
+    return ZSTD_CCtx_setParameter((ZSTD_CCtx*)ctx, param, value);
+}
+
+static size_t ZSTD_CCtx_setPledgedSrcSize_wrapper(uintptr_t ctx, unsigned long long pledgedSrcSize) {
+    return ZSTD_CCtx_setPledgedSrcSize((ZSTD_CCtx*)ctx, pledgedSrcSize);
+}
+
+// ZSTD_compressStream2_wrapper constructs ZSTD_outBuffer and ZSTD_inBuffer
+// on the C side, since Go memory cannot contain pointers to Go memory
+// when passed to C. dstPos and srcPos are updated after the call.
+static size_t ZSTD_compressStream2_wrapper(uintptr_t ctx, uintptr_t dst, size_t dstCapacity, uintptr_t dstPos, uintptr_t src, size_t srcSize, uintptr_t srcPos, ZSTD_EndDirective endOp) {
+    ZSTD_outBuffer out = { (void*)dst, dstCapacity, *(size_t*)dstPos };
+    ZSTD_inBuffer in = { (const void*)src, srcSize, *(size_t*)srcPos };
+    size_t rv = ZSTD_compressStream2((ZSTD_CCtx*)ctx, &out, &in, endOp);
+    *(size_t*)dstPos = out.pos;
+    *(size_t*)srcPos = in.pos;
+    return rv;
+}
+
 static unsigned long long ZSTD_findDecompressedSize_wrapper(uintptr_t src, size_t srcSize) {
     return ZSTD_findDecompressedSize((const void*)src, srcSize);
 }
@@ -37,16 +61,28 @@ static unsigned long long ZSTD_findDecompressedSize_wrapper(uintptr_t src, size_
 import "C"
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"unsafe"
 )
 
 // DefaultCompressionLevel is the default compression level.
+//
+// It must be kept in sync with ZSTD_CLEVEL_DEFAULT from the vendored zstd,
+// which is returned by DefaultLevel.
 const DefaultCompressionLevel = 3 // Obtained from ZSTD_CLEVEL_DEFAULT.
 
+// DefaultLevel returns the default compression level used by the vendored zstd.
+//
+// It is obtained via ZSTD_defaultCLevel and it equals to DefaultCompressionLevel.
+func DefaultLevel() int {
+	return int(C.ZSTD_defaultCLevel())
+}
+
 // Compress appends compressed src to dst and returns the result.
 func Compress(dst, src []byte) []byte {
 	return compressDictLevel(dst, src, nil, DefaultCompressionLevel)
@@ -59,6 +95,18 @@ func CompressLevel(dst, src []byte, compressionLevel int) []byte {
 	return compressDictLevel(dst, src, nil, compressionLevel)
 }
 
+// CompressMmap appends compressed src to dst and returns the result.
+//
+// The given compressionLevel is used for the compression.
+//
+// src may be backed by memory outside the Go heap such as a memory-mapped
+// file. src is passed to zstd without copying, so the memory backing
+// src must remain mapped until CompressMmap returns. The result doesn't
+// reference src, so it remains valid after src is unmapped.
+func CompressMmap(dst, src []byte, compressionLevel int) []byte {
+	return compressDictLevel(dst, src, nil, compressionLevel)
+}
+
 // CompressDict appends compressed src to dst and returns the result.
 //
 // The given dictionary is used for the compression.
@@ -66,6 +114,44 @@ func CompressDict(dst, src []byte, cd *CDict) []byte {
 	return compressDictLevel(dst, src, cd, 0)
 }
 
+// CompressIfSmaller appends compressed src to dst and returns the result
+// if the compressed src is smaller than src.
+//
+// Otherwise src is appended to dst as is and compressed=false is returned.
+// This saves space and decompression CPU for incompressible data
+// such as already compressed media.
+//
+// The caller must store the returned compressed flag alongside the data,
+// since only the data with compressed=true must be passed to Decompress.
+func CompressIfSmaller(dst, src []byte, compressionLevel int) (out []byte, compressed bool) {
+	dstLen := len(dst)
+	dst = CompressLevel(dst, src, compressionLevel)
+	if len(dst)-dstLen < len(src) {
+		return dst, true
+	}
+	dst = append(dst[:dstLen], src...)
+	return dst, false
+}
+
+// CompressBudgeted compresses src at the given compressionLevel,
+// writes the compressed data to w and returns the number of bytes written.
+//
+// overBudget is set if the compressed size exceeds budget bytes.
+// The compressed data is written to w regardless of budget, so the caller
+// may decide whether to keep it or to store src elsewhere, e.g. in another
+// storage tier or after the recompression at higher compression level.
+func CompressBudgeted(w io.Writer, src []byte, compressionLevel int, budget int) (written int, overBudget bool, err error) {
+	bb := recompressBufPool.Get().(*recompressBuf)
+	bb.b = CompressLevel(bb.b[:0], src, compressionLevel)
+	overBudget = len(bb.b) > budget
+	written, err = w.Write(bb.b)
+	recompressBufPool.Put(bb)
+	if err != nil {
+		return written, overBudget, fmt.Errorf("cannot write compressed data: %s", err)
+	}
+	return written, overBudget, nil
+}
+
 func compressDictLevel(dst, src []byte, cd *CDict, compressionLevel int) []byte {
 	var cctx, cctxDict *cctxWrapper
 	if cd == nil {
@@ -180,11 +266,332 @@ func compressInternal(cctx, cctxDict *cctxWrapper, dst, src []byte, cd *CDict, c
 	return result
 }
 
+// CompressMulti appends the compressed concatenation of srcs to dst
+// and returns the result.
+//
+// srcs are compressed into a single frame without joining them
+// into a single buffer. The given compressionLevel is used for the compression.
+func CompressMulti(dst []byte, srcs [][]byte, compressionLevel int) []byte {
+	cctx := cctxPool.Get().(*cctxWrapper)
+	dst = compressMulti(cctx, dst, srcs, compressionLevel, false)
+	cctxPool.Put(cctx)
+	return dst
+}
+
+// SafeCompress appends compressed src to dst and returns the result.
+//
+// The content checksum is always written into the compressed frame,
+// so the data may be verified with SafeDecompress. Empty src results
+// in an empty frame with the checksum, since SafeDecompress requires
+// at least a single frame with the checksum.
+// The given compressionLevel is used for the compression.
+func SafeCompress(dst, src []byte, compressionLevel int) []byte {
+	srcs := [1][]byte{src}
+	cctx := cctxPool.Get().(*cctxWrapper)
+	dst = compressMulti(cctx, dst, srcs[:], compressionLevel, true)
+	cctxPool.Put(cctx)
+	return dst
+}
+
+func compressMulti(cctx *cctxWrapper, dst []byte, srcs [][]byte, compressionLevel int, checksum bool) []byte {
+	srcsLen := 0
+	for _, src := range srcs {
+		srcsLen += len(src)
+	}
+	if srcsLen == 0 && !checksum {
+		return dst
+	}
+
+	ctx := C.uintptr_t(uintptr(unsafe.Pointer(cctx.cctx)))
+	result := C.ZSTD_CCtx_reset_wrapper(ctx, C.ZSTD_reset_session_and_parameters)
+	ensureNoError("ZSTD_CCtx_reset", result)
+	result = C.ZSTD_CCtx_setParameter_wrapper(ctx, C.ZSTD_c_compressionLevel, C.int(compressionLevel))
+	ensureNoError("ZSTD_CCtx_setParameter", result)
+	if checksum {
+		result = C.ZSTD_CCtx_setParameter_wrapper(ctx, C.ZSTD_c_checksumFlag, 1)
+		ensureNoError("ZSTD_CCtx_setParameter", result)
+	}
+	result = C.ZSTD_CCtx_setPledgedSrcSize_wrapper(ctx, C.ulonglong(srcsLen))
+	ensureNoError("ZSTD_CCtx_setPledgedSrcSize", result)
+
+	dstLen := len(dst)
+	compressBound := int(C.ZSTD_compressBound(C.size_t(srcsLen))) + 1
+	if n := dstLen + compressBound - cap(dst); n > 0 {
+		// This should be optimized since go 1.11 - see https://golang.org/doc/go1.11#performance-compiler.
+		dst = append(dst[:cap(dst)], make([]byte, n)...)
+	}
+	dst = dst[:cap(dst)]
+
+	dstPos := C.size_t(dstLen)
+	for _, src := range srcs {
+		if len(src) == 0 {
+			continue
+		}
+		srcPos := C.size_t(0)
+		for int(srcPos) < len(src) {
+			result = compressStream2(ctx, dst, &dstPos, src, &srcPos, C.ZSTD_e_continue)
+			ensureNoError("ZSTD_compressStream2", result)
+			if int(dstPos) == len(dst) {
+				dst = append(dst, make([]byte, len(dst)-dstLen)...)
+			}
+		}
+	}
+	for {
+		srcPos := C.size_t(0)
+		result = compressStream2(ctx, dst, &dstPos, nil, &srcPos, C.ZSTD_e_end)
+		ensureNoError("ZSTD_compressStream2", result)
+		if result == 0 {
+			break
+		}
+		dst = append(dst, make([]byte, int(result))...)
+	}
+	dst = dst[:dstPos]
+	if cap(dst)-len(dst) > 4096 {
+		// Re-allocate dst in order to remove superflouos capacity and reduce memory usage.
+		dst = append([]byte{}, dst...)
+	}
+	return dst
+}
+
+func compressStream2(ctx C.uintptr_t, dst []byte, dstPos *C.size_t, src []byte, srcPos *C.size_t, endOp C.ZSTD_EndDirective) C.size_t {
+	var srcPtr *byte
+	if len(src) > 0 {
+		srcPtr = &src[0]
+	}
+	result := C.ZSTD_compressStream2_wrapper(ctx,
+		C.uintptr_t(uintptr(unsafe.Pointer(&dst[0]))),
+		C.size_t(len(dst)),
+		C.uintptr_t(uintptr(unsafe.Pointer(dstPos))),
+		C.uintptr_t(uintptr(unsafe.Pointer(srcPtr))),
+		C.size_t(len(src)),
+		C.uintptr_t(uintptr(unsafe.Pointer(srcPos))),
+		endOp)
+	// Prevent from GC'ing of dst, src, dstPos and srcPos during CGO call above.
+	runtime.KeepAlive(dst)
+	runtime.KeepAlive(src)
+	runtime.KeepAlive(dstPos)
+	runtime.KeepAlive(srcPos)
+	return result
+}
+
 // Decompress appends decompressed src to dst and returns the result.
 func Decompress(dst, src []byte) ([]byte, error) {
 	return DecompressDict(dst, src, nil)
 }
 
+// ErrUnknownContentSize is returned from RequiredOutputSize and SafeDecompressedSize when
+// the decompressed size isn't stored in the frame header.
+var ErrUnknownContentSize = errors.New("the decompressed size isn't stored in the frame header")
+
+// DecompressError is returned from Decompress, DecompressDict,
+// SafeDecompress, DecompressBestEffort and Reader when the compressed data
+// is malformed or corrupted.
+type DecompressError struct {
+	msg string
+}
+
+// Error implements error interface.
+func (e *DecompressError) Error() string {
+	return e.msg
+}
+
+func newDecompressError(format string, args ...interface{}) error {
+	return &DecompressError{
+		msg: fmt.Sprintf(format, args...),
+	}
+}
+
+// RequiredOutputSize returns the exact size of decompressed src.
+//
+// The size is obtained from frame headers without the decompression,
+// so it may be used for preallocating dst for Decompress.
+// src may contain concatenated frames.
+//
+// ErrUnknownContentSize is returned if at least a single frame in src
+// doesn't contain the decompressed size. Use streaming decompression
+// via Reader for such src.
+func RequiredOutputSize(src []byte) (int, error) {
+	n, err := findDecompressedSize(src)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(maxInt) {
+		return 0, fmt.Errorf("too big decompressed size: %d bytes", n)
+	}
+	return int(n), nil
+}
+
+// SafeDecompressedSize returns the decompressed size of src if it doesn't
+// exceed hardCap.
+//
+// The size is obtained from frame headers without the decompression.
+// src may contain concatenated frames. The decompressed size declared
+// in untrusted src may be arbitrarily large, so an error is returned
+// if it exceeds hardCap. This allows safely preallocating the buffer
+// for the decompressed data.
+//
+// ErrUnknownContentSize is returned if at least a single frame in src
+// doesn't contain the decompressed size. Use streaming decompression
+// via Reader for such src.
+func SafeDecompressedSize(src []byte, hardCap uint64) (uint64, error) {
+	n, err := findDecompressedSize(src)
+	if err != nil {
+		return 0, err
+	}
+	if n > hardCap {
+		return 0, fmt.Errorf("decompressed size %d bytes exceeds the limit of %d bytes", n, hardCap)
+	}
+	return n, nil
+}
+
+func findDecompressedSize(src []byte) (uint64, error) {
+	if len(src) == 0 {
+		return 0, nil
+	}
+	result := C.ZSTD_findDecompressedSize_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(&src[0]))), C.size_t(len(src)))
+	// Prevent from GC'ing of src during CGO call above.
+	runtime.KeepAlive(src)
+	switch uint64(result) {
+	case uint64(C.ZSTD_CONTENTSIZE_UNKNOWN):
+		return 0, ErrUnknownContentSize
+	case uint64(C.ZSTD_CONTENTSIZE_ERROR):
+		return 0, fmt.Errorf("cannot obtain decompressed size from invalid src")
+	}
+	return uint64(result), nil
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// SafeDecompress appends decompressed src to dst and returns the result.
+//
+// Every frame in src must contain the content checksum, which is verified
+// during the decompression. An error is returned if the checksum is missing
+// or doesn't match the decompressed data. An error is also returned
+// if src contains no frames with the checksum, e.g. if it is empty
+// or if it contains only skippable frames. Use SafeCompress for creating
+// such frames.
+func SafeDecompress(dst, src []byte) ([]byte, error) {
+	if err := checkFrameChecksums(src); err != nil {
+		return dst, newDecompressError("%s", err)
+	}
+	return Decompress(dst, src)
+}
+
+// DecompressExact appends decompressed src to dst and returns the result.
+//
+// Every frame in src must contain the decompressed size in the frame header,
+// otherwise ErrUnknownContentSize is returned. An error is returned
+// if the size of the decompressed data doesn't match the stored size.
+// This is a strict decompression mode for critical data.
+func DecompressExact(dst, src []byte) ([]byte, error) {
+	n, err := findDecompressedSize(src)
+	if err != nil {
+		return dst, err
+	}
+	if n > uint64(maxInt-len(dst)) {
+		return dst, fmt.Errorf("too big decompressed size: %d bytes", n)
+	}
+	dstLen := len(dst)
+	if cap(dst)-dstLen < int(n) {
+		dst = append(dst[:cap(dst)], make([]byte, dstLen+int(n)-cap(dst))...)[:dstLen]
+	}
+	result, err := Decompress(dst, src)
+	if err != nil {
+		return dst[:dstLen], err
+	}
+	if size := uint64(len(result) - dstLen); size != n {
+		return dst[:dstLen], fmt.Errorf("unexpected decompressed size; got %d bytes; want %d bytes stored in the frame header", size, n)
+	}
+	return result, nil
+}
+
+// DecompressBestEffort decompresses as much data from src as possible.
+//
+// If src is corrupted, then the data decompressed before the corrupted
+// block is returned together with an error containing the offset in src
+// where the decompression stopped. The returned data may contain garbage
+// at the end if the corruption isn't detected immediately.
+// This is useful for recovering data from damaged archives.
+func DecompressBestEffort(src []byte) ([]byte, error) {
+	sd := getStreamDecompressor(nil)
+	sd.src = src
+	_, err := sd.zr.WriteTo(sd)
+	dst := sd.dst
+	if err == nil && (!sd.zr.frameStart || sd.zr.inBuf.pos < sd.zr.inBuf.size) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		// Do not count the compressed data buffered in the Reader.
+		offset := sd.srcOffset - int(sd.zr.inBuf.size-sd.zr.inBuf.pos)
+		err = newDecompressError("decompression stopped at offset %d of %d bytes after decompressing %d bytes: %s", offset, len(src), len(dst), err)
+	}
+	putStreamDecompressor(sd)
+	return dst, err
+}
+
+// DecompressCallback decompresses src and calls fn for every decompressed chunk.
+//
+// This allows processing big decompressed data without holding it in memory.
+// The chunk is backed by the internal buffer, so it is valid only during
+// the fn call. Copy the chunk if it must be retained after fn returns.
+//
+// The decompression stops if fn returns an error. The error is returned
+// from DecompressCallback. io.ErrUnexpectedEOF is returned if src
+// is truncated.
+func DecompressCallback(src []byte, fn func(chunk []byte) error) error {
+	sd := getStreamDecompressor(nil)
+	sd.src = src
+	_, err := sd.zr.WriteTo(chunkCallback(fn))
+	if err == nil && (!sd.zr.frameStart || sd.zr.inBuf.pos < sd.zr.inBuf.size) {
+		err = io.ErrUnexpectedEOF
+	}
+	putStreamDecompressor(sd)
+	return err
+}
+
+type chunkCallback func(chunk []byte) error
+
+func (fn chunkCallback) Write(p []byte) (int, error) {
+	if err := fn(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// DecompressPooled decompresses src into a buffer obtained from pool.
+//
+// pool must contain *[]byte items. The buffer is grown if it cannot hold
+// the decompressed data. The returned release function puts the buffer back
+// to pool, so the returned data must not be used after the release call.
+// The release function may be called multiple times - only the first call
+// has an effect. It must be called even if an error is returned.
+//
+// This is useful for high-throughput decompression of short-lived data.
+func DecompressPooled(src []byte, pool *sync.Pool) ([]byte, func(), error) {
+	bp, _ := pool.Get().(*[]byte)
+	if bp == nil {
+		bp = new([]byte)
+	}
+	buf, err := Decompress((*bp)[:0], src)
+	if cap(buf) > cap(*bp) {
+		*bp = buf[:0]
+	}
+	released := false
+	release := func() {
+		if released {
+			return
+		}
+		released = true
+		pool.Put(bp)
+	}
+	if err != nil {
+		release()
+		return nil, release, err
+	}
+	return buf, release, nil
+}
+
 // DecompressDict appends decompressed src to dst and returns the result.
 //
 // The given dictionary dd is used for the decompression.
@@ -250,7 +657,7 @@ func decompress(dctx, dctxDict *dctxWrapper, dst, src []byte, dd *DDict) ([]byte
 
 		if C.ZSTD_getErrorCode(result) != C.ZSTD_error_dstSize_tooSmall {
 			// Error during decompression.
-			return dst[:dstLen], fmt.Errorf("decompression error: %s", errStr(result))
+			return dst[:dstLen], newDecompressError("decompression error: %s", errStr(result))
 		}
 	}
 
@@ -263,7 +670,7 @@ func decompress(dctx, dctxDict *dctxWrapper, dst, src []byte, dd *DDict) ([]byte
 	case uint64(C.ZSTD_CONTENTSIZE_UNKNOWN):
 		return streamDecompress(dst, src, dd)
 	case uint64(C.ZSTD_CONTENTSIZE_ERROR):
-		return dst, fmt.Errorf("cannot decompress invalid src")
+		return dst, newDecompressError("cannot decompress invalid src")
 	}
 	decompressBound++
 
@@ -284,7 +691,7 @@ func decompress(dctx, dctxDict *dctxWrapper, dst, src []byte, dd *DDict) ([]byte
 	}
 
 	// Error during decompression.
-	return dst[:dstLen], fmt.Errorf("decompression error: %s", errStr(result))
+	return dst[:dstLen], newDecompressError("decompression error: %s", errStr(result))
 }
 
 func decompressInternal(dctx, dctxDict *dctxWrapper, dst, src []byte, dd *DDict) C.size_t {
@@ -311,6 +718,57 @@ func decompressInternal(dctx, dctxDict *dctxWrapper, dst, src []byte, dd *DDict)
 	return n
 }
 
+// Recompress appends src recompressed with the given compressionLevel to dst
+// and returns the result.
+//
+// This is useful for upgrading the stored compressed data to higher
+// compression levels.
+func Recompress(dst, src []byte, compressionLevel int) ([]byte, error) {
+	return recompress(dst, src, nil, nil, compressionLevel)
+}
+
+// RecompressDict appends src recompressed with the given cd to dst
+// and returns the result.
+//
+// src is decompressed with the given dd, which may be nil if src has been
+// compressed without dictionary.
+func RecompressDict(dst, src []byte, dd *DDict, cd *CDict) ([]byte, error) {
+	return recompress(dst, src, dd, cd, 0)
+}
+
+func recompress(dst, src []byte, dd *DDict, cd *CDict, compressionLevel int) ([]byte, error) {
+	bb := recompressBufPool.Get().(*recompressBuf)
+	var err error
+	bb.b, err = DecompressDict(bb.b[:0], src, dd)
+	if err == nil {
+		dst = compressDictLevel(dst, bb.b, cd, compressionLevel)
+	}
+	recompressBufPool.Put(bb)
+	return dst, err
+}
+
+type recompressBuf struct {
+	b []byte
+}
+
+var recompressBufPool = &sync.Pool{
+	New: func() interface{} {
+		return &recompressBuf{}
+	},
+}
+
+// IsError reports whether code returned from zstd functions is an error code.
+func IsError(code uint) bool {
+	return C.ZSTD_isError(C.size_t(code)) != 0
+}
+
+// ErrorName returns human-readable name for code returned from zstd functions.
+//
+// "No error detected" is returned if code isn't an error code.
+func ErrorName(code uint) string {
+	return C.GoString(C.ZSTD_getErrorName(C.size_t(code)))
+}
+
 func errStr(result C.size_t) string {
 	errCode := C.ZSTD_getErrorCode(result)
 	errCStr := C.ZSTD_getErrorString(errCode)
@@ -327,6 +785,46 @@ func ensureNoError(funcName string, result C.size_t) {
 	}
 }
 
+// checkError is like ensureNoError, but returns the error instead of panicking
+// if SetPanicOnError(false) is called.
+func checkError(funcName string, result C.size_t) error {
+	if int(result) >= 0 {
+		// Fast path - avoid calling C function.
+		return nil
+	}
+	if C.ZSTD_getErrorCode(result) == 0 {
+		return nil
+	}
+	return newUnexpectedError(fmt.Errorf("unexpected error in %s: %s", funcName, errStr(result)))
+}
+
+func newUnexpectedError(err error) error {
+	if atomic.LoadUint32(&panicOnError) != 0 {
+		panic(fmt.Errorf("BUG: %s", err))
+	}
+	return err
+}
+
+// SetPanicOnError controls whether unexpected errors from zstd lead to panic.
+//
+// By default unexpected errors are treated as bugs, so they lead to panic.
+// Call SetPanicOnError(false) in order to return such errors from functions
+// and methods with error result such as Writer.Write, Writer.Flush
+// and Writer.Close. Functions without error result always panic
+// on unexpected errors.
+//
+// Errors caused by invalid input data such as corrupted compressed data
+// are always returned as errors.
+func SetPanicOnError(ok bool) {
+	v := uint32(0)
+	if ok {
+		v = 1
+	}
+	atomic.StoreUint32(&panicOnError, v)
+}
+
+var panicOnError = uint32(1)
+
 func streamDecompress(dst, src []byte, dd *DDict) ([]byte, error) {
 	sd := getStreamDecompressor(dd)
 	sd.dst = dst
@@ -362,6 +860,13 @@ func (sd *streamDecompressor) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+func (sd *streamDecompressor) Grow(n int) {
+	if n > cap(sd.dst)-len(sd.dst) {
+		dstLen := len(sd.dst)
+		sd.dst = append(sd.dst[:cap(sd.dst)], make([]byte, dstLen+n-cap(sd.dst))...)[:dstLen]
+	}
+}
+
 func getStreamDecompressor(dd *DDict) *streamDecompressor {
 	v := streamDecompressorPool.Get()
 	if v == nil {
@@ -0,0 +1,41 @@
+//go:build linux
+// +build linux
+
+package gozstd
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestCompressMmap(t *testing.T) {
+	src := []byte(newTestString(1024*1024, 3))
+	f, err := ioutil.TempFile("", "gozstd-mmap")
+	if err != nil {
+		t.Fatalf("cannot create temporary file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(src); err != nil {
+		t.Fatalf("cannot write temporary file: %s", err)
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, len(src), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		t.Fatalf("cannot mmap temporary file: %s", err)
+	}
+	compressed := CompressMmap(nil, data, 5)
+	if err := syscall.Munmap(data); err != nil {
+		t.Fatalf("cannot munmap temporary file: %s", err)
+	}
+
+	plainData, err := Decompress(nil, compressed)
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if string(plainData) != string(src) {
+		t.Fatalf("unexpected data decompressed")
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"math/rand"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -357,3 +359,689 @@ func TestCompressDecompressMultiFrames(t *testing.T) {
 			plainData, origData, len(plainData), len(origData))
 	}
 }
+
+func TestRecompress(t *testing.T) {
+	var bb bytes.Buffer
+	for bb.Len() < 256*1024 {
+		fmt.Fprintf(&bb, "recompress line %d, value %d\n", bb.Len(), rand.Intn(1000))
+	}
+	src := bb.Bytes()
+
+	cd1 := CompressLevel(nil, src, 1)
+	cd19, err := Recompress(nil, cd1, 19)
+	if err != nil {
+		t.Fatalf("cannot recompress data: %s", err)
+	}
+	if len(cd19) >= len(cd1) {
+		t.Fatalf("recompressed data must be smaller than the original data; got %d bytes; want less than %d bytes", len(cd19), len(cd1))
+	}
+	plainData, err := Decompress(nil, cd19)
+	if err != nil {
+		t.Fatalf("cannot decompress recompressed data: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data after recompression")
+	}
+
+	// Verify prefixed recompression.
+	prefix := []byte("prefix")
+	cdp, err := Recompress(prefix, cd1, 19)
+	if err != nil {
+		t.Fatalf("cannot recompress data: %s", err)
+	}
+	if string(cdp[:len(prefix)]) != string(prefix) {
+		t.Fatalf("unexpected prefix in the recompressed result: %q; want %q", cdp[:len(prefix)], prefix)
+	}
+	if !bytes.Equal(cdp[len(prefix):], cd19) {
+		t.Fatalf("unexpected prefixed recompressed result")
+	}
+
+	// Verify invalid src.
+	if _, err := Recompress(nil, []byte("invalid compressed data"), 19); err == nil {
+		t.Fatalf("expecting error when recompressing invalid data")
+	}
+}
+
+func TestRecompressDict(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, []byte(fmt.Sprintf("recompress sample %d", i)))
+	}
+	dict := BuildDict(samples, 8*1024)
+	cd1, err := NewCDictLevel(dict, 1)
+	if err != nil {
+		t.Fatalf("cannot create CDict: %s", err)
+	}
+	defer cd1.Release()
+	cd19, err := NewCDictLevel(dict, 19)
+	if err != nil {
+		t.Fatalf("cannot create CDict: %s", err)
+	}
+	defer cd19.Release()
+	dd, err := NewDDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create DDict: %s", err)
+	}
+	defer dd.Release()
+
+	var bb bytes.Buffer
+	for bb.Len() < 64*1024 {
+		fmt.Fprintf(&bb, "recompress sample %d, ", bb.Len())
+	}
+	src := bb.Bytes()
+
+	compressedData := CompressDict(nil, src, cd1)
+	recompressedData, err := RecompressDict(nil, compressedData, dd, cd19)
+	if err != nil {
+		t.Fatalf("cannot recompress data: %s", err)
+	}
+	plainData, err := DecompressDict(nil, recompressedData, dd)
+	if err != nil {
+		t.Fatalf("cannot decompress recompressed data: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data after recompression")
+	}
+
+	// Recompress data compressed without dict.
+	compressedData = Compress(nil, src)
+	recompressedData, err = RecompressDict(nil, compressedData, nil, cd19)
+	if err != nil {
+		t.Fatalf("cannot recompress data: %s", err)
+	}
+	plainData, err = DecompressDict(nil, recompressedData, dd)
+	if err != nil {
+		t.Fatalf("cannot decompress recompressed data: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data after recompression without dict")
+	}
+}
+
+func TestCompressMulti(t *testing.T) {
+	testCompressMulti(t, nil)
+	testCompressMulti(t, [][]byte{nil, {}})
+	testCompressMulti(t, [][]byte{[]byte("foobar")})
+	testCompressMulti(t, [][]byte{[]byte("foo"), nil, []byte("bar"), []byte("baz")})
+
+	var srcs [][]byte
+	for i := 0; i < 100; i++ {
+		srcs = append(srcs, []byte(newTestString(rand.Intn(20*1024), 20)))
+	}
+	testCompressMulti(t, srcs)
+}
+
+func testCompressMulti(t *testing.T, srcs [][]byte) {
+	t.Helper()
+
+	joined := bytes.Join(srcs, nil)
+	for _, level := range []int{1, DefaultCompressionLevel, 10} {
+		cd := CompressMulti(nil, srcs, level)
+		if len(joined) == 0 {
+			if len(cd) != 0 {
+				t.Fatalf("unexpected non-empty result for empty srcs: %X", cd)
+			}
+			continue
+		}
+		plainData, err := Decompress(nil, cd)
+		if err != nil {
+			t.Fatalf("cannot decompress data on level %d: %s", level, err)
+		}
+		if !bytes.Equal(plainData, joined) {
+			t.Fatalf("unexpected data decompressed on level %d; got %d bytes; want %d bytes", level, len(plainData), len(joined))
+		}
+
+		// Verify prefixed compression.
+		prefix := []byte("prefix")
+		cdp := CompressMulti(prefix, srcs, level)
+		if string(cdp[:len(prefix)]) != string(prefix) {
+			t.Fatalf("unexpected prefix in the compressed result: %q; want %q", cdp[:len(prefix)], prefix)
+		}
+		if !bytes.Equal(cdp[len(prefix):], cd) {
+			t.Fatalf("unexpected prefixed compressed result")
+		}
+	}
+}
+
+func TestCompressIfSmaller(t *testing.T) {
+	prefix := []byte("prefix")
+
+	// Compressible data
+	src := []byte(newTestString(64*1024, 3))
+	out, compressed := CompressIfSmaller(append([]byte{}, prefix...), src, 5)
+	if !compressed {
+		t.Fatalf("expecting compressible data to be compressed")
+	}
+	if !bytes.HasPrefix(out, prefix) {
+		t.Fatalf("missing prefix in the output")
+	}
+	if len(out)-len(prefix) >= len(src) {
+		t.Fatalf("compressed data must be smaller than the original; got %d bytes; original %d bytes", len(out)-len(prefix), len(src))
+	}
+	plainData, err := Decompress(nil, out[len(prefix):])
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data decompressed; got\n%X; want\n%X", plainData, src)
+	}
+
+	// Incompressible data
+	src = make([]byte, 64*1024)
+	if _, err := rand.Read(src); err != nil {
+		t.Fatalf("cannot generate random data: %s", err)
+	}
+	out, compressed = CompressIfSmaller(append([]byte{}, prefix...), src, 5)
+	if compressed {
+		t.Fatalf("expecting random data to be stored uncompressed")
+	}
+	if !bytes.Equal(out, append(append([]byte{}, prefix...), src...)) {
+		t.Fatalf("unexpected output for incompressible data")
+	}
+
+	// Empty data
+	out, compressed = CompressIfSmaller(nil, nil, 5)
+	if compressed {
+		t.Fatalf("expecting empty data to be stored uncompressed")
+	}
+	if len(out) != 0 {
+		t.Fatalf("unexpected output for empty data; got %d bytes", len(out))
+	}
+}
+
+func TestSafeCompressDecompress(t *testing.T) {
+	src := []byte(newTestString(64*1024, 3))
+
+	// Checksum is present and valid.
+	cd := SafeCompress(nil, src, 5)
+	plainData, err := SafeDecompress(nil, cd)
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data decompressed")
+	}
+
+	// Multiple frames with checksums.
+	cdMulti := SafeCompress(append([]byte{}, cd...), src, 1)
+	plainData, err = SafeDecompress(nil, cdMulti)
+	if err != nil {
+		t.Fatalf("cannot decompress multiple frames: %s", err)
+	}
+	if !bytes.Equal(plainData, append(append([]byte{}, src...), src...)) {
+		t.Fatalf("unexpected data decompressed from multiple frames")
+	}
+
+	// Checksum is present, but invalid.
+	cdInvalid := append([]byte{}, cd...)
+	cdInvalid[len(cdInvalid)-1]++
+	if _, err := SafeDecompress(nil, cdInvalid); err == nil {
+		t.Fatalf("expecting error for invalid checksum")
+	}
+
+	// Checksum is absent.
+	if _, err := SafeDecompress(nil, Compress(nil, src)); err == nil {
+		t.Fatalf("expecting error for missing checksum")
+	}
+	if _, err := SafeDecompress(nil, append(append([]byte{}, cd...), Compress(nil, src)...)); err == nil {
+		t.Fatalf("expecting error for missing checksum in the second frame")
+	}
+	if _, err := SafeDecompress(nil, nil); err == nil {
+		t.Fatalf("expecting error for empty src")
+	}
+	skippable := newTestSkippableFrame("foobar")
+	if _, err := SafeDecompress(nil, skippable); err == nil {
+		t.Fatalf("expecting error for src with only skippable frames")
+	}
+	if _, err := SafeDecompress(nil, append(append([]byte{}, skippable...), skippable...)); err == nil {
+		t.Fatalf("expecting error for src with only skippable frames")
+	}
+
+	// Skippable frames are allowed next to frames with checksums.
+	plainData, err = SafeDecompress(nil, append(append([]byte{}, skippable...), cd...))
+	if err != nil {
+		t.Fatalf("cannot decompress data after skippable frame: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data decompressed after skippable frame")
+	}
+
+	// Empty src must result in an empty frame with the checksum.
+	cdEmpty := SafeCompress(nil, nil, 5)
+	if len(cdEmpty) == 0 {
+		t.Fatalf("expecting non-empty frame for empty src")
+	}
+	present, _, err := ExtractFrameChecksum(cdEmpty)
+	if err != nil {
+		t.Fatalf("cannot extract checksum: %s", err)
+	}
+	if !present {
+		t.Fatalf("missing checksum in the frame for empty src")
+	}
+	plainData, err = SafeDecompress(nil, cdEmpty)
+	if err != nil {
+		t.Fatalf("cannot decompress empty frame: %s", err)
+	}
+	if len(plainData) != 0 {
+		t.Fatalf("unexpected data decompressed from empty frame; got %d bytes", len(plainData))
+	}
+}
+
+func TestRequiredOutputSize(t *testing.T) {
+	// Known size
+	src := []byte(newTestString(64*1024, 3))
+	cd := Compress(nil, src)
+	n, err := RequiredOutputSize(cd)
+	if err != nil {
+		t.Fatalf("cannot obtain required output size: %s", err)
+	}
+	if n != len(src) {
+		t.Fatalf("unexpected required output size; got %d; want %d", n, len(src))
+	}
+
+	// Multiple frames with known sizes
+	n, err = RequiredOutputSize(append(append([]byte{}, cd...), cd...))
+	if err != nil {
+		t.Fatalf("cannot obtain required output size for multiple frames: %s", err)
+	}
+	if n != 2*len(src) {
+		t.Fatalf("unexpected required output size for multiple frames; got %d; want %d", n, 2*len(src))
+	}
+
+	// Unknown size
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	if _, err := zw.Write(src); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	zw.Release()
+	if _, err := RequiredOutputSize(bb.Bytes()); err != ErrUnknownContentSize {
+		t.Fatalf("unexpected error; got %v; want %v", err, ErrUnknownContentSize)
+	}
+
+	// Invalid data
+	if _, err := RequiredOutputSize([]byte("invalid data")); err == nil || err == ErrUnknownContentSize {
+		t.Fatalf("unexpected error for invalid data: %v", err)
+	}
+}
+
+func TestDefaultLevel(t *testing.T) {
+	level := DefaultLevel()
+	if level != DefaultCompressionLevel {
+		t.Fatalf("unexpected default level; got %d; want %d", level, DefaultCompressionLevel)
+	}
+	lower, upper, err := getParamBounds(ParamCompressionLevel)
+	if err != nil {
+		t.Fatalf("cannot get compression level bounds: %s", err)
+	}
+	if level < lower || level > upper {
+		t.Fatalf("default level %d is out of range [%d..%d]", level, lower, upper)
+	}
+}
+
+func TestSafeDecompressedSize(t *testing.T) {
+	src := []byte(newTestString(128*1024, 3))
+	compressed := Compress(nil, src)
+
+	// Size below the cap.
+	for _, hardCap := range []uint64{uint64(len(src)), uint64(len(src)) + 1, 1 << 40} {
+		n, err := SafeDecompressedSize(compressed, hardCap)
+		if err != nil {
+			t.Fatalf("unexpected error for hardCap=%d: %s", hardCap, err)
+		}
+		if n != uint64(len(src)) {
+			t.Fatalf("unexpected size for hardCap=%d; got %d; want %d", hardCap, n, len(src))
+		}
+	}
+
+	// Size above the cap.
+	for _, hardCap := range []uint64{0, 1, uint64(len(src)) - 1} {
+		if _, err := SafeDecompressedSize(compressed, hardCap); err == nil {
+			t.Fatalf("expecting non-nil error for hardCap=%d", hardCap)
+		}
+	}
+
+	// Unknown size.
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	if _, err := zw.Write(src); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	zw.Release()
+	if _, err := SafeDecompressedSize(bb.Bytes(), 1<<40); err != ErrUnknownContentSize {
+		t.Fatalf("unexpected error for unknown size; got %v; want %v", err, ErrUnknownContentSize)
+	}
+
+	// Invalid src.
+	if _, err := SafeDecompressedSize([]byte("invalid"), 1<<40); err == nil {
+		t.Fatalf("expecting non-nil error for invalid src")
+	}
+}
+
+func TestDecompressPooled(t *testing.T) {
+	var pool sync.Pool
+	for _, s := range []string{"", "foobar", newTestString(1000, 3), newTestString(100*1000, 10), "baz"} {
+		compressed := Compress(nil, []byte(s))
+		for i := 0; i < 5; i++ {
+			plainData, release, err := DecompressPooled(compressed, &pool)
+			if err != nil {
+				t.Fatalf("cannot decompress data: %s", err)
+			}
+			if string(plainData) != s {
+				t.Fatalf("unexpected data decompressed; got %d bytes; want %d bytes", len(plainData), len(s))
+			}
+			release()
+			// The release function must be idempotent.
+			release()
+		}
+	}
+
+	// Verify the buffer is returned to the pool and is reused.
+	allocs := 0
+	pool = sync.Pool{
+		New: func() interface{} {
+			allocs++
+			return &[]byte{}
+		},
+	}
+	compressed := Compress(nil, []byte("foobar"))
+	const calls = 100
+	for i := 0; i < calls; i++ {
+		plainData, release, err := DecompressPooled(compressed, &pool)
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		if string(plainData) != "foobar" {
+			t.Fatalf("unexpected data decompressed; got %q; want %q", plainData, "foobar")
+		}
+		release()
+		release()
+	}
+	// sync.Pool may drop items, so allow some allocations.
+	if allocs > calls/2 {
+		t.Fatalf("too many buffer allocations; got %d; want no more than %d", allocs, calls/2)
+	}
+
+	// The release function must return the buffer to the pool only once.
+	pool = sync.Pool{}
+	_, release, err := DecompressPooled(compressed, &pool)
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	release()
+	release()
+	pool.Get()
+	if x := pool.Get(); x != nil {
+		t.Fatalf("the buffer must be returned to the pool only once; got %v", x)
+	}
+
+	// Invalid data.
+	plainData, release, err := DecompressPooled([]byte("invalid"), &pool)
+	if err == nil {
+		t.Fatalf("expecting non-nil error for invalid data")
+	}
+	if plainData != nil {
+		t.Fatalf("unexpected data for invalid src: %q", plainData)
+	}
+	release()
+}
+
+func TestIsError(t *testing.T) {
+	// Success codes.
+	for _, code := range []uint{0, 1, 123456} {
+		if IsError(code) {
+			t.Fatalf("code %d mustn't be an error", code)
+		}
+		if name := ErrorName(code); name != "No error detected" {
+			t.Fatalf("unexpected name for code %d; got %q; want %q", code, name, "No error detected")
+		}
+	}
+
+	// Error codes are negated ZSTD_ErrorCode values.
+	// 70 is ZSTD_error_dstSize_tooSmall.
+	code := ^uint(70 - 1)
+	if !IsError(code) {
+		t.Fatalf("code %d must be an error", code)
+	}
+	if name := ErrorName(code); name != "Destination buffer is too small" {
+		t.Fatalf("unexpected name for code %d; got %q; want %q", code, name, "Destination buffer is too small")
+	}
+}
+
+func TestDecompressExact(t *testing.T) {
+	src := []byte(newTestString(10000, 10))
+	prefix := []byte("prefix")
+
+	// Valid frame.
+	compressed := Compress(nil, src)
+	plainData, err := DecompressExact(prefix, compressed)
+	if err != nil {
+		t.Fatalf("cannot decompress valid frame: %s", err)
+	}
+	if string(plainData) != string(prefix)+string(src) {
+		t.Fatalf("unexpected data decompressed")
+	}
+
+	// Concatenated frames.
+	plainData, err = DecompressExact(nil, CompressMulti(nil, [][]byte{src, []byte("foo"), src}, 3))
+	if err != nil {
+		t.Fatalf("cannot decompress concatenated frames: %s", err)
+	}
+	if string(plainData) != string(src)+"foo"+string(src) {
+		t.Fatalf("unexpected data decompressed from concatenated frames")
+	}
+
+	// Empty src.
+	plainData, err = DecompressExact(prefix, nil)
+	if err != nil {
+		t.Fatalf("cannot decompress empty src: %s", err)
+	}
+	if string(plainData) != string(prefix) {
+		t.Fatalf("unexpected data decompressed from empty src; got %q; want %q", plainData, prefix)
+	}
+
+	// Frame without the stored size.
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	if _, err := zw.Write(src); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	zw.Release()
+	plainData, err = DecompressExact(prefix, bb.Bytes())
+	if err != ErrUnknownContentSize {
+		t.Fatalf("unexpected error for frame without the stored size; got %v; want %v", err, ErrUnknownContentSize)
+	}
+	if string(plainData) != string(prefix) {
+		t.Fatalf("unexpected dst on error; got %q; want %q", plainData, prefix)
+	}
+
+	// Frame truncated after the header.
+	for i := 6; i < 32; i++ {
+		plainData, err = DecompressExact(prefix, compressed[:i])
+		if err == nil {
+			t.Fatalf("expecting non-nil error for frame truncated to %d bytes", i)
+		}
+		if string(plainData) != string(prefix) {
+			t.Fatalf("unexpected dst on error; got %q; want %q", plainData, prefix)
+		}
+	}
+	if _, err := DecompressExact(nil, compressed[:len(compressed)-1]); err == nil {
+		t.Fatalf("expecting non-nil error for frame without the last byte")
+	}
+}
+
+func TestDecompressBestEffort(t *testing.T) {
+	src := []byte(newTestString(1024*1024, 10))
+
+	// Valid data.
+	compressed := Compress(nil, src)
+	plainData, err := DecompressBestEffort(compressed)
+	if err != nil {
+		t.Fatalf("cannot decompress valid data: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data decompressed")
+	}
+
+	// Empty data.
+	plainData, err = DecompressBestEffort(nil)
+	if err != nil {
+		t.Fatalf("cannot decompress empty data: %s", err)
+	}
+	if len(plainData) != 0 {
+		t.Fatalf("unexpected data decompressed from empty data: %q", plainData)
+	}
+
+	// Corrupt the second half of the frame.
+	corrupted := append([]byte{}, compressed...)
+	for i := len(corrupted) / 2; i < len(corrupted); i++ {
+		corrupted[i] = 0xff
+	}
+	if _, err := Decompress(nil, corrupted); err == nil {
+		t.Fatalf("expecting non-nil error when decompressing corrupted data")
+	}
+	plainData, err = DecompressBestEffort(corrupted)
+	if err == nil {
+		t.Fatalf("expecting non-nil error for corrupted data")
+	}
+	if !strings.Contains(err.Error(), "decompression stopped at offset") {
+		t.Fatalf("the error must contain the offset; got %q", err)
+	}
+	prefixLen := 0
+	for prefixLen < len(plainData) && prefixLen < len(src) && plainData[prefixLen] == src[prefixLen] {
+		prefixLen++
+	}
+	// The blocks before the corrupted region must be recovered.
+	if prefixLen < len(src)/4 {
+		t.Fatalf("too short prefix recovered; got %d bytes; want at least %d bytes", prefixLen, len(src)/4)
+	}
+
+	// Truncated data.
+	plainData, err = DecompressBestEffort(compressed[:len(compressed)/2])
+	if err == nil {
+		t.Fatalf("expecting non-nil error for truncated data")
+	}
+	if len(plainData) < len(src)/4 || !bytes.Equal(plainData, src[:len(plainData)]) {
+		t.Fatalf("unexpected data recovered from truncated data; got %d bytes", len(plainData))
+	}
+}
+
+func TestCompressBudgeted(t *testing.T) {
+	f := func(src []byte, budget int, overBudgetExpected bool) {
+		t.Helper()
+		var bb bytes.Buffer
+		written, overBudget, err := CompressBudgeted(&bb, src, DefaultCompressionLevel, budget)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if overBudget != overBudgetExpected {
+			t.Fatalf("unexpected overBudget for compressed size %d and budget %d; got %v; want %v", bb.Len(), budget, overBudget, overBudgetExpected)
+		}
+		if written != bb.Len() {
+			t.Fatalf("unexpected number of bytes written; got %d; want %d", written, bb.Len())
+		}
+		plainData, err := Decompress(nil, bb.Bytes())
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		if !bytes.Equal(plainData, src) {
+			t.Fatalf("unexpected data decompressed; got %d bytes; want %d bytes", len(plainData), len(src))
+		}
+	}
+
+	// Compressible data under budget.
+	compressible := []byte(newTestString(100*1024, 3))
+	f(compressible, 50*1024, false)
+
+	// Incompressible data over budget.
+	r := rand.New(rand.NewSource(1))
+	incompressible := make([]byte, 100*1024)
+	r.Read(incompressible)
+	f(incompressible, 50*1024, true)
+
+	// The budget equal to the compressed size isn't exceeded.
+	n := len(Compress(nil, compressible))
+	f(compressible, n, false)
+	f(compressible, n-1, true)
+
+	// Write error.
+	if _, _, err := CompressBudgeted(&errorWriter{}, compressible, DefaultCompressionLevel, 1024); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
+
+func TestDecompressCallback(t *testing.T) {
+	f := func(data []byte) {
+		t.Helper()
+		compressed := Compress(nil, data)
+		var result []byte
+		chunks := 0
+		total := 0
+		err := DecompressCallback(compressed, func(chunk []byte) error {
+			chunks++
+			total += len(chunk)
+			result = append(result, chunk...)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if total != len(data) {
+			t.Fatalf("unexpected number of bytes across chunks; got %d; want %d", total, len(data))
+		}
+		plainData, err := Decompress(nil, compressed)
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		if !bytes.Equal(result, plainData) {
+			t.Fatalf("unexpected data passed to callback; got %d bytes; want %d bytes", len(result), len(plainData))
+		}
+		if len(data) > 4*int(dstreamOutBufSize) && chunks < 2 {
+			t.Fatalf("expecting multiple chunks for %d bytes; got %d chunks", len(data), chunks)
+		}
+	}
+	f(nil)
+	f([]byte("foobar"))
+	f([]byte(newTestString(1000, 10)))
+	f([]byte(newTestString(4*1024*1024, 10)))
+
+	// The error returned by the callback must stop the decompression.
+	compressed := Compress(nil, []byte(newTestString(4*1024*1024, 10)))
+	errStop := fmt.Errorf("stop")
+	calls := 0
+	err := DecompressCallback(compressed, func(chunk []byte) error {
+		calls++
+		return errStop
+	})
+	if err != errStop {
+		t.Fatalf("unexpected error; got %v; want %v", err, errStop)
+	}
+	if calls != 1 {
+		t.Fatalf("unexpected number of callback calls after error; got %d; want 1", calls)
+	}
+
+	// Truncated src.
+	err = DecompressCallback(compressed[:len(compressed)/2], func(chunk []byte) error {
+		return nil
+	})
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("unexpected error for truncated src; got %v; want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	// Invalid src.
+	err = DecompressCallback([]byte("invalid compressed data"), func(chunk []byte) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("expecting non-nil error for invalid src")
+	}
+}
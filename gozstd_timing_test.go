@@ -49,6 +49,79 @@ func benchmarkDecompressDict(b *testing.B, blockSize, level int) {
 	})
 }
 
+func BenchmarkNewCDict(b *testing.B) {
+	dict := newBenchString(1024 * 1024)
+	for _, level := range []int{3, 19} {
+		b.Run(fmt.Sprintf("level_%d", level), func(b *testing.B) {
+			b.Run("normal", func(b *testing.B) {
+				benchmarkNewCDict(b, dict, level, NewCDictLevel)
+			})
+			b.Run("fast", func(b *testing.B) {
+				benchmarkNewCDict(b, dict, level, NewCDictFast)
+			})
+		})
+	}
+}
+
+func benchmarkNewCDict(b *testing.B, dict []byte, level int, newCDict func(dict []byte, level int) (*CDict, error)) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(dict)))
+	for i := 0; i < b.N; i++ {
+		cd, err := newCDict(dict, level)
+		if err != nil {
+			panic(fmt.Errorf("cannot create CDict: %s", err))
+		}
+		cd.Release()
+	}
+}
+
+func BenchmarkCompressDictDedicatedSearch(b *testing.B) {
+	var samples [][]byte
+	for i := 0; i < 1e4; i++ {
+		samples = append(samples, newBenchString(100))
+	}
+	dict := BuildDict(samples, 64*1024)
+	msgs := samples[:1000]
+	for _, level := range []int{5, 9} {
+		b.Run(fmt.Sprintf("level_%d", level), func(b *testing.B) {
+			for _, dedicatedDictSearch := range []bool{false, true} {
+				b.Run(fmt.Sprintf("dedicatedDictSearch_%v", dedicatedDictSearch), func(b *testing.B) {
+					cd, err := NewCDictParams(dict, &CDictParams{
+						CompressionLevel:    level,
+						DedicatedDictSearch: dedicatedDictSearch,
+					})
+					if err != nil {
+						panic(fmt.Errorf("cannot create CDict: %s", err))
+					}
+					defer cd.Release()
+					benchmarkCompressDictMsgs(b, msgs, cd)
+				})
+			}
+		})
+	}
+}
+
+func benchmarkCompressDictMsgs(b *testing.B, msgs [][]byte, cd *CDict) {
+	msgsLen := 0
+	for _, msg := range msgs {
+		msgsLen += len(msg)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(msgsLen))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		n := 0
+		var dst []byte
+		for pb.Next() {
+			for _, msg := range msgs {
+				dst = CompressDict(dst[:0], msg, cd)
+				n += len(dst)
+			}
+		}
+		atomic.AddUint64(&Sink, uint64(n))
+	})
+}
+
 func BenchmarkCompressDict(b *testing.B) {
 	for _, blockSize := range benchBlockSizes {
 		b.Run(fmt.Sprintf("blockSize_%d", blockSize), func(b *testing.B) {
@@ -170,6 +243,21 @@ func BenchmarkDecompress(b *testing.B) {
 	}
 }
 
+func BenchmarkDecompressionThroughput(b *testing.B) {
+	for _, blockSize := range benchBlockSizes {
+		b.Run(fmt.Sprintf("blockSize_%d", blockSize), func(b *testing.B) {
+			block := newBenchString(blockSize)
+			src := Compress(nil, block)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(block)))
+			b.ResetTimer()
+			if _, err := DecompressionThroughput(src, b.N); err != nil {
+				panic(fmt.Errorf("unexpected error: %s", err))
+			}
+		})
+	}
+}
+
 func benchmarkDecompress(b *testing.B, blockSize, level int) {
 	block := newBenchString(blockSize)
 	src := CompressLevel(nil, block, level)
@@ -0,0 +1,120 @@
+package gozstd
+
+import (
+	"io"
+	"sync"
+)
+
+// GRPCCompressorName is the name returned from GRPCCompressor.Name.
+const GRPCCompressorName = "zstd"
+
+// GRPCCompressor implements the encoding.Compressor interface
+// from google.golang.org/grpc/encoding.
+//
+// Register it via encoding.RegisterCompressor(gozstd.NewGRPCCompressor(level))
+// in order to use zstd for gRPC message compression. Writers and Readers
+// are pooled between calls.
+//
+// A single GRPCCompressor may be used from concurrently running goroutines.
+type GRPCCompressor struct {
+	wp WriterPool
+	rp sync.Pool
+}
+
+// NewGRPCCompressor returns new GRPCCompressor compressing messages
+// with the given compressionLevel.
+func NewGRPCCompressor(compressionLevel int) *GRPCCompressor {
+	var c GRPCCompressor
+	c.wp.Params = &WriterParams{
+		CompressionLevel: compressionLevel,
+	}
+	return &c
+}
+
+// Name returns GRPCCompressorName.
+func (c *GRPCCompressor) Name() string {
+	return GRPCCompressorName
+}
+
+// Compress returns a writer compressing data to w.
+//
+// The returned writer must be closed in order to finalize the compressed
+// message. w isn't closed.
+func (c *GRPCCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return &grpcWriter{
+		c:  c,
+		zw: c.wp.Get(w),
+	}, nil
+}
+
+// Decompress returns a reader decompressing data from r.
+//
+// The returned reader is returned to the pool after it returns an error,
+// including io.EOF.
+func (c *GRPCCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	v := c.rp.Get()
+	var zr *Reader
+	if v == nil {
+		zr = NewReader(r)
+	} else {
+		zr = v.(*Reader)
+		zr.Reset(r, nil)
+	}
+	return &grpcReader{
+		c:  c,
+		zr: zr,
+	}, nil
+}
+
+// DecompressedSize returns the decompressed size for the given compressed
+// message or -1 if it is unknown.
+//
+// gRPC uses it for checking the decompressed message size before
+// the decompression.
+func (c *GRPCCompressor) DecompressedSize(compressed []byte) int {
+	n, err := RequiredOutputSize(compressed)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+type grpcWriter struct {
+	c  *GRPCCompressor
+	zw *Writer
+}
+
+func (gw *grpcWriter) Write(p []byte) (int, error) {
+	if gw.zw == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return gw.zw.Write(p)
+}
+
+func (gw *grpcWriter) Close() error {
+	if gw.zw == nil {
+		return nil
+	}
+	err := gw.zw.Close()
+	gw.c.wp.Put(gw.zw)
+	gw.zw = nil
+	return err
+}
+
+type grpcReader struct {
+	c  *GRPCCompressor
+	zr *Reader
+}
+
+func (gr *grpcReader) Read(p []byte) (int, error) {
+	if gr.zr == nil {
+		return 0, io.EOF
+	}
+	n, err := gr.zr.Read(p)
+	if err != nil {
+		gr.zr.Reset(nil, nil)
+		gr.c.rp.Put(gr.zr)
+		gr.zr = nil
+	}
+	return n, err
+}
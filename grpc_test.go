@@ -0,0 +1,65 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// grpcCompressor is the encoding.Compressor interface
+// from google.golang.org/grpc/encoding.
+type grpcCompressor interface {
+	Compress(w io.Writer) (io.WriteCloser, error)
+	Decompress(r io.Reader) (io.Reader, error)
+	Name() string
+}
+
+func TestGRPCCompressor(t *testing.T) {
+	var c grpcCompressor = NewGRPCCompressor(5)
+	if name := c.Name(); name != "zstd" {
+		t.Fatalf("unexpected name; got %q; want %q", name, "zstd")
+	}
+
+	for i := 0; i < 10; i++ {
+		msg := []byte(fmt.Sprintf("message %d %s", i, newTestString(1000*i, 3)))
+
+		var bb bytes.Buffer
+		wc, err := c.Compress(&bb)
+		if err != nil {
+			t.Fatalf("cannot create compressor: %s", err)
+		}
+		if _, err := wc.Write(msg); err != nil {
+			t.Fatalf("cannot write message: %s", err)
+		}
+		if err := wc.Close(); err != nil {
+			t.Fatalf("cannot close compressor: %s", err)
+		}
+		if err := wc.Close(); err != nil {
+			t.Fatalf("unexpected error on the second Close: %s", err)
+		}
+		if _, err := wc.Write(msg); err == nil {
+			t.Fatalf("expecting non-nil error when writing to closed compressor")
+		}
+
+		if n := c.(*GRPCCompressor).DecompressedSize(bb.Bytes()); n != -1 {
+			t.Fatalf("unexpected decompressed size for stream without content size; got %d; want -1", n)
+		}
+		if n := c.(*GRPCCompressor).DecompressedSize(Compress(nil, msg)); n != len(msg) {
+			t.Fatalf("unexpected decompressed size; got %d; want %d", n, len(msg))
+		}
+
+		r, err := c.Decompress(&bb)
+		if err != nil {
+			t.Fatalf("cannot create decompressor: %s", err)
+		}
+		result, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("cannot read message: %s", err)
+		}
+		if !bytes.Equal(result, msg) {
+			t.Fatalf("unexpected message decompressed; got %d bytes; want %d bytes", len(result), len(msg))
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Package gzipcompat provides zstd Writer and Reader with the API
+// of compress/gzip.
+//
+// It eases migration from compress/gzip to zstd: replace the compress/gzip
+// import with github.com/valyala/gozstd/gzipcompat and rename gzip
+// identifiers to gzipcompat. The compressed data is written and read
+// in zstd format, so it isn't compatible with gzip.
+//
+// The differences from compress/gzip:
+//
+//   - There is no Header. zstd frames have no Name, Comment, ModTime,
+//     Extra or OS fields.
+//   - Compression levels are zstd compression levels. NoCompression
+//     and HuffmanOnly aren't supported.
+//   - NewReader doesn't read the stream header, so invalid data is detected
+//     in Read calls.
+package gzipcompat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/valyala/gozstd"
+)
+
+// Compression levels accepted by NewWriterLevel.
+//
+// Any zstd compression level in the range [BestSpeed ... MaxCompression]
+// may be passed to NewWriterLevel.
+const (
+	BestSpeed          = 1
+	BestCompression    = 19
+	DefaultCompression = -1
+
+	// MaxCompression is the maximum zstd compression level.
+	//
+	// Levels above BestCompression require a lot of memory
+	// for both the compression and the decompression.
+	MaxCompression = 22
+)
+
+// Writer is an io.WriteCloser writing zstd-compressed data.
+//
+// Writer mirrors gzip.Writer API.
+type Writer struct {
+	zw     *gozstd.Writer
+	level  int
+	closed bool
+}
+
+// NewWriter returns new Writer writing compressed data to w
+// at the default compression level.
+//
+// Call Close when done writing.
+func NewWriter(w io.Writer) *Writer {
+	zw, _ := NewWriterLevel(w, DefaultCompression)
+	return zw
+}
+
+// NewWriterLevel returns new Writer writing compressed data to w
+// at the given compression level.
+//
+// The level may be DefaultCompression or any zstd compression level
+// in the range [BestSpeed ... MaxCompression].
+func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
+	if level != DefaultCompression && (level < BestSpeed || level > MaxCompression) {
+		return nil, fmt.Errorf("gzipcompat: invalid compression level: %d", level)
+	}
+	if level == DefaultCompression {
+		level = gozstd.DefaultCompressionLevel
+	}
+	return &Writer{
+		zw:    gozstd.NewWriterLevel(w, level),
+		level: level,
+	}, nil
+}
+
+// ErrClosed is returned when writing to closed Writer.
+var ErrClosed = errors.New("gzipcompat: write to closed Writer")
+
+// Write compresses p and writes it to the underlying writer.
+//
+// The compressed data may be buffered until Flush or Close.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, ErrClosed
+	}
+	return z.zw.Write(p)
+}
+
+// Flush flushes any pending compressed data to the underlying writer.
+//
+// The compressed data written so far may be decompressed after Flush
+// without closing the Writer.
+func (z *Writer) Flush() error {
+	if z.closed {
+		return nil
+	}
+	return z.zw.Flush()
+}
+
+// Close finalizes the compressed stream and flushes it to the underlying
+// writer.
+//
+// Close doesn't close the underlying writer.
+func (z *Writer) Close() error {
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+	return z.zw.Close()
+}
+
+// Reset discards z state and makes it write to w at the compression level
+// passed to NewWriterLevel.
+//
+// This permits reusing Writer instead of allocating new one.
+func (z *Writer) Reset(w io.Writer) {
+	z.zw.Reset(w, nil, z.level)
+	z.closed = false
+}
+
+// Reader is an io.Reader reading zstd-compressed data.
+//
+// Reader mirrors gzip.Reader API.
+type Reader struct {
+	zr *gozstd.Reader
+}
+
+// NewReader returns new Reader decompressing data from r.
+//
+// Unlike gzip.NewReader, NewReader doesn't read from r, so it never returns
+// an error. Errors for invalid data are returned from Read.
+//
+// Call Close when done reading.
+func NewReader(r io.Reader) (*Reader, error) {
+	return &Reader{
+		zr: gozstd.NewReader(r),
+	}, nil
+}
+
+// Read reads decompressed data into p.
+func (z *Reader) Read(p []byte) (int, error) {
+	return z.zr.Read(p)
+}
+
+// Multistream controls whether z reads all the concatenated zstd frames.
+//
+// Multistream mode is enabled by default. If it is disabled, then Read
+// returns io.EOF at the end of the current frame and the data following
+// the frame remains in the underlying reader. Call Reset in order to read
+// the next frame.
+//
+// Multistream must be called before the first Read.
+func (z *Reader) Multistream(ok bool) {
+	z.zr.Multistream(ok)
+}
+
+// Reset discards z state and makes it read from r.
+//
+// Reset enables multistream mode. The returned error is always nil.
+// It is kept for compatibility with gzip.Reader.Reset.
+func (z *Reader) Reset(r io.Reader) error {
+	z.zr.Reset(r, nil)
+	return nil
+}
+
+// Close closes z.
+//
+// Close doesn't close the underlying reader.
+func (z *Reader) Close() error {
+	return nil
+}
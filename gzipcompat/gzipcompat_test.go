@@ -0,0 +1,174 @@
+package gzipcompat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// TestRoundTrip is a copy of the round-trip test from compress/gzip
+// with the gzip package replaced by gzipcompat.
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	if _, err := w.Write([]byte("payload")); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close: %s", err)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader: %s", err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+	if string(b) != "payload" {
+		t.Fatalf("payload is %q, want %q", string(b), "payload")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Reader.Close: %s", err)
+	}
+}
+
+func TestWriterLevels(t *testing.T) {
+	src := []byte(strings.Repeat("foo bar baz ", 1000))
+	for _, level := range []int{DefaultCompression, BestSpeed, 5, BestCompression, MaxCompression} {
+		var buf bytes.Buffer
+		w, err := NewWriterLevel(&buf, level)
+		if err != nil {
+			t.Fatalf("cannot create writer at level %d: %s", level, err)
+		}
+		if _, err := w.Write(src); err != nil {
+			t.Fatalf("cannot write data at level %d: %s", level, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("cannot close writer at level %d: %s", level, err)
+		}
+		r, _ := NewReader(&buf)
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("cannot read data at level %d: %s", level, err)
+		}
+		if !bytes.Equal(b, src) {
+			t.Fatalf("unexpected data read at level %d", level)
+		}
+	}
+
+	for _, level := range []int{-2, 0, MaxCompression + 1} {
+		if _, err := NewWriterLevel(ioutil.Discard, level); err == nil {
+			t.Fatalf("expecting non-nil error for level %d", level)
+		}
+	}
+}
+
+func TestWriterFlushReset(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if _, err := w.Write([]byte("foo")); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %s", err)
+	}
+
+	// The flushed data must be readable before Close.
+	r, _ := NewReader(bytes.NewReader(buf.Bytes()))
+	p := make([]byte, 3)
+	if _, err := io.ReadFull(r, p); err != nil {
+		t.Fatalf("cannot read flushed data: %s", err)
+	}
+	if string(p) != "foo" {
+		t.Fatalf("unexpected flushed data; got %q; want %q", p, "foo")
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	if _, err := w.Write([]byte("bar")); err != ErrClosed {
+		t.Fatalf("unexpected error after Close; got %v; want %v", err, ErrClosed)
+	}
+
+	var buf2 bytes.Buffer
+	w.Reset(&buf2)
+	if _, err := w.Write([]byte("bar")); err != nil {
+		t.Fatalf("Write after Reset: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close after Reset: %s", err)
+	}
+	if err := r.Reset(&buf2); err != nil {
+		t.Fatalf("Reader.Reset: %s", err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll after Reset: %s", err)
+	}
+	if string(b) != "bar" {
+		t.Fatalf("unexpected data after Reset; got %q; want %q", b, "bar")
+	}
+}
+
+func TestReaderMultistream(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 3; i++ {
+		w := NewWriter(&buf)
+		if _, err := fmt.Fprintf(w, "frame %d;", i); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %s", err)
+		}
+	}
+	compressed := buf.Bytes()
+
+	r, _ := NewReader(bytes.NewReader(compressed))
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+	if string(b) != "frame 0;frame 1;frame 2;" {
+		t.Fatalf("unexpected multistream data: %q", b)
+	}
+
+	// Read frames one by one in the same way as with gzip.Reader.
+	br := bytes.NewReader(compressed)
+	if err := r.Reset(br); err != nil {
+		t.Fatalf("Reset: %s", err)
+	}
+	var frames []string
+	for {
+		r.Multistream(false)
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll: %s", err)
+		}
+		frames = append(frames, string(b))
+		if br.Len() == 0 {
+			break
+		}
+		if err := r.Reset(br); err != nil {
+			t.Fatalf("Reset: %s", err)
+		}
+	}
+	if strings.Join(frames, "|") != "frame 0;|frame 1;|frame 2;" {
+		t.Fatalf("unexpected frames: %q", frames)
+	}
+}
+
+func TestReaderInvalidData(t *testing.T) {
+	r, err := NewReader(strings.NewReader("not a zstd stream"))
+	if err != nil {
+		t.Fatalf("NewReader: %s", err)
+	}
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Fatalf("expecting non-nil error when reading invalid data")
+	}
+}
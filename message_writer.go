@@ -0,0 +1,74 @@
+package gozstd
+
+import (
+	"fmt"
+	"io"
+)
+
+// MessageWriter writes messages as independent zstd frames.
+//
+// Every message may be decompressed on its own, so readers may start
+// reading at any frame boundary, e.g. after partial reads of log files.
+// The whole output is a valid multi-frame zstd stream, so it may be
+// decompressed at once with Decompress or Reader.
+//
+// Compression contexts are shared with CompressLevel and CompressDict,
+// so MessageWriter doesn't hold compression contexts between
+// WriteMessage calls. It isn't safe to use MessageWriter
+// from concurrently running goroutines.
+type MessageWriter struct {
+	w     io.Writer
+	cd    *CDict
+	level int
+
+	buf    []byte
+	offset int64
+}
+
+// NewMessageWriter returns new MessageWriter writing messages compressed
+// at the given compressionLevel to w.
+//
+// Messages are compressed with cd if it isn't nil. Zero compressionLevel
+// means the compression level cd was created with in this case.
+// cd mustn't be released while it is used by the returned MessageWriter.
+func NewMessageWriter(w io.Writer, compressionLevel int, cd *CDict) *MessageWriter {
+	return &MessageWriter{
+		w:     w,
+		cd:    cd,
+		level: compressionLevel,
+	}
+}
+
+// WriteMessage compresses p into a self-contained frame and writes it
+// to the underlying writer.
+//
+// Every frame is written with a single Write call to the underlying writer.
+// Empty p is skipped, since it doesn't need a frame.
+func (mw *MessageWriter) WriteMessage(p []byte) error {
+	if len(p) == 0 {
+		return nil
+	}
+	mw.buf = compressDictLevel(mw.buf[:0], p, mw.cd, mw.level)
+	n, err := mw.w.Write(mw.buf)
+	mw.offset += int64(n)
+	if err != nil {
+		return fmt.Errorf("cannot write message: %s", err)
+	}
+	return nil
+}
+
+// Offset returns the number of bytes written to the underlying writer.
+//
+// Offset before WriteMessage call is the offset of the message frame,
+// so it may be stored in an index for reading individual messages.
+func (mw *MessageWriter) Offset() int64 {
+	return mw.offset
+}
+
+// Reset resets mw to write messages to w.
+//
+// The compression level and the dictionary remain unchanged.
+func (mw *MessageWriter) Reset(w io.Writer) {
+	mw.w = w
+	mw.offset = 0
+}
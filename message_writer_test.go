@@ -0,0 +1,101 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestMessageWriter(t *testing.T) {
+	cd, dd := newTestShardDicts(t, "message")
+	defer cd.Release()
+	defer dd.Release()
+
+	f := func(compressionLevel int, cd *CDict, dd *DDict) {
+		t.Helper()
+		var bb bytes.Buffer
+		mw := NewMessageWriter(&bb, compressionLevel, cd)
+		var msgs [][]byte
+		var offsets []int64
+		for i := 0; i < 5000; i++ {
+			msg := []byte(fmt.Sprintf("message sample number %d for shard message; level=%d", i, rand.Intn(10)))
+			offsets = append(offsets, mw.Offset())
+			if err := mw.WriteMessage(msg); err != nil {
+				t.Fatalf("cannot write message #%d: %s", i, err)
+			}
+			msgs = append(msgs, msg)
+		}
+		if err := mw.WriteMessage(nil); err != nil {
+			t.Fatalf("cannot write empty message: %s", err)
+		}
+		if mw.Offset() != int64(bb.Len()) {
+			t.Fatalf("unexpected offset; got %d; want %d", mw.Offset(), bb.Len())
+		}
+		offsets = append(offsets, mw.Offset())
+		data := bb.Bytes()
+
+		// Decompress arbitrary individual frames.
+		for i := 0; i < 100; i++ {
+			n := rand.Intn(len(msgs))
+			frame := data[offsets[n]:offsets[n+1]]
+			msg, err := DecompressDict(nil, frame, dd)
+			if err != nil {
+				t.Fatalf("cannot decompress message #%d: %s", n, err)
+			}
+			if !bytes.Equal(msg, msgs[n]) {
+				t.Fatalf("unexpected message #%d; got %q; want %q", n, msg, msgs[n])
+			}
+		}
+
+		// Decompress the whole stream.
+		plainData, err := DecompressDict(nil, data, dd)
+		if err != nil {
+			t.Fatalf("cannot decompress the stream: %s", err)
+		}
+		plainDataExpected := bytes.Join(msgs, nil)
+		if !bytes.Equal(plainData, plainDataExpected) {
+			t.Fatalf("unexpected data decompressed; got %d bytes; want %d bytes", len(plainData), len(plainDataExpected))
+		}
+	}
+	f(3, nil, nil)
+	f(0, cd, dd)
+	f(5, cd, dd)
+}
+
+func TestMessageWriterReset(t *testing.T) {
+	var bb1, bb2 bytes.Buffer
+	mw := NewMessageWriter(&bb1, 1, nil)
+	if err := mw.WriteMessage([]byte("foo")); err != nil {
+		t.Fatalf("cannot write message: %s", err)
+	}
+	mw.Reset(&bb2)
+	if mw.Offset() != 0 {
+		t.Fatalf("unexpected offset after Reset; got %d; want 0", mw.Offset())
+	}
+	if err := mw.WriteMessage([]byte("bar")); err != nil {
+		t.Fatalf("cannot write message: %s", err)
+	}
+	for _, tc := range []struct {
+		bb   *bytes.Buffer
+		want string
+	}{
+		{&bb1, "foo"},
+		{&bb2, "bar"},
+	} {
+		plainData, err := Decompress(nil, tc.bb.Bytes())
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		if string(plainData) != tc.want {
+			t.Fatalf("unexpected data; got %q; want %q", plainData, tc.want)
+		}
+	}
+}
+
+func TestMessageWriterError(t *testing.T) {
+	mw := NewMessageWriter(&errorWriter{}, 1, nil)
+	if err := mw.WriteMessage([]byte("foobar")); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
@@ -0,0 +1,291 @@
+package gozstd
+
+/*
+#cgo CFLAGS: -O3
+
+#define ZSTD_STATIC_LINKING_ONLY
+#include "zstd.h"
+#include "zstd_errors.h"
+
+#include <stdint.h>  // for uintptr_t
+
+// The following *_wrapper functions allow avoiding memory allocations
+// durting calls from Go.
+// See https://github.com/golang/go/issues/24450 .
+
+static size_t ZSTD_CCtx_setParameter_wrapper(uintptr_t cs, ZSTD_cParameter param, int value) {
+    return ZSTD_CCtx_setParameter((ZSTD_CStream*)cs, param, value);
+}
+
+static size_t ZSTD_CCtx_getParameter_wrapper(uintptr_t cs, ZSTD_cParameter param, uintptr_t value) {
+    return ZSTD_CCtx_getParameter((ZSTD_CStream*)cs, param, (int*)value);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"net/url"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"unsafe"
+)
+
+// ParamID identifies a compression parameter.
+//
+// See the corresponding ZSTD_c_* docs in zstd.h for details about
+// every parameter.
+type ParamID int
+
+const (
+	// ParamCompressionLevel is the compression level.
+	ParamCompressionLevel = ParamID(C.ZSTD_c_compressionLevel)
+	// ParamWindowLog is the maximum back-reference distance as a power of 2.
+	ParamWindowLog = ParamID(C.ZSTD_c_windowLog)
+	// ParamHashLog is the size of the initial probe table as a power of 2.
+	ParamHashLog = ParamID(C.ZSTD_c_hashLog)
+	// ParamChainLog is the size of the multi-probe search table as a power of 2.
+	ParamChainLog = ParamID(C.ZSTD_c_chainLog)
+	// ParamSearchLog is the number of search attempts as a power of 2.
+	ParamSearchLog = ParamID(C.ZSTD_c_searchLog)
+	// ParamMinMatch is the minimum size of searched matches.
+	ParamMinMatch = ParamID(C.ZSTD_c_minMatch)
+	// ParamTargetLength is the strategy-dependent target match length.
+	ParamTargetLength = ParamID(C.ZSTD_c_targetLength)
+	// ParamStrategy is the compression strategy.
+	ParamStrategy = ParamID(C.ZSTD_c_strategy)
+	// ParamEnableLongDistanceMatching enables long distance matching.
+	ParamEnableLongDistanceMatching = ParamID(C.ZSTD_c_enableLongDistanceMatching)
+	// ParamLdmHashLog is the size of the long distance matching table as a power of 2.
+	ParamLdmHashLog = ParamID(C.ZSTD_c_ldmHashLog)
+	// ParamLdmMinMatch is the minimum match size for long distance matching.
+	ParamLdmMinMatch = ParamID(C.ZSTD_c_ldmMinMatch)
+	// ParamLdmBucketSizeLog is the log size of each bucket in the long distance matching table.
+	ParamLdmBucketSizeLog = ParamID(C.ZSTD_c_ldmBucketSizeLog)
+	// ParamLdmHashRateLog is the frequency of inserting entries into the long distance matching table.
+	ParamLdmHashRateLog = ParamID(C.ZSTD_c_ldmHashRateLog)
+	// ParamContentSizeFlag enables writing the content size into the frame header.
+	ParamContentSizeFlag = ParamID(C.ZSTD_c_contentSizeFlag)
+	// ParamChecksumFlag enables writing the content checksum at the end of the frame.
+	ParamChecksumFlag = ParamID(C.ZSTD_c_checksumFlag)
+	// ParamDictIDFlag enables writing the dictionary ID into the frame header.
+	ParamDictIDFlag = ParamID(C.ZSTD_c_dictIDFlag)
+	// ParamNbWorkers is the number of threads used for the compression.
+	ParamNbWorkers = ParamID(C.ZSTD_c_nbWorkers)
+	// ParamJobSize is the size of a compression job in multithreaded mode.
+	ParamJobSize = ParamID(C.ZSTD_c_jobSize)
+	// ParamOverlapLog is the overlap size between compression jobs in multithreaded mode.
+	ParamOverlapLog = ParamID(C.ZSTD_c_overlapLog)
+	// ParamSrcSizeHint is the estimated size of the data compressed into a frame.
+	ParamSrcSizeHint = ParamID(C.ZSTD_c_srcSizeHint)
+)
+
+// SetParameter sets the given compression parameter to value.
+//
+// This is a low-level escape hatch for parameters missing in WriterParams.
+// It must be called before writing the data to zw or after Close,
+// since most of parameters cannot be changed in the middle of a frame.
+//
+// The parameters set via SetParameter are reset to WriterParams by Reset
+// and ResetWriterParams calls.
+func (zw *Writer) SetParameter(param ParamID, value int) error {
+	return setCStreamParameter(zw.cs, param, value)
+}
+
+// GetParameter returns the current value for the given compression parameter.
+func (zw *Writer) GetParameter(param ParamID) (int, error) {
+	var value C.int
+	result := C.ZSTD_CCtx_getParameter_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(zw.cs))),
+		C.ZSTD_cParameter(param),
+		C.uintptr_t(uintptr(unsafe.Pointer(&value))))
+	// Prevent from GC'ing of value during CGO call above.
+	runtime.KeepAlive(&value)
+	if C.ZSTD_getErrorCode(result) != 0 {
+		return 0, fmt.Errorf("cannot get parameter %d: %s", param, errStr(result))
+	}
+	return int(value), nil
+}
+
+// Params returns the compression parameters currently applied to zw.
+//
+// The parameters are obtained from the underlying compression context,
+// so they include the changes made via SetParameter. Zero WindowLog,
+// Strategy, MinMatch and TargetLength are substituted with the values
+// zstd selects for the compression level, so Params may be used
+// for verifying the effective parameters.
+//
+// An error is returned if a parameter cannot be obtained from the context.
+func (zw *Writer) Params() (WriterParams, error) {
+	wp := zw.params
+	var err error
+	get := func(param ParamID) int {
+		if err != nil {
+			return 0
+		}
+		var v int
+		v, err = zw.GetParameter(param)
+		return v
+	}
+	wp.CompressionLevel = get(ParamCompressionLevel)
+	wp.WindowLog = get(ParamWindowLog)
+	wp.Strategy = Strategy(get(ParamStrategy))
+	wp.MinMatch = get(ParamMinMatch)
+	wp.TargetLength = get(ParamTargetLength)
+	wp.Checksum = get(ParamChecksumFlag) != 0
+	wp.NoDictID = get(ParamDictIDFlag) == 0
+	wp.NbWorkers = get(ParamNbWorkers)
+	if MultithreadingSupported() {
+		wp.JobSize = get(ParamJobSize)
+		wp.OverlapLog = get(ParamOverlapLog)
+	}
+	if err != nil {
+		return wp, err
+	}
+
+	// Substitute zero values with the values for the compression level.
+	cp := C.ZSTD_getCParams(C.int(wp.CompressionLevel), 0, 0)
+	if wp.WindowLog == 0 {
+		wp.WindowLog = int(cp.windowLog)
+	}
+	if wp.Strategy == 0 {
+		wp.Strategy = Strategy(cp.strategy)
+	}
+	if wp.MinMatch == 0 {
+		wp.MinMatch = int(cp.minMatch)
+	}
+	if wp.TargetLength == 0 {
+		wp.TargetLength = int(cp.targetLength)
+	}
+	return wp, nil
+}
+
+// MultithreadingSupported returns true if the underlying libzstd
+// is built with multithreading support.
+//
+// ParamNbWorkers may be set to non-zero values only if multithreading
+// is supported.
+func MultithreadingSupported() bool {
+	multithreadingSupportedOnce.Do(initMultithreadingSupported)
+	return multithreadingSupported
+}
+
+var (
+	multithreadingSupportedOnce sync.Once
+	multithreadingSupported     bool
+)
+
+func initMultithreadingSupported() {
+	cs := C.ZSTD_createCStream()
+	if cs == nil {
+		panic(fmt.Errorf("BUG: cannot create CStream"))
+	}
+	multithreadingSupported = setCStreamParameter(cs, ParamNbWorkers, 1) == nil
+	result := C.ZSTD_freeCStream(cs)
+	ensureNoError("ZSTD_freeCStream", result)
+}
+
+func setCStreamParameter(cs *C.ZSTD_CStream, param ParamID, value int) error {
+	result := C.ZSTD_CCtx_setParameter_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+		C.ZSTD_cParameter(param),
+		C.int(value))
+	if C.ZSTD_getErrorCode(result) != 0 {
+		return fmt.Errorf("cannot set parameter %d to %d: %s", param, value, errStr(result))
+	}
+	return nil
+}
+
+// ParseWriterParams parses WriterParams from URL query string s
+// such as "level=19&windowLog=27&checksum=1".
+//
+// The following keys are supported:
+//
+//   - level - WriterParams.CompressionLevel
+//   - windowLog - WriterParams.WindowLog
+//   - checksum - WriterParams.Checksum; 0, 1, false or true
+//   - noDictID - WriterParams.NoDictID; 0, 1, false or true
+//   - strategy - WriterParams.Strategy
+//   - workers - WriterParams.NbWorkers
+//   - jobSize - WriterParams.JobSize
+//   - overlapLog - WriterParams.OverlapLog
+//   - minMatch - WriterParams.MinMatch
+//   - targetLength - WriterParams.TargetLength
+//   - literalCompressionMode - WriterParams.LiteralCompressionMode
+//
+// An error is returned for unknown keys, duplicate keys and invalid values.
+// This is useful for setting up the compression from config files
+// or command-line flags.
+func ParseWriterParams(s string) (*WriterParams, error) {
+	q, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse writer params %q: %s", s, err)
+	}
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var wp WriterParams
+	for _, k := range keys {
+		vs := q[k]
+		if len(vs) > 1 {
+			return nil, fmt.Errorf("duplicate key %q in writer params %q", k, s)
+		}
+		v := vs[0]
+		if k == "checksum" || k == "noDictID" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %q: %q; must be 0, 1, false or true", k, v)
+			}
+			if k == "checksum" {
+				wp.Checksum = b
+			} else {
+				wp.NoDictID = b
+			}
+			continue
+		}
+
+		var dst *int
+		switch k {
+		case "level":
+			dst = &wp.CompressionLevel
+		case "windowLog":
+			dst = &wp.WindowLog
+		case "strategy":
+			dst = (*int)(&wp.Strategy)
+		case "workers":
+			dst = &wp.NbWorkers
+		case "jobSize":
+			dst = &wp.JobSize
+		case "overlapLog":
+			dst = &wp.OverlapLog
+		case "minMatch":
+			dst = &wp.MinMatch
+		case "targetLength":
+			dst = &wp.TargetLength
+		case "literalCompressionMode":
+			dst = (*int)(&wp.LiteralCompressionMode)
+		default:
+			return nil, fmt.Errorf("unknown key %q in writer params %q", k, s)
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %q: %q; must be integer", k, v)
+		}
+		*dst = n
+	}
+
+	if wp.CompressionLevel != 0 {
+		if err := checkParamBounds(ParamCompressionLevel, wp.CompressionLevel); err != nil {
+			return nil, fmt.Errorf("invalid level: %s", err)
+		}
+	}
+	if err := wp.Validate(); err != nil {
+		return nil, err
+	}
+	return &wp, nil
+}
@@ -0,0 +1,292 @@
+package gozstd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriterSetGetParameter(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+
+	for _, wlog := range []int{WindowLogMin, 15, 20, 27} {
+		if err := zw.SetParameter(ParamWindowLog, wlog); err != nil {
+			t.Fatalf("cannot set window log to %d: %s", wlog, err)
+		}
+		v, err := zw.GetParameter(ParamWindowLog)
+		if err != nil {
+			t.Fatalf("cannot get window log: %s", err)
+		}
+		if v != wlog {
+			t.Fatalf("unexpected window log; got %d; want %d", v, wlog)
+		}
+	}
+
+	// Make sure the written data is still valid.
+	src := []byte(newTestString(1024, 10))
+	if _, err := zw.Write(src); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	windowSize, err := GetFrameWindowSize(bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get frame window size: %s", err)
+	}
+	if windowSize != 1<<27 {
+		t.Fatalf("unexpected window size; got %d; want %d", windowSize, 1<<27)
+	}
+	plainData, err := Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data decompressed; got\n%X; want\n%X", plainData, src)
+	}
+
+	// Reset must drop the parameters set via SetParameter.
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	v, err := zw.GetParameter(ParamWindowLog)
+	if err != nil {
+		t.Fatalf("cannot get window log: %s", err)
+	}
+	if v != DefaultWindowLog {
+		t.Fatalf("unexpected window log after Reset; got %d; want %d", v, DefaultWindowLog)
+	}
+}
+
+func TestWriterSetParameterInvalid(t *testing.T) {
+	zw := NewWriter(nil)
+	defer zw.Release()
+
+	if err := zw.SetParameter(ParamWindowLog, 1234); err == nil {
+		t.Fatalf("expecting error when setting out of bounds window log")
+	}
+	if err := zw.SetParameter(ParamID(-1), 1); err == nil {
+		t.Fatalf("expecting error when setting unknown parameter")
+	}
+	if _, err := zw.GetParameter(ParamID(-1)); err == nil {
+		t.Fatalf("expecting error when getting unknown parameter")
+	}
+}
+
+func TestMultithreadingSupported(t *testing.T) {
+	ok := MultithreadingSupported()
+	for i := 0; i < 10; i++ {
+		if MultithreadingSupported() != ok {
+			t.Fatalf("MultithreadingSupported must return stable result")
+		}
+	}
+
+	zw := NewWriter(nil)
+	defer zw.Release()
+	err := zw.SetParameter(ParamNbWorkers, 2)
+	if ok && err != nil {
+		t.Fatalf("cannot set workers when multithreading is supported: %s", err)
+	}
+	if !ok && err == nil {
+		t.Fatalf("expecting error when setting workers without multithreading support")
+	}
+}
+
+func TestParseWriterParams(t *testing.T) {
+	f := func(s string, wpExpected *WriterParams) {
+		t.Helper()
+		wp, err := ParseWriterParams(s)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", s, err)
+		}
+		if *wp != *wpExpected {
+			t.Fatalf("unexpected params parsed from %q; got %+v; want %+v", s, wp, wpExpected)
+		}
+	}
+	f("", &WriterParams{})
+	f("level=19", &WriterParams{CompressionLevel: 19})
+	f("level=-5", &WriterParams{CompressionLevel: -5})
+	f("level=19&windowLog=27&checksum=1", &WriterParams{CompressionLevel: 19, WindowLog: 27, Checksum: true})
+	f("checksum=false&workers=0", &WriterParams{})
+	f("checksum=true&strategy=5&minMatch=4&targetLength=64", &WriterParams{
+		Checksum:     true,
+		Strategy:     StrategyLazy2,
+		MinMatch:     4,
+		TargetLength: 64,
+	})
+	f("literalCompressionMode=2", &WriterParams{LiteralCompressionMode: LiteralCompressionUncompressed})
+	f("noDictID=1", &WriterParams{NoDictID: true})
+	if MultithreadingSupported() {
+		f("workers=4&jobSize=1048576&overlapLog=6", &WriterParams{NbWorkers: 4, JobSize: 1048576, OverlapLog: 6})
+	}
+}
+
+func TestParseWriterParamsError(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		wp, err := ParseWriterParams(s)
+		if err == nil {
+			t.Fatalf("expecting non-nil error when parsing %q", s)
+		}
+		if wp != nil {
+			t.Fatalf("expecting nil params on error for %q; got %+v", s, wp)
+		}
+	}
+
+	// Unknown keys.
+	f("foo=bar")
+	f("level=3&Level=3")
+	f("dict=1")
+
+	// Duplicate keys.
+	f("level=3&level=5")
+
+	// Invalid values.
+	f("level=foo")
+	f("level=")
+	f("checksum=2")
+	f("noDictID=yes")
+	f("windowLog=1.5")
+	f("%zz")
+
+	// Out-of-range values.
+	f("level=1000")
+	f("windowLog=1")
+	f("windowLog=1234")
+	f("strategy=100")
+	f("minMatch=1000")
+	f("literalCompressionMode=5")
+	if !MultithreadingSupported() {
+		f("workers=4")
+	}
+}
+
+func TestWriterParamsChecksum(t *testing.T) {
+	for _, checksum := range []bool{false, true} {
+		var bb bytes.Buffer
+		zw := NewWriterParams(&bb, &WriterParams{Checksum: checksum})
+		if _, err := zw.Write([]byte("foobar")); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw: %s", err)
+		}
+		zw.Release()
+		present, _, err := ExtractFrameChecksum(bb.Bytes())
+		if err != nil {
+			t.Fatalf("cannot extract checksum: %s", err)
+		}
+		if present != checksum {
+			t.Fatalf("unexpected checksum presence; got %v; want %v", present, checksum)
+		}
+		if _, err := SafeDecompress(nil, bb.Bytes()); (err == nil) != checksum {
+			t.Fatalf("unexpected SafeDecompress result for checksum=%v: %v", checksum, err)
+		}
+	}
+}
+
+func TestWriterParamsNoDictID(t *testing.T) {
+	cd, dd := newTestShardDicts(t, "dictid")
+	defer cd.Release()
+	defer dd.Release()
+
+	data := []byte("dictid sample number 12345 for shard dictid")
+	for _, noDictID := range []bool{false, true} {
+		var bb bytes.Buffer
+		zw := NewWriterParams(&bb, &WriterParams{Dict: cd, NoDictID: noDictID})
+		if _, err := zw.Write(data); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw: %s", err)
+		}
+		if got := mustWriterParams(t, zw).NoDictID; got != noDictID {
+			t.Fatalf("unexpected NoDictID in Params; got %v; want %v", got, noDictID)
+		}
+		zw.Release()
+
+		dictID, err := GetFrameDictID(bb.Bytes())
+		if err != nil {
+			t.Fatalf("cannot obtain dict id: %s", err)
+		}
+		dictIDExpected := cd.DictID()
+		if noDictID {
+			dictIDExpected = 0
+		}
+		if dictID != dictIDExpected {
+			t.Fatalf("unexpected dict id for NoDictID=%v; got %d; want %d", noDictID, dictID, dictIDExpected)
+		}
+
+		plainData, err := DecompressDict(nil, bb.Bytes(), dd)
+		if err != nil {
+			t.Fatalf("cannot decompress data for NoDictID=%v: %s", noDictID, err)
+		}
+		if !bytes.Equal(plainData, data) {
+			t.Fatalf("unexpected data decompressed for NoDictID=%v; got %q; want %q", noDictID, plainData, data)
+		}
+	}
+}
+
+func TestWriterParams(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriterParams(&bb, &WriterParams{
+		CompressionLevel: 5,
+		WindowLog:        20,
+		Strategy:         StrategyBtlazy2,
+		Checksum:         true,
+	})
+	defer zw.Release()
+
+	wp := mustWriterParams(t, zw)
+	if wp.CompressionLevel != 5 {
+		t.Fatalf("unexpected CompressionLevel; got %d; want 5", wp.CompressionLevel)
+	}
+	if wp.WindowLog != 20 {
+		t.Fatalf("unexpected WindowLog; got %d; want 20", wp.WindowLog)
+	}
+	if wp.Strategy != StrategyBtlazy2 {
+		t.Fatalf("unexpected Strategy; got %d; want %d", wp.Strategy, StrategyBtlazy2)
+	}
+	if !wp.Checksum {
+		t.Fatalf("Checksum must be enabled")
+	}
+	if wp.MinMatch == 0 {
+		t.Fatalf("MinMatch must be substituted with the value for the compression level")
+	}
+
+	// SetParameter must be reflected in Params.
+	if err := zw.SetParameter(ParamWindowLog, 22); err != nil {
+		t.Fatalf("cannot set window log: %s", err)
+	}
+	if wp := mustWriterParams(t, zw); wp.WindowLog != 22 {
+		t.Fatalf("unexpected WindowLog after SetParameter; got %d; want 22", wp.WindowLog)
+	}
+
+	// Defaults for the compression level must be filled in.
+	zw.ResetWriterParams(&bb, &WriterParams{CompressionLevel: 1})
+	wp = mustWriterParams(t, zw)
+	if wp.CompressionLevel != 1 {
+		t.Fatalf("unexpected CompressionLevel after Reset; got %d; want 1", wp.CompressionLevel)
+	}
+	if wp.Strategy != StrategyFast {
+		t.Fatalf("unexpected Strategy for level 1; got %d; want %d", wp.Strategy, StrategyFast)
+	}
+	if wp.WindowLog == 0 || wp.MinMatch == 0 {
+		t.Fatalf("WindowLog and MinMatch must be filled in for level 1; got %+v", wp)
+	}
+	if wp.Checksum {
+		t.Fatalf("Checksum must be disabled after Reset")
+	}
+	zw.ResetWriterParams(&bb, &WriterParams{CompressionLevel: 19})
+	if wp := mustWriterParams(t, zw); wp.Strategy < StrategyBtopt {
+		t.Fatalf("unexpected Strategy for level 19; got %d; want at least %d", wp.Strategy, StrategyBtopt)
+	}
+}
+
+func mustWriterParams(t *testing.T, zw *Writer) WriterParams {
+	t.Helper()
+	wp, err := zw.Params()
+	if err != nil {
+		t.Fatalf("cannot obtain writer params: %s", err)
+	}
+	return wp
+}
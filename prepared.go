@@ -0,0 +1,189 @@
+package gozstd
+
+/*
+#cgo CFLAGS: -O3
+
+#define ZSTD_STATIC_LINKING_ONLY
+#include "zstd.h"
+#include "zstd_errors.h"
+
+#include <stdint.h>  // for uintptr_t
+
+// The following *_wrapper functions allow avoiding memory allocations
+// durting calls from Go.
+// See https://github.com/golang/go/issues/24450 .
+
+static size_t ZSTD_CCtx_reset_wrapper(uintptr_t cs, ZSTD_ResetDirective reset) {
+    return ZSTD_CCtx_reset((ZSTD_CStream*)cs, reset);
+}
+
+static size_t ZSTD_CCtx_refCDict_wrapper(uintptr_t cc, uintptr_t dict) {
+    return ZSTD_CCtx_refCDict((ZSTD_CCtx*)cc, (ZSTD_CDict*)dict);
+}
+
+static size_t ZSTD_CCtx_setParametersUsingCCtxParams_wrapper(uintptr_t cs, uintptr_t params) {
+    return ZSTD_CCtx_setParametersUsingCCtxParams((ZSTD_CCtx*)cs, (const ZSTD_CCtx_params*)params);
+}
+
+static size_t ZSTD_CCtxParams_setParameter_wrapper(uintptr_t params, ZSTD_cParameter param, int value) {
+    return ZSTD_CCtxParams_setParameter((ZSTD_CCtx_params*)params, param, value);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"unsafe"
+)
+
+// Params is a prepared set of compression parameters.
+//
+// Params is validated once by NewParams and then it may be applied
+// to many Writers via NewWriterPrepared and Writer.ResetPrepared.
+// This is faster than applying WriterParams, since all the parameters
+// are applied to the compression context with a single call.
+// This may be useful for hot paths resetting pooled writers.
+//
+// A single Params may be used from concurrently running goroutines.
+type Params struct {
+	p  *C.ZSTD_CCtx_params
+	wp WriterParams
+}
+
+// NewParams validates wp and returns the prepared Params for it.
+//
+// wp.Dict mustn't be released while the returned Params is in use.
+//
+// Call Release when the returned Params is no longer needed.
+func NewParams(wp WriterParams) (*Params, error) {
+	if err := wp.Validate(); err != nil {
+		return nil, err
+	}
+	p := C.ZSTD_createCCtxParams()
+	if p == nil {
+		return nil, fmt.Errorf("cannot allocate memory for compression parameters")
+	}
+	params := &Params{
+		p:  p,
+		wp: wp,
+	}
+	runtime.SetFinalizer(params, freeParams)
+
+	set := func(param ParamID, value int) error {
+		result := C.ZSTD_CCtxParams_setParameter_wrapper(
+			C.uintptr_t(uintptr(unsafe.Pointer(p))),
+			C.ZSTD_cParameter(param),
+			C.int(value))
+		if C.ZSTD_getErrorCode(result) != 0 {
+			return fmt.Errorf("cannot set parameter %d to %d: %s", param, value, errStr(result))
+		}
+		return nil
+	}
+	values := []paramValue{
+		{ParamWindowLog, wp.WindowLog},
+		{ParamID(C.ZSTD_c_forceAttachDict), int(wp.ForceAttachDict)},
+		{ParamStrategy, int(wp.Strategy)},
+		{ParamNbWorkers, wp.NbWorkers},
+		{ParamJobSize, wp.JobSize},
+		{ParamOverlapLog, wp.OverlapLog},
+		{ParamMinMatch, wp.MinMatch},
+		{ParamTargetLength, wp.TargetLength},
+		{ParamID(C.ZSTD_c_literalCompressionMode), int(wp.LiteralCompressionMode)},
+	}
+	if wp.Dict == nil {
+		// The compression level for the dictionary is selected
+		// by the CDict passed to ZSTD_CCtx_refCDict.
+		values = append(values, paramValue{ParamCompressionLevel, wp.CompressionLevel})
+	}
+	if wp.Checksum {
+		values = append(values, paramValue{ParamChecksumFlag, 1})
+	}
+	if wp.NoDictID {
+		if err := set(ParamDictIDFlag, 0); err != nil {
+			params.Release()
+			return nil, err
+		}
+	}
+	for _, v := range values {
+		if v.value == 0 {
+			// Zero means the default value, which is already set.
+			continue
+		}
+		if err := set(v.param, v.value); err != nil {
+			params.Release()
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+type paramValue struct {
+	param ParamID
+	value int
+}
+
+// WriterParams returns the parameters p has been created with.
+func (p *Params) WriterParams() WriterParams {
+	return p.wp
+}
+
+// Release releases resources occupied by p.
+//
+// p cannot be used after the release.
+func (p *Params) Release() {
+	freeParams(p)
+}
+
+func freeParams(v interface{}) {
+	p := v.(*Params)
+	if p.p == nil {
+		return
+	}
+	result := C.ZSTD_freeCCtxParams(p.p)
+	ensureNoError("ZSTD_freeCCtxParams", result)
+	p.p = nil
+	p.wp.Dict = nil
+}
+
+// NewWriterPrepared returns new zstd writer writing compressed data to w
+// using the given prepared params.
+//
+// The returned writer must be closed with Close call in order
+// to finalize the compressed stream.
+//
+// Call Release when the Writer is no longer needed.
+func NewWriterPrepared(w io.Writer, p *Params) *Writer {
+	zw := NewWriterParams(w, &p.wp)
+	zw.ResetPrepared(w, p)
+	return zw
+}
+
+// ResetPrepared resets zw to write to w using the given prepared params.
+//
+// It is equivalent to ResetWriterParams(w, &wp), where wp is the WriterParams
+// p has been created with, but it is faster.
+func (zw *Writer) ResetPrepared(w io.Writer, p *Params) {
+	zw.resetWriterParams(w, &p.wp, p)
+}
+
+func initCStreamPrepared(cs *C.ZSTD_CStream, p *Params) {
+	result := C.ZSTD_CCtx_reset_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+		C.ZSTD_reset_session_and_parameters)
+	ensureNoError("ZSTD_CCtx_reset", result)
+
+	result = C.ZSTD_CCtx_setParametersUsingCCtxParams_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+		C.uintptr_t(uintptr(unsafe.Pointer(p.p))))
+	ensureNoError("ZSTD_CCtx_setParametersUsingCCtxParams", result)
+
+	if p.wp.Dict != nil {
+		result = C.ZSTD_CCtx_refCDict_wrapper(
+			C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+			C.uintptr_t(uintptr(unsafe.Pointer(p.wp.cdict()))))
+		ensureNoError("ZSTD_CCtx_refCDict", result)
+	}
+	runtime.KeepAlive(p)
+}
@@ -0,0 +1,104 @@
+package gozstd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewParams(t *testing.T) {
+	cd, dd := newTestShardDicts(t, "foo")
+	defer cd.Release()
+	defer dd.Release()
+
+	f := func(wp WriterParams, dd *DDict) {
+		t.Helper()
+		p, err := NewParams(wp)
+		if err != nil {
+			t.Fatalf("cannot create params: %s", err)
+		}
+		defer p.Release()
+
+		data := []byte(newTestString(100*1024, 10))
+		var bb bytes.Buffer
+		zw := NewWriterPrepared(&bb, p)
+		defer zw.Release()
+
+		// The prepared params must be equivalent to WriterParams.
+		zwExpected := NewWriterParams(nil, &wp)
+		defer zwExpected.Release()
+		if got, want := mustWriterParams(t, zw), mustWriterParams(t, zwExpected); got != want {
+			t.Fatalf("unexpected params applied;\ngot\n%+v\nwant\n%+v", got, want)
+		}
+
+		for i := 0; i < 3; i++ {
+			bb.Reset()
+			zw.ResetPrepared(&bb, p)
+			if _, err := zw.Write(data); err != nil {
+				t.Fatalf("cannot write data: %s", err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatalf("cannot close writer: %s", err)
+			}
+			plainData, err := DecompressDict(nil, bb.Bytes(), dd)
+			if err != nil {
+				t.Fatalf("cannot decompress data: %s", err)
+			}
+			if !bytes.Equal(plainData, data) {
+				t.Fatalf("unexpected data decompressed; got %d bytes; want %d bytes", len(plainData), len(data))
+			}
+			if got, want := mustWriterParams(t, zw), mustWriterParams(t, zwExpected); got != want {
+				t.Fatalf("unexpected params after ResetPrepared;\ngot\n%+v\nwant\n%+v", got, want)
+			}
+		}
+
+		// The parameters set via SetParameter mustn't leak through ResetPrepared.
+		if err := zw.SetParameter(ParamChecksumFlag, 1); err != nil {
+			t.Fatalf("cannot set parameter: %s", err)
+		}
+		zw.ResetPrepared(&bb, p)
+		if got, want := mustWriterParams(t, zw), mustWriterParams(t, zwExpected); got != want {
+			t.Fatalf("unexpected params after SetParameter and ResetPrepared;\ngot\n%+v\nwant\n%+v", got, want)
+		}
+		if p.WriterParams() != wp {
+			t.Fatalf("unexpected WriterParams; got %+v; want %+v", p.WriterParams(), wp)
+		}
+	}
+	f(WriterParams{}, nil)
+	f(WriterParams{CompressionLevel: 7}, nil)
+	f(WriterParams{
+		CompressionLevel:       5,
+		WindowLog:              18,
+		Strategy:               StrategyLazy2,
+		MinMatch:               5,
+		TargetLength:           32,
+		LiteralCompressionMode: LiteralCompressionHuffman,
+		Checksum:               true,
+	}, nil)
+	f(WriterParams{
+		CompressionLevel: 0,
+		Dict:             cd,
+	}, dd)
+	f(WriterParams{
+		CompressionLevel: 9,
+		Dict:             cd,
+		ForceAttachDict:  DictForceCopy,
+	}, dd)
+	f(WriterParams{
+		CompressionLevel: 3,
+		Dict:             cd,
+		NoDictID:         true,
+	}, dd)
+}
+
+func TestNewParamsInvalid(t *testing.T) {
+	f := func(wp WriterParams) {
+		t.Helper()
+		p, err := NewParams(wp)
+		if err == nil {
+			p.Release()
+			t.Fatalf("expecting non-nil error for %+v", wp)
+		}
+	}
+	f(WriterParams{WindowLog: 1})
+	f(WriterParams{Strategy: 100})
+}
@@ -0,0 +1,44 @@
+package gozstd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+func BenchmarkWriterResetPrepared(b *testing.B) {
+	wp := WriterParams{
+		CompressionLevel:       5,
+		WindowLog:              20,
+		Strategy:               StrategyLazy2,
+		MinMatch:               5,
+		TargetLength:           32,
+		LiteralCompressionMode: LiteralCompressionHuffman,
+		Checksum:               true,
+	}
+	b.Run("WriterParams", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			zw := NewWriterParams(ioutil.Discard, &wp)
+			defer zw.Release()
+			for pb.Next() {
+				zw.ResetWriterParams(ioutil.Discard, &wp)
+			}
+		})
+	})
+	b.Run("Params", func(b *testing.B) {
+		p, err := NewParams(wp)
+		if err != nil {
+			panic(fmt.Errorf("cannot create params: %s", err))
+		}
+		defer p.Release()
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			zw := NewWriterPrepared(ioutil.Discard, p)
+			defer zw.Release()
+			for pb.Next() {
+				zw.ResetPrepared(ioutil.Discard, p)
+			}
+		})
+	})
+}
@@ -30,10 +30,16 @@ static size_t ZSTD_freeDStream_wrapper(uintptr_t ds) {
 static size_t ZSTD_decompressStream_wrapper(uintptr_t ds, uintptr_t output, uintptr_t input) {
     return ZSTD_decompressStream((ZSTD_DStream*)ds, (ZSTD_outBuffer*)output, (ZSTD_inBuffer*)input);
 }
+
+static size_t ZSTD_frameHeaderSizePrefix() {
+    return ZSTD_FRAMEHEADERSIZE_PREFIX(ZSTD_f_zstd1);
+}
 */
 import "C"
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"runtime"
@@ -43,19 +49,58 @@ import (
 var (
 	dstreamInBufSize  = C.ZSTD_DStreamInSize()
 	dstreamOutBufSize = C.ZSTD_DStreamOutSize()
+
+	frameHeaderSizePrefix = C.ZSTD_frameHeaderSizePrefix()
 )
 
 // Reader implements zstd reader.
+//
+// Reader retries reading from the underlying reader on (0, nil) results,
+// but it gives up with io.ErrNoProgress after 100 consecutive (0, nil)
+// results, like bufio.Reader does. This prevents from busy-looping
+// on a broken underlying reader. The read may be retried after that.
 type Reader struct {
 	r  io.Reader
 	ds *C.ZSTD_DStream
 	dd *DDict
 
+	// reg is set by NewReaderRegistry and ResetRegistry.
+	reg *DictRegistry
+
 	inBuf  *C.ZSTD_inBuffer
 	outBuf *C.ZSTD_outBuffer
 
 	inBufGo  cMemPtr
 	outBufGo cMemPtr
+
+	multistream bool
+	frameDone   bool
+	waitForMore bool
+
+	// frameStart is set if the header of the next frame must be read.
+	frameStart bool
+	dictID     uint32
+
+	// streamStart is set until the header of the first frame is read.
+	streamStart bool
+
+	// The following fields are used by PreallocateFromHeader.
+	noPreallocate   bool
+	preallocSize    uint64
+	preallocPending bool
+
+	// The following fields are used by Metadata.
+	metadata        []byte
+	metadataVariant uint32
+	metadataLeft    uint64
+
+	// srcSizeHint is the number of compressed bytes zstd needs for making
+	// progress on the current frame.
+	srcSizeHint C.size_t
+
+	// atEOFErr is the error from the underlying reader obtained by AtEOF.
+	// It is returned from the next Read call.
+	atEOFErr error
 }
 
 // NewReader returns new zstd reader reading compressed data from r.
@@ -89,6 +134,11 @@ func NewReaderDict(r io.Reader, dd *DDict) *Reader {
 		dd:     dd,
 		inBuf:  inBuf,
 		outBuf: outBuf,
+
+		multistream: true,
+		frameStart:  true,
+		streamStart: true,
+		srcSizeHint: frameHeaderSizePrefix,
 	}
 
 	zr.inBufGo = cMemPtr(zr.inBuf.src)
@@ -98,19 +148,359 @@ func NewReaderDict(r io.Reader, dd *DDict) *Reader {
 	return zr
 }
 
+// NewAutoReader returns a reader for r, which may contain either
+// zstd-compressed data or uncompressed data.
+//
+// NewAutoReader reads the first 4 bytes from r. If they contain zstd magic
+// number or skippable frame magic number, then the returned reader
+// decompresses the data from r. Otherwise the returned reader returns
+// the data from r as is.
+//
+// The decompressing reader is released by the garbage collector, so it
+// may be inefficient for reading many small streams. Use NewReader
+// for such cases.
+func NewAutoReader(r io.Reader) (io.Reader, error) {
+	var b [4]byte
+	n, err := io.ReadFull(r, b[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("cannot read magic number: %s", err)
+	}
+	mr := io.MultiReader(bytes.NewReader(b[:n]), r)
+	if n < len(b) {
+		// Too short data for zstd.
+		return mr, nil
+	}
+	magic := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+	if magic == FrameMagic || IsSkippableMagic(magic) {
+		return NewReader(mr), nil
+	}
+	return mr, nil
+}
+
+// NewReaderRegistry returns new zstd reader reading compressed data from r
+// using dictionaries from reg.
+//
+// The dictionary for every frame is selected from reg by the dictionary ID
+// stored in the frame header. Frames without dictionary ID are decompressed
+// without a dictionary. An error is returned if reg doesn't contain
+// the dictionary referenced by the frame.
+//
+// Call Release when the Reader is no longer needed.
+func NewReaderRegistry(r io.Reader, reg *DictRegistry) *Reader {
+	zr := NewReader(r)
+	zr.reg = reg
+	return zr
+}
+
 // Reset resets zr to read from r using the given dictionary dd.
+//
+// Reset enables multistream mode. See Multistream for details.
 func (zr *Reader) Reset(r io.Reader, dd *DDict) {
 	zr.inBuf.size = 0
 	zr.inBuf.pos = 0
 	zr.outBuf.size = 0
 	zr.outBuf.pos = 0
 
+	zr.multistream = true
+	zr.waitForMore = false
+	zr.frameDone = false
+	zr.frameStart = true
+	zr.dictID = 0
+	zr.srcSizeHint = frameHeaderSizePrefix
+
+	zr.streamStart = true
+	zr.noPreallocate = false
+	zr.preallocPending = false
+	zr.metadata = nil
+	zr.metadataVariant = 0
+	zr.metadataLeft = 0
+	zr.atEOFErr = nil
+
 	zr.dd = dd
+	zr.reg = nil
 	initDStream(zr.ds, zr.dd)
 
 	zr.r = r
 }
 
+// ResetRegistry resets zr to read from r using dictionaries from reg.
+//
+// See NewReaderRegistry for details.
+func (zr *Reader) ResetRegistry(r io.Reader, reg *DictRegistry) {
+	zr.Reset(r, nil)
+	zr.reg = reg
+}
+
+// ResetNoDict resets zr to read from r without a dictionary.
+//
+// This is useful for pooled readers, which must read dictionary-free
+// frames after reading frames with a dictionary.
+func (zr *Reader) ResetNoDict(r io.Reader) {
+	zr.Reset(r, nil)
+}
+
+// Multistream controls whether zr reads all the concatenated frames
+// from the underlying reader.
+//
+// By default zr reads all the frames until the end of the underlying reader.
+// If ok is false, then zr stops at the end of the current frame, so Read
+// returns io.EOF after the frame is decompressed. zr doesn't read past
+// the end of the frame in this mode, so the data following the frame
+// remains in the underlying reader. This is useful when zstd frames
+// are embedded into another protocol.
+//
+// Call Reset in order to read the next frame after io.EOF.
+//
+// Multistream must be called before the first Read.
+func (zr *Reader) Multistream(ok bool) {
+	zr.multistream = ok
+}
+
+// ErrNeedMoreData is returned from Reader.Read and Reader.WriteTo
+// in WaitForMore mode when the underlying reader returns io.EOF
+// in the middle of a frame.
+var ErrNeedMoreData = errors.New("the underlying reader has no more data in the middle of a frame")
+
+// WaitForMore controls whether io.EOF from the underlying reader
+// in the middle of a frame means the data is temporarily unavailable.
+//
+// By default zr returns io.EOF in this case. If ok is true, then zr returns
+// ErrNeedMoreData instead, so the caller may retry the Read after more data
+// is appended to the underlying reader. Decompression resumes where it
+// has been stopped. io.EOF is returned only if the underlying reader returns
+// io.EOF at the frame boundary. This is useful for tailing compressed files
+// while they are written.
+//
+// WaitForMore doesn't affect (0, nil) results from the underlying reader.
+// They are retried up to 100 times in a row before io.ErrNoProgress
+// is returned. Return io.EOF from the underlying reader when no data
+// is available for now.
+//
+// Reset disables WaitForMore mode.
+func (zr *Reader) WaitForMore(ok bool) {
+	zr.waitForMore = ok
+}
+
+// NextFrame prepares zr for reading the next frame after Read returns
+// io.EOF at the end of the current frame in single-frame mode.
+// See Multistream for details.
+//
+// Unlike Reset, NextFrame preserves the data buffered from the underlying
+// reader. The header of the next frame is read, so DictID returns
+// the dictionary ID for the next frame after NextFrame returns.
+// io.EOF is returned if there are no more frames.
+//
+// NextFrame may be also called before the first Read for reading
+// the header of the first frame.
+func (zr *Reader) NextFrame() error {
+	if (!zr.frameDone && !zr.frameStart) || zr.outBuf.pos < zr.outBuf.size {
+		return fmt.Errorf("the current frame must be read till io.EOF before calling NextFrame")
+	}
+	zr.frameDone = false
+	zr.frameStart = true
+	return zr.readFrameHeader()
+}
+
+// AtEOF returns true if all the data has been read from zr,
+// so the next Read call returns io.EOF.
+//
+// This allows avoiding the extra Read call returning (0, io.EOF).
+// AtEOF may read from the underlying reader if the current frame is complete
+// and there is no buffered compressed data, in order to detect whether
+// the underlying reader contains more frames. The read data is retained
+// for the subsequent Read calls. Errors other than io.EOF from the underlying
+// reader are returned from the next Read call, and false is returned for them.
+func (zr *Reader) AtEOF() bool {
+	if zr.outBuf.pos < zr.outBuf.size {
+		// There is unread decompressed data.
+		return false
+	}
+	if zr.frameDone {
+		// Multistream is disabled and the current frame is over.
+		return true
+	}
+	if !zr.frameStart || zr.inBuf.pos < zr.inBuf.size || zr.atEOFErr != nil {
+		// The current frame isn't complete, there is buffered compressed data
+		// or the pending error.
+		return false
+	}
+	err := zr.fillInBuf()
+	if err == io.EOF {
+		return true
+	}
+	zr.atEOFErr = err
+	return false
+}
+
+// Unread returns the compressed data read by zr from the underlying reader,
+// which hasn't been consumed yet.
+//
+// This allows processing the data following the frame in single-frame mode
+// (see Multistream) or the data zr failed to decompress. The data is
+// followed by the data remaining in the underlying reader, e.g.
+// io.MultiReader(bytes.NewReader(zr.Unread()), r) reads all the data
+// past the consumed compressed data.
+//
+// The returned slice is valid until the next call on zr. It mustn't
+// be modified.
+func (zr *Reader) Unread() []byte {
+	return zr.inBufGo[zr.inBuf.pos:zr.inBuf.size]
+}
+
+// DictID returns the dictionary ID for the frame being read.
+//
+// Zero is returned if the frame doesn't refer to a dictionary or if
+// the frame header hasn't been read yet. The frame header is read
+// on the first Read call for the frame or by NextFrame.
+//
+// DictID may be used for selecting the dictionary from a registry
+// and passing it to SetDict.
+func (zr *Reader) DictID() uint32 {
+	return zr.dictID
+}
+
+// SetDict sets the dictionary for decompressing the frame being read.
+//
+// SetDict may be called only before decompressing the frame,
+// i.e. after NextFrame, Reset or before the first Read.
+func (zr *Reader) SetDict(dd *DDict) {
+	zr.dd = dd
+	initDStream(zr.ds, zr.dd)
+}
+
+// readFrameHeader reads the header for the next frame from inBuf
+// without passing it to the decompressor.
+func (zr *Reader) readFrameHeader() error {
+	if zr.metadataLeft > 0 {
+		if err := zr.readMetadata(); err != nil {
+			return err
+		}
+	}
+	for {
+		var fh C.ZSTD_frameHeader
+		n, err := parseFrameHeader(&fh, zr.inBufGo[zr.inBuf.pos:zr.inBuf.size])
+		if err != nil {
+			// Let the decompressor return the proper error.
+			zr.frameStart = false
+			zr.streamStart = false
+			return nil
+		}
+		if n == 0 && zr.streamStart {
+			zr.streamStart = false
+			if fh.frameType == C.ZSTD_skippableFrame && uint64(fh.frameContentSize) <= maxMetadataSize {
+				// Read the leading skippable frame written
+				// by Writer.SetLeadingMetadata. Bigger frames are skipped
+				// by the decompressor without buffering.
+				// ZSTD_getFrameHeader doesn't return the magic variant
+				// for skippable frames, so obtain it from the magic number.
+				b := zr.inBufGo[zr.inBuf.pos:]
+				magic := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+				zr.inBuf.pos += C.ZSTD_SKIPPABLEHEADERSIZE
+				zr.metadata = []byte{}
+				zr.metadataVariant = magic - SkippableFrameMagicStart
+				zr.metadataLeft = uint64(fh.frameContentSize)
+				if err := zr.readMetadata(); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if n == 0 {
+			if fh.frameType == C.ZSTD_frame && uint64(fh.frameContentSize) != uint64(C.ZSTD_CONTENTSIZE_UNKNOWN) {
+				zr.preallocSize = uint64(fh.frameContentSize)
+				zr.preallocPending = true
+			}
+			zr.dictID = uint32(fh.dictID)
+			zr.frameStart = false
+			if zr.reg != nil {
+				return zr.selectRegistryDict()
+			}
+			return nil
+		}
+
+		// Read the remaining part of the header.
+		zr.srcSizeHint = C.size_t(n) - (zr.inBuf.size - zr.inBuf.pos)
+		if err := zr.fillInBuf(); err != nil {
+			if err == io.EOF && zr.inBuf.pos < zr.inBuf.size {
+				// Truncated frame header. Let the decompressor deal with it.
+				zr.frameStart = false
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// maxMetadataSize is the maximum size of the leading skippable frame
+// collected by Reader for Metadata.
+//
+// This limits the memory allocated for untrusted streams starting with
+// big skippable frames.
+const maxMetadataSize = 1024 * 1024
+
+// readMetadata reads the remaining contents of the leading skippable frame.
+func (zr *Reader) readMetadata() error {
+	for zr.metadataLeft > 0 {
+		if zr.inBuf.pos == zr.inBuf.size {
+			zr.srcSizeHint = dstreamInBufSize
+			if zr.metadataLeft < uint64(zr.srcSizeHint) {
+				zr.srcSizeHint = C.size_t(zr.metadataLeft)
+			}
+			if err := zr.fillInBuf(); err != nil {
+				if err == io.EOF {
+					if zr.waitForMore {
+						return ErrNeedMoreData
+					}
+					return newDecompressError("unexpected end of stream in the leading skippable frame")
+				}
+				return err
+			}
+		}
+		n := zr.inBuf.size - zr.inBuf.pos
+		if uint64(n) > zr.metadataLeft {
+			n = C.size_t(zr.metadataLeft)
+		}
+		zr.metadata = append(zr.metadata, zr.inBufGo[zr.inBuf.pos:zr.inBuf.pos+n]...)
+		zr.inBuf.pos += n
+		zr.metadataLeft -= uint64(n)
+	}
+	zr.srcSizeHint = frameHeaderSizePrefix
+	return nil
+}
+
+// Metadata returns the contents of the leading skippable frame written
+// by Writer.SetLeadingMetadata.
+//
+// The leading skippable frame is read during the first Read call, so
+// Metadata must be called after it. nil data is returned if the stream
+// doesn't start with a skippable frame. The contents of skippable frames
+// bigger than 1MiB aren't collected, so nil data is returned for them too.
+//
+// Reset drops the metadata.
+func (zr *Reader) Metadata() (magicVariant uint32, data []byte) {
+	if zr.metadataLeft > 0 {
+		return 0, nil
+	}
+	return zr.metadataVariant, zr.metadata
+}
+
+// selectRegistryDict sets the dictionary from zr.reg for the frame
+// with zr.dictID.
+func (zr *Reader) selectRegistryDict() error {
+	var dd *DDict
+	if zr.dictID != 0 {
+		dd = zr.reg.Get(zr.dictID)
+		if dd == nil {
+			return fmt.Errorf("cannot find dictionary with ID %d in the registry", zr.dictID)
+		}
+	}
+	if dd != zr.dd {
+		zr.dd = dd
+		initDStream(zr.ds, zr.dd)
+	}
+	return nil
+}
+
 func initDStream(ds *C.ZSTD_DStream, dd *DDict) {
 	var ddict *C.ZSTD_DDict
 	if dd != nil {
@@ -149,6 +539,7 @@ func (zr *Reader) Release() {
 
 	zr.r = nil
 	zr.dd = nil
+	zr.reg = nil
 }
 
 // WriteTo writes all the data from zr to w.
@@ -165,6 +556,9 @@ func (zr *Reader) WriteTo(w io.Writer) (int64, error) {
 				return nn, err
 			}
 		}
+		if zr.preallocPending {
+			zr.preallocate(w)
+		}
 		n, err := w.Write(zr.outBufGo[zr.outBuf.pos:zr.outBuf.size])
 		zr.outBuf.pos += C.size_t(n)
 		nn += int64(n)
@@ -174,7 +568,60 @@ func (zr *Reader) WriteTo(w io.Writer) (int64, error) {
 	}
 }
 
+// maxPreallocateSize is the maximum size preallocated by PreallocateFromHeader.
+//
+// This limits the memory allocated for frames with bogus content size.
+const maxPreallocateSize = 32 * 1024 * 1024
+
+type bufferGrower interface {
+	Grow(n int)
+}
+
+// PreallocateFromHeader controls whether WriteTo preallocates memory
+// for the decompressed frame in w.
+//
+// By default WriteTo calls w.Grow with the decompressed size obtained from
+// the frame header before writing the frame to w if w has Grow method
+// such as bytes.Buffer. This avoids reallocations of w while writing
+// big frames. The preallocated size is limited to 32MB in order to limit
+// memory usage for frames with bogus decompressed size. Frames without
+// the decompressed size in the header are written to w as is.
+//
+// Reset enables preallocation.
+func (zr *Reader) PreallocateFromHeader(ok bool) {
+	zr.noPreallocate = !ok
+}
+
+func (zr *Reader) preallocate(w io.Writer) {
+	zr.preallocPending = false
+	if zr.noPreallocate {
+		return
+	}
+	g, ok := w.(bufferGrower)
+	if !ok {
+		return
+	}
+	n := zr.preallocSize
+	if n > maxPreallocateSize {
+		n = maxPreallocateSize
+	}
+	if n > 0 {
+		g.Grow(int(n))
+	}
+}
+
 // Read reads up to len(p) bytes from zr to p.
+//
+// The underlying reader may return compressed data in chunks of arbitrary
+// sizes, including partial frames. Read waits until enough compressed data
+// is read for decompressing at least a single byte.
+//
+// If the underlying reader returns (0, nil), then Read retries reading.
+// io.ErrNoProgress is returned after 100 consecutive (0, nil) results.
+// Read may be called again after that, and the decompression resumes
+// where it has been stopped.
+// io.EOF is returned when the underlying reader returns io.EOF and all
+// the compressed data is decompressed.
 func (zr *Reader) Read(p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
@@ -192,6 +639,15 @@ func (zr *Reader) Read(p []byte) (int, error) {
 }
 
 func (zr *Reader) fillOutBuf() error {
+	if err := zr.atEOFErr; err != nil {
+		zr.atEOFErr = nil
+		return err
+	}
+	if zr.frameDone {
+		// Multistream is disabled and the current frame is over.
+		return io.EOF
+	}
+
 	if zr.inBuf.pos == zr.inBuf.size && zr.outBuf.size < dstreamOutBufSize {
 		// inBuf is empty and the previously decompressed data size
 		// is smaller than the maximum possible zr.outBuf.size.
@@ -203,6 +659,12 @@ func (zr *Reader) fillOutBuf() error {
 	}
 
 tryDecompressAgain:
+	if zr.frameStart {
+		if err := zr.readFrameHeader(); err != nil {
+			return err
+		}
+	}
+
 	// Try decompressing inBuf into outBuf.
 	zr.outBuf.size = dstreamOutBufSize
 	zr.outBuf.pos = 0
@@ -215,13 +677,24 @@ tryDecompressAgain:
 	zr.outBuf.pos = 0
 
 	if C.ZSTD_getErrorCode(result) != 0 {
-		return fmt.Errorf("cannot decompress data: %s", errStr(result))
+		return newDecompressError("cannot decompress data: %s", errStr(result))
+	}
+	zr.srcSizeHint = result
+	if result == 0 {
+		// The frame is fully decoded and flushed.
+		zr.frameStart = true
+		if !zr.multistream {
+			zr.frameDone = true
+		}
 	}
 
 	if zr.outBuf.size > 0 {
 		// Something has been decompressed to outBuf. Return it.
 		return nil
 	}
+	if zr.frameDone {
+		return io.EOF
+	}
 
 	// Nothing has been decompressed from inBuf.
 	if zr.inBuf.pos != prevInBufPos && zr.inBuf.pos < zr.inBuf.size {
@@ -240,19 +713,35 @@ tryDecompressAgain:
 	goto tryDecompressAgain
 }
 
+// maxConsecutiveEmptyReads is the maximum number of consecutive (0, nil)
+// results from the underlying reader before giving up with io.ErrNoProgress.
+const maxConsecutiveEmptyReads = 100
+
 func (zr *Reader) fillInBuf() error {
 	// Copy the remaining data to the start of inBuf.
 	copy(zr.inBufGo[:dstreamInBufSize], zr.inBufGo[zr.inBuf.pos:zr.inBuf.size])
 	zr.inBuf.size -= zr.inBuf.pos
 	zr.inBuf.pos = 0
 
+	bufEnd := dstreamInBufSize
+	if !zr.multistream && zr.inBuf.size+zr.srcSizeHint < bufEnd {
+		// Do not read past the end of the current frame.
+		bufEnd = zr.inBuf.size + zr.srcSizeHint
+	}
+
+	emptyReads := 0
+
 readAgain:
 	// Read more data into inBuf.
-	n, err := zr.r.Read(zr.inBufGo[zr.inBuf.size:dstreamInBufSize])
+	n, err := zr.r.Read(zr.inBufGo[zr.inBuf.size:bufEnd])
 	zr.inBuf.size += C.size_t(n)
 	if err == nil {
 		if n == 0 {
 			// Nothing has been read. Try reading data again.
+			emptyReads++
+			if emptyReads >= maxConsecutiveEmptyReads {
+				return io.ErrNoProgress
+			}
 			goto readAgain
 		}
 		return nil
@@ -262,6 +751,10 @@ readAgain:
 		return nil
 	}
 	if err == io.EOF {
+		if zr.waitForMore && (!zr.frameStart || zr.inBuf.size > 0) {
+			// The underlying reader has no more data in the middle of a frame.
+			return ErrNeedMoreData
+		}
 		// Do not wrap io.EOF, so the caller may notify the end of stream.
 		return err
 	}
@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -317,3 +318,789 @@ func testReaderExt(zr *Reader, s string) error {
 	}
 	return nil
 }
+
+func TestReaderMultistreamDisabled(t *testing.T) {
+	for _, size := range []int{1, 100, 64 * 1024, 300 * 1024} {
+		data1 := newTestString(size, 20)
+		data2 := newTestString(size+1, 20)
+		trailer := "trailing non-zstd data"
+
+		var bb bytes.Buffer
+		bb.Write(Compress(nil, []byte(data1)))
+		bb.Write(Compress(nil, []byte(data2)))
+		bb.WriteString(trailer)
+		r := bytes.NewReader(bb.Bytes())
+
+		zr := NewReader(r)
+		zr.Multistream(false)
+		plainData, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("cannot read the first frame for size %d: %s", size, err)
+		}
+		if string(plainData) != data1 {
+			t.Fatalf("unexpected data read from the first frame for size %d; got\n%X; want\n%X", size, plainData, data1)
+		}
+
+		// Read the second frame.
+		zr.Reset(r, nil)
+		zr.Multistream(false)
+		plainData, err = ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("cannot read the second frame for size %d: %s", size, err)
+		}
+		if string(plainData) != data2 {
+			t.Fatalf("unexpected data read from the second frame for size %d; got\n%X; want\n%X", size, plainData, data2)
+		}
+		zr.Release()
+
+		// The trailing data must remain in the underlying reader.
+		tail, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("cannot read trailing data: %s", err)
+		}
+		if string(tail) != trailer {
+			t.Fatalf("unexpected trailing data for size %d; got %q; want %q", size, tail, trailer)
+		}
+	}
+}
+
+func TestReaderByteByByte(t *testing.T) {
+	data := newTestString(200*1024, 20)
+	cd := Compress(nil, []byte(data))
+
+	r := &byteByByteReader{
+		b: cd,
+	}
+	zr := NewReader(r)
+	defer zr.Release()
+
+	plainData, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("cannot read data: %s", err)
+	}
+	if string(plainData) != data {
+		t.Fatalf("unexpected data read; got\n%X; want\n%X", plainData, data)
+	}
+	if r.emptyReads == 0 {
+		t.Fatalf("expecting non-zero number of empty reads")
+	}
+}
+
+func TestReaderNoProgress(t *testing.T) {
+	zr := NewReader(&emptyReader{})
+	defer zr.Release()
+
+	buf := make([]byte, 10)
+	if _, err := zr.Read(buf); err != io.ErrNoProgress {
+		t.Fatalf("unexpected error; got %v; want %v", err, io.ErrNoProgress)
+	}
+
+	// The decompression must resume after io.ErrNoProgress.
+	data := newTestString(1000, 10)
+	r := &stallingReader{
+		b:          Compress(nil, []byte(data)),
+		emptyReads: 2*maxConsecutiveEmptyReads + 1,
+	}
+	zr.Reset(r, nil)
+	var plainData []byte
+	for i := 0; ; i++ {
+		if i > 10 {
+			t.Fatalf("too many io.ErrNoProgress errors")
+		}
+		b, err := ioutil.ReadAll(zr)
+		plainData = append(plainData, b...)
+		if err == nil {
+			break
+		}
+		if err != io.ErrNoProgress {
+			t.Fatalf("unexpected error; got %v; want %v", err, io.ErrNoProgress)
+		}
+	}
+	if string(plainData) != data {
+		t.Fatalf("unexpected data read; got %q; want %q", plainData, data)
+	}
+}
+
+// stallingReader returns (0, nil) emptyReads times before returning b
+// one byte at a time.
+type stallingReader struct {
+	b          []byte
+	emptyReads int
+}
+
+func (r *stallingReader) Read(p []byte) (int, error) {
+	if r.emptyReads > 0 {
+		r.emptyReads--
+		return 0, nil
+	}
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+	p[0] = r.b[0]
+	r.b = r.b[1:]
+	return 1, nil
+}
+
+// byteByByteReader returns a single byte per Read call, interleaved
+// with empty reads.
+type byteByByteReader struct {
+	b          []byte
+	n          int
+	emptyReads int
+}
+
+func (r *byteByByteReader) Read(p []byte) (int, error) {
+	r.n++
+	if r.n%3 == 0 {
+		r.emptyReads++
+		return 0, nil
+	}
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p[:1], r.b)
+	r.b = r.b[n:]
+	return n, nil
+}
+
+type emptyReader struct{}
+
+func (*emptyReader) Read(p []byte) (int, error) {
+	return 0, nil
+}
+
+func TestReaderResetNoDict(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 1e4; i++ {
+		sample := []byte(fmt.Sprintf("this is a sample number %d", i))
+		samples = append(samples, sample)
+	}
+	dict := BuildDict(samples, 8*1024)
+
+	cd, err := NewCDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create CDict: %s", err)
+	}
+	defer cd.Release()
+
+	dd, err := NewDDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create DDict: %s", err)
+	}
+	defer dd.Release()
+
+	src := []byte("this is a sample number 42")
+
+	zr := NewReaderDict(bytes.NewReader(CompressDict(nil, src, cd)), dd)
+	defer zr.Release()
+	plainData, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("cannot read the frame with dictionary: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data read; got %q; want %q", plainData, src)
+	}
+
+	zr.ResetNoDict(bytes.NewReader(Compress(nil, src)))
+	plainData, err = ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("cannot read the frame without dictionary: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data read; got %q; want %q", plainData, src)
+	}
+
+	// The dictionary must be dropped, so frames with dictionary cannot be read.
+	zr.ResetNoDict(bytes.NewReader(CompressDict(nil, src, cd)))
+	if _, err := ioutil.ReadAll(zr); err == nil {
+		t.Fatalf("expecting error when reading the frame with dictionary after ResetNoDict")
+	}
+}
+
+func TestReaderDictID(t *testing.T) {
+	newDicts := func(prefix string) (*CDict, *DDict) {
+		t.Helper()
+		var samples [][]byte
+		for i := 0; i < 1e4; i++ {
+			sample := []byte(fmt.Sprintf("%s sample number %d", prefix, i))
+			samples = append(samples, sample)
+		}
+		dict := BuildDict(samples, 8*1024)
+		cd, err := NewCDict(dict)
+		if err != nil {
+			t.Fatalf("cannot create CDict: %s", err)
+		}
+		dd, err := NewDDict(dict)
+		if err != nil {
+			t.Fatalf("cannot create DDict: %s", err)
+		}
+		return cd, dd
+	}
+	cd1, dd1 := newDicts("foo")
+	defer cd1.Release()
+	defer dd1.Release()
+	cd2, dd2 := newDicts("bar")
+	defer cd2.Release()
+	defer dd2.Release()
+
+	src1 := []byte("foo sample number 123")
+	src2 := []byte("bar sample number 456")
+	frame1 := CompressDict(nil, src1, cd1)
+	frame2 := CompressDict(nil, src2, cd2)
+	dictID1, err := GetFrameDictID(frame1)
+	if err != nil {
+		t.Fatalf("cannot get dict ID: %s", err)
+	}
+	dictID2, err := GetFrameDictID(frame2)
+	if err != nil {
+		t.Fatalf("cannot get dict ID: %s", err)
+	}
+	if dictID1 == 0 || dictID2 == 0 || dictID1 == dictID2 {
+		t.Fatalf("unexpected dict IDs: %d, %d", dictID1, dictID2)
+	}
+	registry := map[uint32]*DDict{
+		dictID1: dd1,
+		dictID2: dd2,
+	}
+
+	// Read frames byte by byte in order to verify header reading at frame boundaries.
+	r := &byteByByteReader{
+		b: append(append([]byte{}, frame1...), frame2...),
+	}
+	zr := NewReader(r)
+	defer zr.Release()
+	zr.Multistream(false)
+
+	for i, f := range []struct {
+		src    []byte
+		dictID uint32
+	}{
+		{src1, dictID1},
+		{src2, dictID2},
+	} {
+		if err := zr.NextFrame(); err != nil {
+			t.Fatalf("cannot read frame #%d header: %s", i, err)
+		}
+		if zr.DictID() != f.dictID {
+			t.Fatalf("unexpected dict ID for frame #%d; got %d; want %d", i, zr.DictID(), f.dictID)
+		}
+		zr.SetDict(registry[zr.DictID()])
+		var buf [1]byte
+		if _, err := zr.Read(buf[:]); err != nil {
+			t.Fatalf("cannot read frame #%d: %s", i, err)
+		}
+		if err := zr.NextFrame(); err == nil {
+			t.Fatalf("expecting error when calling NextFrame in the middle of frame #%d", i)
+		}
+		tail, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("cannot read frame #%d: %s", i, err)
+		}
+		plainData := append(buf[:], tail...)
+		if !bytes.Equal(plainData, f.src) {
+			t.Fatalf("unexpected data read from frame #%d; got %q; want %q", i, plainData, f.src)
+		}
+		if zr.DictID() != f.dictID {
+			t.Fatalf("unexpected dict ID after reading frame #%d; got %d; want %d", i, zr.DictID(), f.dictID)
+		}
+	}
+	if err := zr.NextFrame(); err != io.EOF {
+		t.Fatalf("unexpected error after the last frame; got %v; want %v", err, io.EOF)
+	}
+
+	// DictID must be updated at frame boundaries in multistream mode.
+	r.b = append(append(append([]byte{}, frame1...), Compress(nil, src1)...), frame1...)
+	zr.Reset(r, dd1)
+	var dictIDs []uint32
+	var buf [1]byte
+	for {
+		_, err := zr.Read(buf[:])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("cannot read data: %s", err)
+		}
+		if len(dictIDs) == 0 || dictIDs[len(dictIDs)-1] != zr.DictID() {
+			dictIDs = append(dictIDs, zr.DictID())
+		}
+	}
+	if len(dictIDs) != 3 || dictIDs[0] != dictID1 || dictIDs[1] != 0 || dictIDs[2] != dictID1 {
+		t.Fatalf("unexpected dict IDs in multistream mode; got %v; want [%d 0 %d]", dictIDs, dictID1, dictID1)
+	}
+}
+
+func TestReaderWaitForMore(t *testing.T) {
+	src := []byte(newTestString(512*1024, 3))
+	compressed := Compress(nil, src)
+	compressed = append(compressed, Compress(nil, src)...)
+	expected := append(append([]byte{}, src...), src...)
+
+	for _, split := range []int{1, 3, len(compressed) / 3, len(compressed)/2 + 5, len(compressed) - 1} {
+		var bb bytes.Buffer
+		bb.Write(compressed[:split])
+		zr := NewReader(&bb)
+		zr.WaitForMore(true)
+
+		var result []byte
+		buf := make([]byte, 4096)
+		gaps := 0
+		for {
+			n, err := zr.Read(buf)
+			result = append(result, buf[:n]...)
+			if err == nil {
+				continue
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != ErrNeedMoreData {
+				t.Fatalf("unexpected error for split=%d: %s", split, err)
+			}
+			gaps++
+			if gaps > 1 {
+				t.Fatalf("unexpected ErrNeedMoreData after all the data is written for split=%d", split)
+			}
+			// Append the remaining data after the gap.
+			bb.Write(compressed[split:])
+		}
+		if gaps != 1 {
+			t.Fatalf("unexpected number of gaps for split=%d; got %d; want 1", split, gaps)
+		}
+		if !bytes.Equal(result, expected) {
+			t.Fatalf("unexpected data read for split=%d; got %d bytes; want %d bytes", split, len(result), len(expected))
+		}
+		zr.Release()
+	}
+
+	// Verify that io.EOF is returned at the frame boundary.
+	zr := NewReader(bytes.NewReader(compressed))
+	defer zr.Release()
+	zr.WaitForMore(true)
+	result, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(result, expected) {
+		t.Fatalf("unexpected data read")
+	}
+}
+
+func TestReaderAtEOF(t *testing.T) {
+	var compressed, expected []byte
+	for i := 0; i < 3; i++ {
+		src := []byte(fmt.Sprintf("frame %d %s", i, newTestString(100*1024, 3)))
+		compressed = Compress(compressed, src)
+		expected = append(expected, src...)
+	}
+
+	zr := NewReader(bytes.NewReader(compressed))
+	defer zr.Release()
+	testReaderAtEOF(t, zr, expected)
+
+	// Empty stream.
+	zr.Reset(bytes.NewReader(nil), nil)
+	testReaderAtEOF(t, zr, nil)
+
+	// Single-frame mode.
+	zr.Reset(bytes.NewReader(compressed), nil)
+	zr.Multistream(false)
+	testReaderAtEOF(t, zr, expected[:len(expected)/3])
+}
+
+func testReaderAtEOF(t *testing.T, zr *Reader, expected []byte) {
+	t.Helper()
+	var result []byte
+	buf := make([]byte, 1000)
+	for !zr.AtEOF() {
+		n, err := zr.Read(buf)
+		if err != nil {
+			t.Fatalf("unexpected error after reading %d bytes when AtEOF returns false: %s", len(result), err)
+		}
+		result = append(result, buf[:n]...)
+	}
+	if !bytes.Equal(result, expected) {
+		t.Fatalf("unexpected data read before AtEOF returned true; got %d bytes; want %d bytes", len(result), len(expected))
+	}
+	if n, err := zr.Read(buf); err != io.EOF || n != 0 {
+		t.Fatalf("unexpected result after AtEOF returned true; got (%d, %v); want (0, io.EOF)", n, err)
+	}
+}
+
+// failOnceReader returns err on the first Read call and then reads from r.
+type failOnceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *failOnceReader) Read(p []byte) (int, error) {
+	if err := r.err; err != nil {
+		r.err = nil
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+func TestReaderAtEOFError(t *testing.T) {
+	src1 := newTestString(100*1024, 3)
+	src2 := "second frame"
+	compressed1 := Compress(nil, []byte(src1))
+	compressed2 := Compress(nil, []byte(src2))
+
+	f := func(r io.Reader, errExpected error, tail string) {
+		t.Helper()
+		zr := NewReader(io.MultiReader(bytes.NewReader(compressed1), r))
+		defer zr.Release()
+		buf := make([]byte, len(src1))
+		if _, err := io.ReadFull(zr, buf); err != nil {
+			t.Fatalf("cannot read the first frame: %s", err)
+		}
+		if string(buf) != src1 {
+			t.Fatalf("unexpected data read from the first frame")
+		}
+		if zr.AtEOF() {
+			t.Fatalf("AtEOF must return false on error")
+		}
+		if zr.AtEOF() {
+			t.Fatalf("AtEOF must return false with the pending error")
+		}
+		n, err := zr.Read(buf)
+		if err == nil || !strings.Contains(err.Error(), errExpected.Error()) || n != 0 {
+			t.Fatalf("unexpected result after AtEOF; got (%d, %v); want (0, %v)", n, err, errExpected)
+		}
+		plainData, err := ioutil.ReadAll(zr)
+		if err != nil && err != errExpected {
+			t.Fatalf("unexpected error when reading the remaining data: %s", err)
+		}
+		if string(plainData) != tail {
+			t.Fatalf("unexpected data read after the error; got %q; want %q", plainData, tail)
+		}
+	}
+
+	// Transient error.
+	errTransient := fmt.Errorf("transient error")
+	f(&failOnceReader{r: bytes.NewReader(compressed2), err: errTransient}, errTransient, src2)
+
+	// The reader making no progress.
+	f(&emptyReader{}, io.ErrNoProgress, "")
+}
+
+func TestReaderMetadata(t *testing.T) {
+	f := func(magicVariant uint32, metadata, payload string, multistream bool) {
+		t.Helper()
+
+		var bb bytes.Buffer
+		zw := NewWriter(&bb)
+		zw.SetLeadingMetadata(magicVariant, []byte(metadata))
+		if _, err := zw.Write([]byte(payload)); err != nil {
+			t.Fatalf("cannot write payload: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw: %s", err)
+		}
+		zw.Release()
+		compressed := bb.Bytes()
+
+		// The leading skippable frame must be readable by other decoders.
+		n, err := CountFrames(compressed, true)
+		if err != nil {
+			t.Fatalf("cannot count frames: %s", err)
+		}
+		if n != 2 {
+			t.Fatalf("unexpected number of frames; got %d; want 2", n)
+		}
+		plainData, err := Decompress(nil, compressed)
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		if string(plainData) != payload {
+			t.Fatalf("unexpected data decompressed; got %d bytes; want %d bytes", len(plainData), len(payload))
+		}
+
+		// Read the data in small chunks in order to verify
+		// metadata split across reads.
+		zr := NewReader(iotest.OneByteReader(bytes.NewReader(compressed)))
+		defer zr.Release()
+		zr.Multistream(multistream)
+		if _, data := zr.Metadata(); data != nil {
+			t.Fatalf("unexpected metadata before the first Read: %q", data)
+		}
+		plainData, err = ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("cannot read data: %s", err)
+		}
+		if string(plainData) != payload {
+			t.Fatalf("unexpected data read; got %d bytes; want %d bytes", len(plainData), len(payload))
+		}
+		variant, data := zr.Metadata()
+		if variant != magicVariant {
+			t.Fatalf("unexpected magicVariant; got %d; want %d", variant, magicVariant)
+		}
+		if string(data) != metadata {
+			t.Fatalf("unexpected metadata; got %q; want %q", data, metadata)
+		}
+	}
+	f(0, "", "foobar", true)
+	f(1, "key-id:42", "foobar", true)
+	f(15, "key-id:42", newTestString(300*1000, 10), true)
+	f(3, newTestString(200*1000, 3), "foobar", false)
+	f(7, "nonce", "", true)
+
+	// The stream without metadata.
+	zr := NewReader(bytes.NewReader(Compress(nil, []byte("foobar"))))
+	defer zr.Release()
+	if _, err := ioutil.ReadAll(zr); err != nil {
+		t.Fatalf("cannot read data: %s", err)
+	}
+	if _, data := zr.Metadata(); data != nil {
+		t.Fatalf("unexpected metadata for stream without metadata: %q", data)
+	}
+
+	// Only the first frame of the stream is the metadata.
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+	zw.SetLeadingMetadata(2, []byte("metadata"))
+	fmt.Fprintf(zw, "foo")
+	if err := zw.EndFrame(); err != nil {
+		t.Fatalf("cannot end frame: %s", err)
+	}
+	fmt.Fprintf(zw, "bar")
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	if n, err := CountFrames(bb.Bytes(), true); err != nil || n != 3 {
+		t.Fatalf("unexpected number of frames; got %d; want 3; err: %v", n, err)
+	}
+	zr.Reset(&bb, nil)
+	plainData, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("cannot read data: %s", err)
+	}
+	if string(plainData) != "foobar" {
+		t.Fatalf("unexpected data read; got %q; want %q", plainData, "foobar")
+	}
+	if _, data := zr.Metadata(); string(data) != "metadata" {
+		t.Fatalf("unexpected metadata; got %q; want %q", data, "metadata")
+	}
+}
+
+func TestReaderMetadataOversized(t *testing.T) {
+	payload := newTestString(100*1000, 10)
+	compressed := Compress(nil, []byte(payload))
+
+	f := func(src []byte, truncated bool) {
+		t.Helper()
+		zr := NewReader(bytes.NewReader(src))
+		defer zr.Release()
+		plainData, err := ioutil.ReadAll(zr)
+		if !truncated {
+			// The payload is a part of the truncated skippable frame
+			// otherwise, so it cannot be read.
+			if err != nil {
+				t.Fatalf("cannot read data: %s", err)
+			}
+			if string(plainData) != payload {
+				t.Fatalf("unexpected data read; got %d bytes; want %d bytes", len(plainData), len(payload))
+			}
+		}
+		if _, data := zr.Metadata(); data != nil {
+			t.Fatalf("unexpected metadata for oversized skippable frame; got %d bytes", len(data))
+		}
+		if n := cap(zr.metadata); n > 0 {
+			t.Fatalf("oversized skippable frame mustn't be buffered; got %d bytes buffered", n)
+		}
+	}
+
+	// The skippable frame exceeding the limit must be skipped.
+	data := make([]byte, maxMetadataSize+1)
+	src := appendSkippableFrame(nil, 1, data)
+	src = append(src, compressed...)
+	f(src, false)
+
+	// The truncated skippable frame with the maximum size must be skipped
+	// in constant memory.
+	src = []byte{0x50, 0x2A, 0x4D, 0x18, 0xFF, 0xFF, 0xFF, 0xFF}
+	src = append(src, compressed...)
+	f(src, true)
+
+	// The skippable frame with the maximum allowed size must be collected.
+	data = []byte(newTestString(maxMetadataSize, 3))[:maxMetadataSize]
+	src = appendSkippableFrame(nil, 2, data)
+	src = append(src, compressed...)
+	zr := NewReader(bytes.NewReader(src))
+	defer zr.Release()
+	plainData, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("cannot read data: %s", err)
+	}
+	if string(plainData) != payload {
+		t.Fatalf("unexpected data read; got %d bytes; want %d bytes", len(plainData), len(payload))
+	}
+	if variant, md := zr.Metadata(); variant != 2 || !bytes.Equal(md, data) {
+		t.Fatalf("unexpected metadata; got variant %d with %d bytes; want variant 2 with %d bytes", variant, len(md), len(data))
+	}
+}
+
+func TestNewAutoReader(t *testing.T) {
+	f := func(src []byte, plainDataExpected string, compressed bool) {
+		t.Helper()
+		r, err := NewAutoReader(iotest.HalfReader(bytes.NewReader(src)))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, ok := r.(*Reader); ok != compressed {
+			t.Fatalf("unexpected reader type; got %T; compressed=%v", r, compressed)
+		}
+		plainData, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("cannot read data: %s", err)
+		}
+		if string(plainData) != plainDataExpected {
+			t.Fatalf("unexpected data read; got %q; want %q", plainData, plainDataExpected)
+		}
+	}
+
+	// zstd streams.
+	s := newTestString(100*1000, 10)
+	f(Compress(nil, []byte(s)), s, true)
+	f(Compress(nil, []byte("foobar")), "foobar", true)
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	zw.SetLeadingMetadata(1, []byte("metadata"))
+	fmt.Fprintf(zw, "data with metadata")
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	zw.Release()
+	f(bb.Bytes(), "data with metadata", true)
+
+	// Plain streams.
+	f(nil, "", false)
+	f([]byte("a"), "a", false)
+	f([]byte("abcd"), "abcd", false)
+	f([]byte("plain text stream"), "plain text stream", false)
+	f([]byte(s), s, false)
+	f([]byte{0x28, 0xb5, 0x2f}, "\x28\xb5\x2f", false)
+
+	// Read error.
+	if _, err := NewAutoReader(iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("foobar")))); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
+
+type growRecorder struct {
+	bytes.Buffer
+	grows []int
+}
+
+func (gr *growRecorder) Grow(n int) {
+	gr.grows = append(gr.grows, n)
+	gr.Buffer.Grow(n)
+}
+
+func TestReaderPreallocateFromHeader(t *testing.T) {
+	f := func(compressed []byte, plainDataExpected string, preallocate bool, growsExpected []int) {
+		t.Helper()
+		zr := NewReader(bytes.NewReader(compressed))
+		defer zr.Release()
+		zr.PreallocateFromHeader(preallocate)
+		var gr growRecorder
+		n, err := zr.WriteTo(&gr)
+		if err != nil {
+			t.Fatalf("cannot read data: %s", err)
+		}
+		if n != int64(len(plainDataExpected)) {
+			t.Fatalf("unexpected number of bytes written; got %d; want %d", n, len(plainDataExpected))
+		}
+		if gr.String() != plainDataExpected {
+			t.Fatalf("unexpected data read")
+		}
+		if fmt.Sprintf("%v", gr.grows) != fmt.Sprintf("%v", growsExpected) {
+			t.Fatalf("unexpected Grow calls; got %v; want %v", gr.grows, growsExpected)
+		}
+	}
+
+	s := newTestString(3*1000*1000, 10)
+
+	// Frames with known size.
+	compressed := Compress(nil, []byte(s))
+	f(compressed, s, true, []int{len(s)})
+	f(compressed, s, false, nil)
+	compressed = Compress(compressed, []byte("foobar"))
+	f(compressed, s+"foobar", true, []int{len(s), len("foobar")})
+
+	// Frames with unknown size must be decompressed with streaming growth.
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	zw.Release()
+	f(bb.Bytes(), s, true, nil)
+
+	// Mixed frames.
+	compressed = append(bb.Bytes(), Compress(nil, []byte("foobar"))...)
+	f(compressed, s+"foobar", true, []int{len("foobar")})
+	plainData, err := Decompress(nil, compressed)
+	if err != nil {
+		t.Fatalf("cannot decompress mixed frames: %s", err)
+	}
+	if string(plainData) != s+"foobar" {
+		t.Fatalf("unexpected data decompressed from mixed frames")
+	}
+}
+
+func TestReaderUnread(t *testing.T) {
+	data := []byte(newTestString(300*1024, 10))
+	compressed := Compress(nil, data)
+	trailer := []byte("trailing data of another protocol")
+
+	// Single-frame mode.
+	src := append(append([]byte{}, compressed...), trailer...)
+	r := bytes.NewReader(src)
+	zr := NewReader(r)
+	defer zr.Release()
+	zr.Multistream(false)
+	plainData, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("cannot read data: %s", err)
+	}
+	if !bytes.Equal(plainData, data) {
+		t.Fatalf("unexpected data read; got %d bytes; want %d bytes", len(plainData), len(data))
+	}
+	rest, err := ioutil.ReadAll(io.MultiReader(bytes.NewReader(zr.Unread()), r))
+	if err != nil {
+		t.Fatalf("cannot read the remaining data: %s", err)
+	}
+	if !bytes.Equal(rest, trailer) {
+		t.Fatalf("unexpected data after the frame; got %q; want %q", rest, trailer)
+	}
+
+	// Multistream mode with invalid data after the frame.
+	small := Compress(nil, []byte("foobar"))
+	src = append(append([]byte{}, small...), trailer...)
+	r = bytes.NewReader(src)
+	zr.Reset(r, nil)
+	if _, err := ioutil.ReadAll(zr); err == nil {
+		t.Fatalf("expecting non-nil error when reading the trailing data in multistream mode")
+	}
+	if !bytes.Equal(zr.Unread(), trailer) {
+		t.Fatalf("unexpected unread data; got %q; want %q", zr.Unread(), trailer)
+	}
+	if r.Len() != 0 {
+		t.Fatalf("unexpected data remaining in the underlying reader: %d bytes", r.Len())
+	}
+
+	// No unread data after reading all the frames.
+	zr.Reset(bytes.NewReader(compressed), nil)
+	if _, err := ioutil.ReadAll(zr); err != nil {
+		t.Fatalf("cannot read data: %s", err)
+	}
+	if n := len(zr.Unread()); n != 0 {
+		t.Fatalf("unexpected unread data: %d bytes", n)
+	}
+}
@@ -87,3 +87,38 @@ func benchmarkReader(b *testing.B, blockSize, level int) {
 		}
 	})
 }
+
+func BenchmarkReaderPreallocateFromHeader(b *testing.B) {
+	for _, preallocate := range []bool{false, true} {
+		b.Run(fmt.Sprintf("preallocate_%v", preallocate), func(b *testing.B) {
+			benchmarkReaderPreallocateFromHeader(b, preallocate)
+		})
+	}
+}
+
+func benchmarkReaderPreallocateFromHeader(b *testing.B, preallocate bool) {
+	block := newBenchString(4 * 1024 * 1024)
+	cd := Compress(nil, block)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(block)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := bytes.NewReader(cd)
+		zr := NewReader(r)
+		defer zr.Release()
+		for pb.Next() {
+			zr.PreallocateFromHeader(preallocate)
+			// Use new buffer on every iteration in order to measure
+			// the buffer reallocations.
+			var bb bytes.Buffer
+			if _, err := zr.WriteTo(&bb); err != nil {
+				panic(fmt.Errorf("unexpected error: %s", err))
+			}
+			if bb.Len() != len(block) {
+				panic(fmt.Errorf("unexpected data length; got %d; want %d", bb.Len(), len(block)))
+			}
+			r.Reset(cd)
+			zr.Reset(r, nil)
+		}
+	})
+}
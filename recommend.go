@@ -0,0 +1,160 @@
+package gozstd
+
+import (
+	"fmt"
+	"time"
+)
+
+// recommendLevels contains compression levels tried by RecommendLevel
+// in the order they are tried.
+var recommendLevels = []int{1, 2, 3, 5, 7, 9, 12, 15, 19}
+
+// RecommendLevel returns the compression level with the best compression
+// ratio per millisecond of compression time for the given sample
+// and the compression ratio for the level.
+//
+// The sample must be representative of the data to be compressed.
+// The levels are tried from the fastest to the slowest until maxTime
+// is exhausted, so RecommendLevel returns in about maxTime in the worst case.
+// At least a single level is always tried.
+//
+// The set of tried levels and the tie-breaking between them are deterministic,
+// but the result depends on the measured compression speed, so it may vary
+// on a heavily loaded system.
+func RecommendLevel(sample []byte, maxTime time.Duration) (level int, ratio float64) {
+	if len(sample) == 0 {
+		return DefaultCompressionLevel, 1
+	}
+
+	var buf []byte
+	bestScore := float64(-1)
+	startTime := time.Now()
+	var prevDuration time.Duration
+	for i, lvl := range recommendLevels {
+		if i > 0 {
+			// Slower levels take at least the same time as the previous level,
+			// so stop if the next level doesn't fit maxTime.
+			if time.Since(startTime)+prevDuration > maxTime {
+				break
+			}
+		}
+
+		t := time.Now()
+		buf = CompressLevel(buf[:0], sample, lvl)
+		d := time.Since(t)
+		prevDuration = d
+
+		r := float64(len(sample)) / float64(len(buf))
+		ms := d.Seconds() * 1e3
+		if ms < 1e-3 {
+			ms = 1e-3
+		}
+		score := r / ms
+		if score > bestScore {
+			bestScore = score
+			level = lvl
+			ratio = r
+		}
+	}
+	return level, ratio
+}
+
+// DecompressionThroughput returns the decompression speed in bytes
+// of decompressed data per second for the given compressed src.
+//
+// src is decompressed the given number of iterations with the same
+// decompression context and the same output buffer, so the result
+// reflects the speed of the decompression itself.
+// This may be used for capacity planning together with RecommendLevel.
+func DecompressionThroughput(src []byte, iterations int) (float64, error) {
+	if iterations <= 0 {
+		return 0, fmt.Errorf("iterations must be positive; got %d", iterations)
+	}
+
+	dctx := dctxPool.Get().(*dctxWrapper)
+	defer dctxPool.Put(dctx)
+
+	// Decompress src beforehand in order to validate it and to allocate
+	// the output buffer outside the measured loop.
+	buf, err := decompress(dctx, nil, nil, src, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) == 0 {
+		return 0, fmt.Errorf("cannot measure decompression throughput for empty decompressed data")
+	}
+
+	// Sum the decompressed sizes, so the decompression results are used.
+	total := 0
+	startTime := time.Now()
+	for i := 0; i < iterations; i++ {
+		buf, err = decompress(dctx, nil, buf[:0], src, nil)
+		if err != nil {
+			return 0, err
+		}
+		total += len(buf)
+	}
+	seconds := time.Since(startTime).Seconds()
+	if seconds <= 0 {
+		seconds = 1e-9
+	}
+	return float64(total) / seconds, nil
+}
+
+// ProfilePoint contains compression stats for a single compression level.
+//
+// See Profile.
+type ProfilePoint struct {
+	// Level is the compression level.
+	Level int
+
+	// CompressedSize is the size of the compressed sample.
+	CompressedSize int
+
+	// Ratio is the compression ratio, i.e. the sample size divided
+	// by CompressedSize.
+	Ratio float64
+
+	// Duration is the time spent on the sample compression.
+	Duration time.Duration
+}
+
+// Profile compresses sample at every level from levels and returns
+// the compression stats for every level in the order of levels.
+//
+// The returned points may be used for plotting the tradeoff curve between
+// the compression speed and the compression ratio in order to choose
+// the compression level. The sample must be representative of the data
+// to be compressed. All the levels are measured with the same compression
+// context, so the measurements aren't skewed by context allocations.
+func Profile(sample []byte, levels []int) ([]ProfilePoint, error) {
+	if len(sample) == 0 {
+		return nil, fmt.Errorf("cannot profile empty sample")
+	}
+	for _, level := range levels {
+		if err := checkParamBounds(ParamCompressionLevel, level); err != nil {
+			return nil, fmt.Errorf("invalid level: %s", err)
+		}
+	}
+
+	cctx := cctxPool.Get().(*cctxWrapper)
+	defer cctxPool.Put(cctx)
+
+	// Compress the sample beforehand in order to allocate the output buffer
+	// outside the measured code.
+	buf := compress(cctx, nil, nil, sample, nil, DefaultCompressionLevel)
+
+	points := make([]ProfilePoint, 0, len(levels))
+	for _, level := range levels {
+		startTime := time.Now()
+		buf = compress(cctx, nil, buf[:0], sample, nil, level)
+		d := time.Since(startTime)
+		points = append(points, ProfilePoint{
+			Level:          level,
+			CompressedSize: len(buf),
+			Ratio:          float64(len(sample)) / float64(len(buf)),
+			Duration:       d,
+		})
+	}
+	return points, nil
+}
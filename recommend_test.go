@@ -0,0 +1,136 @@
+package gozstd
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestRecommendLevel(t *testing.T) {
+	sample := []byte(newTestString(256*1024, 10))
+	for _, maxTime := range []time.Duration{0, 10 * time.Millisecond, 200 * time.Millisecond} {
+		startTime := time.Now()
+		level, ratio := RecommendLevel(sample, maxTime)
+		d := time.Since(startTime)
+		if level < 1 || level > 22 {
+			t.Fatalf("unexpected level for maxTime=%s: %d", maxTime, level)
+		}
+		if ratio <= 1 {
+			t.Fatalf("unexpected ratio for maxTime=%s: %f", maxTime, ratio)
+		}
+		cd := CompressLevel(nil, sample, level)
+		ratioExpected := float64(len(sample)) / float64(len(cd))
+		if ratio != ratioExpected {
+			t.Fatalf("unexpected ratio for level %d; got %f; want %f", level, ratio, ratioExpected)
+		}
+		// The first level is always tried, so give it some room.
+		if d > maxTime+time.Second {
+			t.Fatalf("RecommendLevel exceeded maxTime=%s; took %s", maxTime, d)
+		}
+	}
+
+	// Empty sample
+	level, ratio := RecommendLevel(nil, time.Second)
+	if level != DefaultCompressionLevel || ratio != 1 {
+		t.Fatalf("unexpected result for empty sample; got level=%d, ratio=%f", level, ratio)
+	}
+}
+
+func TestDecompressionThroughput(t *testing.T) {
+	src := CompressLevel(nil, []byte(newTestString(256*1024, 10)), 3)
+	throughput, err := DecompressionThroughput(src, 10)
+	if err != nil {
+		t.Fatalf("cannot measure decompression throughput: %s", err)
+	}
+	if throughput <= 0 {
+		t.Fatalf("unexpected throughput: %f", throughput)
+	}
+
+	// The decompression context and the output buffer must be re-used
+	// between iterations.
+	allocsOne := testing.AllocsPerRun(10, func() {
+		if _, err := DecompressionThroughput(src, 1); err != nil {
+			panic(fmt.Errorf("unexpected error: %s", err))
+		}
+	})
+	allocsMany := testing.AllocsPerRun(10, func() {
+		if _, err := DecompressionThroughput(src, 100); err != nil {
+			panic(fmt.Errorf("unexpected error: %s", err))
+		}
+	})
+	if allocsMany > allocsOne {
+		t.Fatalf("unexpected per-iteration allocations; got %f allocs for 100 iterations; want at most %f allocs", allocsMany, allocsOne)
+	}
+
+	// Invalid args.
+	if _, err := DecompressionThroughput(src, 0); err == nil {
+		t.Fatalf("expecting non-nil error for zero iterations")
+	}
+	if _, err := DecompressionThroughput([]byte("invalid"), 1); err == nil {
+		t.Fatalf("expecting non-nil error for invalid src")
+	}
+	if _, err := DecompressionThroughput(nil, 1); err == nil {
+		t.Fatalf("expecting non-nil error for empty src")
+	}
+}
+
+func TestProfile(t *testing.T) {
+	var sample []byte
+	r := rand.New(rand.NewSource(1))
+	for len(sample) < 256*1024 {
+		sample = append(sample, fmt.Sprintf("ts=%d level=info method=%s path=/api/v1/items/%d status=%d duration=%dms\n",
+			1600000000+len(sample), []string{"GET", "POST", "PUT"}[r.Intn(3)], r.Intn(1000), []int{200, 404, 500}[r.Intn(3)], r.Intn(300))...)
+	}
+	levels := []int{1, 3, 7, 12, 19}
+	points, err := Profile(sample, levels)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(points) != len(levels) {
+		t.Fatalf("unexpected number of points; got %d; want %d", len(points), len(levels))
+	}
+	for i, p := range points {
+		if p.Level != levels[i] {
+			t.Fatalf("unexpected level for point #%d; got %d; want %d", i, p.Level, levels[i])
+		}
+		if n := len(CompressLevel(nil, sample, p.Level)); p.CompressedSize != n {
+			t.Fatalf("unexpected compressed size for level %d; got %d; want %d", p.Level, p.CompressedSize, n)
+		}
+		if ratio := float64(len(sample)) / float64(p.CompressedSize); p.Ratio != ratio {
+			t.Fatalf("unexpected ratio for level %d; got %f; want %f", p.Level, p.Ratio, ratio)
+		}
+		if p.Duration <= 0 {
+			t.Fatalf("unexpected duration for level %d: %s", p.Level, p.Duration)
+		}
+		// Higher levels must compress better for compressible data.
+		// zstd doesn't guarantee strict monotonicity for adjacent levels,
+		// so allow small deviations.
+		if i > 0 && p.Ratio < points[i-1].Ratio*0.95 {
+			t.Fatalf("ratio for level %d is worse than the ratio for level %d; %f vs %f", p.Level, points[i-1].Level, p.Ratio, points[i-1].Ratio)
+		}
+	}
+	if points[0].Ratio <= 1 {
+		t.Fatalf("expecting compressible sample; got ratio %f", points[0].Ratio)
+	}
+	if last := points[len(points)-1]; last.Ratio <= points[0].Ratio {
+		t.Fatalf("ratio for level %d must be better than the ratio for level %d; %f vs %f", last.Level, points[0].Level, last.Ratio, points[0].Ratio)
+	}
+
+	// Empty levels.
+	points, err = Profile(sample, nil)
+	if err != nil {
+		t.Fatalf("unexpected error for empty levels: %s", err)
+	}
+	if len(points) != 0 {
+		t.Fatalf("unexpected points for empty levels: %v", points)
+	}
+
+	// Invalid args.
+	if _, err := Profile(nil, levels); err == nil {
+		t.Fatalf("expecting non-nil error for empty sample")
+	}
+	if _, err := Profile(sample, []int{3, 1000}); err == nil {
+		t.Fatalf("expecting non-nil error for invalid level")
+	}
+}
@@ -0,0 +1,206 @@
+package gozstd
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrRingFull is returned from RingWriter methods in non-blocking mode
+// when the ring buffer has no space for the compressed data.
+var ErrRingFull = errors.New("the ring buffer is full")
+
+// ErrRingEmpty is returned from RingWriter.Read in non-blocking mode
+// when the ring buffer has no compressed data.
+var ErrRingEmpty = errors.New("the ring buffer is empty")
+
+// RingWriter compresses data into a fixed-capacity ring buffer.
+//
+// The compressed data is drained from the ring buffer via Read.
+// This puts a hard limit on the memory used for the compressed data,
+// which isn't consumed yet, and applies backpressure to the compression
+// when the consumer is slow.
+//
+// In blocking mode Write, Flush and Close wait until Read frees enough
+// space in the ring buffer, while Read waits until the compressed data
+// is available. Write and Read must be called from distinct goroutines
+// in this mode.
+//
+// In non-blocking mode Write, Flush and Close return ErrRingFull when
+// the ring buffer is full, while Read returns ErrRingEmpty when
+// there is no compressed data. The data accepted by zw before ErrRingFull
+// is retained, so Flush or Close may be retried after draining the ring
+// buffer with Read. Write returns the number of bytes accepted before
+// ErrRingFull, so only the remaining data must be written on retry.
+//
+// Write, Flush and Close mustn't be called concurrently with each other.
+// Read may be called concurrently with them.
+type RingWriter struct {
+	zw *Writer
+	rb ringBuffer
+}
+
+// NewRingWriter returns new RingWriter, which compresses data
+// at the given compressionLevel into the ring buffer with the given capacity.
+//
+// If blocking is set, then RingWriter works in blocking mode.
+// Otherwise it works in non-blocking mode. See RingWriter for details.
+//
+// Call Release when RingWriter is no longer needed.
+func NewRingWriter(capacity, compressionLevel int, blocking bool) *RingWriter {
+	if capacity <= 0 {
+		panic("BUG: capacity must be positive")
+	}
+	rw := &RingWriter{}
+	rw.rb.buf = make([]byte, capacity)
+	rw.rb.blocking = blocking
+	rw.rb.cond = sync.NewCond(&rw.rb.mu)
+	rw.zw = NewWriterLevel(&rw.rb, compressionLevel)
+	return rw
+}
+
+// Write compresses p into the ring buffer.
+func (rw *RingWriter) Write(p []byte) (int, error) {
+	n, err := rw.zw.Write(p)
+	return n, rw.fixError(err)
+}
+
+// Flush flushes the compressed data to the ring buffer, so it may be read
+// and decompressed.
+func (rw *RingWriter) Flush() error {
+	return rw.fixError(rw.zw.Flush())
+}
+
+// Close finalizes the compressed stream in the ring buffer.
+//
+// Read returns io.EOF after all the compressed data is read
+// from the closed RingWriter.
+func (rw *RingWriter) Close() error {
+	if err := rw.zw.Close(); err != nil {
+		return rw.fixError(err)
+	}
+	rw.rb.close()
+	return nil
+}
+
+// fixError returns ErrRingFull instead of the error wrapped by zw.
+func (rw *RingWriter) fixError(err error) error {
+	if err == nil {
+		return nil
+	}
+	rw.rb.mu.Lock()
+	full := rw.rb.full
+	rw.rb.full = false
+	rw.rb.mu.Unlock()
+	if full {
+		return ErrRingFull
+	}
+	return err
+}
+
+// Read reads compressed data from the ring buffer into p.
+func (rw *RingWriter) Read(p []byte) (int, error) {
+	return rw.rb.Read(p)
+}
+
+// Buffered returns the size of the compressed data in the ring buffer.
+func (rw *RingWriter) Buffered() int {
+	rw.rb.mu.Lock()
+	n := rw.rb.n
+	rw.rb.mu.Unlock()
+	return n
+}
+
+// Release releases resources occupied by rw.
+//
+// rw cannot be used after the release.
+func (rw *RingWriter) Release() {
+	rw.zw.Release()
+}
+
+type ringBuffer struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	buf   []byte
+	start int
+	n     int
+
+	blocking bool
+	closed   bool
+
+	// full is set when Write returns ErrRingFull.
+	full bool
+}
+
+func (rb *ringBuffer) Write(p []byte) (int, error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		if rb.n == len(rb.buf) {
+			if !rb.blocking {
+				rb.full = true
+				return written, ErrRingFull
+			}
+			rb.cond.Wait()
+			continue
+		}
+		end := rb.start + rb.n
+		if end >= len(rb.buf) {
+			end -= len(rb.buf)
+		}
+		limit := len(rb.buf)
+		if end < rb.start {
+			limit = rb.start
+		}
+		n := copy(rb.buf[end:limit], p)
+		rb.n += n
+		written += n
+		p = p[n:]
+		rb.cond.Broadcast()
+	}
+	return written, nil
+}
+
+func (rb *ringBuffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	for rb.n == 0 {
+		if rb.closed {
+			return 0, io.EOF
+		}
+		if !rb.blocking {
+			return 0, ErrRingEmpty
+		}
+		rb.cond.Wait()
+	}
+	limit := rb.start + rb.n
+	if limit > len(rb.buf) {
+		limit = len(rb.buf)
+	}
+	n := copy(p, rb.buf[rb.start:limit])
+	rb.start += n
+	if rb.start == len(rb.buf) {
+		rb.start = 0
+	}
+	rb.n -= n
+	if rb.n == 0 {
+		rb.start = 0
+	}
+	rb.cond.Broadcast()
+	return n, nil
+}
+
+func (rb *ringBuffer) close() {
+	rb.mu.Lock()
+	rb.closed = true
+	rb.cond.Broadcast()
+	rb.mu.Unlock()
+}
@@ -0,0 +1,133 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestRingWriterNonBlocking(t *testing.T) {
+	src := []byte(newTestString(1024*1024, 10))
+
+	const capacity = 10000
+	rw := NewRingWriter(capacity, 3, false)
+	defer rw.Release()
+
+	var compressed []byte
+	buf := make([]byte, 3000)
+	drain := func() {
+		t.Helper()
+		for {
+			n, err := rw.Read(buf)
+			compressed = append(compressed, buf[:n]...)
+			if err == ErrRingEmpty {
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error when draining the ring: %s", err)
+			}
+		}
+	}
+
+	fullErrors := 0
+	p := src
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > 7777 {
+			chunk = chunk[:7777]
+		}
+		n, err := rw.Write(chunk)
+		p = p[n:]
+		if err == ErrRingFull {
+			fullErrors++
+			if rw.Buffered() != capacity {
+				t.Fatalf("unexpected buffered size for the full ring; got %d; want %d", rw.Buffered(), capacity)
+			}
+			drain()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if fullErrors == 0 {
+		t.Fatalf("the ring must be filled at least once")
+	}
+	for {
+		err := rw.Close()
+		if err == nil {
+			break
+		}
+		if err != ErrRingFull {
+			t.Fatalf("unexpected error on Close: %s", err)
+		}
+		drain()
+	}
+	for {
+		n, err := rw.Read(buf)
+		compressed = append(compressed, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	plainData, err := Decompress(nil, compressed)
+	if err != nil {
+		t.Fatalf("cannot decompress the reassembled stream: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data decompressed from the reassembled stream")
+	}
+}
+
+func TestRingWriterBlocking(t *testing.T) {
+	var msgs []string
+	for i := 0; i < 1000; i++ {
+		msgs = append(msgs, fmt.Sprintf("message %d %s\n", i, newTestString(i, 3)))
+	}
+
+	rw := NewRingWriter(100, 5, true)
+	defer rw.Release()
+
+	ch := make(chan error, 1)
+	go func() {
+		for i, msg := range msgs {
+			if _, err := rw.Write([]byte(msg)); err != nil {
+				ch <- err
+				return
+			}
+			if i%100 == 0 {
+				if err := rw.Flush(); err != nil {
+					ch <- err
+					return
+				}
+			}
+		}
+		ch <- rw.Close()
+	}()
+
+	zr := NewReader(rw)
+	defer zr.Release()
+	plainData, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("cannot read data: %s", err)
+	}
+	if err := <-ch; err != nil {
+		t.Fatalf("unexpected error in writer: %s", err)
+	}
+	var expected []byte
+	for _, msg := range msgs {
+		expected = append(expected, msg...)
+	}
+	if !bytes.Equal(plainData, expected) {
+		t.Fatalf("unexpected data read; got %d bytes; want %d bytes", len(plainData), len(expected))
+	}
+	if n := rw.Buffered(); n != 0 {
+		t.Fatalf("unexpected buffered data after reading the whole stream: %d bytes", n)
+	}
+}
@@ -0,0 +1,339 @@
+package gozstd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// The seekable format is described at
+// https://github.com/facebook/zstd/blob/dev/contrib/seekable_format/zstd_seekable_compression_format.md .
+const (
+	seekTableMagicVariant    = 0xE
+	seekableMagicNumber      = 0x8F92EAB1
+	seekTableFooterSize      = 9
+	seekTableChecksumFlag    = 1 << 7
+	seekTableReservedMask    = 0x7c
+	skippableHeaderSize      = 8
+	maxSeekableFrameSize     = 1 << 30
+	defaultSeekableFrameSize = 1 << 20
+)
+
+// SeekableWriter writes data in the zstd seekable format.
+//
+// The data is split into independent frames, which are followed by
+// the seek table with the sizes of the frames. The output is a valid
+// multi-frame zstd stream, so it may be decompressed at once with Decompress
+// or Reader. Use SeekableReader for random access to the decompressed data.
+//
+// It isn't safe to use SeekableWriter from concurrently running goroutines.
+type SeekableWriter struct {
+	w         io.Writer
+	level     int
+	frameSize int
+
+	buf     []byte
+	cbuf    []byte
+	entries []byte
+	frames  uint32
+	closed  bool
+}
+
+// NewSeekableWriter returns new SeekableWriter writing data compressed
+// at the given compressionLevel to w.
+//
+// Every frame contains up to frameSize bytes of uncompressed data.
+// Smaller frames give faster seeks at the cost of lower compression ratio.
+// Zero or negative frameSize means 1MiB frames. frameSize is limited to 1GiB.
+//
+// The returned writer must be closed with Close call in order
+// to write the seek table.
+func NewSeekableWriter(w io.Writer, compressionLevel, frameSize int) *SeekableWriter {
+	if frameSize <= 0 {
+		frameSize = defaultSeekableFrameSize
+	}
+	if frameSize > maxSeekableFrameSize {
+		frameSize = maxSeekableFrameSize
+	}
+	return &SeekableWriter{
+		w:         w,
+		level:     compressionLevel,
+		frameSize: frameSize,
+	}
+}
+
+// Write writes p to sw.
+//
+// Frames are written to the underlying writer as soon as they are full.
+func (sw *SeekableWriter) Write(p []byte) (int, error) {
+	if sw.closed {
+		return 0, ErrClosed
+	}
+	n := 0
+	for len(p) > 0 {
+		m := sw.frameSize - len(sw.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		sw.buf = append(sw.buf, p[:m]...)
+		p = p[m:]
+		n += m
+		if len(sw.buf) == sw.frameSize {
+			if err := sw.writeFrame(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes the remaining data and the seek table to the underlying writer.
+//
+// It doesn't close the underlying writer.
+func (sw *SeekableWriter) Close() error {
+	if sw.closed {
+		return nil
+	}
+	sw.closed = true
+	if len(sw.buf) > 0 {
+		if err := sw.writeFrame(); err != nil {
+			return err
+		}
+	}
+
+	var footer [seekTableFooterSize]byte
+	binary.LittleEndian.PutUint32(footer[:], sw.frames)
+	binary.LittleEndian.PutUint32(footer[5:], seekableMagicNumber)
+	table := append(sw.entries, footer[:]...)
+	sw.cbuf = appendSkippableFrame(sw.cbuf[:0], seekTableMagicVariant, table)
+	if _, err := sw.w.Write(sw.cbuf); err != nil {
+		return fmt.Errorf("cannot write seek table: %s", err)
+	}
+	return nil
+}
+
+func (sw *SeekableWriter) writeFrame() error {
+	sw.cbuf = compressDictLevel(sw.cbuf[:0], sw.buf, nil, sw.level)
+	if _, err := sw.w.Write(sw.cbuf); err != nil {
+		return fmt.Errorf("cannot write frame #%d: %s", sw.frames, err)
+	}
+	var entry [8]byte
+	binary.LittleEndian.PutUint32(entry[:], uint32(len(sw.cbuf)))
+	binary.LittleEndian.PutUint32(entry[4:], uint32(len(sw.buf)))
+	sw.entries = append(sw.entries, entry[:]...)
+	sw.frames++
+	sw.buf = sw.buf[:0]
+	return nil
+}
+
+// Reset resets sw to write to w.
+//
+// The compression level and the frame size remain unchanged.
+func (sw *SeekableWriter) Reset(w io.Writer) {
+	sw.w = w
+	sw.buf = sw.buf[:0]
+	sw.entries = sw.entries[:0]
+	sw.frames = 0
+	sw.closed = false
+}
+
+// seekableFrame describes a frame from the seek table.
+type seekableFrame struct {
+	offset         int64
+	plainOffset    int64
+	compressedSize int
+	plainSize      int
+}
+
+// SeekableReader provides random access to data in the zstd seekable format
+// such as the data written by SeekableWriter.
+//
+// SeekableReader implements io.ReadSeeker. Only the frames containing
+// the requested data are read and decompressed.
+//
+// It isn't safe to use SeekableReader from concurrently running goroutines.
+type SeekableReader struct {
+	r      io.ReaderAt
+	frames []seekableFrame
+	size   int64
+
+	offset int64
+
+	// frame is the index of the frame decompressed into buf.
+	frame int
+	buf   []byte
+	cbuf  []byte
+}
+
+// NewSeekableReader returns new SeekableReader for size bytes
+// of the seekable data at r.
+//
+// The seek table is read from the end of the data. An error is returned
+// if the seek table is missing or invalid.
+func NewSeekableReader(r io.ReaderAt, size int64) (*SeekableReader, error) {
+	frames, err := readSeekTable(r, size)
+	if err != nil {
+		return nil, err
+	}
+	plainSize := int64(0)
+	if len(frames) > 0 {
+		f := frames[len(frames)-1]
+		plainSize = f.plainOffset + int64(f.plainSize)
+	}
+	return &SeekableReader{
+		r:      r,
+		frames: frames,
+		size:   plainSize,
+		frame:  -1,
+	}, nil
+}
+
+func readSeekTable(r io.ReaderAt, size int64) ([]seekableFrame, error) {
+	var footer [seekTableFooterSize]byte
+	if size < skippableHeaderSize+seekTableFooterSize {
+		return nil, fmt.Errorf("too small size for seekable data: %d bytes", size)
+	}
+	if err := readAtFull(r, footer[:], size-seekTableFooterSize); err != nil {
+		return nil, fmt.Errorf("cannot read seek table footer: %s", err)
+	}
+	if magic := binary.LittleEndian.Uint32(footer[5:]); magic != seekableMagicNumber {
+		return nil, fmt.Errorf("missing seek table; unexpected magic number at the end: 0x%08X", magic)
+	}
+	descriptor := footer[4]
+	if descriptor&seekTableReservedMask != 0 {
+		return nil, fmt.Errorf("unexpected reserved bits in seek table descriptor: 0x%02X", descriptor)
+	}
+	entrySize := int64(8)
+	if descriptor&seekTableChecksumFlag != 0 {
+		entrySize += 4
+	}
+	framesCount := int64(binary.LittleEndian.Uint32(footer[:]))
+	tableSize := framesCount*entrySize + seekTableFooterSize
+	dataSize := size - skippableHeaderSize - tableSize
+	if dataSize < 0 {
+		return nil, fmt.Errorf("too big seek table for %d frames in %d bytes", framesCount, size)
+	}
+
+	table := make([]byte, skippableHeaderSize+tableSize-seekTableFooterSize)
+	if err := readAtFull(r, table, dataSize); err != nil {
+		return nil, fmt.Errorf("cannot read seek table: %s", err)
+	}
+	if magic := binary.LittleEndian.Uint32(table); magic != SkippableFrameMagicStart+seekTableMagicVariant {
+		return nil, fmt.Errorf("unexpected seek table magic number: 0x%08X", magic)
+	}
+	if n := binary.LittleEndian.Uint32(table[4:]); int64(n) != tableSize {
+		return nil, fmt.Errorf("unexpected seek table size; got %d bytes; want %d bytes", n, tableSize)
+	}
+
+	frames := make([]seekableFrame, framesCount)
+	entries := table[skippableHeaderSize:]
+	var offset, plainOffset int64
+	for i := range frames {
+		entry := entries[int64(i)*entrySize:]
+		f := &frames[i]
+		f.offset = offset
+		f.plainOffset = plainOffset
+		f.compressedSize = int(binary.LittleEndian.Uint32(entry))
+		f.plainSize = int(binary.LittleEndian.Uint32(entry[4:]))
+		offset += int64(f.compressedSize)
+		plainOffset += int64(f.plainSize)
+	}
+	if offset != dataSize {
+		return nil, fmt.Errorf("unexpected size of frames in the seek table; got %d bytes; want %d bytes", offset, dataSize)
+	}
+	return frames, nil
+}
+
+// readAtFull reads len(b) bytes at the given offset from r.
+func readAtFull(r io.ReaderAt, b []byte, offset int64) error {
+	n, err := r.ReadAt(b, offset)
+	if n == len(b) {
+		// io.ReaderAt may return io.EOF together with the data
+		// at the end of input.
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Size returns the size of the decompressed data.
+func (sr *SeekableReader) Size() int64 {
+	return sr.size
+}
+
+// Read reads up to len(p) bytes of the decompressed data from the current
+// offset to p.
+//
+// io.EOF is returned at the end of the decompressed data.
+func (sr *SeekableReader) Read(p []byte) (int, error) {
+	if sr.offset >= sr.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	idx := sort.Search(len(sr.frames), func(i int) bool {
+		f := &sr.frames[i]
+		return f.plainOffset+int64(f.plainSize) > sr.offset
+	})
+	if err := sr.loadFrame(idx); err != nil {
+		return 0, err
+	}
+	f := &sr.frames[idx]
+	n := copy(p, sr.buf[sr.offset-f.plainOffset:])
+	sr.offset += int64(n)
+	return n, nil
+}
+
+func (sr *SeekableReader) loadFrame(idx int) error {
+	if sr.frame == idx {
+		return nil
+	}
+	sr.frame = -1
+	f := &sr.frames[idx]
+	if cap(sr.cbuf) < f.compressedSize {
+		sr.cbuf = make([]byte, f.compressedSize)
+	}
+	sr.cbuf = sr.cbuf[:f.compressedSize]
+	if err := readAtFull(sr.r, sr.cbuf, f.offset); err != nil {
+		return fmt.Errorf("cannot read frame #%d at offset %d: %s", idx, f.offset, err)
+	}
+	buf, err := Decompress(sr.buf[:0], sr.cbuf)
+	if err != nil {
+		return fmt.Errorf("cannot decompress frame #%d at offset %d: %s", idx, f.offset, err)
+	}
+	sr.buf = buf
+	if len(buf) != f.plainSize {
+		return fmt.Errorf("unexpected size of decompressed frame #%d; got %d bytes; want %d bytes", idx, len(buf), f.plainSize)
+	}
+	sr.frame = idx
+	return nil
+}
+
+var errNegativeSeekOffset = errors.New("gozstd: negative seek offset")
+
+// Seek implements io.Seeker.
+//
+// Seeking past the end of the decompressed data is allowed. Read returns
+// io.EOF in this case. The frame at the new offset is decompressed
+// on the next Read call.
+func (sr *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += sr.offset
+	case io.SeekEnd:
+		offset += sr.size
+	default:
+		return sr.offset, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return sr.offset, errNegativeSeekOffset
+	}
+	sr.offset = offset
+	return offset, nil
+}
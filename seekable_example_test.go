@@ -0,0 +1,40 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+)
+
+func ExampleSeekableReader() {
+	// Write the data in the seekable format with 16-byte frames.
+	var bb bytes.Buffer
+	sw := NewSeekableWriter(&bb, 3, 16)
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(sw, "line %d\n", i)
+	}
+	if err := sw.Close(); err != nil {
+		log.Fatalf("cannot close SeekableWriter: %s", err)
+	}
+
+	sr, err := NewSeekableReader(bytes.NewReader(bb.Bytes()), int64(bb.Len()))
+	if err != nil {
+		log.Fatalf("cannot create SeekableReader: %s", err)
+	}
+
+	// Read the last two lines. Only the last frames are decompressed.
+	if _, err := sr.Seek(-14, io.SeekEnd); err != nil {
+		log.Fatalf("cannot seek: %s", err)
+	}
+	data, err := ioutil.ReadAll(sr)
+	if err != nil {
+		log.Fatalf("cannot read data: %s", err)
+	}
+	fmt.Printf("%s", data)
+
+	// Output:
+	// line 8
+	// line 9
+}
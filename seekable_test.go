@@ -0,0 +1,231 @@
+package gozstd
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func newTestSeekableData(t *testing.T, src []byte, frameSize int) []byte {
+	t.Helper()
+	var bb bytes.Buffer
+	sw := NewSeekableWriter(&bb, 3, frameSize)
+	// Write the data in uneven chunks, so they do not match frame boundaries.
+	for s := src; len(s) > 0; {
+		n := 1000
+		if n > len(s) {
+			n = len(s)
+		}
+		if _, err := sw.Write(s[:n]); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		s = s[n:]
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatalf("cannot close SeekableWriter: %s", err)
+	}
+	return bb.Bytes()
+}
+
+func TestSeekableWriter(t *testing.T) {
+	src := []byte(newTestString(100*1024, 3))
+	for _, frameSize := range []int{1, 777, 4096, 0, 1 << 40} {
+		data := newTestSeekableData(t, src, frameSize)
+
+		// The seekable data must be readable as a usual zstd stream.
+		plainData, err := Decompress(nil, data)
+		if err != nil {
+			t.Fatalf("cannot decompress seekable data with frameSize=%d: %s", frameSize, err)
+		}
+		if !bytes.Equal(plainData, src) {
+			t.Fatalf("unexpected data decompressed with frameSize=%d; got %d bytes; want %d bytes", frameSize, len(plainData), len(src))
+		}
+
+		wantFrames := 1
+		if frameSize > 0 && frameSize < len(src) {
+			wantFrames = (len(src) + frameSize - 1) / frameSize
+		}
+		zstdFrames, err := CountFrames(data, false)
+		if err != nil {
+			t.Fatalf("cannot count frames: %s", err)
+		}
+		if zstdFrames != wantFrames {
+			t.Fatalf("unexpected number of frames with frameSize=%d; got %d; want %d", frameSize, zstdFrames, wantFrames)
+		}
+
+		sr, err := NewSeekableReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("cannot create SeekableReader with frameSize=%d: %s", frameSize, err)
+		}
+		if len(sr.frames) != wantFrames {
+			t.Fatalf("unexpected number of frames in the seek table with frameSize=%d; got %d; want %d", frameSize, len(sr.frames), wantFrames)
+		}
+		if sr.Size() != int64(len(src)) {
+			t.Fatalf("unexpected size with frameSize=%d; got %d; want %d", frameSize, sr.Size(), len(src))
+		}
+		plainData, err = ioutil.ReadAll(sr)
+		if err != nil {
+			t.Fatalf("cannot read data with frameSize=%d: %s", frameSize, err)
+		}
+		if !bytes.Equal(plainData, src) {
+			t.Fatalf("unexpected data read with frameSize=%d; got %d bytes; want %d bytes", frameSize, len(plainData), len(src))
+		}
+	}
+}
+
+func TestSeekableWriterEmpty(t *testing.T) {
+	data := newTestSeekableData(t, nil, 100)
+	sr, err := NewSeekableReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("cannot create SeekableReader: %s", err)
+	}
+	if sr.Size() != 0 {
+		t.Fatalf("unexpected size; got %d; want 0", sr.Size())
+	}
+	buf := make([]byte, 10)
+	if n, err := sr.Read(buf); n != 0 || err != io.EOF {
+		t.Fatalf("unexpected result; got (%d, %v); want (0, %v)", n, err, io.EOF)
+	}
+}
+
+func TestSeekableWriterReset(t *testing.T) {
+	var bb1, bb2 bytes.Buffer
+	sw := NewSeekableWriter(&bb1, 1, 2)
+	if _, err := sw.Write([]byte("foo")); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatalf("cannot close sw: %s", err)
+	}
+	if _, err := sw.Write([]byte("foo")); err != ErrClosed {
+		t.Fatalf("unexpected error after Close; got %v; want %v", err, ErrClosed)
+	}
+	sw.Reset(&bb2)
+	if _, err := sw.Write([]byte("barbaz")); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatalf("cannot close sw: %s", err)
+	}
+	for _, tc := range []struct {
+		bb   *bytes.Buffer
+		want string
+	}{
+		{&bb1, "foo"},
+		{&bb2, "barbaz"},
+	} {
+		sr, err := NewSeekableReader(bytes.NewReader(tc.bb.Bytes()), int64(tc.bb.Len()))
+		if err != nil {
+			t.Fatalf("cannot create SeekableReader: %s", err)
+		}
+		plainData, err := ioutil.ReadAll(sr)
+		if err != nil {
+			t.Fatalf("cannot read data: %s", err)
+		}
+		if string(plainData) != tc.want {
+			t.Fatalf("unexpected data; got %q; want %q", plainData, tc.want)
+		}
+	}
+}
+
+func TestSeekableReaderSeek(t *testing.T) {
+	src := []byte(newTestString(64*1024, 3))
+	data := newTestSeekableData(t, src, 1000)
+	sr, err := NewSeekableReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("cannot create SeekableReader: %s", err)
+	}
+	var rs io.ReadSeeker = sr
+
+	f := func(offset int64, whence int, offsetExpected int64) {
+		t.Helper()
+		n, err := rs.Seek(offset, whence)
+		if err != nil {
+			t.Fatalf("cannot seek to %d with whence=%d: %s", offset, whence, err)
+		}
+		if n != offsetExpected {
+			t.Fatalf("unexpected offset after seeking to %d with whence=%d; got %d; want %d", offset, whence, n, offsetExpected)
+		}
+
+		// Read data crossing frame boundaries.
+		buf := make([]byte, 2500)
+		n2, err := io.ReadFull(rs, buf)
+		want := src[offsetExpected:]
+		if len(want) > len(buf) {
+			want = want[:len(buf)]
+		}
+		if len(want) < len(buf) {
+			if err != io.ErrUnexpectedEOF && err != io.EOF {
+				t.Fatalf("unexpected error when reading at offset %d; got %v; want %v", offsetExpected, err, io.ErrUnexpectedEOF)
+			}
+		} else if err != nil {
+			t.Fatalf("cannot read data at offset %d: %s", offsetExpected, err)
+		}
+		if !bytes.Equal(buf[:n2], want) {
+			t.Fatalf("unexpected data read at offset %d; got %q; want %q", offsetExpected, buf[:n2], want)
+		}
+	}
+	f(0, io.SeekStart, 0)
+	f(12345, io.SeekStart, 12345)
+	f(-100, io.SeekCurrent, 12345+2500-100)
+	f(1000, io.SeekCurrent, 12345+2*2500-100+1000)
+	f(-10, io.SeekEnd, int64(len(src))-10)
+	f(-int64(len(src)), io.SeekEnd, 0)
+	f(999, io.SeekStart, 999)
+	f(-3000, io.SeekEnd, int64(len(src))-3000)
+
+	// Seeking past the end is allowed.
+	if n, err := rs.Seek(10, io.SeekEnd); err != nil || n != int64(len(src))+10 {
+		t.Fatalf("unexpected result when seeking past the end; got (%d, %v); want (%d, nil)", n, err, len(src)+10)
+	}
+	if n, err := rs.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Fatalf("unexpected result when reading past the end; got (%d, %v); want (0, %v)", n, err, io.EOF)
+	}
+
+	// Invalid seeks mustn't change the offset.
+	if _, err := rs.Seek(-1, io.SeekStart); err == nil {
+		t.Fatalf("expecting non-nil error when seeking to negative offset")
+	}
+	if _, err := rs.Seek(0, 42); err == nil {
+		t.Fatalf("expecting non-nil error for invalid whence")
+	}
+	if n, err := rs.Seek(0, io.SeekCurrent); err != nil || n != int64(len(src))+10 {
+		t.Fatalf("unexpected offset after invalid seeks; got (%d, %v); want (%d, nil)", n, err, len(src)+10)
+	}
+}
+
+func TestSeekableReaderError(t *testing.T) {
+	src := []byte(newTestString(10*1024, 3))
+	data := newTestSeekableData(t, src, 1000)
+
+	f := func(data []byte) {
+		t.Helper()
+		sr, err := NewSeekableReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return
+		}
+		if _, err := ioutil.ReadAll(sr); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+	f(nil)
+	f([]byte("foobar"))
+	f(Compress(nil, src))
+	f(data[:len(data)-1])
+	f(data[1:])
+
+	corrupted := func(i int, v byte) []byte {
+		b := append([]byte{}, data...)
+		b[i] ^= v
+		return b
+	}
+	// Corrupted footer.
+	f(corrupted(len(data)-1, 0xff))
+	f(corrupted(len(data)-5, 0x04))
+	f(corrupted(len(data)-9, 0x01))
+	// Corrupted entry with the decompressed size of the last frame.
+	f(corrupted(len(data)-10, 0x01))
+	// Corrupted magic number of the first frame.
+	f(corrupted(0, 0xff))
+}
@@ -0,0 +1,85 @@
+package gozstd
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ShardedCompressor compresses data with per-shard dictionaries.
+//
+// This is useful for sharded stores, where every shard has its own
+// dictionary trained on the shard data. Every shard has its own pool
+// of compression contexts, so the contexts are always used with the same
+// dictionary. This avoids dictionary reloading when the contexts are
+// switched between dictionaries.
+//
+// ShardedCompressor may be used from concurrently running goroutines.
+type ShardedCompressor struct {
+	mu     sync.RWMutex
+	shards map[string]*compressorShard
+}
+
+type compressorShard struct {
+	cd       *CDict
+	cctxPool sync.Pool
+}
+
+// NewShardedCompressor returns new ShardedCompressor without shards.
+//
+// Add shards via AddShard.
+func NewShardedCompressor() *ShardedCompressor {
+	return &ShardedCompressor{
+		shards: make(map[string]*compressorShard),
+	}
+}
+
+// AddShard registers cd as the dictionary for the given shardKey.
+//
+// An error is returned if the shardKey is already registered.
+// cd mustn't be released while it is registered in sc.
+func (sc *ShardedCompressor) AddShard(shardKey string, cd *CDict) error {
+	if cd == nil {
+		return fmt.Errorf("cannot add nil dictionary for shard %q", shardKey)
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if _, ok := sc.shards[shardKey]; ok {
+		return fmt.Errorf("shard %q is already registered", shardKey)
+	}
+	s := &compressorShard{
+		cd: cd,
+	}
+	s.cctxPool.New = newCCtx
+	sc.shards[shardKey] = s
+	return nil
+}
+
+// RemoveShard removes the shard with the given shardKey from sc.
+//
+// The dictionary for the removed shard may be released after all
+// the Compress calls for the shard are finished.
+func (sc *ShardedCompressor) RemoveShard(shardKey string) {
+	sc.mu.Lock()
+	delete(sc.shards, shardKey)
+	sc.mu.Unlock()
+}
+
+// Compress compresses src with the dictionary for the given shardKey
+// and returns the result.
+//
+// An error is returned if the shardKey isn't registered.
+// The result may be decompressed with DecompressDict using DDict
+// for the shard dictionary.
+func (sc *ShardedCompressor) Compress(shardKey string, src []byte) ([]byte, error) {
+	sc.mu.RLock()
+	s := sc.shards[shardKey]
+	sc.mu.RUnlock()
+	if s == nil {
+		return nil, fmt.Errorf("unknown shard %q", shardKey)
+	}
+
+	cctxDict := s.cctxPool.Get().(*cctxWrapper)
+	dst := compress(nil, cctxDict, nil, src, s.cd, s.cd.compressionLevel)
+	s.cctxPool.Put(cctxDict)
+	return dst, nil
+}
@@ -0,0 +1,118 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func newTestShardDicts(t *testing.T, prefix string) (*CDict, *DDict) {
+	t.Helper()
+	var samples [][]byte
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, []byte(fmt.Sprintf("%s sample number %d for shard %s", prefix, i, prefix)))
+	}
+	dict := BuildDict(samples, 8*1024)
+	cd, err := NewCDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create CDict: %s", err)
+	}
+	dd, err := NewDDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create DDict: %s", err)
+	}
+	return cd, dd
+}
+
+func TestShardedCompressor(t *testing.T) {
+	cdFoo, ddFoo := newTestShardDicts(t, "foo")
+	defer cdFoo.Release()
+	defer ddFoo.Release()
+	cdBar, ddBar := newTestShardDicts(t, "bar")
+	defer cdBar.Release()
+	defer ddBar.Release()
+
+	sc := NewShardedCompressor()
+	if err := sc.AddShard("foo", cdFoo); err != nil {
+		t.Fatalf("cannot add shard: %s", err)
+	}
+	if err := sc.AddShard("bar", cdBar); err != nil {
+		t.Fatalf("cannot add shard: %s", err)
+	}
+	if err := sc.AddShard("foo", cdBar); err == nil {
+		t.Fatalf("expecting non-nil error when adding duplicate shard")
+	}
+	if err := sc.AddShard("baz", nil); err == nil {
+		t.Fatalf("expecting non-nil error when adding nil dictionary")
+	}
+
+	shards := []struct {
+		key string
+		cd  *CDict
+		dd  *DDict
+		src string
+	}{
+		{"foo", cdFoo, ddFoo, "foo sample number 42 for shard foo"},
+		{"bar", cdBar, ddBar, "bar sample number 43 for shard bar"},
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, s := range shards {
+					compressed, err := sc.Compress(s.key, []byte(s.src))
+					if err != nil {
+						errCh <- err
+						return
+					}
+					if !bytes.Equal(compressed, CompressDict(nil, []byte(s.src), s.cd)) {
+						errCh <- fmt.Errorf("unexpected compressed data for shard %q", s.key)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, s := range shards {
+		compressed, err := sc.Compress(s.key, []byte(s.src))
+		if err != nil {
+			t.Fatalf("cannot compress data for shard %q: %s", s.key, err)
+		}
+		plainData, err := DecompressDict(nil, compressed, s.dd)
+		if err != nil {
+			t.Fatalf("cannot decompress data for shard %q: %s", s.key, err)
+		}
+		if string(plainData) != s.src {
+			t.Fatalf("unexpected data decompressed for shard %q; got %q; want %q", s.key, plainData, s.src)
+		}
+	}
+
+	// Cross-shard decompression must fail.
+	compressed, err := sc.Compress("foo", []byte(shards[0].src))
+	if err != nil {
+		t.Fatalf("cannot compress data: %s", err)
+	}
+	if _, err := DecompressDict(nil, compressed, ddBar); err == nil {
+		t.Fatalf("expecting non-nil error when decompressing data with the dictionary from another shard")
+	}
+
+	// Unknown shard.
+	if _, err := sc.Compress("baz", []byte("foobar")); err == nil {
+		t.Fatalf("expecting non-nil error for unknown shard")
+	}
+	sc.RemoveShard("foo")
+	if _, err := sc.Compress("foo", []byte("foobar")); err == nil {
+		t.Fatalf("expecting non-nil error for removed shard")
+	}
+}
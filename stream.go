@@ -43,6 +43,103 @@ func streamCompressDictLevel(dst io.Writer, src io.Reader, cd *CDict, compressio
 	return err
 }
 
+const (
+	// SmartCopyRaw is the SmartCopy header for uncompressed data.
+	SmartCopyRaw = 0
+
+	// SmartCopyZstd is the SmartCopy header for zstd-compressed data.
+	SmartCopyZstd = 1
+)
+
+// smartCopySampleSize is the size of the sample used by SmartCopy
+// for detecting whether src is compressible.
+const smartCopySampleSize = 64 * 1024
+
+// SmartCopy copies src to dst compressing it with the given compressionLevel
+// only if src looks compressible.
+//
+// The first 64KB of src are compressed in order to detect whether src
+// is compressible. Incompressible data such as already compressed media
+// is copied to dst as is, so it may be passed through via io.ReaderFrom
+// implemented by dst without the compression overhead.
+//
+// The data written to dst starts with a single-byte header:
+//
+//   - SmartCopyRaw means the rest of the data is uncompressed src.
+//   - SmartCopyZstd means the rest of the data is a zstd stream, which may be
+//     decompressed with StreamDecompress or Reader.
+//
+// Returns the number of bytes read from src.
+func SmartCopy(dst io.Writer, src io.Reader, compressionLevel int) (int64, error) {
+	sb := smartCopyBufPool.Get().(*smartCopyBuf)
+	n, err := smartCopy(dst, src, compressionLevel, sb)
+	smartCopyBufPool.Put(sb)
+	return n, err
+}
+
+func smartCopy(dst io.Writer, src io.Reader, compressionLevel int, sb *smartCopyBuf) (int64, error) {
+	if cap(sb.sample) < smartCopySampleSize {
+		sb.sample = make([]byte, smartCopySampleSize)
+	}
+	sample := sb.sample[:smartCopySampleSize]
+	n, err := io.ReadFull(src, sample)
+	sample = sample[:n]
+	srcEOF := false
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		srcEOF = true
+	default:
+		return int64(n), err
+	}
+
+	var compressed bool
+	sb.compressed, compressed = CompressIfSmaller(sb.compressed[:0], sample, compressionLevel)
+	if !compressed {
+		sb.header[0] = SmartCopyRaw
+		if _, err := dst.Write(sb.header[:]); err != nil {
+			return int64(n), err
+		}
+		if _, err := dst.Write(sample); err != nil {
+			return int64(n), err
+		}
+		if srcEOF {
+			return int64(n), nil
+		}
+		nn, err := io.Copy(dst, src)
+		return int64(n) + nn, err
+	}
+
+	sb.header[0] = SmartCopyZstd
+	if _, err := dst.Write(sb.header[:]); err != nil {
+		return int64(n), err
+	}
+	sc := getSCompressor(compressionLevel)
+	sc.zw.Reset(dst, nil, compressionLevel)
+	nn := int64(0)
+	_, err = sc.zw.Write(sample)
+	if err == nil && !srcEOF {
+		nn, err = sc.zw.ReadFrom(src)
+	}
+	if err == nil {
+		err = sc.zw.Close()
+	}
+	putSCompressor(sc)
+	return int64(n) + nn, err
+}
+
+type smartCopyBuf struct {
+	header     [1]byte
+	sample     []byte
+	compressed []byte
+}
+
+var smartCopyBufPool = &sync.Pool{
+	New: func() interface{} {
+		return &smartCopyBuf{}
+	},
+}
+
 type sCompressor struct {
 	zw               *Writer
 	compressionLevel int
@@ -99,11 +196,29 @@ func StreamDecompress(dst io.Writer, src io.Reader) error {
 // from src may be buffered before passing to dst for performance reasons.
 // Use Reader for interactive network streams.
 func StreamDecompressDict(dst io.Writer, src io.Reader, dd *DDict) error {
+	_, err := streamDecompressDict(dst, src, dd)
+	return err
+}
+
+// DecompressStream decompresses src into dst and returns the number
+// of decompressed bytes written to dst.
+//
+// Decompression is performed via fixed-size internal buffers, so neither
+// compressed nor decompressed data is materialized in memory.
+//
+// This function doesn't work with interactive network streams, since data read
+// from src may be buffered before passing to dst for performance reasons.
+// Use Reader for interactive network streams.
+func DecompressStream(dst io.Writer, src io.Reader) (int64, error) {
+	return streamDecompressDict(dst, src, nil)
+}
+
+func streamDecompressDict(dst io.Writer, src io.Reader, dd *DDict) (int64, error) {
 	sd := getSDecompressor()
 	sd.zr.Reset(src, dd)
-	_, err := sd.zr.WriteTo(dst)
+	n, err := sd.zr.WriteTo(dst)
 	putSDecompressor(sd)
-	return err
+	return n, err
 }
 
 type sDecompressor struct {
@@ -3,6 +3,7 @@ package gozstd
 import (
 	"bytes"
 	"fmt"
+	"math/rand"
 	"testing"
 	"time"
 )
@@ -188,3 +189,78 @@ func testStreamCompressDecompressDictSerial(cd *CDict, dd *DDict, data []byte) e
 	}
 	return nil
 }
+
+func TestDecompressStream(t *testing.T) {
+	// Build a large multi-frame stream.
+	var bbCompress, bbOrig bytes.Buffer
+	for i := 0; i < 20; i++ {
+		data := newTestString(100*1024+i, 3)
+		bbOrig.WriteString(data)
+		bbCompress.Write(CompressLevel(nil, []byte(data), i%10+1))
+	}
+
+	var bbDecompress bytes.Buffer
+	n, err := DecompressStream(&bbDecompress, &bbCompress)
+	if err != nil {
+		t.Fatalf("cannot decompress stream: %s", err)
+	}
+	if n != int64(bbOrig.Len()) {
+		t.Fatalf("unexpected number of decompressed bytes; got %d; want %d", n, bbOrig.Len())
+	}
+	if !bytes.Equal(bbDecompress.Bytes(), bbOrig.Bytes()) {
+		t.Fatalf("unexpected decompressed data")
+	}
+
+	// Invalid data
+	bbDecompress.Reset()
+	if _, err := DecompressStream(&bbDecompress, bytes.NewBufferString("invalid compressed data")); err == nil {
+		t.Fatalf("expecting error when decompressing invalid data")
+	}
+}
+
+func TestSmartCopy(t *testing.T) {
+	randomData := make([]byte, 300*1024)
+	if _, err := rand.Read(randomData); err != nil {
+		t.Fatalf("cannot generate random data: %s", err)
+	}
+	for _, tc := range []struct {
+		src    []byte
+		header byte
+	}{
+		{[]byte(newTestString(300*1024, 3)), SmartCopyZstd},
+		{[]byte(newTestString(1000, 3)), SmartCopyZstd},
+		{randomData, SmartCopyRaw},
+		{randomData[:1000], SmartCopyRaw},
+		{nil, SmartCopyRaw},
+	} {
+		var bb bytes.Buffer
+		n, err := SmartCopy(&bb, bytes.NewReader(tc.src), 5)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if n != int64(len(tc.src)) {
+			t.Fatalf("unexpected number of bytes read; got %d; want %d", n, len(tc.src))
+		}
+		data := bb.Bytes()
+		if len(data) == 0 {
+			t.Fatalf("missing header")
+		}
+		if data[0] != tc.header {
+			t.Fatalf("unexpected header for %d bytes of data; got %d; want %d", len(tc.src), data[0], tc.header)
+		}
+		plainData := data[1:]
+		if tc.header == SmartCopyZstd {
+			var bbDecompress bytes.Buffer
+			if err := StreamDecompress(&bbDecompress, bytes.NewReader(data[1:])); err != nil {
+				t.Fatalf("cannot decompress data: %s", err)
+			}
+			plainData = bbDecompress.Bytes()
+			if len(data) >= len(tc.src) {
+				t.Fatalf("compressed data must be smaller than the original; got %d bytes; original %d bytes", len(data), len(tc.src))
+			}
+		}
+		if !bytes.Equal(plainData, tc.src) {
+			t.Fatalf("unexpected data for %d bytes of src", len(tc.src))
+		}
+	}
+}
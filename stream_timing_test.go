@@ -63,3 +63,24 @@ func benchmarkStreamDecompress(b *testing.B, blockSize, level int) {
 		}
 	})
 }
+
+func BenchmarkDecompressStream(b *testing.B) {
+	block := newBenchString(1024 * 1024)
+	cd := Compress(nil, block)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(block)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := bytes.NewReader(cd)
+		for pb.Next() {
+			n, err := DecompressStream(ioutil.Discard, r)
+			if err != nil {
+				panic(fmt.Errorf("unexpected error: %s", err))
+			}
+			if n != int64(len(block)) {
+				panic(fmt.Errorf("unexpected number of decompressed bytes; got %d; want %d", n, len(block)))
+			}
+			r.Reset(cd)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package gozstd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// CompressStrings appends the compressed strs to dst and returns the result.
+//
+// Every string is prefixed with its length encoded as uvarint before
+// the compression, so the strings may be restored with DecompressStrings.
+// The strings are compressed without copying them into a joined buffer.
+// The given compressionLevel is used for the compression.
+func CompressStrings(dst []byte, strs []string, compressionLevel int) []byte {
+	prefixesLen := 0
+	for _, s := range strs {
+		prefixesLen += uvarintSize(uint64(len(s)))
+	}
+
+	// Store all the length prefixes in a single buffer in order to reduce
+	// the number of memory allocations.
+	prefixes := make([]byte, prefixesLen)
+	srcs := make([][]byte, 0, 2*len(strs))
+	offset := 0
+	for _, s := range strs {
+		n := binary.PutUvarint(prefixes[offset:], uint64(len(s)))
+		srcs = append(srcs, prefixes[offset:offset+n], s2b(s))
+		offset += n
+	}
+	return CompressMulti(dst, srcs, compressionLevel)
+}
+
+// DecompressStrings appends the strings decompressed from src to dst
+// and returns the result.
+//
+// src must be created with CompressStrings. The returned strings share
+// a single memory allocation for the decompressed data.
+func DecompressStrings(dst []string, src []byte) ([]string, error) {
+	data, err := Decompress(nil, src)
+	if err != nil {
+		return dst, err
+	}
+	s := string(data)
+	dstLen := len(dst)
+	for len(s) > 0 {
+		n, nSize := binary.Uvarint(s2b(s))
+		if nSize <= 0 {
+			return dst[:dstLen], fmt.Errorf("cannot read string length for string #%d", len(dst)-dstLen)
+		}
+		s = s[nSize:]
+		if n > uint64(len(s)) {
+			return dst[:dstLen], fmt.Errorf("too big length for string #%d: %d bytes; only %d bytes left", len(dst)-dstLen, n, len(s))
+		}
+		dst = append(dst, s[:n])
+		s = s[n:]
+	}
+	return dst, nil
+}
+
+func uvarintSize(n uint64) int {
+	size := 1
+	for n >= 0x80 {
+		n >>= 7
+		size++
+	}
+	return size
+}
+
+// s2b converts s to a byte slice without memory allocation.
+//
+// The returned byte slice mustn't be modified.
+func s2b(s string) []byte {
+	sh := (*reflect.StringHeader)(unsafe.Pointer(&s))
+	var b []byte
+	bh := (*reflect.SliceHeader)(unsafe.Pointer(&b))
+	bh.Data = sh.Data
+	bh.Len = sh.Len
+	bh.Cap = sh.Len
+	return b
+}
@@ -0,0 +1,56 @@
+package gozstd
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompressDecompressStrings(t *testing.T) {
+	f := func(strs []string) {
+		t.Helper()
+		prefix := []byte("prefix")
+		compressed := CompressStrings(append([]byte{}, prefix...), strs, 5)
+		if !strings.HasPrefix(string(compressed), string(prefix)) {
+			t.Fatalf("missing dst prefix in the result")
+		}
+		result, err := DecompressStrings([]string{"foo"}, compressed[len(prefix):])
+		if err != nil {
+			t.Fatalf("cannot decompress strings: %s", err)
+		}
+		if result[0] != "foo" {
+			t.Fatalf("unexpected dst prefix; got %q; want %q", result[0], "foo")
+		}
+		result = result[1:]
+		if len(strs) == 0 && len(result) == 0 {
+			return
+		}
+		if !reflect.DeepEqual(result, strs) {
+			t.Fatalf("unexpected strings decompressed\ngot\n%q\nwant\n%q", result, strs)
+		}
+	}
+
+	f(nil)
+	f([]string{""})
+	f([]string{"", "", ""})
+	f([]string{"foo"})
+	f([]string{"foo", "", "bar", "привет", "日本語", "", "emoji 😀"})
+	f([]string{strings.Repeat("x", 128), strings.Repeat("y", 300), newTestString(100*1024, 3)})
+
+	var strs []string
+	for i := 0; i < 10000; i++ {
+		strs = append(strs, fmt.Sprintf("string number %d", i))
+	}
+	f(strs)
+
+	// Invalid data.
+	for _, data := range []string{"\x80", "\x05foo"} {
+		if _, err := DecompressStrings(nil, Compress(nil, []byte(data))); err == nil {
+			t.Fatalf("expecting non-nil error for invalid data %q", data)
+		}
+	}
+	if _, err := DecompressStrings(nil, []byte("invalid")); err == nil {
+		t.Fatalf("expecting non-nil error for invalid src")
+	}
+}
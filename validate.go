@@ -0,0 +1,112 @@
+package gozstd
+
+/*
+#cgo CFLAGS: -O3
+
+#define ZSTD_STATIC_LINKING_ONLY
+#include "zstd.h"
+#include "zstd_errors.h"
+
+#include <stdint.h>  // for uintptr_t
+
+// The following *_wrapper functions allow avoiding memory allocations
+// durting calls from Go.
+// See https://github.com/golang/go/issues/24450 .
+
+static size_t ZSTD_cParam_getBounds_wrapper(ZSTD_cParameter param, uintptr_t lowerBound, uintptr_t upperBound) {
+    ZSTD_bounds b = ZSTD_cParam_getBounds(param);
+    *(int*)lowerBound = b.lowerBound;
+    *(int*)upperBound = b.upperBound;
+    return b.error;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// Validate verifies whether wp contains valid parameters.
+//
+// Zero values are always valid, since they mean 'use default value'.
+func (wp *WriterParams) Validate() error {
+	if wp.WindowLog != 0 {
+		if err := checkParamBounds(ParamWindowLog, wp.WindowLog); err != nil {
+			return fmt.Errorf("invalid WindowLog: %s", err)
+		}
+	}
+	if wp.ForceAttachDict != 0 {
+		switch wp.ForceAttachDict {
+		case DictForceAttach, DictForceCopy, DictForceLoad:
+		default:
+			return fmt.Errorf("invalid ForceAttachDict: unknown mode %d", wp.ForceAttachDict)
+		}
+	}
+	if wp.LiteralCompressionMode != 0 {
+		switch wp.LiteralCompressionMode {
+		case LiteralCompressionHuffman, LiteralCompressionUncompressed:
+		default:
+			return fmt.Errorf("invalid LiteralCompressionMode: unknown mode %d", wp.LiteralCompressionMode)
+		}
+	}
+	if wp.Strategy != 0 {
+		if err := checkParamBounds(ParamStrategy, int(wp.Strategy)); err != nil {
+			return fmt.Errorf("invalid Strategy: %s", err)
+		}
+	}
+	if wp.NbWorkers != 0 {
+		if err := checkParamBounds(ParamNbWorkers, wp.NbWorkers); err != nil {
+			return fmt.Errorf("invalid NbWorkers: %s", err)
+		}
+	}
+	if wp.JobSize != 0 {
+		if err := checkParamBounds(ParamJobSize, wp.JobSize); err != nil {
+			return fmt.Errorf("invalid JobSize: %s", err)
+		}
+	}
+	if wp.OverlapLog != 0 {
+		if err := checkParamBounds(ParamOverlapLog, wp.OverlapLog); err != nil {
+			return fmt.Errorf("invalid OverlapLog: %s", err)
+		}
+	}
+	if wp.MinMatch != 0 {
+		if err := checkParamBounds(ParamMinMatch, wp.MinMatch); err != nil {
+			return fmt.Errorf("invalid MinMatch: %s", err)
+		}
+	}
+	if wp.TargetLength != 0 {
+		if err := checkParamBounds(ParamTargetLength, wp.TargetLength); err != nil {
+			return fmt.Errorf("invalid TargetLength: %s", err)
+		}
+	}
+	return nil
+}
+
+// checkParamBounds verifies whether value is in the allowed range for param.
+func checkParamBounds(param ParamID, value int) error {
+	lower, upper, err := getParamBounds(param)
+	if err != nil {
+		return err
+	}
+	if value < lower || value > upper {
+		return fmt.Errorf("value %d is out of range [%d..%d]", value, lower, upper)
+	}
+	return nil
+}
+
+func getParamBounds(param ParamID) (int, int, error) {
+	var lower, upper C.int
+	result := C.ZSTD_cParam_getBounds_wrapper(
+		C.ZSTD_cParameter(param),
+		C.uintptr_t(uintptr(unsafe.Pointer(&lower))),
+		C.uintptr_t(uintptr(unsafe.Pointer(&upper))))
+	// Prevent from GC'ing of lower and upper during CGO call above.
+	runtime.KeepAlive(&lower)
+	runtime.KeepAlive(&upper)
+	if C.ZSTD_getErrorCode(result) != 0 {
+		return 0, 0, fmt.Errorf("cannot get bounds for parameter %d: %s", param, errStr(result))
+	}
+	return int(lower), int(upper), nil
+}
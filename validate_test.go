@@ -0,0 +1,44 @@
+package gozstd
+
+import (
+	"testing"
+)
+
+func TestWriterParamsValidate(t *testing.T) {
+	validParams := []WriterParams{
+		{},
+		{CompressionLevel: 19, WindowLog: 20},
+		{Strategy: StrategyFast},
+		{Strategy: StrategyBtultra2},
+		{ForceAttachDict: DictForceCopy},
+		{MinMatch: 3, TargetLength: 1024},
+		{LiteralCompressionMode: LiteralCompressionHuffman},
+		{LiteralCompressionMode: LiteralCompressionUncompressed},
+	}
+	for _, params := range validParams {
+		if err := params.Validate(); err != nil {
+			t.Fatalf("unexpected error for %+v: %s", params, err)
+		}
+	}
+
+	invalidParams := []WriterParams{
+		{WindowLog: 1},
+		{WindowLog: 100},
+		{Strategy: -1},
+		{Strategy: StrategyBtultra2 + 1},
+		{ForceAttachDict: 10},
+		{LiteralCompressionMode: -1},
+		{LiteralCompressionMode: 3},
+		{NbWorkers: -1},
+		{OverlapLog: 10},
+		{MinMatch: 2},
+		{MinMatch: 100},
+		{TargetLength: -1},
+		{TargetLength: 1 << 20},
+	}
+	for _, params := range invalidParams {
+		if err := params.Validate(); err == nil {
+			t.Fatalf("expecting error for %+v", params)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package gozstd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Verifier verifies the integrity of zstd-compressed streams.
+//
+// Unlike SafeDecompress, which needs the whole compressed data in memory,
+// Verifier streams the compressed data through the decompression
+// and discards the decompressed data. The memory usage doesn't depend
+// on the stream size, so it may be used for checking large archives.
+type Verifier struct {
+	zr *Reader
+}
+
+// NewVerifier returns new Verifier for the compressed data read from r.
+//
+// Call Release when the Verifier is no longer needed.
+func NewVerifier(r io.Reader) *Verifier {
+	return &Verifier{
+		zr: NewReader(r),
+	}
+}
+
+// Verify reads all the compressed data from the underlying reader
+// and verifies it.
+//
+// The structure of all the frames is validated, as well as the content
+// checksums for frames with checksums. The first error is returned.
+// io.ErrUnexpectedEOF is returned if the compressed data is truncated.
+func (v *Verifier) Verify() error {
+	zr := v.zr
+	n, err := zr.WriteTo(ioutil.Discard)
+	if err != nil {
+		return fmt.Errorf("verification failed after decompressing %d bytes: %s", n, err)
+	}
+	if !zr.frameStart || zr.inBuf.pos < zr.inBuf.size {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// Reset resets v to verify the compressed data read from r.
+func (v *Verifier) Reset(r io.Reader) {
+	v.zr.Reset(r, nil)
+}
+
+// Release releases all the resources occupied by v.
+//
+// v cannot be used after the release.
+func (v *Verifier) Release() {
+	v.zr.Release()
+}
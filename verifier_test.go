@@ -0,0 +1,74 @@
+package gozstd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func newTestVerifierStream(t *testing.T) []byte {
+	t.Helper()
+	var bb bytes.Buffer
+	zw := NewWriterParams(&bb, &WriterParams{Checksum: true})
+	defer zw.Release()
+	for i := 0; i < 10; i++ {
+		if _, err := io.WriteString(zw, newTestString(500*1024, 10)); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.EndFrame(); err != nil {
+			t.Fatalf("cannot end frame: %s", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	return bb.Bytes()
+}
+
+func TestVerifier(t *testing.T) {
+	src := newTestVerifierStream(t)
+	v := NewVerifier(bytes.NewReader(src))
+	defer v.Release()
+	if err := v.Verify(); err != nil {
+		t.Fatalf("unexpected error for valid stream: %s", err)
+	}
+
+	// Empty stream is valid.
+	v.Reset(bytes.NewReader(nil))
+	if err := v.Verify(); err != nil {
+		t.Fatalf("unexpected error for empty stream: %s", err)
+	}
+}
+
+func TestVerifierError(t *testing.T) {
+	src := newTestVerifierStream(t)
+	v := NewVerifier(nil)
+	defer v.Release()
+	f := func(src []byte) {
+		t.Helper()
+		v.Reset(bytes.NewReader(src))
+		if err := v.Verify(); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// Corrupted checksum in the last frame.
+	corrupted := append([]byte{}, src...)
+	corrupted[len(corrupted)-1]++
+	f(corrupted)
+
+	// Corrupted data in the middle of the stream.
+	corrupted = append([]byte{}, src...)
+	for i := len(corrupted) / 2; i < len(corrupted)/2+100; i++ {
+		corrupted[i] ^= 0x55
+	}
+	f(corrupted)
+
+	// Truncated stream. The stream consists of 10 frames of similar size,
+	// so cut it in the middle of the 6th frame instead of the frame boundary.
+	f(src[:len(src)/2+len(src)/20])
+	f(src[:len(src)-1])
+
+	// Garbage after the valid stream.
+	f(append(append([]byte{}, src...), "foobar"...))
+}
@@ -18,6 +18,10 @@ static size_t ZSTD_CCtx_setParameter_wrapper(uintptr_t cs, ZSTD_cParameter param
     return ZSTD_CCtx_setParameter((ZSTD_CStream*)cs, param, value);
 }
 
+static size_t ZSTD_CCtx_reset_wrapper(uintptr_t cs, ZSTD_ResetDirective reset) {
+    return ZSTD_CCtx_reset((ZSTD_CStream*)cs, reset);
+}
+
 static size_t ZSTD_initCStream_wrapper(uintptr_t cs, int compressionLevel) {
     return ZSTD_initCStream((ZSTD_CStream*)cs, compressionLevel);
 }
@@ -26,6 +30,28 @@ static size_t ZSTD_CCtx_refCDict_wrapper(uintptr_t cc, uintptr_t dict) {
     return ZSTD_CCtx_refCDict((ZSTD_CCtx*)cc, (ZSTD_CDict*)dict);
 }
 
+static size_t ZSTD_CCtx_setPledgedSrcSize_wrapper(uintptr_t cs, unsigned long long pledgedSrcSize) {
+    return ZSTD_CCtx_setPledgedSrcSize((ZSTD_CStream*)cs, pledgedSrcSize);
+}
+
+// goZstdAlloc and goZstdFree are exported from custom_mem.go.
+// They accept the opaque allocator id as uintptr_t, since it isn't a pointer.
+extern void* goZstdAlloc(uintptr_t opaque, size_t size);
+extern void goZstdFree(uintptr_t opaque, void* address);
+
+static void* goZstdAlloc_wrapper(void* opaque, size_t size) {
+    return goZstdAlloc((uintptr_t)opaque, size);
+}
+
+static void goZstdFree_wrapper(void* opaque, void* address) {
+    goZstdFree((uintptr_t)opaque, address);
+}
+
+static ZSTD_CStream* ZSTD_createCStream_customMem_wrapper(uintptr_t opaque) {
+    ZSTD_customMem cmem = { goZstdAlloc_wrapper, goZstdFree_wrapper, (void*)opaque };
+    return ZSTD_createCStream_advanced(cmem);
+}
+
 static size_t ZSTD_freeCStream_wrapper(uintptr_t cs) {
     return ZSTD_freeCStream((ZSTD_CStream*)cs);
 }
@@ -34,6 +60,19 @@ static size_t ZSTD_compressStream_wrapper(uintptr_t cs, uintptr_t output, uintpt
     return ZSTD_compressStream((ZSTD_CStream*)cs, (ZSTD_outBuffer*)output, (ZSTD_inBuffer*)input);
 }
 
+// ZSTD_compressStream_input_wrapper constructs ZSTD_inBuffer on the stack
+// for the input residing in Go memory.
+static size_t ZSTD_compressStream_input_wrapper(uintptr_t cs, uintptr_t output, uintptr_t src, size_t srcSize, size_t* srcPos) {
+    ZSTD_inBuffer in = { (const void*)src, srcSize, *srcPos };
+    size_t result = ZSTD_compressStream((ZSTD_CStream*)cs, (ZSTD_outBuffer*)output, &in);
+    *srcPos = in.pos;
+    return result;
+}
+
+static size_t ZSTD_sizeof_CStream_wrapper(uintptr_t cs) {
+    return ZSTD_sizeof_CStream((ZSTD_CStream*)cs);
+}
+
 static size_t ZSTD_flushStream_wrapper(uintptr_t cs, uintptr_t output) {
     return ZSTD_flushStream((ZSTD_CStream*)cs, (ZSTD_outBuffer*)output);
 }
@@ -46,9 +85,14 @@ static size_t ZSTD_endStream_wrapper(uintptr_t cs, uintptr_t output) {
 import "C"
 
 import (
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"runtime"
+	"strings"
+	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -61,17 +105,103 @@ type cMemPtr *[1 << 30]byte
 
 // Writer implements zstd writer.
 type Writer struct {
-	w                io.Writer
-	compressionLevel int
-	wlog             int
-	cs               *C.ZSTD_CStream
-	cd               *CDict
+	w      io.Writer
+	params WriterParams
+	cs     *C.ZSTD_CStream
 
 	inBuf  *C.ZSTD_inBuffer
 	outBuf *C.ZSTD_outBuffer
 
 	inBufGo  cMemPtr
 	outBufGo cMemPtr
+
+	// The sizes of the memory allocated for inBuf and outBuf.
+	// They are changed by Grow.
+	inBufSize  C.size_t
+	outBufSize C.size_t
+
+	// allocatorID is the id of the custom allocator for cs.
+	// It is set by NewWriterCustomMem.
+	allocatorID uintptr
+
+	// The following fields are used by WriterPool for releasing
+	// buffers of idle writers.
+	idleLock  sync.Mutex
+	idle      bool
+	idleTimer *time.Timer
+
+	// frameOpen is set if data has been written to the current frame.
+	frameOpen bool
+
+	// closed is set by Close. It is cleared by Reset*.
+	closed bool
+
+	// stableInput is set via SetStableInput.
+	stableInput bool
+
+	// The following fields are used by BytesIn and CloseWithStats.
+	bytesIn  int64
+	bytesOut int64
+
+	// The following fields are used by SetMaxInput.
+	maxInput   int64
+	inputBytes int64
+
+	// sinks contains writers added via AddSink.
+	sinks      []writerSink
+	sinkErrors []string
+
+	// flushObserver is set by SetFlushObserver.
+	flushObserver func(n int)
+
+	// frameEndObserver is set by SetFrameEndObserver.
+	frameEndObserver func(compressedLen, uncompressedLen int64)
+
+	// bytesIn and bytesOut at the start of the current frame.
+	frameStartIn  int64
+	frameStartOut int64
+
+	// The following fields are used by PledgeSize and Grow.
+	pledged     bool
+	pledgedSize int64
+
+	// growPending is set if the size pledged by Grow hasn't been passed
+	// to zstd yet. See commitGrow.
+	growPending bool
+
+	// compressedHash is set by HashCompressed.
+	compressedHash hash.Hash
+
+	// leadingMetadata is the skippable frame set by SetLeadingMetadata,
+	// which must be written before the first compressed frame.
+	leadingMetadata []byte
+
+	// flushEveryWrite is set by SetFlushEveryWrite.
+	flushEveryWrite bool
+
+	// The following fields are used by SetAutoFlush.
+	autoFlushMaxBytes    int
+	autoFlushMaxInterval time.Duration
+	autoFlushBytes       int
+	autoFlushStart       time.Time
+	autoFlushNow         func() time.Time
+	autoFlushAfterFunc   func(d time.Duration, f func()) flushTimer
+
+	// The following fields are used by the timer flushing zw after
+	// autoFlushMaxInterval. They are protected by autoFlushLock.
+	autoFlushLock  sync.Mutex
+	autoFlushTimer flushTimer
+	autoFlushGen   uint64
+	autoFlushErr   error
+}
+
+// flushTimer is the timer created by Writer.autoFlushAfterFunc.
+type flushTimer interface {
+	Stop() bool
+}
+
+func newFlushTimer(d time.Duration, f func()) flushTimer {
+	return time.AfterFunc(d, f)
 }
 
 // NewWriter returns new zstd writer writing compressed data to w.
@@ -112,6 +242,28 @@ func NewWriterDict(w io.Writer, cd *CDict) *Writer {
 	return NewWriterParams(w, params)
 }
 
+// NewWriterDictLevel returns new zstd writer writing compressed data to w
+// using the given cd at the given compressionLevel.
+//
+// This allows using a single CDict at distinct compression levels.
+// The dictionary contents are shared between the levels, while the tables
+// for every level are created on the first use and are kept until cd.Release.
+// Other constructors and Reset* calls compress with cd at the compression
+// level cd was created with.
+//
+// The returned writer must be closed with Close call in order
+// to finalize the compressed stream.
+//
+// Call Release when the Writer is no longer needed.
+func NewWriterDictLevel(w io.Writer, cd *CDict, compressionLevel int) *Writer {
+	params := &WriterParams{
+		CompressionLevel: compressionLevel,
+		Dict:             cd,
+		dictLevel:        true,
+	}
+	return NewWriterParams(w, params)
+}
+
 const (
 	// WindowLogMin is the minimum value of the windowLog parameter.
 	WindowLogMin = 10 // from zstd.h
@@ -124,11 +276,103 @@ const (
 	DefaultWindowLog = 0
 )
 
+// DictAttachMode controls whether the CDict contents are used in place
+// or copied into the working compression context.
+//
+// See WriterParams.ForceAttachDict.
+type DictAttachMode int
+
+const (
+	// DictAttachDefault lets zstd choose between attaching and copying
+	// the dictionary depending on the input size.
+	DictAttachDefault = DictAttachMode(C.ZSTD_dictDefaultAttach)
+
+	// DictForceAttach always uses the dictionary in place.
+	//
+	// This avoids copying the dictionary tables at the start of every frame,
+	// so it is usually faster for small inputs. The compression speed
+	// may be lower for big inputs.
+	DictForceAttach = DictAttachMode(C.ZSTD_dictForceAttach)
+
+	// DictForceCopy always copies the dictionary tables into the working
+	// context at the start of every frame.
+	//
+	// This costs CPU time and memory bandwidth per frame, but usually results
+	// in faster compression of big inputs.
+	DictForceCopy = DictAttachMode(C.ZSTD_dictForceCopy)
+
+	// DictForceLoad always reloads the dictionary from its raw content
+	// at the start of every frame.
+	//
+	// This is the slowest mode. It may be useful when the dictionary is tiny
+	// comparing to the compressed data.
+	DictForceLoad = DictAttachMode(C.ZSTD_dictForceLoad)
+)
+
+// LiteralCompressionMode controls the entropy compression of literals,
+// i.e. the bytes, which aren't a part of matches.
+//
+// See WriterParams.LiteralCompressionMode.
+type LiteralCompressionMode int
+
+const (
+	// LiteralCompressionAuto lets zstd choose whether to compress literals
+	// depending on the compression level. Literals aren't compressed
+	// for negative compression levels.
+	LiteralCompressionAuto = LiteralCompressionMode(C.ZSTD_ps_auto)
+
+	// LiteralCompressionHuffman always attempts Huffman compression
+	// for literals. Uncompressed literals are still emitted if Huffman
+	// compression isn't profitable.
+	LiteralCompressionHuffman = LiteralCompressionMode(C.ZSTD_ps_enable)
+
+	// LiteralCompressionUncompressed always emits uncompressed literals.
+	//
+	// This speeds up the compression and the decompression of data
+	// with high-entropy literals such as already compressed or encrypted
+	// parts at the cost of compression ratio for the rest of data.
+	LiteralCompressionUncompressed = LiteralCompressionMode(C.ZSTD_ps_disable)
+)
+
+// Strategy is the compression strategy.
+//
+// Strategies are listed from the fastest to the strongest.
+//
+// See WriterParams.Strategy.
+type Strategy int
+
+const (
+	// StrategyDefault lets zstd choose the strategy for the compression level.
+	StrategyDefault = Strategy(0)
+
+	// StrategyFast is ZSTD_fast strategy.
+	StrategyFast = Strategy(C.ZSTD_fast)
+	// StrategyDFast is ZSTD_dfast strategy.
+	StrategyDFast = Strategy(C.ZSTD_dfast)
+	// StrategyGreedy is ZSTD_greedy strategy.
+	StrategyGreedy = Strategy(C.ZSTD_greedy)
+	// StrategyLazy is ZSTD_lazy strategy.
+	StrategyLazy = Strategy(C.ZSTD_lazy)
+	// StrategyLazy2 is ZSTD_lazy2 strategy.
+	StrategyLazy2 = Strategy(C.ZSTD_lazy2)
+	// StrategyBtlazy2 is ZSTD_btlazy2 strategy.
+	StrategyBtlazy2 = Strategy(C.ZSTD_btlazy2)
+	// StrategyBtopt is ZSTD_btopt strategy.
+	StrategyBtopt = Strategy(C.ZSTD_btopt)
+	// StrategyBtultra is ZSTD_btultra strategy.
+	StrategyBtultra = Strategy(C.ZSTD_btultra)
+	// StrategyBtultra2 is ZSTD_btultra2 strategy.
+	StrategyBtultra2 = Strategy(C.ZSTD_btultra2)
+)
+
 // A WriterParams allows users to specify compression parameters by calling
 // NewWriterParams.
 //
 // Calling NewWriterParams with a nil WriterParams is equivalent to calling
 // NewWriter.
+//
+// NewWriterParams panics on invalid params. Use Validate for verifying
+// params obtained from untrusted sources.
 type WriterParams struct {
 	// Compression level. Special value 0 means 'default compression level'.
 	CompressionLevel int
@@ -143,6 +387,78 @@ type WriterParams struct {
 
 	// Dict is optional dictionary used for compression.
 	Dict *CDict
+
+	// ForceAttachDict controls how Dict is used by the compressor.
+	// See DictAttachMode for the available modes and their tradeoffs.
+	//
+	// Special value 0 (DictAttachDefault) lets zstd choose the mode.
+	ForceAttachDict DictAttachMode
+
+	// Strategy overrides the compression strategy chosen by zstd
+	// for the CompressionLevel.
+	//
+	// Special value 0 (StrategyDefault) means 'use the strategy
+	// for the CompressionLevel'.
+	Strategy Strategy
+
+	// NbWorkers is the number of background threads used for the compression.
+	//
+	// Special value 0 means 'compress in the calling goroutine'.
+	// Non-zero values may be used only if MultithreadingSupported returns true.
+	NbWorkers int
+
+	// JobSize is the size in bytes of a compression job in multithreaded mode.
+	// Every job is compressed by a separate worker, so smaller jobs improve
+	// parallelism at the cost of compression ratio.
+	//
+	// Special value 0 means 'use default job size', which depends on
+	// the window size - it is usually 4x the window size. JobSize is ignored
+	// if NbWorkers is 0.
+	JobSize int
+
+	// OverlapLog controls how much data is reloaded from the previous job
+	// in multithreaded mode. The overlap size is WindowSize >> (9 - OverlapLog)
+	// for OverlapLog in the range [1..9], where 9 means 'full window'.
+	//
+	// Special value 0 means 'use default overlap for the compression strategy'.
+	// OverlapLog is ignored if NbWorkers is 0.
+	OverlapLog int
+
+	// MinMatch is the minimum size of matches searched by the compressor.
+	// Larger values speed up the compression and decompression, while
+	// smaller values may improve the compression ratio for data with
+	// short repeated sequences. The effect is data-dependent.
+	//
+	// Special value 0 means 'use the MinMatch for the CompressionLevel'.
+	MinMatch int
+
+	// TargetLength is the strategy-dependent match length, which stops
+	// the search for a better match. Larger values usually improve
+	// the compression ratio at the cost of compression speed.
+	// The effect is data-dependent.
+	//
+	// Special value 0 means 'use the TargetLength for the CompressionLevel'.
+	TargetLength int
+
+	// LiteralCompressionMode controls the entropy compression of literals.
+	//
+	// By default zstd chooses the mode depending on the CompressionLevel.
+	LiteralCompressionMode LiteralCompressionMode
+
+	// Checksum enables writing the content checksum at the end of every frame.
+	// The checksum is verified during the decompression.
+	Checksum bool
+
+	// NoDictID disables writing the dictionary ID into the frame header
+	// when compressing with Dict. This saves up to 4 bytes per frame
+	// if the decompressor always knows which dictionary to use.
+	//
+	// GetFrameDictID and Reader.DictID return 0 for such frames.
+	NoDictID bool
+
+	// dictLevel is set by NewWriterDictLevel. It makes the writer compress
+	// with Dict at CompressionLevel instead of the level of Dict.
+	dictLevel bool
 }
 
 // NewWriterParams returns new zstd writer writing compressed data to w
@@ -152,12 +468,65 @@ type WriterParams struct {
 // to finalize the compressed stream.
 //
 // Call Release when the Writer is no longer needed.
+//
+// NewWriterParams blocks if the limit set via SetMaxConcurrentContexts
+// is reached.
 func NewWriterParams(w io.Writer, params *WriterParams) *Writer {
 	if params == nil {
 		params = &WriterParams{}
 	}
 
+	acquireContext()
+	cs := C.ZSTD_createCStream()
+	return newWriter(w, params, cs)
+}
+
+// TryNewWriterParams is like NewWriterParams, but it returns
+// ErrTooManyContexts instead of blocking if the limit set via
+// SetMaxConcurrentContexts is reached.
+func TryNewWriterParams(w io.Writer, params *WriterParams) (*Writer, error) {
+	if params == nil {
+		params = &WriterParams{}
+	}
+
+	if !tryAcquireContext() {
+		return nil, ErrTooManyContexts
+	}
 	cs := C.ZSTD_createCStream()
+	return newWriter(w, params, cs), nil
+}
+
+// NewWriterCustomMem returns new zstd writer writing compressed data to w
+// at the given compressionLevel.
+//
+// The memory for zstd compression context is allocated via the given a.
+// This may be useful for NUMA-aware or arena-based deployments.
+// The input and output buffers of the writer are still allocated
+// with the system allocator.
+//
+// The returned writer must be closed with Close call in order
+// to finalize the compressed stream.
+//
+// Call Release when the Writer is no longer needed. All the memory
+// obtained from a is freed on Release.
+func NewWriterCustomMem(w io.Writer, compressionLevel int, a Allocator) *Writer {
+	params := &WriterParams{
+		CompressionLevel: compressionLevel,
+	}
+	acquireContext()
+	allocatorID := registerAllocator(a)
+	cs := C.ZSTD_createCStream_customMem_wrapper(C.uintptr_t(allocatorID))
+	if cs == nil {
+		releaseContext()
+		unregisterAllocator(allocatorID)
+		panic(fmt.Errorf("BUG: cannot allocate memory for CStream via custom allocator"))
+	}
+	zw := newWriter(w, params, cs)
+	zw.allocatorID = allocatorID
+	return zw
+}
+
+func newWriter(w io.Writer, params *WriterParams, cs *C.ZSTD_CStream) *Writer {
 	initCStream(cs, *params)
 
 	inBuf := (*C.ZSTD_inBuffer)(C.calloc(1, C.sizeof_ZSTD_inBuffer))
@@ -171,13 +540,13 @@ func NewWriterParams(w io.Writer, params *WriterParams) *Writer {
 	outBuf.pos = 0
 
 	zw := &Writer{
-		w:                w,
-		compressionLevel: params.CompressionLevel,
-		wlog:             params.WindowLog,
-		cs:               cs,
-		cd:               params.Dict,
-		inBuf:            inBuf,
-		outBuf:           outBuf,
+		w:          w,
+		params:     *params,
+		cs:         cs,
+		inBuf:      inBuf,
+		outBuf:     outBuf,
+		inBufSize:  cstreamInBufSize,
+		outBufSize: cstreamOutBufSize,
 	}
 
 	zw.inBufGo = cMemPtr(zw.inBuf.src)
@@ -187,49 +556,247 @@ func NewWriterParams(w io.Writer, params *WriterParams) *Writer {
 	return zw
 }
 
+// freeBuffers frees the memory occupied by zw buffers.
+//
+// The buffers must be allocated again with allocBuffers before using zw.
+func (zw *Writer) freeBuffers() {
+	if zw.inBufGo == nil {
+		return
+	}
+
+	C.free(unsafe.Pointer(zw.inBuf.src))
+	zw.inBuf.src = nil
+	zw.inBufGo = nil
+
+	C.free(unsafe.Pointer(zw.outBuf.dst))
+	zw.outBuf.dst = nil
+	zw.outBufGo = nil
+}
+
+// allocBuffers allocates zw buffers freed by freeBuffers.
+func (zw *Writer) allocBuffers() {
+	if zw.inBufGo != nil {
+		return
+	}
+
+	zw.inBuf.src = C.calloc(1, zw.inBufSize)
+	zw.inBufGo = cMemPtr(zw.inBuf.src)
+
+	zw.outBuf.dst = C.calloc(1, zw.outBufSize)
+	zw.outBufGo = cMemPtr(zw.outBuf.dst)
+}
+
+// resizeBuffers changes the sizes of zw buffers.
+//
+// The data in the buffers is preserved.
+func (zw *Writer) resizeBuffers(inBufSize, outBufSize C.size_t) {
+	if zw.inBufGo != nil {
+		if inBufSize != zw.inBufSize {
+			if zw.inBuf.size > inBufSize {
+				panic(fmt.Errorf("BUG: cannot shrink inBuf with %d bytes to %d bytes", zw.inBuf.size, inBufSize))
+			}
+			zw.inBuf.src = C.realloc(zw.inBuf.src, inBufSize)
+			if zw.inBuf.src == nil {
+				panic(fmt.Errorf("BUG: cannot allocate %d bytes for inBuf", inBufSize))
+			}
+			zw.inBufGo = cMemPtr(zw.inBuf.src)
+		}
+		if outBufSize != zw.outBufSize {
+			if zw.outBuf.pos > outBufSize {
+				panic(fmt.Errorf("BUG: cannot shrink outBuf with %d bytes to %d bytes", zw.outBuf.pos, outBufSize))
+			}
+			zw.outBuf.dst = C.realloc(zw.outBuf.dst, outBufSize)
+			if zw.outBuf.dst == nil {
+				panic(fmt.Errorf("BUG: cannot allocate %d bytes for outBuf", outBufSize))
+			}
+			zw.outBufGo = cMemPtr(zw.outBuf.dst)
+		}
+	}
+	zw.inBufSize = inBufSize
+	zw.outBufSize = outBufSize
+	zw.outBuf.size = outBufSize
+}
+
 // Reset resets zw to write to w using the given dictionary cd and the given
 // compressionLevel. Use ResetWriterParams if you wish to change other
 // parameters that were set via WriterParams.
 func (zw *Writer) Reset(w io.Writer, cd *CDict, compressionLevel int) {
-	params := WriterParams{
-		CompressionLevel: compressionLevel,
-		WindowLog:        zw.wlog,
-		Dict:             cd,
+	params := zw.params
+	params.CompressionLevel = compressionLevel
+	params.Dict = cd
+	params.dictLevel = false
+	zw.ResetWriterParams(w, &params)
+}
+
+// cdict returns the CDict to compress with according to wp.
+func (wp *WriterParams) cdict() *C.ZSTD_CDict {
+	if wp.dictLevel {
+		return wp.Dict.levelCDict(wp.CompressionLevel)
+	}
+	return wp.Dict.p
+}
+
+// ResetNoDict resets zw to write to w without a dictionary.
+//
+// The rest of parameters are preserved. If the compression level
+// wasn't set explicitly, then the compression level of the previously
+// used dictionary is retained.
+//
+// This is useful for pooled writers, which must write dictionary-free
+// frames after writing frames with a dictionary.
+func (zw *Writer) ResetNoDict(w io.Writer) {
+	params := zw.params
+	if params.Dict != nil && params.CompressionLevel == 0 {
+		params.CompressionLevel = params.Dict.compressionLevel
 	}
+	params.Dict = nil
 	zw.ResetWriterParams(w, &params)
 }
 
 // ResetWriterParams resets zw to write to w using the given set of parameters.
 func (zw *Writer) ResetWriterParams(w io.Writer, params *WriterParams) {
+	zw.resetWriterParams(w, params, nil)
+}
+
+func (zw *Writer) resetWriterParams(w io.Writer, params *WriterParams, p *Params) {
+	if zw.lockAutoFlush() {
+		defer zw.autoFlushLock.Unlock()
+	}
+	zw.setAutoFlush(0, 0)
+	zw.autoFlushErr = nil
+
 	zw.inBuf.size = 0
 	zw.inBuf.pos = 0
-	zw.outBuf.size = cstreamOutBufSize
 	zw.outBuf.pos = 0
+	zw.resizeBuffers(cstreamInBufSize, cstreamOutBufSize)
+
+	zw.params = *params
+	if p != nil {
+		initCStreamPrepared(zw.cs, p)
+	} else {
+		initCStream(zw.cs, *params)
+	}
+	zw.frameOpen = false
+	zw.closed = false
 
-	zw.cd = params.Dict
-	initCStream(zw.cs, *params)
+	zw.SetFlushEveryWrite(false)
+	zw.SetMaxInput(0)
+	zw.SetStableInput(false)
+	zw.compressedHash = nil
+	zw.flushObserver = nil
+	zw.frameEndObserver = nil
+	zw.sinks = nil
+	zw.sinkErrors = zw.sinkErrors[:0]
+	zw.leadingMetadata = nil
+	zw.bytesIn = 0
+	zw.bytesOut = 0
+	zw.frameStartIn = 0
+	zw.frameStartOut = 0
+	zw.pledged = false
+	zw.growPending = false
 
 	zw.w = w
 }
 
 func initCStream(cs *C.ZSTD_CStream, params WriterParams) {
+	// Reset all the parameters, so the parameters set via SetParameter
+	// do not leak into the next stream.
+	result := C.ZSTD_CCtx_reset_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+		C.ZSTD_reset_session_and_parameters)
+	ensureNoError("ZSTD_CCtx_reset", result)
+
 	if params.Dict != nil {
-		result := C.ZSTD_CCtx_refCDict_wrapper(
+		result = C.ZSTD_CCtx_refCDict_wrapper(
 			C.uintptr_t(uintptr(unsafe.Pointer(cs))),
-			C.uintptr_t(uintptr(unsafe.Pointer(params.Dict.p))))
+			C.uintptr_t(uintptr(unsafe.Pointer(params.cdict()))))
 		ensureNoError("ZSTD_CCtx_refCDict", result)
 	} else {
-		result := C.ZSTD_initCStream_wrapper(
+		result = C.ZSTD_initCStream_wrapper(
 			C.uintptr_t(uintptr(unsafe.Pointer(cs))),
 			C.int(params.CompressionLevel))
 		ensureNoError("ZSTD_initCStream", result)
 	}
 
-	result := C.ZSTD_CCtx_setParameter_wrapper(
+	result = C.ZSTD_CCtx_setParameter_wrapper(
 		C.uintptr_t(uintptr(unsafe.Pointer(cs))),
 		C.ZSTD_cParameter(C.ZSTD_c_windowLog),
 		C.int(params.WindowLog))
 	ensureNoError("ZSTD_CCtx_setParameter", result)
+
+	result = C.ZSTD_CCtx_setParameter_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+		C.ZSTD_cParameter(C.ZSTD_c_forceAttachDict),
+		C.int(params.ForceAttachDict))
+	ensureNoError("ZSTD_CCtx_setParameter", result)
+
+	result = C.ZSTD_CCtx_setParameter_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+		C.ZSTD_cParameter(C.ZSTD_c_strategy),
+		C.int(params.Strategy))
+	ensureNoError("ZSTD_CCtx_setParameter", result)
+
+	result = C.ZSTD_CCtx_setParameter_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+		C.ZSTD_cParameter(C.ZSTD_c_nbWorkers),
+		C.int(params.NbWorkers))
+	ensureNoError("ZSTD_CCtx_setParameter", result)
+
+	result = C.ZSTD_CCtx_setParameter_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+		C.ZSTD_cParameter(C.ZSTD_c_jobSize),
+		C.int(params.JobSize))
+	ensureNoError("ZSTD_CCtx_setParameter", result)
+
+	result = C.ZSTD_CCtx_setParameter_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+		C.ZSTD_cParameter(C.ZSTD_c_overlapLog),
+		C.int(params.OverlapLog))
+	ensureNoError("ZSTD_CCtx_setParameter", result)
+
+	result = C.ZSTD_CCtx_setParameter_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+		C.ZSTD_cParameter(C.ZSTD_c_minMatch),
+		C.int(params.MinMatch))
+	ensureNoError("ZSTD_CCtx_setParameter", result)
+
+	result = C.ZSTD_CCtx_setParameter_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+		C.ZSTD_cParameter(C.ZSTD_c_targetLength),
+		C.int(params.TargetLength))
+	ensureNoError("ZSTD_CCtx_setParameter", result)
+
+	result = C.ZSTD_CCtx_setParameter_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+		C.ZSTD_cParameter(C.ZSTD_c_literalCompressionMode),
+		C.int(params.LiteralCompressionMode))
+	ensureNoError("ZSTD_CCtx_setParameter", result)
+
+	if params.Checksum {
+		result = C.ZSTD_CCtx_setParameter_wrapper(
+			C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+			C.ZSTD_cParameter(C.ZSTD_c_checksumFlag),
+			1)
+		ensureNoError("ZSTD_CCtx_setParameter", result)
+	}
+
+	if params.NoDictID {
+		result = C.ZSTD_CCtx_setParameter_wrapper(
+			C.uintptr_t(uintptr(unsafe.Pointer(cs))),
+			C.ZSTD_cParameter(C.ZSTD_c_dictIDFlag),
+			0)
+		ensureNoError("ZSTD_CCtx_setParameter", result)
+	}
+}
+
+func (zw *Writer) setPledgedSrcSize(n uint64) error {
+	result := C.ZSTD_CCtx_setPledgedSrcSize_wrapper(
+		C.uintptr_t(uintptr(unsafe.Pointer(zw.cs))),
+		C.ulonglong(n))
+	if C.ZSTD_getErrorCode(result) != 0 {
+		return fmt.Errorf("cannot pledge size %d: %s", n, errStr(result))
+	}
+	return nil
 }
 
 func freeCStream(v interface{}) {
@@ -243,11 +810,21 @@ func (zw *Writer) Release() {
 	if zw.cs == nil {
 		return
 	}
+	if zw.lockAutoFlush() {
+		defer zw.autoFlushLock.Unlock()
+	}
+	zw.stopAutoFlushTimer()
 
 	result := C.ZSTD_freeCStream_wrapper(
 		C.uintptr_t(uintptr(unsafe.Pointer(zw.cs))))
 	ensureNoError("ZSTD_freeCStream", result)
 	zw.cs = nil
+	releaseContext()
+
+	if zw.allocatorID != 0 {
+		unregisterAllocator(zw.allocatorID)
+		zw.allocatorID = 0
+	}
 
 	C.free(unsafe.Pointer(zw.inBuf.src))
 	C.free(unsafe.Pointer(zw.inBuf))
@@ -258,7 +835,7 @@ func (zw *Writer) Release() {
 	zw.outBuf = nil
 
 	zw.w = nil
-	zw.cd = nil
+	zw.params.Dict = nil
 }
 
 // ReadFrom reads all the data from r and writes it to zw.
@@ -270,16 +847,80 @@ func (zw *Writer) Release() {
 // Call Flush or Close when the compressed data must propagate
 // to the underlying writer.
 func (zw *Writer) ReadFrom(r io.Reader) (int64, error) {
+	locked := zw.lockAutoFlush()
+	if locked {
+		defer zw.autoFlushLock.Unlock()
+	}
+	if zw.w == nil {
+		return 0, ErrNilWriter
+	}
+	if zw.closed {
+		return 0, ErrClosed
+	}
+	if err := zw.takeAutoFlushError(); err != nil {
+		return 0, err
+	}
 	nn := int64(0)
 	for {
-		// Fill the inBuf.
-		for zw.inBuf.size < cstreamInBufSize {
-			n, err := r.Read(zw.inBufGo[zw.inBuf.size:cstreamInBufSize])
+		// Fill the inBuf. The data is read directly into inBuf,
+		// so ReadFrom doesn't need intermediate buffers and doesn't allocate.
+		for {
+			if locked && zw.inBuf.size > 0 {
+				// Pass the buffered data to zstd, so the timer may flush it
+				// while r.Read blocks. The timer doesn't touch the empty inBuf,
+				// so r.Read may fill it without holding the lock.
+				for zw.inBuf.size > 0 {
+					if err := zw.flushInBuf(); err != nil {
+						return nn, err
+					}
+				}
+			}
+			bufEnd := zw.readFromBufEnd()
+			if zw.inBuf.size >= bufEnd {
+				break
+			}
+
+			if locked {
+				zw.autoFlushLock.Unlock()
+			}
+			n, err := r.Read(zw.inBufGo[zw.inBuf.size:bufEnd])
+			if locked {
+				zw.autoFlushLock.Lock()
+				if err == nil {
+					err = zw.takeAutoFlushError()
+				}
+			}
 
 			// Sometimes n > 0 even when Read() returns an error.
 			// This is true especially if the error is io.EOF.
 			zw.inBuf.size += C.size_t(n)
 			nn += int64(n)
+			zw.inputBytes += int64(n)
+			zw.bytesIn += int64(n)
+			if n > 0 {
+				zw.frameOpen = true
+			}
+
+			if zw.maxInput > 0 && zw.inputBytes > zw.maxInput {
+				// Drop the byte read past the input limit.
+				zw.inBuf.size--
+				nn--
+				zw.inputBytes--
+				zw.bytesIn--
+				return nn, ErrInputLimitExceeded
+			}
+			if zw.pledged && zw.pledgeRemaining() < 0 {
+				if !zw.growPending {
+					// Drop the byte read past the pledged size.
+					zw.inBuf.size--
+					nn--
+					zw.inputBytes--
+					zw.bytesIn--
+					return nn, ErrPledgedSizeMismatch
+				}
+				// The frame exceeds the size passed to Grow.
+				zw.dropGrow()
+			}
 
 			if err != nil {
 				if err == io.EOF {
@@ -287,6 +928,9 @@ func (zw *Writer) ReadFrom(r io.Reader) (int64, error) {
 				}
 				return nn, err
 			}
+			if err := zw.autoFlush(n); err != nil {
+				return nn, err
+			}
 		}
 
 		// Flush the inBuf.
@@ -296,6 +940,26 @@ func (zw *Writer) ReadFrom(r io.Reader) (int64, error) {
 	}
 }
 
+// readFromBufEnd returns the end of inBuf region ReadFrom may read data to.
+func (zw *Writer) readFromBufEnd() C.size_t {
+	bufEnd := zw.inBufSize
+	if zw.maxInput > 0 {
+		// Read a byte past the input limit in order to detect
+		// whether r contains more data than allowed.
+		if end := zw.inBuf.size + C.size_t(zw.maxInput-zw.inputBytes) + 1; end < bufEnd {
+			bufEnd = end
+		}
+	}
+	if zw.pledged && !zw.growPending {
+		// Read a byte past the pledged size in order to detect
+		// whether r contains more data than pledged.
+		if end := zw.inBuf.size + C.size_t(zw.pledgeRemaining()) + 1; end < bufEnd {
+			bufEnd = end
+		}
+	}
+	return bufEnd
+}
+
 // Write writes p to zw.
 //
 // Write doesn't flush the compressed data to the underlying writer
@@ -303,35 +967,388 @@ func (zw *Writer) ReadFrom(r io.Reader) (int64, error) {
 // Call Flush or Close when the compressed data must propagate
 // to the underlying writer.
 func (zw *Writer) Write(p []byte) (int, error) {
+	if zw.lockAutoFlush() {
+		defer zw.autoFlushLock.Unlock()
+	}
+	return zw.writeData(p)
+}
+
+func (zw *Writer) writeData(p []byte) (int, error) {
+	if zw.w == nil {
+		return 0, ErrNilWriter
+	}
+	if zw.closed {
+		return 0, ErrClosed
+	}
+	if err := zw.takeAutoFlushError(); err != nil {
+		return 0, err
+	}
+	var limitErr error
+	if zw.maxInput > 0 {
+		if remaining := zw.maxInput - zw.inputBytes; int64(len(p)) > remaining {
+			p = p[:remaining]
+			limitErr = ErrInputLimitExceeded
+		}
+	}
+	if zw.pledged && int64(len(p)) > zw.pledgeRemaining() {
+		if !zw.growPending {
+			return 0, ErrPledgedSizeMismatch
+		}
+		// The frame exceeds the size passed to Grow. Drop the pledge,
+		// since it hasn't been passed to zstd yet.
+		zw.dropGrow()
+	}
+	n, err := zw.write(p)
+	zw.inputBytes += int64(n)
+	zw.bytesIn += int64(n)
+	if err == nil && n > 0 && zw.flushEveryWrite {
+		err = zw.syncFlush()
+	} else if err == nil {
+		err = zw.autoFlush(n)
+	}
+	if err == nil {
+		err = limitErr
+	}
+	return n, err
+}
+
+// ErrNilWriter is returned from Writer methods when the Writer has
+// no underlying writer.
+//
+// New* functions and Reset* methods accept nil writer, so Writer
+// may be created in advance and then pointed to the actual writer
+// via Reset. The data cannot be written until then.
+var ErrNilWriter = errors.New("gozstd: nil writer")
+
+// ErrClosed is returned when writing to or flushing the closed Writer.
+//
+// Reset* methods make the Writer usable again.
+var ErrClosed = errors.New("gozstd: writer is closed")
+
+// ErrInputLimitExceeded is returned from Writer.Write and Writer.ReadFrom
+// when the limit set via Writer.SetMaxInput is exceeded.
+var ErrInputLimitExceeded = errors.New("the input limit for the writer is exceeded")
+
+// SetMaxInput limits the number of uncompressed bytes accepted by zw to n.
+//
+// Write writes the data up to the limit and returns ErrInputLimitExceeded
+// for the data past the limit. The data past the limit is dropped,
+// so the compressed stream remains valid and it may be finalized with Close.
+// ReadFrom returns ErrInputLimitExceeded if r contains more data than
+// the limit allows.
+//
+// The limit applies to the data written after the SetMaxInput call.
+// Zero or negative n disables the limit. Reset and ResetWriterParams
+// disable the limit.
+func (zw *Writer) SetMaxInput(n int64) {
+	zw.maxInput = n
+	zw.inputBytes = 0
+}
+
+// SetAutoFlush enables flushing zw after maxBytes of data is written to it
+// or after maxInterval passes since the first write of unflushed data.
+//
+// This bounds both the amount of buffered data and the buffering delay
+// for streaming telemetry. The data written via Write, WriteWithHint
+// and ReadFrom counts toward the thresholds.
+//
+// If maxInterval is positive, then zw starts a timer on the first write
+// of unflushed data, which flushes zw after maxInterval even if no more data
+// is written to zw. The timer flushes zw in a separate goroutine, so
+// the underlying writer may be called from that goroutine. Writer methods
+// for writing, flushing, closing, resetting and releasing zw are synchronized
+// with the timer. Other methods such as AddSink, HashCompressed
+// or SetLeadingMetadata must be called when zw has no unflushed data.
+// The error from the timer flush is returned from the next Write, ReadFrom,
+// Flush, EndFrame or Close call. The timer is stopped by Flush, Close,
+// Reset* and Release.
+//
+// Zero or negative maxBytes and maxInterval disable the corresponding threshold.
+// Reset and ResetWriterParams disable auto-flush.
+func (zw *Writer) SetAutoFlush(maxBytes int, maxInterval time.Duration) {
+	if zw.lockAutoFlush() {
+		defer zw.autoFlushLock.Unlock()
+	}
+	zw.setAutoFlush(maxBytes, maxInterval)
+}
+
+func (zw *Writer) setAutoFlush(maxBytes int, maxInterval time.Duration) {
+	zw.stopAutoFlushTimer()
+	zw.autoFlushMaxBytes = maxBytes
+	zw.autoFlushMaxInterval = maxInterval
+	zw.autoFlushBytes = 0
+	zw.autoFlushStart = time.Time{}
+	if zw.autoFlushNow == nil {
+		zw.autoFlushNow = time.Now
+	}
+	if zw.autoFlushAfterFunc == nil {
+		zw.autoFlushAfterFunc = newFlushTimer
+	}
+}
+
+// lockAutoFlush locks autoFlushLock if the timer flush is enabled
+// via SetAutoFlush.
+//
+// It returns true if the lock is acquired. The timer flush settings
+// are changed only by the goroutine owning zw, so they cannot change
+// between lockAutoFlush and the corresponding unlock.
+func (zw *Writer) lockAutoFlush() bool {
+	if zw.autoFlushMaxInterval <= 0 {
+		return false
+	}
+	zw.autoFlushLock.Lock()
+	return true
+}
+
+// stopAutoFlushTimer stops the timer started by autoFlush.
+//
+// The timer func, which is already running, skips the flush,
+// since it belongs to the previous generation.
+func (zw *Writer) stopAutoFlushTimer() {
+	zw.autoFlushGen++
+	if zw.autoFlushTimer != nil {
+		zw.autoFlushTimer.Stop()
+		zw.autoFlushTimer = nil
+	}
+}
+
+func (zw *Writer) resetAutoFlushBytes() {
+	zw.autoFlushBytes = 0
+	zw.stopAutoFlushTimer()
+}
+
+func (zw *Writer) takeAutoFlushError() error {
+	err := zw.autoFlushErr
+	zw.autoFlushErr = nil
+	return err
+}
+
+// timerFlush is called by the timer started by autoFlush.
+func (zw *Writer) timerFlush(gen uint64) {
+	zw.autoFlushLock.Lock()
+	defer zw.autoFlushLock.Unlock()
+	if gen != zw.autoFlushGen || zw.cs == nil || zw.closed {
+		// zw has been flushed, closed, reset or released
+		// since the timer start.
+		return
+	}
+	zw.autoFlushTimer = nil
+	if err := zw.flush(); err != nil {
+		zw.autoFlushErr = err
+	}
+}
+
+// HashCompressed enables hashing the compressed data written by zw
+// to the underlying writer with h.
+//
+// This allows obtaining the hash of the compressed data for content-addressed
+// storage without reading the compressed data again. Use CompressedSum
+// for obtaining the hash after Close. Nil h disables hashing.
+//
+// Reset and ResetWriterParams disable hashing.
+func (zw *Writer) HashCompressed(h hash.Hash) {
+	zw.compressedHash = h
+}
+
+// SetFlushObserver sets fn, which is called with the number of compressed
+// bytes every time they are written to the underlying writer.
+//
+// This allows collecting metrics such as the histogram of flushed block sizes
+// without wrapping the underlying writer. fn is called synchronously,
+// so it must be fast. Nil fn removes the observer.
+//
+// Reset and ResetWriterParams remove the observer.
+func (zw *Writer) SetFlushObserver(fn func(n int)) {
+	zw.flushObserver = fn
+}
+
+// SetFrameEndObserver sets fn, which is called every time a frame
+// is finalized via EndFrame, Close or WriteWithHint.
+//
+// fn is called with the compressed and the uncompressed length of the frame
+// after the frame is written to the underlying writer. The compressed length
+// includes the skippable frame set via SetLeadingMetadata if it is written
+// in front of the frame, so the sum of compressed lengths equals
+// the number of bytes written to the underlying writer. This allows building
+// seek tables for random access to the compressed stream.
+// Nil fn removes the observer.
+//
+// Reset and ResetWriterParams remove the observer.
+func (zw *Writer) SetFrameEndObserver(fn func(compressedLen, uncompressedLen int64)) {
+	zw.frameEndObserver = fn
+}
+
+// CompressedSum returns the hash of the compressed data written to
+// the underlying writer since HashCompressed call.
+//
+// Call it after Close in order to obtain the hash for the whole compressed data.
+// Nil is returned if hashing isn't enabled via HashCompressed.
+func (zw *Writer) CompressedSum() []byte {
+	if zw.compressedHash == nil {
+		return nil
+	}
+	return zw.compressedHash.Sum(nil)
+}
+
+// SetFlushEveryWrite enables flushing zw with SyncFlush after every
+// non-empty Write call.
+//
+// This minimizes the latency for interactive streams, since the data
+// becomes available to the reader immediately after the Write call returns.
+// Every flush closes the current compressed block and issues a Write call
+// to the underlying writer, so this reduces the compression ratio
+// and increases the overhead for small writes. Use SetAutoFlush
+// for bounding the latency with lower overhead.
+//
+// ReadFrom isn't affected by this mode.
+// Reset and ResetWriterParams disable this mode.
+func (zw *Writer) SetFlushEveryWrite(ok bool) {
+	zw.flushEveryWrite = ok
+}
+
+func (zw *Writer) autoFlush(n int) error {
+	if n == 0 || (zw.autoFlushMaxBytes <= 0 && zw.autoFlushMaxInterval <= 0) {
+		return nil
+	}
+	if zw.autoFlushBytes == 0 && zw.autoFlushMaxInterval > 0 {
+		zw.autoFlushStart = zw.autoFlushNow()
+		zw.stopAutoFlushTimer()
+		gen := zw.autoFlushGen
+		zw.autoFlushTimer = zw.autoFlushAfterFunc(zw.autoFlushMaxInterval, func() {
+			zw.timerFlush(gen)
+		})
+	}
+	zw.autoFlushBytes += n
+	if zw.autoFlushMaxBytes > 0 && zw.autoFlushBytes >= zw.autoFlushMaxBytes {
+		return zw.syncFlush()
+	}
+	if zw.autoFlushMaxInterval > 0 && zw.autoFlushNow().Sub(zw.autoFlushStart) >= zw.autoFlushMaxInterval {
+		return zw.syncFlush()
+	}
+	return nil
+}
+
+func (zw *Writer) write(p []byte) (int, error) {
 	pLen := len(p)
 	if pLen == 0 {
 		return 0, nil
 	}
+	zw.frameOpen = true
+
+	if zw.stableInput && pLen > zw.Available() {
+		return zw.writeDirect(p)
+	}
 
 	for {
-		n := copy(zw.inBufGo[zw.inBuf.size:cstreamInBufSize], p)
+		n := copy(zw.inBufGo[zw.inBuf.size:zw.inBufSize], p)
 		zw.inBuf.size += C.size_t(n)
 		p = p[n:]
 		if len(p) == 0 {
 			// Fast path - just copy the data to input buffer.
 			return pLen, nil
 		}
+		if err := zw.flushInBuf(); err != nil {
+			// The data copied to inBuf is retained, so report it
+			// as written in order to avoid duplicate writes on retry.
+			return pLen - len(p), err
+		}
+	}
+}
+
+// SetStableInput enables passing the data from Write calls directly to zstd
+// without copying it into the internal input buffer of zw.
+//
+// This saves a memory copy per written byte for large Write calls.
+// Write calls with the data fitting the free space in the internal input
+// buffer are buffered as usual, since passing small chunks to zstd
+// is slower than copying them. See Available.
+//
+// p passed to Write mustn't be modified until Write returns. This is
+// the usual io.Writer contract, since zstd copies the data into its own
+// window buffer before Write returns. zstd's ZSTD_c_stableInBuffer mode
+// isn't used, since it requires the whole frame to reside in a single
+// unmodified buffer until the frame end, which cannot be guaranteed
+// for a sequence of Write calls.
+//
+// Reset and ResetWriterParams disable stable input.
+func (zw *Writer) SetStableInput(ok bool) {
+	zw.stableInput = ok
+}
+
+// writeDirect compresses p without copying it to inBuf.
+func (zw *Writer) writeDirect(p []byte) (int, error) {
+	if err := zw.commitGrow(false); err != nil {
+		return 0, err
+	}
+	// Compress the buffered data first in order to preserve
+	// the order of the data.
+	for zw.inBuf.size > 0 {
 		if err := zw.flushInBuf(); err != nil {
 			return 0, err
 		}
 	}
+	if zw.leadingMetadata != nil {
+		if err := zw.writeLeadingMetadata(); err != nil {
+			return 0, err
+		}
+	}
+
+	pos := C.size_t(0)
+	for int(pos) < len(p) {
+		prevPos := pos
+		result := C.ZSTD_compressStream_input_wrapper(
+			C.uintptr_t(uintptr(unsafe.Pointer(zw.cs))),
+			C.uintptr_t(uintptr(unsafe.Pointer(zw.outBuf))),
+			C.uintptr_t(uintptr(unsafe.Pointer(&p[0]))),
+			C.size_t(len(p)),
+			&pos)
+		// Prevent from GC'ing of p during CGO call above.
+		runtime.KeepAlive(p)
+		if err := checkError("ZSTD_compressStream", result); err != nil {
+			return int(pos), err
+		}
+		if zw.outBuf.size-zw.outBuf.pos > zw.outBuf.pos && prevPos != pos {
+			// There is enough space in outBuf and the last compression
+			// succeeded, so don't flush outBuf yet.
+			continue
+		}
+		if err := zw.flushOutBuf(); err != nil {
+			return int(pos), err
+		}
+	}
+	return len(p), nil
+}
+
+// Available returns the number of bytes, which may be written to zw
+// before the internal input buffer is compressed.
+//
+// It may be used for choosing chunk sizes for Write calls in order
+// to minimize the number of compression calls.
+func (zw *Writer) Available() int {
+	return int(zw.inBufSize - zw.inBuf.size)
 }
 
 func (zw *Writer) flushInBuf() error {
+	if err := zw.commitGrow(false); err != nil {
+		return err
+	}
+	if zw.leadingMetadata != nil {
+		if err := zw.writeLeadingMetadata(); err != nil {
+			return err
+		}
+	}
+
 	prevInBufPos := zw.inBuf.pos
 	result := C.ZSTD_compressStream_wrapper(
 		C.uintptr_t(uintptr(unsafe.Pointer(zw.cs))),
 		C.uintptr_t(uintptr(unsafe.Pointer(zw.outBuf))),
 		C.uintptr_t(uintptr(unsafe.Pointer(zw.inBuf))))
-	ensureNoError("ZSTD_compressStream", result)
+	if err := checkError("ZSTD_compressStream", result); err != nil {
+		return err
+	}
 
 	// Move the remaining data to the start of inBuf.
-	copy(zw.inBufGo[:cstreamInBufSize], zw.inBufGo[zw.inBuf.pos:zw.inBuf.size])
+	copy(zw.inBufGo[:zw.inBufSize], zw.inBufGo[zw.inBuf.pos:zw.inBuf.size])
 	zw.inBuf.size -= zw.inBuf.pos
 	zw.inBuf.pos = 0
 
@@ -346,27 +1363,205 @@ func (zw *Writer) flushInBuf() error {
 	return zw.flushOutBuf()
 }
 
+// SetLeadingMetadata sets the skippable frame with the given magicVariant
+// and data, which is written at the start of the stream before
+// the first compressed frame.
+//
+// This allows attaching application-defined metadata such as a key ID
+// or a nonce to the stream. Reader skips the frame and exposes its contents
+// via Reader.Metadata. Other zstd decoders skip the frame.
+//
+// magicVariant must be in the range [0..15]. Reader.Metadata returns only
+// up to 1MiB of data, bigger frames are skipped by Reader.
+// SetLeadingMetadata must be called before writing data to zw.
+// Reset and ResetWriterParams drop the metadata.
+func (zw *Writer) SetLeadingMetadata(magicVariant uint32, data []byte) {
+	if magicVariant > 15 {
+		panic(fmt.Errorf("BUG: magicVariant must be in the range [0..15]; got %d", magicVariant))
+	}
+	zw.leadingMetadata = appendSkippableFrame(nil, magicVariant, data)
+}
+
+// writeLeadingMetadata writes the skippable frame set by SetLeadingMetadata
+// to outBuf.
+func (zw *Writer) writeLeadingMetadata() error {
+	frame := zw.leadingMetadata
+	zw.leadingMetadata = nil
+	for {
+		n := copy(zw.outBufGo[zw.outBuf.pos:zw.outBuf.size], frame)
+		zw.outBuf.pos += C.size_t(n)
+		frame = frame[n:]
+		if len(frame) == 0 {
+			return nil
+		}
+		if err := zw.flushOutBuf(); err != nil {
+			// Retain the unwritten part of the frame, so it is written
+			// if the caller retries Flush.
+			zw.leadingMetadata = frame
+			return err
+		}
+	}
+}
+
 func (zw *Writer) flushOutBuf() error {
 	if zw.outBuf.pos == 0 {
 		// Nothing to flush.
 		return nil
 	}
 
+	if zw.w == nil {
+		return ErrNilWriter
+	}
+
 	outBuf := zw.outBufGo[:zw.outBuf.pos]
 	n, err := zw.w.Write(outBuf)
 	zw.outBuf.pos = 0
+	if n > 0 {
+		zw.bytesOut += int64(n)
+	}
+	if zw.compressedHash != nil && n > 0 {
+		zw.compressedHash.Write(outBuf[:n])
+	}
+	if zw.flushObserver != nil && n > 0 {
+		zw.flushObserver(n)
+	}
+	if len(zw.sinks) > 0 && n > 0 {
+		zw.writeSinks(outBuf[:n])
+	}
 	if err != nil {
+		if n >= 0 && n < len(outBuf) {
+			// Retain the data, which wasn't written to the underlying writer,
+			// so the stream remains valid if the caller retries Flush
+			// after a temporary error such as a write timeout.
+			zw.outBuf.pos = C.size_t(copy(outBuf, outBuf[n:]))
+		}
 		return fmt.Errorf("cannot flush internal buffer to the underlying writer: %s", err)
 	}
 	if n != len(outBuf) {
-		panic(fmt.Errorf("BUG: the underlying writer violated io.Writer contract and didn't return error after writing incomplete data; written %d bytes; want %d bytes",
+		return newUnexpectedError(fmt.Errorf("the underlying writer violated io.Writer contract and didn't return error after writing incomplete data; written %d bytes; want %d bytes",
 			n, len(outBuf)))
 	}
 	return nil
 }
 
+// AddSink adds w to the list of additional writers receiving
+// the compressed data.
+//
+// The compressed data is written to the underlying writer and then
+// to the sinks in the order they were added, so the data is compressed
+// only once for all the destinations. Every sink receives exactly the data
+// successfully written to the underlying writer.
+//
+// If a sink returns an error, then it stops receiving the data, since
+// its compressed stream is broken, while the rest of destinations continue
+// receiving the data. The errors from the sinks failed since the previous
+// Flush or Close call are returned from the next Flush or Close call
+// after all the data is flushed, so sink errors don't interrupt
+// the compressed stream for the rest of destinations.
+//
+// Reset and ResetWriterParams remove all the sinks.
+func (zw *Writer) AddSink(w io.Writer) {
+	zw.sinks = append(zw.sinks, writerSink{
+		w: w,
+	})
+}
+
+type writerSink struct {
+	w      io.Writer
+	failed bool
+}
+
+func (zw *Writer) writeSinks(p []byte) {
+	for i := range zw.sinks {
+		ws := &zw.sinks[i]
+		if ws.failed {
+			continue
+		}
+		n, err := ws.w.Write(p)
+		if err == nil && n != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			ws.failed = true
+			zw.sinkErrors = append(zw.sinkErrors, fmt.Sprintf("sink #%d: %s", i, err))
+		}
+	}
+}
+
+// takeSinksError returns the error for the sinks failed since
+// the previous takeSinksError call.
+func (zw *Writer) takeSinksError() error {
+	if len(zw.sinkErrors) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("cannot write compressed data to sinks: %s", strings.Join(zw.sinkErrors, "; "))
+	zw.sinkErrors = zw.sinkErrors[:0]
+	return err
+}
+
 // Flush flushes the remaining data from zw to the underlying writer.
+//
+// Flush is equivalent to SyncFlush.
 func (zw *Writer) Flush() error {
+	return zw.SyncFlush()
+}
+
+// SyncFlush compresses all the data written to zw and flushes
+// the compressed data to the underlying writer.
+//
+// The decompressor reading from the underlying writer is able to decompress
+// all the data written to zw before SyncFlush after it returns.
+// This slightly reduces the compression ratio, since the current
+// compressed block is finished by SyncFlush.
+func (zw *Writer) SyncFlush() error {
+	if zw.lockAutoFlush() {
+		defer zw.autoFlushLock.Unlock()
+	}
+	return zw.syncFlush()
+}
+
+func (zw *Writer) syncFlush() error {
+	if zw.closed {
+		return ErrClosed
+	}
+	if err := zw.takeAutoFlushError(); err != nil {
+		return err
+	}
+	if err := zw.flush(); err != nil {
+		return err
+	}
+	return zw.takeSinksError()
+}
+
+// OutputFlush writes the already compressed data buffered in zw
+// to the underlying writer.
+//
+// Unlike SyncFlush, it doesn't compress the buffered data and doesn't
+// finish the current compressed block, so the decompressor reading from
+// the underlying writer may be unable to decompress some of the data
+// written to zw before OutputFlush. OutputFlush doesn't affect
+// the compression ratio, so it may be used for bounding the amount
+// of memory occupied by compressed data buffered in zw.
+func (zw *Writer) OutputFlush() error {
+	if zw.lockAutoFlush() {
+		defer zw.autoFlushLock.Unlock()
+	}
+	if zw.closed {
+		return ErrClosed
+	}
+	if err := zw.flushOutBuf(); err != nil {
+		return err
+	}
+	return zw.takeSinksError()
+}
+
+func (zw *Writer) flush() error {
+	if zw.leadingMetadata != nil {
+		if err := zw.writeLeadingMetadata(); err != nil {
+			return err
+		}
+	}
+
 	// Flush inBuf.
 	for zw.inBuf.size > 0 {
 		if err := zw.flushInBuf(); err != nil {
@@ -379,12 +1574,15 @@ func (zw *Writer) Flush() error {
 		result := C.ZSTD_flushStream_wrapper(
 			C.uintptr_t(uintptr(unsafe.Pointer(zw.cs))),
 			C.uintptr_t(uintptr(unsafe.Pointer(zw.outBuf))))
-		ensureNoError("ZSTD_flushStream", result)
+		if err := checkError("ZSTD_flushStream", result); err != nil {
+			return err
+		}
 		if err := zw.flushOutBuf(); err != nil {
 			return err
 		}
 		if result == 0 {
 			// No more data left in the internal buffer.
+			zw.resetAutoFlushBytes()
 			return nil
 		}
 	}
@@ -394,21 +1592,280 @@ func (zw *Writer) Flush() error {
 // to the underlying writer.
 //
 // It doesn't close the underlying writer passed to New* functions.
+//
+// Write, ReadFrom, Flush and EndFrame return ErrClosed after successful
+// Close. Subsequent Close calls return nil. Close may be retried
+// if it returns an error. Call Reset* for writing a new compressed stream.
 func (zw *Writer) Close() error {
-	if err := zw.Flush(); err != nil {
+	if zw.lockAutoFlush() {
+		defer zw.autoFlushLock.Unlock()
+	}
+	if zw.closed {
+		return nil
+	}
+	if err := zw.endFrame(); err != nil {
 		return err
 	}
+	zw.closed = true
+	zw.stopAutoFlushTimer()
+	return nil
+}
+
+// CloseWithStats closes zw and returns the number of compressed bytes
+// written to the underlying writer since zw creation or the last Reset.
+//
+// Use BytesIn for obtaining the number of uncompressed bytes
+// written to zw, e.g. for calculating the compression ratio.
+func (zw *Writer) CloseWithStats() (bytesOut int64, err error) {
+	err = zw.Close()
+	return zw.bytesOut, err
+}
+
+// BytesIn returns the number of uncompressed bytes written to zw
+// since zw creation or the last Reset.
+func (zw *Writer) BytesIn() int64 {
+	return zw.bytesIn
+}
+
+// EndFrame finalizes the current frame and flushes all the compressed data
+// to the underlying writer.
+//
+// The data written to zw after EndFrame goes to the next frame.
+func (zw *Writer) EndFrame() error {
+	if zw.lockAutoFlush() {
+		defer zw.autoFlushLock.Unlock()
+	}
+	return zw.endFrame()
+}
+
+func (zw *Writer) endFrame() error {
+	if zw.closed {
+		return ErrClosed
+	}
+	if err := zw.takeAutoFlushError(); err != nil {
+		return err
+	}
+	if err := zw.commitGrow(true); err != nil {
+		return err
+	}
+	if err := zw.flush(); err != nil {
+		return err
+	}
+	return zw.endStream()
+}
 
+func (zw *Writer) endStream() error {
+	if zw.pledged && zw.pledgeRemaining() != 0 {
+		return ErrPledgedSizeMismatch
+	}
 	for {
 		result := C.ZSTD_endStream_wrapper(
 			C.uintptr_t(uintptr(unsafe.Pointer(zw.cs))),
 			C.uintptr_t(uintptr(unsafe.Pointer(zw.outBuf))))
-		ensureNoError("ZSTD_endStream", result)
+		if err := checkError("ZSTD_endStream", result); err != nil {
+			return err
+		}
 		if err := zw.flushOutBuf(); err != nil {
 			return err
 		}
 		if result == 0 {
-			return nil
+			zw.frameOpen = false
+			if zw.frameEndObserver != nil {
+				zw.frameEndObserver(zw.bytesOut-zw.frameStartOut, zw.bytesIn-zw.frameStartIn)
+			}
+			zw.frameStartIn = zw.bytesIn
+			zw.frameStartOut = zw.bytesOut
+			zw.pledged = false
+			return zw.takeSinksError()
 		}
 	}
 }
+
+// WriteWithHint writes p to zw and finalizes the current frame
+// if isLastOfFrame is set.
+//
+// WriteWithHint(p, true) is equivalent to Write(p) followed by EndFrame,
+// but it compresses the buffered data together with the frame end,
+// so the last block of the frame isn't closed by an intermediate flush.
+// This reduces the overhead for streams consisting of many small frames.
+//
+// WriteWithHint(p, false) is equivalent to Write(p).
+func (zw *Writer) WriteWithHint(p []byte, isLastOfFrame bool) (int, error) {
+	if zw.lockAutoFlush() {
+		defer zw.autoFlushLock.Unlock()
+	}
+	n, err := zw.writeData(p)
+	if err != nil || !isLastOfFrame {
+		return n, err
+	}
+	return n, zw.endFrameWithInBuf()
+}
+
+// endFrameWithInBuf compresses inBuf and finalizes the current frame
+// without flushing the internal buffer with ZSTD_flushStream, since
+// the flush closes the current block.
+func (zw *Writer) endFrameWithInBuf() error {
+	if err := zw.commitGrow(true); err != nil {
+		return err
+	}
+	if zw.leadingMetadata != nil {
+		if err := zw.writeLeadingMetadata(); err != nil {
+			return err
+		}
+	}
+	for zw.inBuf.size > 0 {
+		if err := zw.flushInBuf(); err != nil {
+			return err
+		}
+	}
+	zw.resetAutoFlushBytes()
+	return zw.endStream()
+}
+
+// MemoryUsage returns the number of bytes of memory occupied by zw.
+//
+// This includes the zstd compression context and the internal buffers of zw.
+// The compression context is allocated on the first write to zw and it may
+// grow with the window size and other compression parameters. It isn't
+// shrunk by Reset*, so MemoryUsage may be used for detecting heavy writers,
+// which must be released instead of re-using them.
+// See also WriterPool.MaxWriterMemory.
+func (zw *Writer) MemoryUsage() int {
+	if zw.cs == nil {
+		return 0
+	}
+	n := int(C.ZSTD_sizeof_CStream_wrapper(C.uintptr_t(uintptr(unsafe.Pointer(zw.cs)))))
+	n += int(C.sizeof_ZSTD_inBuffer + C.sizeof_ZSTD_outBuffer)
+	if zw.inBufGo != nil {
+		n += int(zw.inBufSize + zw.outBufSize)
+	}
+	return n
+}
+
+// FrameOpen returns true if data has been written to the current frame
+// since the last EndFrame, Close or Reset call.
+func (zw *Writer) FrameOpen() bool {
+	return zw.frameOpen
+}
+
+// Grow tells zw that n bytes of uncompressed data are going to be written
+// to the current frame.
+//
+// n is pledged as the content size of the frame, so it is stored
+// in the frame header like with PledgeSize. The internal buffers of zw
+// are grown to hold up to 16MiB of the frame, so big frames are compressed
+// in a few large chunks and written to the underlying writer with a few
+// Write calls. Reset* shrinks the buffers back.
+//
+// The pledge is passed to zstd when the buffered data is compressed,
+// so overestimating n is safe if the frame fits the buffers: the actual
+// content size is stored if less than n bytes are written to the frame,
+// and the content size isn't stored if more than n bytes are written.
+// The pledge becomes exact like with PledgeSize when the frame doesn't
+// fit the buffers, i.e. when n exceeds 16MiB, or when the frame
+// is flushed with Flush. An exact pledge allows the decompressor
+// to verify the decompressed size.
+//
+// An error is returned if data has been already written to the current frame.
+func (zw *Writer) Grow(n int) error {
+	if err := zw.checkPledge(int64(n)); err != nil {
+		return err
+	}
+	bufSize := n + 1
+	if n >= maxGrowBufSize {
+		bufSize = maxGrowBufSize
+	}
+	if C.size_t(bufSize) > zw.inBufSize {
+		outBufSize := C.ZSTD_compressBound(C.size_t(bufSize))
+		if outBufSize < zw.outBufSize {
+			outBufSize = zw.outBufSize
+		}
+		zw.resizeBuffers(C.size_t(bufSize), outBufSize)
+	}
+	zw.pledged = true
+	zw.pledgedSize = int64(n)
+	zw.growPending = true
+	return nil
+}
+
+// maxGrowBufSize is the maximum size of inBuf set by Grow.
+const maxGrowBufSize = 16 * 1024 * 1024
+
+// commitGrow passes the size pledged by Grow to zstd before the compression
+// of the frame data.
+//
+// frameEnd must be set if the frame is going to be finalized. The whole frame
+// is buffered in inBuf in this case, so its actual size is pledged.
+func (zw *Writer) commitGrow(frameEnd bool) error {
+	if !zw.growPending {
+		return nil
+	}
+	zw.growPending = false
+	n := zw.bytesIn - zw.frameStartIn
+	if n > zw.pledgedSize {
+		zw.pledged = false
+		return nil
+	}
+	if frameEnd {
+		zw.pledgedSize = n
+	}
+	if err := zw.setPledgedSrcSize(uint64(zw.pledgedSize)); err != nil {
+		zw.pledged = false
+		return err
+	}
+	return nil
+}
+
+// dropGrow drops the size pledged by Grow, which hasn't been passed
+// to zstd yet.
+func (zw *Writer) dropGrow() {
+	zw.growPending = false
+	zw.pledged = false
+}
+
+// ErrPledgedSizeMismatch is returned from Writer methods when the size
+// of the frame differs from the size set via Writer.PledgeSize.
+var ErrPledgedSizeMismatch = errors.New("gozstd: the frame size doesn't match the pledged size")
+
+// PledgeSize tells zw that exactly n bytes of uncompressed data are going
+// to be written to the current frame.
+//
+// n is stored in the frame header as the content size, so the decompressor
+// may preallocate the output buffer and verify the decompressed size.
+// zstd also tunes the compression parameters for n like Grow does.
+//
+// n must be exact. Write and ReadFrom return ErrPledgedSizeMismatch
+// for the data past n bytes. EndFrame and Close return ErrPledgedSizeMismatch
+// if less than n bytes have been written to the frame; the frame may be
+// finalized after writing the missing data. The pledge applies only
+// to the current frame.
+//
+// An error is returned if data has been already written to the current frame.
+func (zw *Writer) PledgeSize(n int64) error {
+	if err := zw.checkPledge(n); err != nil {
+		return err
+	}
+	if err := zw.setPledgedSrcSize(uint64(n)); err != nil {
+		return err
+	}
+	zw.pledged = true
+	zw.pledgedSize = n
+	zw.growPending = false
+	return nil
+}
+
+func (zw *Writer) checkPledge(n int64) error {
+	if n < 0 {
+		return fmt.Errorf("the pledged size cannot be negative; got %d", n)
+	}
+	if zw.frameOpen {
+		return fmt.Errorf("the size must be pledged before writing data to the frame")
+	}
+	return nil
+}
+
+// pledgeRemaining returns the number of bytes, which may be written
+// to the current frame according to PledgeSize.
+func (zw *Writer) pledgeRemaining() int64 {
+	return zw.pledgedSize - (zw.bytesIn - zw.frameStartIn)
+}
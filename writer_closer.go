@@ -0,0 +1,101 @@
+package gozstd
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// WriteCloser is a Writer, which closes the underlying writer on Close.
+//
+// WriteCloser must be created via NewWriterCloser.
+type WriteCloser struct {
+	*Writer
+
+	wc     io.WriteCloser
+	closed bool
+}
+
+// NewWriterCloser returns new zstd writer writing compressed data to wc
+// at the given compression level.
+//
+// Unlike Writer.Close, the returned writer's Close finalizes the compressed
+// stream and then closes wc, so an underlying file isn't leaked if the caller
+// forgets to close it. wc is closed only once, even if Close is called
+// multiple times.
+//
+// Call Release when the WriteCloser is no longer needed.
+func NewWriterCloser(wc io.WriteCloser, compressionLevel int) *WriteCloser {
+	return &WriteCloser{
+		Writer: NewWriterLevel(wc, compressionLevel),
+		wc:     wc,
+	}
+}
+
+// Close finalizes the compressed stream and closes the underlying writer.
+//
+// The underlying writer is closed even if the compressed stream cannot be
+// finalized.
+func (zwc *WriteCloser) Close() error {
+	if zwc.closed {
+		return nil
+	}
+	zwc.closed = true
+	err := zwc.Writer.Close()
+	if closeErr := zwc.wc.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("cannot close the underlying writer: %s", closeErr)
+	}
+	return err
+}
+
+// Reset resets zwc to write to wc using the given dictionary cd
+// and the given compressionLevel.
+//
+// The previous underlying writer isn't closed, so call Close before Reset
+// in order to finalize the stream and to close the previous underlying writer.
+func (zwc *WriteCloser) Reset(wc io.WriteCloser, cd *CDict, compressionLevel int) {
+	zwc.Writer.Reset(wc, cd, compressionLevel)
+	zwc.resetWriteCloser(wc)
+}
+
+// ResetNoDict resets zwc to write to wc without a dictionary.
+//
+// See Writer.ResetNoDict for details. The previous underlying writer
+// isn't closed.
+func (zwc *WriteCloser) ResetNoDict(wc io.WriteCloser) {
+	zwc.Writer.ResetNoDict(wc)
+	zwc.resetWriteCloser(wc)
+}
+
+// ResetWriterParams resets zwc to write to wc using the given set of parameters.
+//
+// The previous underlying writer isn't closed.
+func (zwc *WriteCloser) ResetWriterParams(wc io.WriteCloser, params *WriterParams) {
+	zwc.Writer.ResetWriterParams(wc, params)
+	zwc.resetWriteCloser(wc)
+}
+
+func (zwc *WriteCloser) resetWriteCloser(wc io.WriteCloser) {
+	zwc.wc = wc
+	zwc.closed = false
+}
+
+// OpenAppendWriter opens the file at the given path for appending
+// and returns zstd writer adding a new frame to the end of the file
+// at the given compression level.
+//
+// The file is created if it doesn't exist. zstd streams may contain
+// concatenated frames, so the file remains a valid zstd stream after
+// the returned writer is closed if the file contained complete frames
+// before the OpenAppendWriter call. This is useful for log rotation
+// and incremental archives.
+//
+// Close the returned writer in order to finalize the frame and to close
+// the file. Call Release when the WriteCloser is no longer needed.
+func OpenAppendWriter(path string, compressionLevel int) (*WriteCloser, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterCloser(f, compressionLevel), nil
+}
@@ -0,0 +1,99 @@
+package gozstd
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// WriterPool is a pool of Writers sharing the same set of parameters.
+//
+// A single WriterPool may be used from concurrently running goroutines.
+type WriterPool struct {
+	// Params is an optional set of parameters for the Writers obtained
+	// from the pool. Nil Params means default parameters.
+	//
+	// Params mustn't be modified after the first call to Get.
+	Params *WriterParams
+
+	// IdleTimeout is an optional duration after which the buffers
+	// of the Writer sitting idle in the pool are freed.
+	//
+	// Every Writer holds ~256KB of buffers, so this may save a lot of memory
+	// for big pools after traffic bursts. The buffers are allocated again
+	// when the Writer is obtained from the pool, so this adds a little
+	// latency to Get. Zero IdleTimeout means the buffers are never freed.
+	//
+	// IdleTimeout mustn't be modified after the first call to Get.
+	IdleTimeout time.Duration
+
+	// MaxWriterMemory is an optional limit on the memory occupied
+	// by the Writer returned to the pool via Put.
+	//
+	// Writers occupying more memory than MaxWriterMemory are released
+	// by Put instead of returning them to the pool. See Writer.MemoryUsage
+	// for details. This prevents from holding heavy compression contexts
+	// in the pool after compressing the data with big windows.
+	// Zero MaxWriterMemory means the Writers are always returned to the pool.
+	//
+	// MaxWriterMemory mustn't be modified after the first call to Get.
+	MaxWriterMemory int
+
+	p sync.Pool
+}
+
+// Get returns a Writer from wp writing compressed data to w.
+//
+// Return the Writer to wp via Put when it is no longer needed.
+func (wp *WriterPool) Get(w io.Writer) *Writer {
+	v := wp.p.Get()
+	if v == nil {
+		return NewWriterParams(w, wp.Params)
+	}
+	zw := v.(*Writer)
+	if wp.IdleTimeout > 0 {
+		zw.idleLock.Lock()
+		zw.idle = false
+		zw.idleTimer.Stop()
+		zw.allocBuffers()
+		zw.idleLock.Unlock()
+	}
+	// zw has been already reset in Put, so just set the new destination.
+	zw.w = w
+	return zw
+}
+
+// Put returns zw to wp.
+//
+// Call zw.Close before returning it to the pool, since Put drops
+// the data buffered in zw. zw cannot be used after returning it to the pool.
+func (wp *WriterPool) Put(zw *Writer) {
+	if wp.MaxWriterMemory > 0 && zw.MemoryUsage() > wp.MaxWriterMemory {
+		zw.Release()
+		return
+	}
+	params := wp.Params
+	if params == nil {
+		params = &WriterParams{}
+	}
+	zw.ResetWriterParams(nil, params)
+	if wp.IdleTimeout > 0 {
+		zw.idleLock.Lock()
+		zw.idle = true
+		if zw.idleTimer == nil {
+			zw.idleTimer = time.AfterFunc(wp.IdleTimeout, zw.freeIdleBuffers)
+		} else {
+			zw.idleTimer.Reset(wp.IdleTimeout)
+		}
+		zw.idleLock.Unlock()
+	}
+	wp.p.Put(zw)
+}
+
+func (zw *Writer) freeIdleBuffers() {
+	zw.idleLock.Lock()
+	if zw.idle {
+		zw.freeBuffers()
+	}
+	zw.idleLock.Unlock()
+}
@@ -0,0 +1,175 @@
+package gozstd
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWriterPool(t *testing.T) {
+	var wp WriterPool
+
+	// Run serial test.
+	if err := testWriterPoolSerial(&wp); err != nil {
+		t.Fatalf("error in serial test: %s", err)
+	}
+
+	// Run concurrent test.
+	ch := make(chan error, 10)
+	for i := 0; i < cap(ch); i++ {
+		go func() {
+			ch <- testWriterPoolSerial(&wp)
+		}()
+	}
+	for i := 0; i < cap(ch); i++ {
+		select {
+		case err := <-ch:
+			if err != nil {
+				t.Fatalf("error in concurrent test: %s", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout in concurrent test")
+		}
+	}
+}
+
+func TestWriterPoolParams(t *testing.T) {
+	wp := &WriterPool{
+		Params: &WriterParams{
+			CompressionLevel: 10,
+			WindowLog:        14,
+		},
+	}
+	if err := testWriterPoolSerial(wp); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func testWriterPoolSerial(wp *WriterPool) error {
+	for i := 0; i < 100; i++ {
+		var bb bytes.Buffer
+		zw := wp.Get(&bb)
+		s := newTestString(i*100+1, 20)
+		if _, err := zw.Write([]byte(s)); err != nil {
+			return fmt.Errorf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("cannot close zw: %s", err)
+		}
+		wp.Put(zw)
+
+		plainData, err := Decompress(nil, bb.Bytes())
+		if err != nil {
+			return fmt.Errorf("cannot decompress data: %s", err)
+		}
+		if string(plainData) != s {
+			return fmt.Errorf("unexpected data decompressed; got\n%X; want\n%X", plainData, s)
+		}
+	}
+	return nil
+}
+
+func TestWriterPoolIdleTimeout(t *testing.T) {
+	wp := &WriterPool{
+		IdleTimeout: 10 * time.Millisecond,
+	}
+
+	src := []byte(newTestString(128*1024, 3))
+	roundTrip := func(zw *Writer, bb *bytes.Buffer) {
+		t.Helper()
+		if _, err := zw.Write(src); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw: %s", err)
+		}
+		plainData, err := Decompress(nil, bb.Bytes())
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		if !bytes.Equal(plainData, src) {
+			t.Fatalf("unexpected data decompressed")
+		}
+	}
+
+	var bb bytes.Buffer
+	zw := wp.Get(&bb)
+	roundTrip(zw, &bb)
+	wp.Put(zw)
+
+	// Wait until the idle buffers are freed.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		zw.idleLock.Lock()
+		freed := zw.inBufGo == nil && zw.outBufGo == nil
+		zw.idleLock.Unlock()
+		if freed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout when waiting for idle buffers to be freed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Simulate obtaining the same writer from the pool, since sync.Pool
+	// doesn't guarantee returning it. The writer must work after
+	// buffers are allocated again.
+	zw.idleLock.Lock()
+	zw.idle = false
+	zw.allocBuffers()
+	zw.idleLock.Unlock()
+	bb.Reset()
+	zw.w = &bb
+	roundTrip(zw, &bb)
+	wp.Put(zw)
+
+	// Writers obtained from the pool must have buffers.
+	bb.Reset()
+	zw = wp.Get(&bb)
+	if zw.inBufGo == nil || zw.outBufGo == nil {
+		t.Fatalf("expecting allocated buffers for the writer obtained from the pool")
+	}
+	roundTrip(zw, &bb)
+	wp.Put(zw)
+}
+
+func TestWriterPoolMaxWriterMemory(t *testing.T) {
+	params := &WriterParams{
+		WindowLog: 23,
+	}
+	data := []byte(newTestString(1024*1024, 10))
+	probe := NewWriterParams(&bytes.Buffer{}, params)
+	if _, err := probe.Write(data); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := probe.Close(); err != nil {
+		t.Fatalf("cannot close writer: %s", err)
+	}
+	memoryUsage := probe.MemoryUsage()
+	probe.Release()
+
+	f := func(maxWriterMemory int, mustRelease bool) {
+		t.Helper()
+		wp := &WriterPool{
+			Params:          params,
+			MaxWriterMemory: maxWriterMemory,
+		}
+		zw := wp.Get(&bytes.Buffer{})
+		if _, err := zw.Write(data); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close writer: %s", err)
+		}
+		wp.Put(zw)
+		if released := zw.cs == nil; released != mustRelease {
+			t.Fatalf("unexpected writer state for MaxWriterMemory=%d and MemoryUsage=%d; released=%v; want %v",
+				maxWriterMemory, memoryUsage, released, mustRelease)
+		}
+	}
+	f(0, false)
+	f(memoryUsage, false)
+	f(memoryUsage-1, true)
+}
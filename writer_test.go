@@ -2,12 +2,15 @@ package gozstd
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
+	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -496,3 +499,2112 @@ func TestWriterBig(t *testing.T) {
 		t.Fatalf("unequal writtenBB and readBB\nwrittenBB=\n%X\nreadBB=\n%X", writtenBB.Bytes(), readBB.Bytes())
 	}
 }
+
+func TestWriterForceAttachDict(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 1e4; i++ {
+		sample := []byte(fmt.Sprintf("this is a sample number %d", i))
+		samples = append(samples, sample)
+	}
+	dict := BuildDict(samples, 8*1024)
+
+	cd, err := NewCDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create CDict: %s", err)
+	}
+	defer cd.Release()
+
+	dd, err := NewDDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create DDict: %s", err)
+	}
+	defer dd.Release()
+
+	src := []byte("this is a sample number 12345, this is a sample number 42")
+	for _, mode := range []DictAttachMode{DictAttachDefault, DictForceAttach, DictForceCopy, DictForceLoad} {
+		var bb bytes.Buffer
+		zw := NewWriterParams(&bb, &WriterParams{
+			Dict:            cd,
+			ForceAttachDict: mode,
+		})
+		for i := 0; i < 3; i++ {
+			bb.Reset()
+			if _, err := zw.Write(src); err != nil {
+				t.Fatalf("cannot write data in mode %d: %s", mode, err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatalf("cannot close zw in mode %d: %s", mode, err)
+			}
+			plainData, err := DecompressDict(nil, bb.Bytes(), dd)
+			if err != nil {
+				t.Fatalf("cannot decompress data in mode %d: %s", mode, err)
+			}
+			if !bytes.Equal(plainData, src) {
+				t.Fatalf("unexpected data decompressed in mode %d; got\n%q; want\n%q", mode, plainData, src)
+			}
+			zw.Reset(&bb, cd, 0)
+		}
+		zw.Release()
+	}
+}
+
+func TestWriterPanicOnError(t *testing.T) {
+	data := []byte(newTestString(1000, 20))
+
+	// The default mode must panic on unexpected errors.
+	func() {
+		var bb bytes.Buffer
+		zw := NewWriter(&bb)
+		defer zw.Release()
+		if err := zw.setPledgedSrcSize(1); err != nil {
+			t.Fatalf("cannot set pledged src size: %s", err)
+		}
+		defer func() {
+			r := recover()
+			if r == nil {
+				t.Fatalf("expecting panic")
+			}
+			if !strings.Contains(fmt.Sprintf("%s", r), "BUG: unexpected error in ") {
+				t.Fatalf("unexpected panic: %s", r)
+			}
+		}()
+		if _, err := zw.Write(data); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		_ = zw.Close()
+	}()
+
+	// Unexpected errors must be returned after SetPanicOnError(false).
+	SetPanicOnError(false)
+	defer SetPanicOnError(true)
+
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+	if err := zw.setPledgedSrcSize(1); err != nil {
+		t.Fatalf("cannot set pledged src size: %s", err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err := zw.Close()
+	if err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if !strings.Contains(err.Error(), "unexpected error in ") {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The Writer must be usable after Reset.
+	bb.Reset()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("cannot write data after Reset: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw after Reset: %s", err)
+	}
+	plainData, err := Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if !bytes.Equal(plainData, data) {
+		t.Fatalf("unexpected data decompressed; got\n%X; want\n%X", plainData, data)
+	}
+}
+
+func TestWriterAvailable(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+
+	bufSize := int(cstreamInBufSize)
+	if n := zw.Available(); n != bufSize {
+		t.Fatalf("unexpected Available for new writer; got %d; want %d", n, bufSize)
+	}
+
+	data := []byte(newTestString(100, 20))
+	for i := 1; i <= 5; i++ {
+		if _, err := zw.Write(data); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if n := zw.Available(); n != bufSize-i*len(data) {
+			t.Fatalf("unexpected Available after writing %d bytes; got %d; want %d", i*len(data), n, bufSize-i*len(data))
+		}
+	}
+
+	if err := zw.Flush(); err != nil {
+		t.Fatalf("cannot flush zw: %s", err)
+	}
+	if n := zw.Available(); n != bufSize {
+		t.Fatalf("unexpected Available after Flush; got %d; want %d", n, bufSize)
+	}
+
+	// Fill the buffer completely.
+	buf := make([]byte, zw.Available())
+	if _, err := zw.Write(buf); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if n := zw.Available(); n != 0 {
+		t.Fatalf("unexpected Available after filling the buffer; got %d; want 0", n)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	if n := zw.Available(); n != bufSize {
+		t.Fatalf("unexpected Available after Close; got %d; want %d", n, bufSize)
+	}
+}
+
+func TestWriterStrategy(t *testing.T) {
+	var bb bytes.Buffer
+	for bb.Len() < 256*1024 {
+		fmt.Fprintf(&bb, "strategy line %d, value %d\n", bb.Len(), rand.Intn(1000))
+	}
+	src := bb.Bytes()
+
+	compressWithStrategy := func(strategy Strategy) []byte {
+		t.Helper()
+		var bb bytes.Buffer
+		zw := NewWriterParams(&bb, &WriterParams{
+			Strategy: strategy,
+		})
+		defer zw.Release()
+		if _, err := zw.Write(src); err != nil {
+			t.Fatalf("cannot write data with strategy %d: %s", strategy, err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw with strategy %d: %s", strategy, err)
+		}
+		plainData, err := Decompress(nil, bb.Bytes())
+		if err != nil {
+			t.Fatalf("cannot decompress data with strategy %d: %s", strategy, err)
+		}
+		if !bytes.Equal(plainData, src) {
+			t.Fatalf("unexpected data decompressed with strategy %d", strategy)
+		}
+		return bb.Bytes()
+	}
+
+	strategies := []Strategy{
+		StrategyFast, StrategyDFast, StrategyGreedy, StrategyLazy, StrategyLazy2,
+		StrategyBtlazy2, StrategyBtopt, StrategyBtultra, StrategyBtultra2,
+	}
+	for _, strategy := range strategies {
+		compressWithStrategy(strategy)
+	}
+
+	cdDefault := compressWithStrategy(StrategyDefault)
+	cdBtultra2 := compressWithStrategy(StrategyBtultra2)
+	if len(cdBtultra2) >= len(cdDefault) {
+		t.Fatalf("StrategyBtultra2 must compress better than the default strategy; got %d bytes; want less than %d bytes", len(cdBtultra2), len(cdDefault))
+	}
+}
+
+func TestWriterResetNoDict(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 1e4; i++ {
+		sample := []byte(fmt.Sprintf("this is a sample number %d", i))
+		samples = append(samples, sample)
+	}
+	dict := BuildDict(samples, 8*1024)
+
+	cd, err := NewCDictLevel(dict, 7)
+	if err != nil {
+		t.Fatalf("cannot create CDict: %s", err)
+	}
+	defer cd.Release()
+
+	dd, err := NewDDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create DDict: %s", err)
+	}
+	defer dd.Release()
+
+	src := []byte("this is a sample number 42")
+
+	// The first frame with the dictionary.
+	var bb bytes.Buffer
+	zw := NewWriterDict(&bb, cd)
+	defer zw.Release()
+	if _, err := zw.Write(src); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	dictID, err := GetFrameDictID(bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dict ID: %s", err)
+	}
+	if dictID == 0 {
+		t.Fatalf("expecting non-zero dict ID for the frame with dictionary")
+	}
+	if _, err := Decompress(nil, bb.Bytes()); err == nil {
+		t.Fatalf("expecting error when decompressing the frame with dictionary without dictionary")
+	}
+	plainData, err := DecompressDict(nil, bb.Bytes(), dd)
+	if err != nil {
+		t.Fatalf("cannot decompress the frame with dictionary: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data decompressed; got %q; want %q", plainData, src)
+	}
+
+	// The second frame without the dictionary.
+	bb.Reset()
+	zw.ResetNoDict(&bb)
+	level, err := zw.GetParameter(ParamCompressionLevel)
+	if err != nil {
+		t.Fatalf("cannot get compression level: %s", err)
+	}
+	if level != 7 {
+		t.Fatalf("unexpected compression level after ResetNoDict; got %d; want 7", level)
+	}
+	if _, err := zw.Write(src); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	dictID, err = GetFrameDictID(bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot get dict ID: %s", err)
+	}
+	if dictID != 0 {
+		t.Fatalf("unexpected dict ID after ResetNoDict; got %d; want 0", dictID)
+	}
+	plainData, err = Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress the frame without dictionary: %s", err)
+	}
+	if !bytes.Equal(plainData, src) {
+		t.Fatalf("unexpected data decompressed; got %q; want %q", plainData, src)
+	}
+}
+
+func TestWriterJobSize(t *testing.T) {
+	if !MultithreadingSupported() {
+		for _, params := range []WriterParams{{NbWorkers: 2}, {JobSize: 1024 * 1024}} {
+			if err := params.Validate(); err == nil {
+				t.Fatalf("expecting error for %+v without multithreading support", params)
+			}
+		}
+		t.Skip("multithreading isn't supported")
+	}
+
+	src := []byte(newTestString(8*1024*1024, 3))
+	compress := func(jobSize, overlapLog int) []byte {
+		t.Helper()
+		var bb bytes.Buffer
+		zw := NewWriterParams(&bb, &WriterParams{
+			NbWorkers:  2,
+			JobSize:    jobSize,
+			OverlapLog: overlapLog,
+		})
+		defer zw.Release()
+		v, err := zw.GetParameter(ParamJobSize)
+		if err != nil {
+			t.Fatalf("cannot get job size: %s", err)
+		}
+		if v != jobSize {
+			t.Fatalf("unexpected job size; got %d; want %d", v, jobSize)
+		}
+		if _, err := zw.Write(src); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw: %s", err)
+		}
+		plainData, err := Decompress(nil, bb.Bytes())
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		if !bytes.Equal(plainData, src) {
+			t.Fatalf("unexpected data decompressed for jobSize=%d, overlapLog=%d", jobSize, overlapLog)
+		}
+		return bb.Bytes()
+	}
+
+	small := compress(512*1024, 1)
+	big := compress(4*1024*1024, 9)
+	t.Logf("compressed size for small jobs: %d bytes; for big jobs: %d bytes", len(small), len(big))
+}
+
+func TestWriterAutoFlush(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+
+	// Flush after maxBytes.
+	zw.SetAutoFlush(1000, 0)
+	chunk := []byte(newTestString(100, 3))
+	for i := 0; i < 9; i++ {
+		if _, err := zw.Write(chunk); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+	}
+	if bb.Len() != 0 {
+		t.Fatalf("unexpected flush before reaching maxBytes; got %d bytes in the output", bb.Len())
+	}
+	if _, err := zw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if bb.Len() == 0 {
+		t.Fatalf("expecting flush after reaching maxBytes")
+	}
+
+	// Flush after maxInterval.
+	now := time.Unix(1000, 0)
+	zw.autoFlushNow = func() time.Time {
+		return now
+	}
+	var ft fakeFlushTimers
+	zw.autoFlushAfterFunc = ft.AfterFunc
+	zw.SetAutoFlush(0, time.Second)
+	n := bb.Len()
+	if _, err := zw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if _, err := zw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if bb.Len() != n {
+		t.Fatalf("unexpected flush before reaching maxInterval")
+	}
+	now = now.Add(500 * time.Millisecond)
+	if _, err := zw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if bb.Len() == n {
+		t.Fatalf("expecting flush after reaching maxInterval")
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	plainData, err := Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if len(plainData) != 13*len(chunk) {
+		t.Fatalf("unexpected decompressed data length; got %d; want %d", len(plainData), 13*len(chunk))
+	}
+
+	// Reset disables auto-flush.
+	var bb2 bytes.Buffer
+	zw.Reset(&bb2, nil, DefaultCompressionLevel)
+	for i := 0; i < 100; i++ {
+		if _, err := zw.Write(chunk); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+	}
+	if bb2.Len() != 0 {
+		t.Fatalf("unexpected flush after Reset")
+	}
+}
+
+// fakeFlushTimers is a fake clock for the timer flush started by SetAutoFlush.
+type fakeFlushTimers struct {
+	mu     sync.Mutex
+	timers []*fakeFlushTimer
+}
+
+type fakeFlushTimer struct {
+	ft      *fakeFlushTimers
+	d       time.Duration
+	f       func()
+	stopped bool
+}
+
+func (ft *fakeFlushTimers) AfterFunc(d time.Duration, f func()) flushTimer {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	t := &fakeFlushTimer{
+		ft: ft,
+		d:  d,
+		f:  f,
+	}
+	ft.timers = append(ft.timers, t)
+	return t
+}
+
+func (t *fakeFlushTimer) Stop() bool {
+	t.ft.mu.Lock()
+	defer t.ft.mu.Unlock()
+	stopped := t.stopped
+	t.stopped = true
+	return !stopped
+}
+
+// last returns the last started timer and the number of started timers.
+func (ft *fakeFlushTimers) last() (*fakeFlushTimer, int) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if len(ft.timers) == 0 {
+		return nil, 0
+	}
+	return ft.timers[len(ft.timers)-1], len(ft.timers)
+}
+
+// fire runs the timer func like the timer goroutine does.
+func (t *fakeFlushTimer) fire() {
+	ch := make(chan struct{})
+	go func() {
+		t.f()
+		close(ch)
+	}()
+	<-ch
+}
+
+func TestWriterAutoFlushTimer(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+	var ft fakeFlushTimers
+	zw.autoFlushAfterFunc = ft.AfterFunc
+	zw.SetAutoFlush(0, time.Second)
+
+	chunk := []byte(newTestString(100, 3))
+	if _, err := zw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if _, err := zw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if bb.Len() != 0 {
+		t.Fatalf("unexpected flush before the timer fires")
+	}
+	timer, timers := ft.last()
+	if timers != 1 {
+		t.Fatalf("unexpected number of started timers; got %d; want 1", timers)
+	}
+	if timer.d != time.Second {
+		t.Fatalf("unexpected timer duration; got %s; want %s", timer.d, time.Second)
+	}
+
+	// The timer must flush zw without further writes.
+	timer.fire()
+	if bb.Len() == 0 {
+		t.Fatalf("expecting flush after the timer fires")
+	}
+	buf := make([]byte, 2*len(chunk))
+	if _, err := io.ReadFull(NewReader(bytes.NewReader(bb.Bytes())), buf); err != nil {
+		t.Fatalf("cannot read the flushed data: %s", err)
+	}
+	if !bytes.Equal(buf, append(append([]byte{}, chunk...), chunk...)) {
+		t.Fatalf("unexpected flushed data")
+	}
+
+	// The next write must start a new timer. Flush must stop it,
+	// so the stale timer func must skip the flush.
+	if _, err := zw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	timer, timers = ft.last()
+	if timers != 2 {
+		t.Fatalf("unexpected number of started timers; got %d; want 2", timers)
+	}
+	if err := zw.Flush(); err != nil {
+		t.Fatalf("cannot flush zw: %s", err)
+	}
+	if !timer.stopped {
+		t.Fatalf("Flush must stop the timer")
+	}
+	n := bb.Len()
+	timer.fire()
+	if bb.Len() != n {
+		t.Fatalf("unexpected flush by the stopped timer")
+	}
+
+	// Close must stop the timer.
+	if _, err := zw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	timer, _ = ft.last()
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	if !timer.stopped {
+		t.Fatalf("Close must stop the timer")
+	}
+	n = bb.Len()
+	timer.fire()
+	if bb.Len() != n {
+		t.Fatalf("unexpected flush by the timer after Close")
+	}
+	plainData, err := Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if len(plainData) != 4*len(chunk) {
+		t.Fatalf("unexpected decompressed data length; got %d; want %d", len(plainData), 4*len(chunk))
+	}
+
+	// Reset must stop the timer.
+	bb.Reset()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	zw.SetAutoFlush(0, time.Second)
+	if _, err := zw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	timer, _ = ft.last()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if !timer.stopped {
+		t.Fatalf("Reset must stop the timer")
+	}
+	timer.fire()
+	if bb.Len() != 0 {
+		t.Fatalf("unexpected flush by the timer after Reset")
+	}
+
+	// The error from the timer flush must be returned from the next call.
+	zw.SetAutoFlush(0, time.Second)
+	if _, err := zw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	timer, _ = ft.last()
+	zw.w = &errorWriter{}
+	timer.fire()
+	if _, err := zw.Write(chunk); err == nil {
+		t.Fatalf("expecting non-nil error after failed timer flush")
+	}
+
+	// Release must stop the timer.
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	zw.SetAutoFlush(0, time.Second)
+	if _, err := zw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	timer, _ = ft.last()
+	zw.Release()
+	if !timer.stopped {
+		t.Fatalf("Release must stop the timer")
+	}
+	timer.fire()
+}
+
+func TestWriterAutoFlushReadFrom(t *testing.T) {
+	chunk := []byte(newTestString(100, 3))
+
+	// ReadFrom must count toward maxBytes.
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+	zw.SetAutoFlush(1000, 0)
+	r := &chunkedReader{b: bytes.Repeat(chunk, 10), chunkSize: len(chunk)}
+	if _, err := zw.ReadFrom(r); err != nil {
+		t.Fatalf("cannot read data: %s", err)
+	}
+	if bb.Len() == 0 {
+		t.Fatalf("expecting flush after reaching maxBytes in ReadFrom")
+	}
+
+	// The timer must flush the data while ReadFrom waits for more data.
+	bb.Reset()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	var ft fakeFlushTimers
+	zw.autoFlushAfterFunc = ft.AfterFunc
+	zw.SetAutoFlush(0, time.Second)
+	pr, pw := io.Pipe()
+	ch := make(chan error, 1)
+	go func() {
+		_, err := zw.ReadFrom(pr)
+		ch <- err
+	}()
+	if _, err := pw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data to pipe: %s", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if timer, _ := ft.last(); timer != nil {
+			timer.fire()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout when waiting for the timer start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// ReadFrom doesn't write to bb while it waits for data in the pipe.
+	buf := make([]byte, len(chunk))
+	if _, err := io.ReadFull(NewReader(bytes.NewReader(bb.Bytes())), buf); err != nil {
+		t.Fatalf("cannot read the flushed data: %s", err)
+	}
+	if !bytes.Equal(buf, chunk) {
+		t.Fatalf("unexpected flushed data")
+	}
+	if _, err := pw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data to pipe: %s", err)
+	}
+	_ = pw.Close()
+	if err := <-ch; err != nil {
+		t.Fatalf("unexpected error in ReadFrom: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	plainData, err := Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if !bytes.Equal(plainData, append(append([]byte{}, chunk...), chunk...)) {
+		t.Fatalf("unexpected data decompressed")
+	}
+}
+
+func TestWriterAutoFlushRealTimer(t *testing.T) {
+	var lw lockedBuffer
+	zw := NewWriter(&lw)
+	defer zw.Release()
+	zw.SetAutoFlush(0, 10*time.Millisecond)
+	chunk := []byte(newTestString(100, 3))
+	if _, err := zw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for lw.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout when waiting for the timer flush")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := zw.Write(chunk); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	plainData, err := Decompress(nil, lw.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if !bytes.Equal(plainData, append(append([]byte{}, chunk...), chunk...)) {
+		t.Fatalf("unexpected data decompressed")
+	}
+}
+
+type chunkedReader struct {
+	b         []byte
+	chunkSize int
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+	if len(p) > r.chunkSize {
+		p = p[:r.chunkSize]
+	}
+	n := copy(p, r.b)
+	r.b = r.b[n:]
+	return n, nil
+}
+
+type lockedBuffer struct {
+	mu sync.Mutex
+	bb bytes.Buffer
+}
+
+func (lw *lockedBuffer) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.bb.Write(p)
+}
+
+func (lw *lockedBuffer) Len() int {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.bb.Len()
+}
+
+func (lw *lockedBuffer) Bytes() []byte {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return append([]byte{}, lw.bb.Bytes()...)
+}
+
+func TestWriterMinMatchTargetLength(t *testing.T) {
+	// The effect of MinMatch and TargetLength on the compression ratio
+	// is data-dependent, so just verify the round-trip and parameters.
+	src := []byte(newTestString(256*1024, 3))
+	for _, params := range []WriterParams{
+		{MinMatch: 3, TargetLength: 16},
+		{MinMatch: 7, TargetLength: 4096},
+		{CompressionLevel: 19, MinMatch: 3, TargetLength: 999},
+	} {
+		var bb bytes.Buffer
+		zw := NewWriterParams(&bb, &params)
+		minMatch, err := zw.GetParameter(ParamMinMatch)
+		if err != nil {
+			t.Fatalf("cannot get min match: %s", err)
+		}
+		if minMatch != params.MinMatch {
+			t.Fatalf("unexpected min match; got %d; want %d", minMatch, params.MinMatch)
+		}
+		targetLength, err := zw.GetParameter(ParamTargetLength)
+		if err != nil {
+			t.Fatalf("cannot get target length: %s", err)
+		}
+		if targetLength != params.TargetLength {
+			t.Fatalf("unexpected target length; got %d; want %d", targetLength, params.TargetLength)
+		}
+		if _, err := zw.Write(src); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw: %s", err)
+		}
+		zw.Release()
+
+		plainData, err := Decompress(nil, bb.Bytes())
+		if err != nil {
+			t.Fatalf("cannot decompress data for %+v: %s", params, err)
+		}
+		if !bytes.Equal(plainData, src) {
+			t.Fatalf("unexpected data decompressed for %+v", params)
+		}
+	}
+}
+
+func TestWriterReadFromWriteNoAllocs(t *testing.T) {
+	src := []byte(newTestString(512*1024, 3))
+	r := bytes.NewReader(src)
+	zw := NewWriter(ioutil.Discard)
+	defer zw.Release()
+
+	allocs := testing.AllocsPerRun(10, func() {
+		r.Reset(src)
+		if _, err := zw.ReadFrom(r); err != nil {
+			t.Fatalf("cannot read data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw: %s", err)
+		}
+		zw.Reset(ioutil.Discard, nil, DefaultCompressionLevel)
+	})
+	if allocs != 0 {
+		t.Fatalf("unexpected number of allocations per ReadFrom call; got %f; want 0", allocs)
+	}
+
+	allocs = testing.AllocsPerRun(10, func() {
+		for i := 0; i < len(src); i += 1000 {
+			end := i + 1000
+			if end > len(src) {
+				end = len(src)
+			}
+			if _, err := zw.Write(src[i:end]); err != nil {
+				t.Fatalf("cannot write data: %s", err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw: %s", err)
+		}
+		zw.Reset(ioutil.Discard, nil, DefaultCompressionLevel)
+	})
+	if allocs != 0 {
+		t.Fatalf("unexpected number of allocations per Write call; got %f; want 0", allocs)
+	}
+}
+
+func TestWriterDictLevel(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 1e4; i++ {
+		sample := []byte(fmt.Sprintf("this is a sample number %d", i))
+		samples = append(samples, sample)
+	}
+	dict := BuildDict(samples, 8*1024)
+
+	cd, err := NewCDictLevel(dict, 3)
+	if err != nil {
+		t.Fatalf("cannot create CDict: %s", err)
+	}
+	defer cd.Release()
+
+	dd, err := NewDDict(dict)
+	if err != nil {
+		t.Fatalf("cannot create DDict: %s", err)
+	}
+	defer dd.Release()
+
+	var bbOrig bytes.Buffer
+	for i := 0; i < 1e4; i++ {
+		fmt.Fprintf(&bbOrig, "this is a sample number %d, %d; ", i, rand.Intn(1000))
+	}
+	src := bbOrig.Bytes()
+
+	compress := func(level int) []byte {
+		t.Helper()
+		var bb bytes.Buffer
+		zw := NewWriterDictLevel(&bb, cd, level)
+		defer zw.Release()
+		if _, err := zw.Write(src); err != nil {
+			t.Fatalf("cannot write data at level %d: %s", level, err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw at level %d: %s", level, err)
+		}
+		plainData, err := DecompressDict(nil, bb.Bytes(), dd)
+		if err != nil {
+			t.Fatalf("cannot decompress data compressed at level %d: %s", level, err)
+		}
+		if !bytes.Equal(plainData, src) {
+			t.Fatalf("unexpected data decompressed at level %d", level)
+		}
+		return bb.Bytes()
+	}
+
+	cdFast := compress(1)
+	cdBest := compress(19)
+	if bytes.Equal(cdFast, cdBest) {
+		t.Fatalf("the compressed data must differ for distinct compression levels")
+	}
+	if len(cdBest) >= len(cdFast) {
+		t.Fatalf("level 19 must compress better than level 1; got %d bytes vs %d bytes", len(cdBest), len(cdFast))
+	}
+
+	// The CDicts for levels must be re-used.
+	cdFast2 := compress(1)
+	if !bytes.Equal(cdFast, cdFast2) {
+		t.Fatalf("unexpected compressed data on the second compression at level 1")
+	}
+	checkLevelCDicts := func(want int) {
+		t.Helper()
+		cd.levelCDictsLock.Lock()
+		n := len(cd.levelCDicts)
+		cd.levelCDictsLock.Unlock()
+		if n != want {
+			t.Fatalf("unexpected number of level CDicts; got %d; want %d", n, want)
+		}
+	}
+	checkLevelCDicts(2)
+
+	// Other writers must use the compression level of cd.
+	cdOrig := compress(3)
+	var bb bytes.Buffer
+	zw := NewWriterParams(&bb, &WriterParams{
+		CompressionLevel: 19,
+		Dict:             cd,
+	})
+	defer zw.Release()
+	for _, level := range []int{19, 5} {
+		bb.Reset()
+		if _, err := zw.Write(src); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close zw: %s", err)
+		}
+		if !bytes.Equal(bb.Bytes(), cdOrig) {
+			t.Fatalf("unexpected compressed data; the compression level of cd must be used")
+		}
+		zw.Reset(&bb, cd, level)
+	}
+	checkLevelCDicts(2)
+}
+
+func TestWriterCompressedSum(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+
+	if sum := zw.CompressedSum(); sum != nil {
+		t.Fatalf("unexpected non-nil sum when hashing is disabled: %X", sum)
+	}
+
+	zw.HashCompressed(sha256.New())
+	for bb.Len() < 1024*1024 {
+		if _, err := fmt.Fprintf(zw, "compressed sum data %d, %d; ", bb.Len(), rand.Intn(1000)); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if rand.Intn(100) == 0 {
+			if err := zw.Flush(); err != nil {
+				t.Fatalf("cannot flush data: %s", err)
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	sum := zw.CompressedSum()
+	sumExpected := sha256.Sum256(bb.Bytes())
+	if !bytes.Equal(sum, sumExpected[:]) {
+		t.Fatalf("unexpected sum; got %X; want %X", sum, sumExpected[:])
+	}
+
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if sum := zw.CompressedSum(); sum != nil {
+		t.Fatalf("unexpected non-nil sum after Reset: %X", sum)
+	}
+}
+
+func TestWriterSetMaxInput(t *testing.T) {
+	const maxInput = 100 * 1024
+	src := []byte(newTestString(3*maxInput, 3))
+
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+
+	// Verify Write.
+	zw.SetMaxInput(maxInput)
+	written := 0
+	for written < len(src) {
+		chunk := src[written:]
+		if len(chunk) > 1000 {
+			chunk = chunk[:1000]
+		}
+		n, err := zw.Write(chunk)
+		written += n
+		if err != nil {
+			if err != ErrInputLimitExceeded {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			break
+		}
+	}
+	if written != maxInput {
+		t.Fatalf("unexpected number of bytes written; got %d; want %d", written, maxInput)
+	}
+	n, err := zw.Write(src[:1])
+	if err != ErrInputLimitExceeded {
+		t.Fatalf("unexpected error after exceeding the limit; got %v; want %v", err, ErrInputLimitExceeded)
+	}
+	if n != 0 {
+		t.Fatalf("unexpected number of bytes written after exceeding the limit; got %d; want 0", n)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	plainData, err := Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if string(plainData) != string(src[:maxInput]) {
+		t.Fatalf("unexpected data decompressed")
+	}
+
+	// Verify ReadFrom.
+	bb.Reset()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	zw.SetMaxInput(maxInput)
+	nn, err := zw.ReadFrom(bytes.NewReader(src))
+	if err != ErrInputLimitExceeded {
+		t.Fatalf("unexpected error from ReadFrom; got %v; want %v", err, ErrInputLimitExceeded)
+	}
+	if nn != maxInput {
+		t.Fatalf("unexpected number of bytes read; got %d; want %d", nn, maxInput)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	plainData, err = Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if string(plainData) != string(src[:maxInput]) {
+		t.Fatalf("unexpected data decompressed after ReadFrom")
+	}
+
+	// Verify that ReadFrom succeeds for data fitting the limit.
+	bb.Reset()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	zw.SetMaxInput(maxInput)
+	if _, err := zw.ReadFrom(bytes.NewReader(src[:maxInput])); err != nil {
+		t.Fatalf("unexpected error for data fitting the limit: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+}
+
+func TestWriterFrameOpen(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+
+	if zw.FrameOpen() {
+		t.Fatalf("FrameOpen must return false for new writer")
+	}
+	if _, err := zw.Write(nil); err != nil {
+		t.Fatalf("cannot write empty data: %s", err)
+	}
+	if zw.FrameOpen() {
+		t.Fatalf("FrameOpen must return false after writing empty data")
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := zw.Write([]byte("foobar")); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if !zw.FrameOpen() {
+			t.Fatalf("FrameOpen must return true after Write")
+		}
+		if err := zw.Flush(); err != nil {
+			t.Fatalf("cannot flush data: %s", err)
+		}
+		if !zw.FrameOpen() {
+			t.Fatalf("FrameOpen must return true after Flush")
+		}
+		if err := zw.EndFrame(); err != nil {
+			t.Fatalf("cannot end frame: %s", err)
+		}
+		if zw.FrameOpen() {
+			t.Fatalf("FrameOpen must return false after EndFrame")
+		}
+	}
+	plainData, err := Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if string(plainData) != "foobarfoobarfoobar" {
+		t.Fatalf("unexpected data decompressed: %q", plainData)
+	}
+
+	// Verify ReadFrom and Reset.
+	if _, err := zw.ReadFrom(strings.NewReader("foobar")); err != nil {
+		t.Fatalf("cannot read data: %s", err)
+	}
+	if !zw.FrameOpen() {
+		t.Fatalf("FrameOpen must return true after ReadFrom")
+	}
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if zw.FrameOpen() {
+		t.Fatalf("FrameOpen must return false after Reset")
+	}
+}
+
+type closeCounter struct {
+	bytes.Buffer
+	closeCalls int
+}
+
+func (cc *closeCounter) Close() error {
+	cc.closeCalls++
+	return nil
+}
+
+func TestNewWriterCloser(t *testing.T) {
+	var cc closeCounter
+	zwc := NewWriterCloser(&cc, 5)
+	defer zwc.Release()
+
+	src := newTestString(100*1024, 3)
+	if _, err := io.WriteString(zwc, src); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if cc.closeCalls != 0 {
+		t.Fatalf("the underlying writer must not be closed before Close call")
+	}
+	for i := 0; i < 3; i++ {
+		if err := zwc.Close(); err != nil {
+			t.Fatalf("cannot close zwc: %s", err)
+		}
+	}
+	if cc.closeCalls != 1 {
+		t.Fatalf("unexpected number of Close calls for the underlying writer; got %d; want 1", cc.closeCalls)
+	}
+
+	// Verify that the frame is finalized.
+	plainData, err := Decompress(nil, cc.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if string(plainData) != src {
+		t.Fatalf("unexpected data decompressed")
+	}
+}
+
+func TestWriteCloserReset(t *testing.T) {
+	var cc1 closeCounter
+	zwc := NewWriterCloser(&cc1, 5)
+	defer zwc.Release()
+
+	f := func(cc *closeCounter, reset func(), src string) {
+		t.Helper()
+		reset()
+		if _, err := io.WriteString(zwc, src); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zwc.Close(); err != nil {
+			t.Fatalf("cannot close zwc: %s", err)
+		}
+		if cc.closeCalls != 1 {
+			t.Fatalf("unexpected number of Close calls for the underlying writer; got %d; want 1", cc.closeCalls)
+		}
+		plainData, err := Decompress(nil, cc.Bytes())
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		if string(plainData) != src {
+			t.Fatalf("unexpected data decompressed; got %d bytes; want %d bytes", len(plainData), len(src))
+		}
+	}
+
+	var cc2, cc3, cc4 closeCounter
+	f(&cc1, func() {}, "foo")
+	f(&cc2, func() { zwc.Reset(&cc2, nil, 3) }, newTestString(100*1024, 3))
+	f(&cc3, func() { zwc.ResetNoDict(&cc3) }, "bar")
+	f(&cc4, func() { zwc.ResetWriterParams(&cc4, &WriterParams{CompressionLevel: 1}) }, "baz")
+	if cc1.closeCalls != 1 {
+		t.Fatalf("unexpected number of Close calls for the first writer; got %d; want 1", cc1.closeCalls)
+	}
+}
+
+func TestWriterAddSink(t *testing.T) {
+	var bb, sink1, sink2 bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+	zw.AddSink(&sink1)
+	zw.AddSink(&sink2)
+
+	src := newTestString(1024*1024, 3)
+	for i := 0; i < len(src); i += 10000 {
+		end := i + 10000
+		if end > len(src) {
+			end = len(src)
+		}
+		if _, err := io.WriteString(zw, src[i:end]); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	if !bytes.Equal(sink1.Bytes(), bb.Bytes()) {
+		t.Fatalf("unexpected data in sink1; got %d bytes; want %d bytes", sink1.Len(), bb.Len())
+	}
+	if !bytes.Equal(sink2.Bytes(), bb.Bytes()) {
+		t.Fatalf("unexpected data in sink2; got %d bytes; want %d bytes", sink2.Len(), bb.Len())
+	}
+	plainData, err := Decompress(nil, sink2.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data from sink2: %s", err)
+	}
+	if string(plainData) != src {
+		t.Fatalf("unexpected data decompressed from sink2")
+	}
+
+	// Verify that a failed sink doesn't break the rest of destinations.
+	bb.Reset()
+	sink1.Reset()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	zw.AddSink(&errorWriter{})
+	zw.AddSink(&sink1)
+	if _, err := io.WriteString(zw, src); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err == nil {
+		t.Fatalf("expecting non-nil error for failed sink")
+	}
+	if !bytes.Equal(sink1.Bytes(), bb.Bytes()) {
+		t.Fatalf("unexpected data in sink1 after sink failure; got %d bytes; want %d bytes", sink1.Len(), bb.Len())
+	}
+	plainData, err = Decompress(nil, sink1.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data from sink1: %s", err)
+	}
+	if string(plainData) != src {
+		t.Fatalf("unexpected data decompressed from sink1")
+	}
+}
+
+type errorWriter struct{}
+
+func (*errorWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("some error")
+}
+
+func TestWriterSyncFlushOutputFlush(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+
+	readAvailable := func() []byte {
+		t.Helper()
+		zr := NewReader(bytes.NewReader(bb.Bytes()))
+		defer zr.Release()
+		var result []byte
+		buf := make([]byte, 4096)
+		for {
+			n, err := zr.Read(buf)
+			result = append(result, buf[:n]...)
+			if err != nil {
+				return result
+			}
+		}
+	}
+
+	src := []byte("foobar baz")
+	if _, err := zw.Write(src); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+
+	// OutputFlush doesn't make the buffered data visible to the decompressor.
+	if err := zw.OutputFlush(); err != nil {
+		t.Fatalf("cannot flush output: %s", err)
+	}
+	if result := readAvailable(); len(result) != 0 {
+		t.Fatalf("unexpected data read after OutputFlush: %q", result)
+	}
+
+	// SyncFlush makes all the written data visible to the decompressor.
+	if err := zw.SyncFlush(); err != nil {
+		t.Fatalf("cannot sync flush: %s", err)
+	}
+	if result := readAvailable(); string(result) != string(src) {
+		t.Fatalf("unexpected data read after SyncFlush; got %q; want %q", result, src)
+	}
+
+	// Flush is equivalent to SyncFlush.
+	if _, err := zw.Write(src); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Flush(); err != nil {
+		t.Fatalf("cannot flush data: %s", err)
+	}
+	if result := readAvailable(); string(result) != string(src)+string(src) {
+		t.Fatalf("unexpected data read after Flush; got %q; want %q", result, string(src)+string(src))
+	}
+}
+
+func TestOpenAppendWriter(t *testing.T) {
+	f, err := ioutil.TempFile("", "gozstd-append")
+	if err != nil {
+		t.Fatalf("cannot create temporary file: %s", err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	if err := f.Close(); err != nil {
+		t.Fatalf("cannot close temporary file: %s", err)
+	}
+
+	var expected []byte
+	for i := 0; i < 5; i++ {
+		zwc, err := OpenAppendWriter(path, 5)
+		if err != nil {
+			t.Fatalf("cannot open append writer: %s", err)
+		}
+		src := []byte(fmt.Sprintf("append #%d %s", i, newTestString(10000*i, 3)))
+		if _, err := zwc.Write(src); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zwc.Close(); err != nil {
+			t.Fatalf("cannot close append writer: %s", err)
+		}
+		zwc.Release()
+		expected = append(expected, src...)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read file: %s", err)
+	}
+	n, err := CountFrames(data, false)
+	if err != nil {
+		t.Fatalf("cannot count frames: %s", err)
+	}
+	if n != 5 {
+		t.Fatalf("unexpected number of frames; got %d; want 5", n)
+	}
+	plainData, err := Decompress(nil, data)
+	if err != nil {
+		t.Fatalf("cannot decompress file: %s", err)
+	}
+	if !bytes.Equal(plainData, expected) {
+		t.Fatalf("unexpected data decompressed from file")
+	}
+
+	// Missing directory.
+	if _, err := OpenAppendWriter(path+"/missing/file", 5); err == nil {
+		t.Fatalf("expecting non-nil error for invalid path")
+	}
+}
+
+func TestWriterSetFlushObserver(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+
+	calls := 0
+	total := 0
+	zw.SetFlushObserver(func(n int) {
+		if n <= 0 {
+			t.Fatalf("unexpected number of bytes passed to the observer: %d", n)
+		}
+		calls++
+		total += n
+	})
+	src := newTestString(2*1024*1024, 3)
+	for i := 0; i < len(src); i += 100000 {
+		end := i + 100000
+		if end > len(src) {
+			end = len(src)
+		}
+		if _, err := io.WriteString(zw, src[i:end]); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Flush(); err != nil {
+			t.Fatalf("cannot flush data: %s", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	if calls < 2 {
+		t.Fatalf("unexpected number of observer calls; got %d; want at least 2", calls)
+	}
+	if total != bb.Len() {
+		t.Fatalf("unexpected total number of bytes seen by the observer; got %d; want %d", total, bb.Len())
+	}
+
+	// Reset must remove the observer.
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	callsPrev := calls
+	if _, err := io.WriteString(zw, src); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	if calls != callsPrev {
+		t.Fatalf("the observer must be removed by Reset")
+	}
+}
+
+func TestWriterNilWriter(t *testing.T) {
+	zw := NewWriter(nil)
+	defer zw.Release()
+
+	if _, err := zw.Write([]byte("foobar")); err != ErrNilWriter {
+		t.Fatalf("unexpected error from Write; got %v; want %v", err, ErrNilWriter)
+	}
+	if _, err := zw.ReadFrom(strings.NewReader("foobar")); err != ErrNilWriter {
+		t.Fatalf("unexpected error from ReadFrom; got %v; want %v", err, ErrNilWriter)
+	}
+	if err := zw.Close(); err != ErrNilWriter {
+		t.Fatalf("unexpected error from Close; got %v; want %v", err, ErrNilWriter)
+	}
+	if err := zw.Close(); err != ErrNilWriter {
+		t.Fatalf("unexpected error from the second Close; got %v; want %v", err, ErrNilWriter)
+	}
+	if ErrNilWriter.Error() != "gozstd: nil writer" {
+		t.Fatalf("unexpected error message: %q", ErrNilWriter.Error())
+	}
+
+	// The writer created with nil writer may be used after Reset.
+	var bb bytes.Buffer
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if _, err := zw.Write([]byte("foobar")); err != nil {
+		t.Fatalf("cannot write data after Reset: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw after Reset: %s", err)
+	}
+	plainData, err := Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if string(plainData) != "foobar" {
+		t.Fatalf("unexpected data decompressed; got %q; want %q", plainData, "foobar")
+	}
+
+	// Reset to nil writer.
+	zw.Reset(nil, nil, DefaultCompressionLevel)
+	if _, err := zw.Write([]byte("foobar")); err != ErrNilWriter {
+		t.Fatalf("unexpected error from Write after Reset(nil); got %v; want %v", err, ErrNilWriter)
+	}
+}
+
+func TestWriterWriteWithHint(t *testing.T) {
+	var msgs [][]byte
+	for i := 0; i < 100; i++ {
+		msgs = append(msgs, []byte(fmt.Sprintf("message #%d: %s", i, newTestString(i*10, 3))))
+	}
+
+	// Write + EndFrame.
+	var bbExpected bytes.Buffer
+	zw := NewWriter(&bbExpected)
+	for _, msg := range msgs {
+		if _, err := zw.Write(msg); err != nil {
+			t.Fatalf("cannot write message: %s", err)
+		}
+		if err := zw.EndFrame(); err != nil {
+			t.Fatalf("cannot end frame: %s", err)
+		}
+	}
+	zw.Release()
+
+	// WriteWithHint.
+	var bb bytes.Buffer
+	zw = NewWriter(&bb)
+	defer zw.Release()
+	for _, msg := range msgs {
+		half := len(msg) / 2
+		if _, err := zw.WriteWithHint(msg[:half], false); err != nil {
+			t.Fatalf("cannot write the first part of message: %s", err)
+		}
+		if !zw.FrameOpen() && half > 0 {
+			t.Fatalf("the frame must be open after WriteWithHint(p, false)")
+		}
+		n, err := zw.WriteWithHint(msg[half:], true)
+		if err != nil {
+			t.Fatalf("cannot write the last part of message: %s", err)
+		}
+		if n != len(msg)-half {
+			t.Fatalf("unexpected number of bytes written; got %d; want %d", n, len(msg)-half)
+		}
+		if zw.FrameOpen() {
+			t.Fatalf("the frame must be closed after WriteWithHint(p, true)")
+		}
+	}
+	if bb.Len() > bbExpected.Len() {
+		t.Fatalf("WriteWithHint output is bigger than Write+EndFrame output; got %d bytes; want no more than %d bytes", bb.Len(), bbExpected.Len())
+	}
+
+	n, err := CountFrames(bb.Bytes(), false)
+	if err != nil {
+		t.Fatalf("cannot count frames: %s", err)
+	}
+	if n != len(msgs) {
+		t.Fatalf("unexpected number of frames; got %d; want %d", n, len(msgs))
+	}
+	i := 0
+	err = ForEachFrame(bb.Bytes(), func(frame, decompressed []byte) error {
+		if !bytes.Equal(decompressed, msgs[i]) {
+			return fmt.Errorf("unexpected message #%d; got %q; want %q", i, decompressed, msgs[i])
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error when decompressing frames: %s", err)
+	}
+}
+
+func TestWriterSetFlushEveryWrite(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+	zw.SetFlushEveryWrite(true)
+
+	var written []byte
+	for i := 0; i < 100; i++ {
+		line := []byte(fmt.Sprintf("line %d %s\n", i, newTestString(i*10, 3)))
+		if _, err := zw.Write(line); err != nil {
+			t.Fatalf("cannot write line: %s", err)
+		}
+		written = append(written, line...)
+
+		// All the data written so far must be decodable without explicit flush.
+		zr := NewReader(bytes.NewReader(bb.Bytes()))
+		zr.WaitForMore(true)
+		buf := make([]byte, len(written))
+		if _, err := io.ReadFull(zr, buf); err != nil {
+			t.Fatalf("cannot read data after the line #%d: %s", i, err)
+		}
+		zr.Release()
+		if !bytes.Equal(buf, written) {
+			t.Fatalf("unexpected data read after the line #%d", i)
+		}
+	}
+
+	// Empty writes mustn't flush.
+	n := bb.Len()
+	if _, err := zw.Write(nil); err != nil {
+		t.Fatalf("cannot write empty data: %s", err)
+	}
+	if bb.Len() != n {
+		t.Fatalf("unexpected data written on empty write; got %d bytes; want %d bytes", bb.Len(), n)
+	}
+
+	// Reset disables the mode.
+	bb.Reset()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if _, err := zw.Write([]byte("foobar")); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if bb.Len() != 0 {
+		t.Fatalf("unexpected data written after Reset; got %d bytes; want 0 bytes", bb.Len())
+	}
+}
+
+func TestWriterCloseWithStats(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+
+	for i := 0; i < 2; i++ {
+		bb.Reset()
+		zw.Reset(&bb, nil, DefaultCompressionLevel)
+		if n := zw.BytesIn(); n != 0 {
+			t.Fatalf("unexpected BytesIn after Reset; got %d; want 0", n)
+		}
+
+		s := newTestString(500*1000, 10)
+		if _, err := zw.Write([]byte(s[:1000])); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.EndFrame(); err != nil {
+			t.Fatalf("cannot end frame: %s", err)
+		}
+		n, err := zw.ReadFrom(strings.NewReader(s[1000:]))
+		if err != nil {
+			t.Fatalf("cannot read data: %s", err)
+		}
+		if n != int64(len(s)-1000) {
+			t.Fatalf("unexpected number of bytes read; got %d; want %d", n, len(s)-1000)
+		}
+		bytesOut, err := zw.CloseWithStats()
+		if err != nil {
+			t.Fatalf("cannot close zw: %s", err)
+		}
+		if bytesOut != int64(bb.Len()) {
+			t.Fatalf("unexpected bytesOut; got %d; want %d", bytesOut, bb.Len())
+		}
+		if n := zw.BytesIn(); n != int64(len(s)) {
+			t.Fatalf("unexpected BytesIn; got %d; want %d", n, len(s))
+		}
+		plainData, err := Decompress(nil, bb.Bytes())
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		if string(plainData) != s {
+			t.Fatalf("unexpected data decompressed")
+		}
+	}
+}
+
+func TestWriterLiteralCompressionMode(t *testing.T) {
+	src := []byte(newTestString(100*1000, 10))
+	sizes := make(map[LiteralCompressionMode]int)
+	for _, mode := range []LiteralCompressionMode{LiteralCompressionAuto, LiteralCompressionHuffman, LiteralCompressionUncompressed} {
+		for _, level := range []int{-5, 1, 5, 19} {
+			var bb bytes.Buffer
+			zw := NewWriterParams(&bb, &WriterParams{
+				CompressionLevel:       level,
+				LiteralCompressionMode: mode,
+			})
+			if _, err := zw.Write(src); err != nil {
+				t.Fatalf("cannot write data: %s", err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatalf("cannot close zw: %s", err)
+			}
+			zw.Release()
+			plainData, err := Decompress(nil, bb.Bytes())
+			if err != nil {
+				t.Fatalf("cannot decompress data for mode %d at level %d: %s", mode, level, err)
+			}
+			if !bytes.Equal(plainData, src) {
+				t.Fatalf("unexpected data decompressed for mode %d at level %d", mode, level)
+			}
+			if level == 5 {
+				sizes[mode] = bb.Len()
+			}
+		}
+	}
+	if sizes[LiteralCompressionUncompressed] <= sizes[LiteralCompressionHuffman] {
+		t.Fatalf("uncompressed literals must result in bigger output; got %d bytes vs %d bytes for huffman literals",
+			sizes[LiteralCompressionUncompressed], sizes[LiteralCompressionHuffman])
+	}
+}
+
+func TestWriterGrow(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+
+	f := func(growSize, n int, readFrom bool, sizeExpected int) {
+		t.Helper()
+		bb.Reset()
+		zw.Reset(&bb, nil, DefaultCompressionLevel)
+		data := []byte(newTestString(n, 10))[:n]
+		if err := zw.Grow(growSize); err != nil {
+			t.Fatalf("cannot grow writer to %d bytes: %s", growSize, err)
+		}
+		if readFrom {
+			if _, err := zw.ReadFrom(bytes.NewReader(data)); err != nil {
+				t.Fatalf("cannot read data: %s", err)
+			}
+		} else {
+			for s := data; len(s) > 0; {
+				m := 1000
+				if m > len(s) {
+					m = len(s)
+				}
+				if _, err := zw.Write(s[:m]); err != nil {
+					t.Fatalf("cannot write data: %s", err)
+				}
+				s = s[m:]
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close writer for growSize=%d, n=%d: %s", growSize, n, err)
+		}
+		compressed := bb.Bytes()
+		size, err := findDecompressedSize(compressed)
+		if sizeExpected < 0 {
+			if err != ErrUnknownContentSize {
+				t.Fatalf("unexpected error for growSize=%d, n=%d; got %v; want %v", growSize, n, err, ErrUnknownContentSize)
+			}
+		} else if err != nil || size != uint64(sizeExpected) {
+			t.Fatalf("unexpected content size for growSize=%d, n=%d; got %d, err=%v; want %d", growSize, n, size, err, sizeExpected)
+		}
+		plainData, err := Decompress(nil, compressed)
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		if !bytes.Equal(plainData, data) {
+			t.Fatalf("unexpected data decompressed; got %d bytes; want %d bytes", len(plainData), len(data))
+		}
+	}
+
+	for _, readFrom := range []bool{false, true} {
+		// Exact sizes.
+		f(0, 0, readFrom, 0)
+		f(1000, 1000, readFrom, 1000)
+		f(300*1024, 300*1024, readFrom, 300*1024)
+
+		// Overestimates.
+		f(1<<20, 1000, readFrom, 1000)
+		f(maxInt, 1000, readFrom, 1000)
+
+		// Underestimates.
+		f(1000, 300*1024, readFrom, -1)
+		f(0, 1000, readFrom, -1)
+	}
+
+	// Grow must return an error for invalid sizes and after writing data
+	// to the frame.
+	bb.Reset()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if err := zw.Grow(-1); err == nil {
+		t.Fatalf("expecting non-nil error for negative size")
+	}
+	if _, err := zw.Write([]byte("foo")); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Grow(100); err == nil {
+		t.Fatalf("expecting non-nil error after writing data to the frame")
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close writer: %s", err)
+	}
+	plainData, err := Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if string(plainData) != "foo" {
+		t.Fatalf("unexpected data decompressed; got %q; want %q", plainData, "foo")
+	}
+
+	// Grow must size the buffers, and Reset must restore them.
+	bb.Reset()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	availableDefault := zw.Available()
+	if err := zw.Grow(1 << 20); err != nil {
+		t.Fatalf("cannot grow writer: %s", err)
+	}
+	if n := zw.Available(); n <= 1<<20 {
+		t.Fatalf("unexpected buffer size after Grow; got %d bytes; want more than %d bytes", n, 1<<20)
+	}
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if n := zw.Available(); n != availableDefault {
+		t.Fatalf("unexpected buffer size after Reset; got %d bytes; want %d bytes", n, availableDefault)
+	}
+
+	// The pledge becomes exact after Flush.
+	bb.Reset()
+	if err := zw.Grow(1000); err != nil {
+		t.Fatalf("cannot grow writer: %s", err)
+	}
+	if _, err := zw.Write([]byte("foo")); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Flush(); err != nil {
+		t.Fatalf("cannot flush writer: %s", err)
+	}
+	if err := zw.EndFrame(); err != ErrPledgedSizeMismatch {
+		t.Fatalf("unexpected error; got %v; want %v", err, ErrPledgedSizeMismatch)
+	}
+}
+
+func TestWriterPledgeSize(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+
+	for _, n := range []int{0, 1, 1000, 300 * 1024} {
+		bb.Reset()
+		zw.Reset(&bb, nil, DefaultCompressionLevel)
+		data := []byte(newTestString(n, 10))[:n]
+		if err := zw.PledgeSize(int64(len(data))); err != nil {
+			t.Fatalf("cannot pledge size: %s", err)
+		}
+		if _, err := zw.Write(data); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close writer: %s", err)
+		}
+		compressed := bb.Bytes()
+		size, err := findDecompressedSize(compressed)
+		if err != nil {
+			t.Fatalf("cannot obtain frame content size: %s", err)
+		}
+		if size != uint64(n) {
+			t.Fatalf("unexpected frame content size; got %d; want %d", size, n)
+		}
+		plainData, err := Decompress(nil, compressed)
+		if err != nil {
+			t.Fatalf("cannot decompress data: %s", err)
+		}
+		if !bytes.Equal(plainData, data) {
+			t.Fatalf("unexpected data decompressed; got %d bytes; want %d bytes", len(plainData), len(data))
+		}
+	}
+
+	// The pledged size must apply only to the current frame.
+	bb.Reset()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if err := zw.PledgeSize(3); err != nil {
+		t.Fatalf("cannot pledge size: %s", err)
+	}
+	if _, err := zw.Write([]byte("foo")); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.EndFrame(); err != nil {
+		t.Fatalf("cannot end frame: %s", err)
+	}
+	if _, err := zw.Write([]byte("foobar")); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close writer: %s", err)
+	}
+	plainData, err := Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if string(plainData) != "foofoobar" {
+		t.Fatalf("unexpected data decompressed; got %q; want %q", plainData, "foofoobar")
+	}
+
+	// Invalid pledges must result in error.
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if err := zw.PledgeSize(-1); err == nil {
+		t.Fatalf("expecting non-nil error for negative size")
+	}
+	if _, err := zw.Write([]byte("foo")); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.PledgeSize(100); err == nil {
+		t.Fatalf("expecting non-nil error after writing data to the frame")
+	}
+
+	// Writing more data than pledged must result in error.
+	bb.Reset()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if err := zw.PledgeSize(5); err != nil {
+		t.Fatalf("cannot pledge size: %s", err)
+	}
+	if _, err := zw.Write([]byte("foo")); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if n, err := zw.Write([]byte("bar")); err != ErrPledgedSizeMismatch || n != 0 {
+		t.Fatalf("unexpected result; got n=%d, err=%v; want n=0, err=%v", n, err, ErrPledgedSizeMismatch)
+	}
+
+	// Writing less data than pledged must result in error,
+	// and the frame must be finalized after writing the missing data.
+	if err := zw.Close(); err != ErrPledgedSizeMismatch {
+		t.Fatalf("unexpected error; got %v; want %v", err, ErrPledgedSizeMismatch)
+	}
+	if _, err := zw.Write([]byte("ba")); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close writer: %s", err)
+	}
+	plainData, err = DecompressExact(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if string(plainData) != "fooba" {
+		t.Fatalf("unexpected data decompressed; got %q; want %q", plainData, "fooba")
+	}
+
+	// ReadFrom must detect data past the pledged size.
+	bb.Reset()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if err := zw.PledgeSize(3); err != nil {
+		t.Fatalf("cannot pledge size: %s", err)
+	}
+	n, err := zw.ReadFrom(strings.NewReader("foobar"))
+	if err != ErrPledgedSizeMismatch {
+		t.Fatalf("unexpected error; got %v; want %v", err, ErrPledgedSizeMismatch)
+	}
+	if n != 3 {
+		t.Fatalf("unexpected number of bytes read; got %d; want 3", n)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close writer: %s", err)
+	}
+	plainData, err = DecompressExact(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if string(plainData) != "foo" {
+		t.Fatalf("unexpected data decompressed; got %q; want %q", plainData, "foo")
+	}
+}
+
+func TestWriterClosed(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+
+	if _, err := zw.Write([]byte("foobar")); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close writer: %s", err)
+	}
+	compressed := append([]byte{}, bb.Bytes()...)
+
+	// Write, ReadFrom and flushes after Close must return ErrClosed.
+	if _, err := zw.Write([]byte("baz")); err != ErrClosed {
+		t.Fatalf("unexpected error from Write after Close; got %v; want %v", err, ErrClosed)
+	}
+	if _, err := zw.ReadFrom(bytes.NewReader([]byte("baz"))); err != ErrClosed {
+		t.Fatalf("unexpected error from ReadFrom after Close; got %v; want %v", err, ErrClosed)
+	}
+	if err := zw.Flush(); err != ErrClosed {
+		t.Fatalf("unexpected error from Flush after Close; got %v; want %v", err, ErrClosed)
+	}
+	if err := zw.OutputFlush(); err != ErrClosed {
+		t.Fatalf("unexpected error from OutputFlush after Close; got %v; want %v", err, ErrClosed)
+	}
+	if err := zw.EndFrame(); err != ErrClosed {
+		t.Fatalf("unexpected error from EndFrame after Close; got %v; want %v", err, ErrClosed)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("unexpected error from the second Close: %s", err)
+	}
+	if !bytes.Equal(bb.Bytes(), compressed) {
+		t.Fatalf("unexpected data written after Close")
+	}
+	plainData, err := Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if string(plainData) != "foobar" {
+		t.Fatalf("unexpected data decompressed; got %q; want %q", plainData, "foobar")
+	}
+
+	// Reset must make the writer usable again.
+	bb.Reset()
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if _, err := zw.Write([]byte("baz")); err != nil {
+		t.Fatalf("cannot write data after Reset: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close writer: %s", err)
+	}
+	plainData, err = Decompress(nil, bb.Bytes())
+	if err != nil {
+		t.Fatalf("cannot decompress data: %s", err)
+	}
+	if string(plainData) != "baz" {
+		t.Fatalf("unexpected data decompressed; got %q; want %q", plainData, "baz")
+	}
+}
+
+func TestWriterStableInput(t *testing.T) {
+	data := []byte(newTestString(2*1024*1024, 10))
+
+	for _, chunkSize := range []int{1, 100, int(cstreamInBufSize) - 1, int(cstreamInBufSize) + 1, 1024 * 1024, len(data)} {
+		var bb bytes.Buffer
+		zw := NewWriter(&bb)
+		zw.SetStableInput(true)
+		for i := 0; i < len(data); i += chunkSize {
+			end := i + chunkSize
+			if end > len(data) {
+				end = len(data)
+			}
+			// Modify the chunk after Write in order to verify
+			// the data isn't referenced after Write returns.
+			chunk := append([]byte{}, data[i:end]...)
+			n, err := zw.Write(chunk)
+			if err != nil {
+				t.Fatalf("chunkSize=%d: cannot write data: %s", chunkSize, err)
+			}
+			if n != len(chunk) {
+				t.Fatalf("chunkSize=%d: unexpected number of bytes written; got %d; want %d", chunkSize, n, len(chunk))
+			}
+			for j := range chunk {
+				chunk[j] = 'x'
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("chunkSize=%d: cannot close writer: %s", chunkSize, err)
+		}
+		zw.Release()
+
+		plainData, err := Decompress(nil, bb.Bytes())
+		if err != nil {
+			t.Fatalf("chunkSize=%d: cannot decompress data: %s", chunkSize, err)
+		}
+		if !bytes.Equal(plainData, data) {
+			t.Fatalf("chunkSize=%d: unexpected data decompressed; got %d bytes; want %d bytes", chunkSize, len(plainData), len(data))
+		}
+	}
+
+	// Stable input must work with leading metadata and flushes.
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+	zw.SetStableInput(true)
+	zw.SetLeadingMetadata(3, []byte("meta"))
+	if _, err := zw.Write([]byte("foo")); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Flush(); err != nil {
+		t.Fatalf("cannot flush data: %s", err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close writer: %s", err)
+	}
+	zr := NewReader(&bb)
+	defer zr.Release()
+	plainData, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("cannot read data: %s", err)
+	}
+	expectedData := append([]byte("foo"), data...)
+	expectedData = append(expectedData, data...)
+	if !bytes.Equal(plainData, expectedData) {
+		t.Fatalf("unexpected data read; got %d bytes; want %d bytes", len(plainData), len(expectedData))
+	}
+	if _, md := zr.Metadata(); string(md) != "meta" {
+		t.Fatalf("unexpected metadata; got %q; want %q", md, "meta")
+	}
+}
+
+func TestWriterMemoryUsage(t *testing.T) {
+	data := []byte(newTestString(1024*1024, 10))
+	f := func(windowLog int) int {
+		t.Helper()
+		zw := NewWriterParams(ioutil.Discard, &WriterParams{
+			CompressionLevel: DefaultCompressionLevel,
+			WindowLog:        windowLog,
+		})
+		defer zw.Release()
+		if n := zw.MemoryUsage(); n <= 0 {
+			t.Fatalf("unexpected memory usage for empty writer: %d", n)
+		}
+		if _, err := zw.Write(data); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close writer: %s", err)
+		}
+		return zw.MemoryUsage()
+	}
+	nSmall := f(WindowLogMin)
+	nBig := f(23)
+	if nBig <= nSmall {
+		t.Fatalf("memory usage must grow with windowLog; got %d bytes for windowLog=%d and %d bytes for windowLog=23", nSmall, WindowLogMin, nBig)
+	}
+
+	zw := NewWriter(ioutil.Discard)
+	zw.Release()
+	if n := zw.MemoryUsage(); n != 0 {
+		t.Fatalf("unexpected memory usage for released writer; got %d; want 0", n)
+	}
+}
+
+func TestWriterSetFrameEndObserver(t *testing.T) {
+	var bb bytes.Buffer
+	zw := NewWriter(&bb)
+	defer zw.Release()
+
+	var compressedLens, uncompressedLens []int64
+	zw.SetFrameEndObserver(func(compressedLen, uncompressedLen int64) {
+		compressedLens = append(compressedLens, compressedLen)
+		uncompressedLens = append(uncompressedLens, uncompressedLen)
+	})
+	zw.SetLeadingMetadata(0, []byte("metadata"))
+
+	var frames []string
+	for i := 0; i < 5; i++ {
+		frame := newTestString(i*100000+10, 3)
+		if _, err := io.WriteString(zw, frame); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.EndFrame(); err != nil {
+			t.Fatalf("cannot end frame: %s", err)
+		}
+		frames = append(frames, frame)
+	}
+	frame := newTestString(12345, 3)
+	if _, err := zw.WriteWithHint([]byte(frame), true); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	frames = append(frames, frame)
+	frame = newTestString(54321, 3)
+	if _, err := io.WriteString(zw, frame); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	frames = append(frames, frame)
+
+	if len(compressedLens) != len(frames) {
+		t.Fatalf("unexpected number of observer calls; got %d; want %d", len(compressedLens), len(frames))
+	}
+	var total int64
+	for _, n := range compressedLens {
+		total += n
+	}
+	if total != int64(bb.Len()) {
+		t.Fatalf("unexpected total compressed length; got %d; want %d", total, bb.Len())
+	}
+
+	// The observed lengths must point to the frames.
+	data := bb.Bytes()
+	for i, frame := range frames {
+		if uncompressedLens[i] != int64(len(frame)) {
+			t.Fatalf("unexpected uncompressed length for frame #%d; got %d; want %d", i, uncompressedLens[i], len(frame))
+		}
+		plainData, err := Decompress(nil, data[:compressedLens[i]])
+		if err != nil {
+			t.Fatalf("cannot decompress frame #%d: %s", i, err)
+		}
+		if string(plainData) != frame {
+			t.Fatalf("unexpected data for frame #%d; got %d bytes; want %d bytes", i, len(plainData), len(frame))
+		}
+		data = data[compressedLens[i]:]
+	}
+
+	// Reset must remove the observer.
+	calls := len(compressedLens)
+	zw.Reset(&bb, nil, DefaultCompressionLevel)
+	if _, err := io.WriteString(zw, "foobar"); err != nil {
+		t.Fatalf("cannot write data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zw: %s", err)
+	}
+	if len(compressedLens) != calls {
+		t.Fatalf("the observer must be removed by Reset")
+	}
+}
@@ -1,8 +1,10 @@
 package gozstd
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"testing"
 )
 
@@ -90,3 +92,138 @@ func BenchmarkWriterResetAlloc(b *testing.B) {
 		zw.ResetWriterParams(ioutil.Discard, params)
 	}
 }
+
+func BenchmarkWriterForceAttachDict(b *testing.B) {
+	modes := []struct {
+		name string
+		mode DictAttachMode
+	}{
+		{"default", DictAttachDefault},
+		{"attach", DictForceAttach},
+		{"copy", DictForceCopy},
+	}
+	for _, m := range modes {
+		b.Run(m.name, func(b *testing.B) {
+			benchmarkWriterForceAttachDict(b, m.mode)
+		})
+	}
+}
+
+func benchmarkWriterForceAttachDict(b *testing.B, mode DictAttachMode) {
+	bd := getBenchDicts(DefaultCompressionLevel)
+	msg := newBenchString(100)
+	params := &WriterParams{
+		Dict:            bd.cd,
+		ForceAttachDict: mode,
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(msg)))
+	b.RunParallel(func(pb *testing.PB) {
+		zw := NewWriterParams(ioutil.Discard, params)
+		defer zw.Release()
+		for pb.Next() {
+			if _, err := zw.Write(msg); err != nil {
+				panic(fmt.Errorf("unexpected error: %s", err))
+			}
+			if err := zw.Close(); err != nil {
+				panic(fmt.Errorf("unexpected error: %s", err))
+			}
+			zw.ResetWriterParams(ioutil.Discard, params)
+		}
+	})
+}
+
+func BenchmarkWriterLiteralCompressionMode(b *testing.B) {
+	modes := []struct {
+		name string
+		mode LiteralCompressionMode
+	}{
+		{"auto", LiteralCompressionAuto},
+		{"huffman", LiteralCompressionHuffman},
+		{"uncompressed", LiteralCompressionUncompressed},
+	}
+	for _, m := range modes {
+		b.Run(m.name, func(b *testing.B) {
+			benchmarkWriterLiteralCompressionMode(b, m.mode)
+		})
+	}
+}
+
+func benchmarkWriterLiteralCompressionMode(b *testing.B, mode LiteralCompressionMode) {
+	// Mix repeated parts with high-entropy literals.
+	r := rand.New(rand.NewSource(1))
+	var block []byte
+	for len(block) < 1024*1024 {
+		block = append(block, "repeated part of the message"...)
+		for i := 0; i < 64; i++ {
+			block = append(block, byte(r.Intn(256)))
+		}
+	}
+	params := &WriterParams{
+		LiteralCompressionMode: mode,
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(block)))
+	b.RunParallel(func(pb *testing.PB) {
+		zw := NewWriterParams(ioutil.Discard, params)
+		defer zw.Release()
+		for pb.Next() {
+			if _, err := zw.Write(block); err != nil {
+				panic(fmt.Errorf("unexpected error: %s", err))
+			}
+			if err := zw.Close(); err != nil {
+				panic(fmt.Errorf("unexpected error: %s", err))
+			}
+			zw.ResetWriterParams(ioutil.Discard, params)
+		}
+	})
+}
+
+func BenchmarkWriterReadFrom(b *testing.B) {
+	block := newBenchString(1024 * 1024)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(block)))
+	b.RunParallel(func(pb *testing.PB) {
+		zw := NewWriter(ioutil.Discard)
+		defer zw.Release()
+		r := bytes.NewReader(block)
+		for pb.Next() {
+			if _, err := zw.ReadFrom(r); err != nil {
+				panic(fmt.Errorf("unexpected error: %s", err))
+			}
+			if err := zw.Close(); err != nil {
+				panic(fmt.Errorf("unexpected error: %s", err))
+			}
+			r.Reset(block)
+			zw.Reset(ioutil.Discard, nil, DefaultCompressionLevel)
+		}
+	})
+}
+
+func BenchmarkWriterStableInput(b *testing.B) {
+	for _, stable := range []bool{false, true} {
+		b.Run(fmt.Sprintf("stable_%v", stable), func(b *testing.B) {
+			benchmarkWriterStableInput(b, stable)
+		})
+	}
+}
+
+func benchmarkWriterStableInput(b *testing.B, stable bool) {
+	block := newBenchString(1024 * 1024)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(block)))
+	b.RunParallel(func(pb *testing.PB) {
+		zw := NewWriterLevel(ioutil.Discard, 1)
+		defer zw.Release()
+		for pb.Next() {
+			zw.SetStableInput(stable)
+			if _, err := zw.Write(block); err != nil {
+				panic(fmt.Errorf("unexpected error: %s", err))
+			}
+			if err := zw.Close(); err != nil {
+				panic(fmt.Errorf("unexpected error: %s", err))
+			}
+			zw.Reset(ioutil.Discard, nil, 1)
+		}
+	})
+}